@@ -0,0 +1,136 @@
+package main
+
+import (
+	"MisakaDB/database"
+	"MisakaDB/logger"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/tidwall/redcon"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+阻塞命令期间 redcon 的协程停在命令里 不会再读这个连接 也就发现不了客户端已经断开 断开的客户端会一直排在等待队列里 抢走之后到来的元素
+
+所以连接第一次执行阻塞命令时 把它从 redcon 中分离出来 之后由后台协程一直读取客户端发来的命令
+
+读取失败说明连接断开了 这时取消连接的 ctx 阻塞中的命令会立即返回 同时离开等待队列
+
+读到的命令交给 serveBlockingConn 按顺序执行 所以阻塞期间客户端发来的命令会在阻塞命令返回之后才执行 这和 redis 是一致的
+*/
+
+// blockingConn 执行过阻塞命令 从 redcon 中分离出来的连接
+type blockingConn struct {
+	redcon.DetachedConn
+	ctx      context.Context
+	cancel   context.CancelFunc
+	commands chan redcon.Command
+}
+
+// block 执行阻塞命令 连接断开或者服务器关闭时 run 收到的 ctx 会被取消 run 只能使用传给它的 args 不能再使用原来的命令
+func (db *MisakaDataBase) block(conn redcon.Conn, cmd redcon.Command, run func(ctx context.Context, args [][]byte)) {
+	if bc, ok := conn.(*blockingConn); ok {
+		// 已经分离出来了 命令在 readCommands 里复制过了 回复由 serveBlockingConn 统一 flush
+		run(bc.ctx, cmd.Args)
+		return
+	}
+	cmd = cloneCommand(cmd)
+
+	bc := &blockingConn{
+		DetachedConn: conn.Detach(),
+		commands:     make(chan redcon.Command),
+	}
+	bc.ctx, bc.cancel = context.WithCancel(db.ctx)
+	// redcon 在分离之后会调用连接断开的回调函数 通过这个标记区分是真的断开还是分离
+	bc.SetContext(bc)
+	go bc.readCommands()
+
+	run(bc.ctx, cmd.Args)
+	e := bc.Flush()
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error())
+	}
+	go db.serveBlockingConn(bc)
+}
+
+// readCommands 在后台持续读取客户端发来的命令 读取失败时取消 ctx
+func (bc *blockingConn) readCommands() {
+	defer close(bc.commands)
+	defer bc.cancel()
+	for {
+		cmd, e := bc.ReadCommand()
+		if e != nil {
+			return
+		}
+		select {
+		case bc.commands <- cloneCommand(cmd):
+		case <-bc.ctx.Done():
+			return
+		}
+	}
+}
+
+// serveBlockingConn 按顺序执行分离出来的连接上的命令 直到连接断开或者服务器关闭
+func (db *MisakaDataBase) serveBlockingConn(bc *blockingConn) {
+	defer func() {
+		bc.cancel()
+		_ = bc.Close()
+		logger.GenerateInfoLog("DataBase Connection Closed: " + bc.RemoteAddr())
+	}()
+	for {
+		select {
+		case cmd, ok := <-bc.commands:
+			if !ok {
+				return
+			}
+			db.handleCommand(bc, cmd)
+			e := bc.Flush()
+			if e != nil {
+				return
+			}
+		case <-bc.ctx.Done():
+			return
+		}
+	}
+}
+
+// cloneCommand 复制命令的参数
+//
+// redcon 读到的命令的参数直接引用读缓冲区 后台协程继续读取时缓冲区会被覆盖 所以阻塞期间还要用到的参数都需要复制一份
+func cloneCommand(cmd redcon.Command) redcon.Command {
+	result := redcon.Command{
+		Raw:  bytes.Clone(cmd.Raw),
+		Args: make([][]byte, len(cmd.Args)),
+	}
+	for i := range cmd.Args {
+		result.Args[i] = bytes.Clone(cmd.Args[i])
+	}
+	return result
+}
+
+// parseBlockingTimeout 解析阻塞命令的超时时间 单位是秒 可以是小数 为0时永不超时
+func parseBlockingTimeout(input []byte) (time.Duration, error) {
+	timeout, e := strconv.ParseFloat(string(input), 64)
+	if e != nil || math.IsNaN(timeout) || math.IsInf(timeout, 0) {
+		return 0, errors.New("ERR timeout is not a float or out of range")
+	}
+	if timeout < 0 {
+		return 0, errors.New("ERR timeout is negative")
+	}
+	return time.Duration(timeout * float64(time.Second)), nil
+}
+
+// parseListEnd 解析 LEFT 或者 RIGHT
+func parseListEnd(input []byte) (database.ListEnd, error) {
+	switch strings.ToLower(string(input)) {
+	case "left":
+		return database.ListLeft, nil
+	case "right":
+		return database.ListRight, nil
+	}
+	return database.ListLeft, errors.New("ERR syntax error")
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"MisakaDB/database"
+	"MisakaDB/logger"
+	"MisakaDB/storage"
+	"bufio"
+	"errors"
+	"flag"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+配置项的来源按优先级从低到高依次为：默认值 < 配置文件 < 环境变量 < 命令行参数
+
+配置文件的格式参考 redis.conf 每行一个配置项 配置项名和值之间用空格隔开 以 # 开头的行是注释 示例见 misakadb.conf
+
+每个配置项在三个地方使用同一个名字：
+配置文件中为 dir
+环境变量中为 MISAKADB_DIR 即加上前缀之后转成大写 - 换成 _
+命令行参数中为 --dir
+
+配置文件的路径本身通过 --config 或者 MISAKADB_CONFIG 指定 不指定则不读取配置文件
+*/
+
+const (
+	configEnvPrefix = "MISAKADB_"
+	configFlagName  = "config"
+)
+
+// ServerOptions 服务器的所有配置项 数据库本身的配置项见 database.Options
+type ServerOptions struct {
+	DataBaseFolderPath string // 数据库进行数据持久化时 文件的保存位置 注意该路径下不可以有其他人任何文件
+	ServerAddr         string // 数据库监听的地址
+	database.Options
+}
+
+// DefaultServerOptions 默认配置 路径按照 Linux 的习惯放在 /var 下
+func DefaultServerOptions() *ServerOptions {
+	return &ServerOptions{
+		DataBaseFolderPath: "/var/lib/misakadb",
+		ServerAddr:         ":23456",
+		Options:            database.DefaultOptions(),
+	}
+}
+
+// optionSetter 将字符串形式的配置值解析之后写入 ServerOptions
+type optionSetter struct {
+	usage  string
+	isBool bool // 布尔型的配置项在命令行中可以只写 --name 不带值
+	set    func(options *ServerOptions, value string) error
+}
+
+// flagValue 命令行参数的值 先原样保存 等到所有来源都读取完之后再按优先级解析
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (v *flagValue) String() string {
+	return v.value
+}
+
+func (v *flagValue) Set(value string) error {
+	v.value = value
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// optionSetters 所有配置项 配置文件 环境变量和命令行参数共用这一份解析逻辑
+var optionSetters = map[string]optionSetter{
+	"dir": {
+		usage: "folder to save record files, no other files should be in it",
+		set: func(options *ServerOptions, value string) error {
+			options.DataBaseFolderPath = value
+			return nil
+		},
+	},
+	"record-file-max-size": {
+		usage: "max bytes of a record file, units like kb, mb and gb are supported",
+		set: func(options *ServerOptions, value string) (e error) {
+			options.RecordFileMaxSize, e = parseBytes(value)
+			return e
+		},
+	},
+	"io-mode": {
+		usage: "how to read and write record files, traditional or mmap",
+		set: func(options *ServerOptions, value string) error {
+			switch strings.ToLower(value) {
+			case "traditional":
+				options.RecordFileIOMode = storage.TraditionalIOFile
+			case "mmap":
+				options.RecordFileIOMode = storage.MMapIOFile
+			default:
+				return logger.ParameterIsNotAllowed
+			}
+			return nil
+		},
+	},
+	"addr": {
+		usage: "address the server listens on",
+		set: func(options *ServerOptions, value string) error {
+			options.ServerAddr = value
+			return nil
+		},
+	},
+	"log-dir": {
+		usage: "folder to save log files",
+		set: func(options *ServerOptions, value string) error {
+			options.LoggerPath = value
+			return nil
+		},
+	},
+	"sync-duration": {
+		usage: "interval of syncing record files to disk, in milliseconds",
+		set: func(options *ServerOptions, value string) (e error) {
+			options.SyncDuration, e = parseMillisecond(value)
+			return e
+		},
+	},
+	"merge-dead-bytes-ratio": {
+		usage: "merge automatically when dead bytes ratio of archived files exceeds it",
+		set: func(options *ServerOptions, value string) (e error) {
+			options.MergeDeadBytesRatio, e = strconv.ParseFloat(value, 64)
+			return e
+		},
+	},
+	"merge-check-duration": {
+		usage: "interval of checking whether merge is needed, in milliseconds",
+		set: func(options *ServerOptions, value string) (e error) {
+			options.MergeCheckDuration, e = parseMillisecond(value)
+			return e
+		},
+	},
+	"repair": {
+		usage:  "truncate broken record files instead of refusing to start",
+		isBool: true,
+		set: func(options *ServerOptions, value string) (e error) {
+			options.IsRepair, e = parseYesOrNo(value)
+			return e
+		},
+	},
+}
+
+// LoadOptions 按照 默认值 < 配置文件 < 环境变量 < 命令行参数 的顺序生成配置 并且检查配置是否合法
+func LoadOptions(args []string) (*ServerOptions, error) {
+	flagSet := flag.NewFlagSet("MisakaDB", flag.ContinueOnError)
+	configPath := flagSet.String(configFlagName, os.Getenv(configEnvPrefix+"CONFIG"), "path of the config file")
+	flagValues := make(map[string]*flagValue)
+	for _, name := range sortedOptionNames() {
+		flagValues[name] = &flagValue{isBool: optionSetters[name].isBool}
+		flagSet.Var(flagValues[name], name, optionSetters[name].usage)
+	}
+	e := flagSet.Parse(args)
+	if e != nil {
+		return nil, e
+	}
+
+	options := DefaultServerOptions()
+
+	// 配置文件
+	if *configPath != "" {
+		e = options.loadConfigFile(*configPath)
+		if e != nil {
+			return nil, e
+		}
+	}
+
+	// 环境变量
+	for _, name := range sortedOptionNames() {
+		value, ok := os.LookupEnv(envName(name))
+		if !ok {
+			continue
+		}
+		e = options.set(name, value)
+		if e != nil {
+			return nil, errors.New("Environment Variable " + envName(name) + ": " + e.Error())
+		}
+	}
+
+	// 命令行参数 只处理实际给出的参数
+	flagSet.Visit(func(f *flag.Flag) {
+		if e != nil || f.Name == configFlagName {
+			return
+		}
+		e = options.set(f.Name, flagValues[f.Name].value)
+		if e != nil {
+			e = errors.New("Flag --" + f.Name + ": " + e.Error())
+		}
+	})
+	if e != nil {
+		return nil, e
+	}
+
+	e = options.Validate()
+	if e != nil {
+		return nil, e
+	}
+	return options, nil
+}
+
+// Validate 检查配置是否合法
+func (options *ServerOptions) Validate() error {
+	if options.DataBaseFolderPath == "" {
+		return errors.New("dir: " + logger.ParameterIsNotAllowed.Error())
+	}
+	if options.ServerAddr == "" {
+		return errors.New("addr: " + logger.ParameterIsNotAllowed.Error())
+	}
+	return options.Options.Validate()
+}
+
+// loadConfigFile 读取配置文件 未知的配置项直接报错 防止拼错了却不知道
+func (options *ServerOptions) loadConfigFile(path string) error {
+	f, e := os.Open(path)
+	if e != nil {
+		return e
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return errors.New(path + ":" + strconv.Itoa(lineNumber) + ": " + logger.ParameterIsNotAllowed.Error())
+		}
+		e = options.set(strings.ToLower(fields[0]), strings.Trim(fields[1], "\""))
+		if e != nil {
+			return errors.New(path + ":" + strconv.Itoa(lineNumber) + ": " + e.Error())
+		}
+	}
+	return scanner.Err()
+}
+
+// set 按配置项名设置配置
+func (options *ServerOptions) set(name string, value string) error {
+	setter, ok := optionSetters[name]
+	if !ok {
+		return errors.New("Unknown Option " + name)
+	}
+	e := setter.set(options, value)
+	if e != nil {
+		return errors.New(name + " " + value + ": " + e.Error())
+	}
+	return nil
+}
+
+// sortedOptionNames 按名字排序的所有配置项 保证每次处理的顺序一样
+func sortedOptionNames() []string {
+	result := make([]string, 0, len(optionSetters))
+	for name := range optionSetters {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// envName 配置项对应的环境变量名 比如 log-dir 对应 MISAKADB_LOG_DIR
+func envName(name string) string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// parseBytes 解析字节数 支持 kb mb gb 单位 和 redis.conf 一样按1024进制
+func parseBytes(value string) (int64, error) {
+	value = strings.ToLower(value)
+	unit := int64(1)
+	for suffix, size := range map[string]int64{"kb": 1 << 10, "mb": 1 << 20, "gb": 1 << 30} {
+		if strings.HasSuffix(value, suffix) {
+			value = strings.TrimSuffix(value, suffix)
+			unit = size
+			break
+		}
+	}
+	result, e := strconv.ParseInt(value, 10, 64)
+	if e != nil {
+		return 0, e
+	}
+	return result * unit, nil
+}
+
+// parseMillisecond 解析以毫秒为单位的时间间隔
+func parseMillisecond(value string) (time.Duration, error) {
+	result, e := strconv.ParseInt(value, 10, 64)
+	if e != nil {
+		return 0, e
+	}
+	return time.Duration(result) * time.Millisecond, nil
+}
+
+// parseYesOrNo 解析 redis.conf 风格的布尔值 也接受 true 和 false
+func parseYesOrNo(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "true":
+		return true, nil
+	case "no", "false":
+		return false, nil
+	}
+	return false, logger.ParameterIsNotAllowed
+}
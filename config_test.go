@@ -0,0 +1,68 @@
+package main
+
+import (
+	"MisakaDB/storage"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadOptions(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "misakadb.conf")
+	e := os.WriteFile(configPath, []byte("# comment\ndir /tmp/fromFile\nrecord-file-max-size 1mb\nio-mode mmap\nsync-duration 500\n"), 0644)
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Setenv("MISAKADB_DIR", "/tmp/fromEnv")
+	t.Setenv("MISAKADB_SYNC_DURATION", "200")
+
+	options, e := LoadOptions([]string{"--config", configPath, "--sync-duration", "100", "--repair"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	// 环境变量覆盖配置文件 命令行参数覆盖环境变量
+	if options.DataBaseFolderPath != "/tmp/fromEnv" {
+		t.Error(options.DataBaseFolderPath)
+	}
+	if options.RecordFileMaxSize != 1<<20 {
+		t.Error(options.RecordFileMaxSize)
+	}
+	if options.RecordFileIOMode != storage.MMapIOFile {
+		t.Error(options.RecordFileIOMode)
+	}
+	if options.SyncDuration != 100*time.Millisecond {
+		t.Error(options.SyncDuration)
+	}
+	if !options.IsRepair {
+		t.Error(options.IsRepair)
+	}
+	// 没有设置的配置项保持默认值
+	if options.ServerAddr != DefaultServerOptions().ServerAddr {
+		t.Error(options.ServerAddr)
+	}
+}
+
+func TestLoadOptionsIllegal(t *testing.T) {
+	_, e := LoadOptions([]string{"--io-mode", "unknown"})
+	t.Log(e)
+	if e == nil {
+		t.Error("illegal io-mode is accepted")
+	}
+	_, e = LoadOptions([]string{"--merge-dead-bytes-ratio", "2"})
+	t.Log(e)
+	if e == nil {
+		t.Error("illegal merge-dead-bytes-ratio is accepted")
+	}
+
+	configPath := filepath.Join(t.TempDir(), "misakadb.conf")
+	e = os.WriteFile(configPath, []byte("unknown-option 1\n"), 0644)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, e = LoadOptions([]string{"--config", configPath})
+	t.Log(e)
+	if e == nil {
+		t.Error("unknown option is accepted")
+	}
+}
@@ -2,11 +2,13 @@ package adaptiveRadixTree
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"github.com/google/uuid"
 	"math/rand"
 	"os"
 	"runtime/pprof"
+	"sort"
 	"strconv"
 	"testing"
 	"time"
@@ -548,6 +550,101 @@ func TestDictForEach(t *testing.T) {
 	t.Log(count)
 }
 
+// randomKey 生成用于测试 ForEachFrom 的键 有很长的公共前缀 有互为前缀的键 第二个字节的取值很多 能生成各种类型的节点
+func randomKey(random *rand.Rand) string {
+	key := []byte{byte(random.Intn(3))}
+	if random.Intn(2) == 0 {
+		key = append(key, "aaaaaaaaaaaaaaaa"...)
+	}
+	key = append(key, byte(random.Intn(256)))
+	for i := random.Intn(4); i > 0; i-- {
+		key = append(key, byte('a'+random.Intn(3)))
+	}
+	return string(key)
+}
+
+func TestTreeForEachFrom(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	tr := New[testValueType]()
+	keys := make(map[string]bool)
+	for i := 0; i < 3000; i++ {
+		key := randomKey(random)
+		keys[key] = true
+		tr.Insert(Key(key), testValueType(key))
+	}
+	for key := range keys {
+		if random.Intn(3) == 0 {
+			delete(keys, key)
+			tr.Delete(Key(key))
+		}
+	}
+	var sortedKeys []string
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for i := 0; i < 200; i++ {
+		start := Key(randomKey(random))
+		if i < len(sortedKeys) && i%2 == 0 {
+			start = Key(sortedKeys[i])
+		}
+		expected := sortedKeys[sort.SearchStrings(sortedKeys, string(start)):]
+		var result []string
+		tr.ForEachFrom(start, func(node Node[testValueType]) (isContinue bool) {
+			result = append(result, string(node.Key()))
+			return len(result) < 50
+		})
+		if len(result) != min(len(expected), 50) {
+			t.Fatal(start, len(result), len(expected))
+		}
+		for j := range result {
+			if result[j] != expected[j] {
+				t.Fatal(start, j, result[j], expected[j])
+			}
+		}
+	}
+
+	// 每次遍历10个键 两次遍历之间随意修改树 一直存在的键都要遍历到 并且键是严格递增的
+	alwaysExisted := make(map[string]bool)
+	for key := range keys {
+		alwaysExisted[key] = true
+	}
+	var start Key
+	var last []byte
+	for {
+		var page []Key
+		tr.ForEachFrom(start, func(node Node[testValueType]) (isContinue bool) {
+			page = append(page, node.Key())
+			return len(page) < 10
+		})
+		for _, key := range page {
+			if last != nil && bytes.Compare(key, last) <= 0 {
+				t.Fatal(key, last)
+			}
+			last = key
+			delete(alwaysExisted, string(key))
+		}
+		if len(page) < 10 {
+			break
+		}
+		start = append(append(Key{}, page[len(page)-1]...), 0)
+		for i := 0; i < 20; i++ {
+			key := randomKey(random)
+			if keys[key] {
+				delete(alwaysExisted, key)
+				tr.Delete(Key(key))
+			} else {
+				tr.Insert(Key(key), testValueType(key))
+			}
+			keys[key] = !keys[key]
+		}
+	}
+	if len(alwaysExisted) != 0 {
+		t.Error(len(alwaysExisted))
+	}
+}
+
 func BenchmarkWordsTreeSearch(b *testing.B) {
 	words := loadTestFile("testWord/hsk_words.txt")
 	tree := New[*test]()
@@ -195,8 +195,8 @@ func (a *artNode[T]) findMinimumKey() *leaf[T] {
 		for !node.isExist.get(index) {
 			index += 1
 		}
-		if node.children[index] != nil {
-			return node.children[index].findMinimumKey()
+		if node.children[node.keys[index]] != nil { // isExist 和 keys 是按字节索引的 children 要先经过 keys 转换
+			return node.children[node.keys[index]].findMinimumKey()
 		}
 	case Node256:
 		node := a.node256()
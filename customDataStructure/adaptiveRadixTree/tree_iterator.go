@@ -1,5 +1,7 @@
 package adaptiveRadixTree
 
+import "bytes"
+
 // iteratorLevel 记录迭代器路径的
 type iteratorLevel[T Value] struct {
 	node       *artNode[T]
@@ -185,6 +187,95 @@ func (t *tree[T]) forEachWithPrefix(current *artNode[T], keyPrefix Key, callback
 	return Continue
 }
 
+// ForEachFrom 按字典序遍历树中所有不小于 start 的键 只遍历叶子节点 callback 返回 false 时停止遍历
+//
+// 和迭代器不同 它不保存任何遍历的状态 每次都从根节点开始找到 start 的位置 所以两次遍历之间树被修改过也没有关系
+//
+// 把上一次遍历到的最后一个键后面加一个0字节作为 start 就能接着上一次继续遍历 在整个过程中一直存在的键都会被遍历到 并且只会遍历到一次
+func (t *tree[T]) ForEachFrom(start Key, callback Callback[T]) {
+	t.forEachFrom(t.root, start, 0, modifyCallbackFunc[T](TraverseLeaf, callback))
+}
+
+// forEachFrom 对 ForEachFrom 的逻辑的封装 比 start 小的子树直接跳过 比 start 大的子树交给 recursiveForEach 只有包含 start 的那条路径需要逐层比较
+func (t *tree[T]) forEachFrom(current *artNode[T], start Key, depth uint32, callback Callback[T]) traverseAction {
+	if current == nil {
+		return Continue
+	}
+
+	if current.isLeaf() {
+		if bytes.Compare(current.leaf().key, start) >= 0 {
+			if !callback(current) {
+				return Stop
+			}
+		}
+		return Continue
+	}
+
+	currentNode := current.node()
+	if currentNode.prefixLen > 0 {
+		// 节点里最多只存了 MaxPrefixLength 个字节的前缀 完整的前缀从叶子节点的键里取
+		nodePrefix := current.findMinimumKey().key[depth : depth+currentNode.prefixLen]
+		startPart := start[depth:min(depth+currentNode.prefixLen, uint32(len(start)))]
+		switch bytes.Compare(nodePrefix[:len(startPart)], startPart) {
+		case 1: // 整个子树都比 start 大
+			return t.recursiveForEach(current, callback)
+		case -1: // 整个子树都比 start 小
+			return Continue
+		}
+		if len(startPart) < len(nodePrefix) { // start 在前缀中间就结束了 它是子树中所有键的前缀
+			return t.recursiveForEach(current, callback)
+		}
+		depth += currentNode.prefixLen
+	}
+
+	if depth == uint32(len(start)) {
+		return t.recursiveForEach(current, callback)
+	}
+
+	// zeroChild 的键在 depth 处结束 一定比 start 小 不用管
+	var chars []byte
+	var children []*artNode[T]
+	switch current.kind {
+	case Node4:
+		node := current.node4()
+		chars, children = node.keys[:], node.children[:]
+	case Node16:
+		node := current.node16()
+		chars, children = node.keys[:], node.children[:]
+	case Node48:
+		node := current.node48()
+		for char := 0; char < node256Max; char++ {
+			if node.isExist.get(char) {
+				chars = append(chars, byte(char))
+				children = append(children, node.children[node.keys[char]])
+			}
+		}
+	case Node256:
+		node := current.node256()
+		for char := 0; char < node256Max; char++ {
+			chars = append(chars, byte(char))
+		}
+		children = node.children[:]
+	}
+
+	for i, child := range children {
+		if child == nil || chars[i] < start[depth] {
+			continue
+		}
+		var action traverseAction
+		if chars[i] == start[depth] {
+			action = t.forEachFrom(child, start, depth+1, callback)
+		} else {
+			action = t.recursiveForEach(child, callback)
+		}
+		if action == Stop {
+			return Stop
+		}
+	}
+
+	return Continue
+}
+
 const nullIndex = -1
 
 // Iterator 获取一个新的迭代器 默认只遍历叶子节点
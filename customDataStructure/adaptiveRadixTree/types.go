@@ -70,6 +70,8 @@ type Tree[T Value] interface {
 	ForEach(callback Callback[T], options ...int)
 	// ForEachWithPrefix 对树进行遍历 对于每个被遍历到的 前缀和指定的键匹配的 符合条件的节点调用 callback 函数 默认情况下遍历只遍历叶子节点
 	ForEachWithPrefix(keyPrefix Key, callback Callback[T], options ...int)
+	// ForEachFrom 按字典序遍历树中所有不小于 start 的键 只遍历叶子节点 不依赖树的 version 遍历之间树被修改过也可以接着遍历
+	ForEachFrom(start Key, callback Callback[T])
 	// Iterator 获取一个新的迭代器 默认只遍历叶子节点
 	Iterator(options ...int) Iterator[T]
 
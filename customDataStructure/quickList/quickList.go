@@ -0,0 +1,389 @@
+package quickList
+
+/*
+仿照 redis 的 quicklist 写的分块双端队列 用来代替 ListIndex 里的切片
+
+切片头部插入和删除中间的元素都要整体挪动 长列表每次操作都是 O(n) 的
+
+这里把元素分成若干块 每块是一个定长的数组 元素保存在数组的 [head, tail) 区间内
+
+	头部插入时 从右往左填充第一块 第一块满了就在前面新建一块
+	尾部插入时 从左往右填充最后一块 最后一块满了就在后面新建一块
+
+这样两端的插入和弹出都是 O(1) 的 不需要挪动其它元素
+
+按下标访问时 需要先找到下标所在的块 为此每块记录自己第一个元素的虚拟坐标 start 第 i 个元素的虚拟坐标是 base + i
+
+头部插入和弹出只会改变第一块的 start 和 base 尾部的操作不改变任何 start 所以两端的操作不需要更新其它块
+
+各块的 start 是递增的 按下标访问时对 start 二分查找即可 复杂度是 O(log n)
+
+在中间插入和删除元素时 只挪动所在块里的元素 之后的块的 start 各自加减1 复杂度是 O(块的大小 + 块的数量)
+*/
+
+// chunkCapacity 每块最多保存的元素个数
+const chunkCapacity = 128
+
+// chunk 一块元素 元素保存在 items 的 [head, tail) 区间内
+type chunk[T any] struct {
+	items [chunkCapacity]T
+	head  int
+	tail  int
+	start int // items[head] 的虚拟坐标
+}
+
+// QuickList 分块双端队列 不是线程安全的
+type QuickList[T any] struct {
+	chunks    []*chunk[T] // chunks[chunkHead:] 是正在使用的块 前面空出来的位置留给头部新建的块
+	chunkHead int
+	length    int
+	base      int // 第0个元素的虚拟坐标
+}
+
+// NewQuickList 新建一个空的 QuickList
+func NewQuickList[T any]() *QuickList[T] {
+	return &QuickList[T]{}
+}
+
+// Len 返回元素个数
+func (ql *QuickList[T]) Len() int {
+	return ql.length
+}
+
+// PushFront 在头部插入元素
+func (ql *QuickList[T]) PushFront(value T) {
+	if ql.length == 0 || ql.firstChunk().head == 0 {
+		ql.prependChunk(&chunk[T]{
+			head:  chunkCapacity,
+			tail:  chunkCapacity,
+			start: ql.base,
+		})
+	}
+	c := ql.firstChunk()
+	c.head -= 1
+	c.items[c.head] = value
+	c.start -= 1
+	ql.base -= 1
+	ql.length += 1
+}
+
+// PushBack 在尾部插入元素
+func (ql *QuickList[T]) PushBack(value T) {
+	if ql.length == 0 || ql.lastChunk().tail == chunkCapacity {
+		ql.appendChunk(&chunk[T]{
+			start: ql.base + ql.length,
+		})
+	}
+	c := ql.lastChunk()
+	c.items[c.tail] = value
+	c.tail += 1
+	ql.length += 1
+}
+
+// PopFront 弹出头部的元素 列表为空时 ok 为 false
+func (ql *QuickList[T]) PopFront() (value T, ok bool) {
+	if ql.length == 0 {
+		return value, false
+	}
+	c := ql.firstChunk()
+	value = c.items[c.head]
+	var zero T
+	c.items[c.head] = zero
+	c.head += 1
+	c.start += 1
+	ql.base += 1
+	ql.length -= 1
+	if c.head == c.tail {
+		ql.chunks[ql.chunkHead] = nil
+		ql.chunkHead += 1
+		ql.resetIfEmpty()
+	}
+	return value, true
+}
+
+// PopBack 弹出尾部的元素 列表为空时 ok 为 false
+func (ql *QuickList[T]) PopBack() (value T, ok bool) {
+	if ql.length == 0 {
+		return value, false
+	}
+	c := ql.lastChunk()
+	c.tail -= 1
+	value = c.items[c.tail]
+	var zero T
+	c.items[c.tail] = zero
+	ql.length -= 1
+	if c.head == c.tail {
+		ql.chunks[len(ql.chunks)-1] = nil
+		ql.chunks = ql.chunks[:len(ql.chunks)-1]
+		ql.resetIfEmpty()
+	}
+	return value, true
+}
+
+// Get 返回下标为 i 的元素 i 必须在 [0, Len()) 范围内
+func (ql *QuickList[T]) Get(i int) T {
+	c, position := ql.locate(i)
+	return c.items[position]
+}
+
+// Set 修改下标为 i 的元素 i 必须在 [0, Len()) 范围内
+func (ql *QuickList[T]) Set(i int, value T) {
+	c, position := ql.locate(i)
+	c.items[position] = value
+}
+
+// Insert 在下标 i 的位置插入元素 原来在 i 及之后的元素后移一位 i 必须在 [0, Len()] 范围内
+func (ql *QuickList[T]) Insert(i int, value T) {
+	if i == 0 {
+		ql.PushFront(value)
+		return
+	}
+	if i == ql.length {
+		ql.PushBack(value)
+		return
+	}
+
+	k := ql.chunkIndex(i)
+	c := ql.chunks[k]
+	if c.head == 0 && c.tail == chunkCapacity {
+		// 块满了 先分成两半
+		ql.split(k)
+		if ql.base+i >= ql.chunks[k+1].start {
+			k += 1
+			c = ql.chunks[k]
+		}
+	}
+	position := c.head + ql.base + i - c.start
+	if c.tail < chunkCapacity {
+		// 后半部分右移 块内已有元素的虚拟坐标不变
+		copy(c.items[position+1:c.tail+1], c.items[position:c.tail])
+		c.tail += 1
+	} else {
+		// 前半部分左移 同样不改变块内已有元素的虚拟坐标
+		copy(c.items[c.head-1:position-1], c.items[c.head:position])
+		c.head -= 1
+		position -= 1
+	}
+	c.items[position] = value
+	for j := k + 1; j < len(ql.chunks); j++ {
+		ql.chunks[j].start += 1
+	}
+	ql.length += 1
+}
+
+// Remove 删除下标为 i 的元素并返回 之后的元素前移一位 i 必须在 [0, Len()) 范围内
+func (ql *QuickList[T]) Remove(i int) T {
+	if i == 0 {
+		value, _ := ql.PopFront()
+		return value
+	}
+	if i == ql.length-1 {
+		value, _ := ql.PopBack()
+		return value
+	}
+
+	k := ql.chunkIndex(i)
+	c := ql.chunks[k]
+	position := c.head + ql.base + i - c.start
+	value := c.items[position]
+	copy(c.items[position:c.tail-1], c.items[position+1:c.tail])
+	c.tail -= 1
+	var zero T
+	c.items[c.tail] = zero
+	for j := k + 1; j < len(ql.chunks); j++ {
+		ql.chunks[j].start -= 1
+	}
+	ql.length -= 1
+
+	// 删除的不是第一个和最后一个元素 所以变空的块一定在中间 直接删掉即可
+	if c.head == c.tail {
+		ql.removeChunk(k)
+	} else if k+1 < len(ql.chunks) && c.tail-c.head+ql.chunks[k+1].tail-ql.chunks[k+1].head <= chunkCapacity/2 {
+		// 相邻的两块都很小时合并 防止块的数量一直增长
+		ql.merge(k)
+	}
+	return value
+}
+
+// Range 返回 [start, stop) 范围内的元素 调用者需要保证 0 <= start <= stop <= Len()
+func (ql *QuickList[T]) Range(start, stop int) []T {
+	result := make([]T, 0, stop-start)
+	ql.ForEach(start, func(i int, value T) bool {
+		if i >= stop {
+			return false
+		}
+		result = append(result, value)
+		return true
+	})
+	return result
+}
+
+// ForEach 从下标 start 开始按顺序遍历元素 handle 返回 false 时停止遍历
+func (ql *QuickList[T]) ForEach(start int, handle func(i int, value T) bool) {
+	if start < 0 || start >= ql.length {
+		return
+	}
+	k := ql.chunkIndex(start)
+	i := start
+	position := ql.chunks[k].head + ql.base + start - ql.chunks[k].start
+	for ; k < len(ql.chunks); k++ {
+		c := ql.chunks[k]
+		if position < c.head {
+			position = c.head
+		}
+		for ; position < c.tail; position++ {
+			if !handle(i, c.items[position]) {
+				return
+			}
+			i += 1
+		}
+		position = 0
+	}
+}
+
+// ForEachReverse 从下标 start 开始按逆序遍历元素 handle 返回 false 时停止遍历
+func (ql *QuickList[T]) ForEachReverse(start int, handle func(i int, value T) bool) {
+	if start < 0 || start >= ql.length {
+		return
+	}
+	k := ql.chunkIndex(start)
+	i := start
+	position := ql.chunks[k].head + ql.base + start - ql.chunks[k].start
+	for ; k >= ql.chunkHead; k-- {
+		c := ql.chunks[k]
+		if position >= c.tail {
+			position = c.tail - 1
+		}
+		for ; position >= c.head; position-- {
+			if !handle(i, c.items[position]) {
+				return
+			}
+			i -= 1
+		}
+		position = chunkCapacity
+	}
+}
+
+// Trim 只保留 [start, stop) 范围内的元素 调用者需要保证 0 <= start <= stop <= Len()
+func (ql *QuickList[T]) Trim(start, stop int) {
+	for ql.length > stop {
+		ql.PopBack()
+	}
+	for i := 0; i < start; i++ {
+		ql.PopFront()
+	}
+}
+
+// locate 返回下标 i 所在的块和在块内的位置
+func (ql *QuickList[T]) locate(i int) (*chunk[T], int) {
+	c := ql.chunks[ql.chunkIndex(i)]
+	return c, c.head + ql.base + i - c.start
+}
+
+// chunkIndex 二分查找下标 i 所在的块 返回块在 chunks 中的位置
+func (ql *QuickList[T]) chunkIndex(i int) int {
+	virtual := ql.base + i
+	low, high := ql.chunkHead, len(ql.chunks)-1
+	for low < high {
+		middle := (low + high + 1) / 2
+		if ql.chunks[middle].start <= virtual {
+			low = middle
+		} else {
+			high = middle - 1
+		}
+	}
+	return low
+}
+
+// firstChunk 返回第一块 调用者需要保证列表不为空
+func (ql *QuickList[T]) firstChunk() *chunk[T] {
+	return ql.chunks[ql.chunkHead]
+}
+
+// lastChunk 返回最后一块 调用者需要保证列表不为空
+func (ql *QuickList[T]) lastChunk() *chunk[T] {
+	return ql.chunks[len(ql.chunks)-1]
+}
+
+// prependChunk 在头部新建一块 前面没有空位时重新分配 chunks 并且在前面留出和现有块数一样多的空位
+func (ql *QuickList[T]) prependChunk(c *chunk[T]) {
+	if ql.chunkHead == 0 {
+		used := len(ql.chunks)
+		space := used
+		if space < 4 {
+			space = 4
+		}
+		newChunks := make([]*chunk[T], space+used, space+used*2)
+		copy(newChunks[space:], ql.chunks)
+		ql.chunks = newChunks
+		ql.chunkHead = space
+	}
+	ql.chunkHead -= 1
+	ql.chunks[ql.chunkHead] = c
+}
+
+// appendChunk 在尾部新建一块
+func (ql *QuickList[T]) appendChunk(c *chunk[T]) {
+	if len(ql.chunks) == cap(ql.chunks) && ql.chunkHead > len(ql.chunks)-ql.chunkHead {
+		// 前面的空位比正在使用的块还多时 把正在使用的块挪到前面 不然尾部插入头部弹出的队列式用法会让 chunks 一直变长
+		used := copy(ql.chunks, ql.chunks[ql.chunkHead:])
+		clear(ql.chunks[used:])
+		ql.chunks = ql.chunks[:used]
+		ql.chunkHead = 0
+	}
+	ql.chunks = append(ql.chunks, c)
+}
+
+// split 把第 k 块的后一半元素移到新的块中 新的块插入到第 k 块后面
+func (ql *QuickList[T]) split(k int) {
+	c := ql.chunks[k]
+	half := (c.tail - c.head) / 2
+	newChunk := &chunk[T]{
+		tail:  c.tail - c.head - half,
+		start: c.start + half,
+	}
+	copy(newChunk.items[:], c.items[c.head+half:c.tail])
+	var zero T
+	for j := c.head + half; j < c.tail; j++ {
+		c.items[j] = zero
+	}
+	c.tail = c.head + half
+
+	ql.chunks = append(ql.chunks, nil)
+	copy(ql.chunks[k+2:], ql.chunks[k+1:])
+	ql.chunks[k+1] = newChunk
+}
+
+// merge 把第 k+1 块的元素移到第 k 块中 然后删除第 k+1 块 调用者需要保证第 k 块放得下
+func (ql *QuickList[T]) merge(k int) {
+	c, next := ql.chunks[k], ql.chunks[k+1]
+	if c.tail+next.tail-next.head > chunkCapacity {
+		// 后面放不下 先把已有的元素挪到数组开头
+		copy(c.items[:], c.items[c.head:c.tail])
+		var zero T
+		for j := c.tail - c.head; j < c.tail; j++ {
+			c.items[j] = zero
+		}
+		c.tail -= c.head
+		c.head = 0
+	}
+	copy(c.items[c.tail:], next.items[next.head:next.tail])
+	c.tail += next.tail - next.head
+	ql.removeChunk(k + 1)
+}
+
+// removeChunk 从 chunks 中删除第 k 块
+func (ql *QuickList[T]) removeChunk(k int) {
+	copy(ql.chunks[k:], ql.chunks[k+1:])
+	ql.chunks[len(ql.chunks)-1] = nil
+	ql.chunks = ql.chunks[:len(ql.chunks)-1]
+}
+
+// resetIfEmpty 列表为空时释放 chunks
+func (ql *QuickList[T]) resetIfEmpty() {
+	if ql.length == 0 {
+		ql.chunks = nil
+		ql.chunkHead = 0
+		ql.base = 0
+	}
+}
@@ -0,0 +1,200 @@
+package quickList
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// check 对比 QuickList 和作为参照的切片是否一致
+func check(t *testing.T, ql *QuickList[int], expected []int) {
+	t.Helper()
+	if ql.Len() != len(expected) {
+		t.Fatal("length", ql.Len(), len(expected))
+	}
+	for i, v := range expected {
+		if ql.Get(i) != v {
+			t.Fatal("index", i, ql.Get(i), v)
+		}
+	}
+	all := ql.Range(0, ql.Len())
+	for i, v := range expected {
+		if all[i] != v {
+			t.Fatal("range", i, all[i], v)
+		}
+	}
+	i := len(expected) - 1
+	ql.ForEachReverse(len(expected)-1, func(index int, value int) bool {
+		if index != i || value != expected[i] {
+			t.Fatal("reverse", index, value, expected[i])
+		}
+		i -= 1
+		return true
+	})
+	if i != -1 {
+		t.Fatal("reverse stopped at", i)
+	}
+}
+
+func TestQuickList(t *testing.T) {
+	ql := NewQuickList[int]()
+	var expected []int
+	random := rand.New(rand.NewSource(1))
+	for round := 0; round < 20000; round++ {
+		value := random.Int()
+		switch operation := random.Intn(10); {
+		case operation < 2:
+			ql.PushFront(value)
+			expected = append([]int{value}, expected...)
+		case operation < 4:
+			ql.PushBack(value)
+			expected = append(expected, value)
+		case operation < 6:
+			i := random.Intn(len(expected) + 1)
+			ql.Insert(i, value)
+			expected = append(expected[:i], append([]int{value}, expected[i:]...)...)
+		case operation == 6 && len(expected) > 0:
+			v, ok := ql.PopFront()
+			if !ok || v != expected[0] {
+				t.Fatal("pop front", v, expected[0])
+			}
+			expected = expected[1:]
+		case operation == 7 && len(expected) > 0:
+			v, ok := ql.PopBack()
+			if !ok || v != expected[len(expected)-1] {
+				t.Fatal("pop back", v, expected[len(expected)-1])
+			}
+			expected = expected[:len(expected)-1]
+		case operation == 8 && len(expected) > 0:
+			i := random.Intn(len(expected))
+			if v := ql.Remove(i); v != expected[i] {
+				t.Fatal("remove", i, v, expected[i])
+			}
+			expected = append(expected[:i], expected[i+1:]...)
+		case operation == 9 && len(expected) > 0:
+			i := random.Intn(len(expected))
+			ql.Set(i, value)
+			expected[i] = value
+		}
+		if round%1000 == 0 {
+			check(t, ql, expected)
+		}
+	}
+	check(t, ql, expected)
+
+	start, stop := len(expected)/4, len(expected)/2
+	ql.Trim(start, stop)
+	check(t, ql, expected[start:stop])
+
+	for ql.Len() > 0 {
+		ql.PopFront()
+	}
+	_, ok := ql.PopBack()
+	if ok {
+		t.Error("pop from empty list")
+	}
+	check(t, ql, nil)
+}
+
+func TestQuickListQueue(t *testing.T) {
+	// 尾部插入头部弹出 chunks 不应该一直变长
+	ql := NewQuickList[int]()
+	for i := 0; i < 100000; i++ {
+		ql.PushBack(i)
+		if i >= 1000 {
+			v, _ := ql.PopFront()
+			if v != i-1000 {
+				t.Fatal(v, i-1000)
+			}
+		}
+	}
+	if cap(ql.chunks) > 64 {
+		t.Error(cap(ql.chunks))
+	}
+}
+
+/*
+和原来 ListIndex 使用的切片做对比 切片的操作照搬原来 LPush 和删除元素时的写法
+
+10000 个元素时的结果如下（go test -bench . -benchtime 200000x）切片的头部插入和中间删除都是 O(n) 的 按下标访问多了一次二分查找
+
+	BenchmarkQuickListPushFront 	  200000	        40.38 ns/op
+	BenchmarkSlicePushFront     	  200000	      5999 ns/op
+	BenchmarkQuickListRemove    	  200000	       308.0 ns/op
+	BenchmarkSliceRemove        	  200000	      7373 ns/op
+	BenchmarkQuickListGet       	  200000	        83.17 ns/op
+	BenchmarkSliceGet           	  200000	         9.996 ns/op
+*/
+
+const benchmarkLength = 10000
+
+func BenchmarkQuickListPushFront(b *testing.B) {
+	ql := NewQuickList[*int]()
+	for i := 0; i < b.N; i++ {
+		if ql.Len() == benchmarkLength {
+			ql = NewQuickList[*int]()
+		}
+		ql.PushFront(&i)
+	}
+}
+
+func BenchmarkSlicePushFront(b *testing.B) {
+	var targetSlice []*int
+	for i := 0; i < b.N; i++ {
+		if len(targetSlice) == 0 || len(targetSlice) == benchmarkLength {
+			targetSlice = []*int{&i}
+			continue
+		}
+		targetSlice = append(targetSlice, targetSlice[len(targetSlice)-1])
+		for j := len(targetSlice) - 2; j >= 0; j-- {
+			targetSlice[j+1] = targetSlice[j]
+		}
+		targetSlice[0] = &i
+	}
+}
+
+func BenchmarkQuickListRemove(b *testing.B) {
+	ql := NewQuickList[*int]()
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < b.N; i++ {
+		for ql.Len() < benchmarkLength {
+			ql.PushBack(&i)
+		}
+		ql.Remove(random.Intn(benchmarkLength))
+	}
+}
+
+func BenchmarkSliceRemove(b *testing.B) {
+	var targetSlice []*int
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < b.N; i++ {
+		for len(targetSlice) < benchmarkLength {
+			targetSlice = append(targetSlice, &i)
+		}
+		j := random.Intn(benchmarkLength)
+		for ; j < len(targetSlice)-1; j++ {
+			targetSlice[j] = targetSlice[j+1]
+		}
+		targetSlice = targetSlice[:len(targetSlice)-1]
+	}
+}
+
+func BenchmarkQuickListGet(b *testing.B) {
+	ql := NewQuickList[*int]()
+	for i := 0; i < benchmarkLength; i++ {
+		ql.PushFront(&i)
+	}
+	random := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = ql.Get(random.Intn(benchmarkLength))
+	}
+}
+
+func BenchmarkSliceGet(b *testing.B) {
+	targetSlice := make([]*int, benchmarkLength)
+	random := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = targetSlice[random.Intn(benchmarkLength)]
+	}
+}
@@ -141,13 +141,15 @@ type (
 	// index 具体的索引 指向节点在某一层的下一个节点
 	index[T Value] struct {
 		nextNode *skipListNode[T]
+		span     uint32 // 从当前节点到 nextNode 跨过的节点数 nextNode 为空时是到跳表末尾的节点数 用于按排名查询
 	}
 
 	// skipListNode 跳表节点
 	skipListNode[T Value] struct {
-		key        Comparable // 键
-		value      T          // 值 值可以是任何类型
-		indexLevel []index[T] // 存储该节点在任意层的索引
+		key        Comparable       // 键
+		value      T                // 值 值可以是任何类型
+		indexLevel []index[T]       // 存储该节点在任意层的索引
+		prevNode   *skipListNode[T] // 最底层的上一个节点 第一个节点的 prevNode 为空 用于反向遍历
 	}
 )
 
@@ -231,43 +233,34 @@ func (sl *SkipList[T]) internalQueryNode(key Comparable) (result *skipListNode[T
 // queryGreaterOrEqualNode 找到第一个大于等于给定的 key 的节点
 func (sl *SkipList[T]) queryGreaterOrEqualNode(key Comparable) (result *skipListNode[T], e error) {
 	pointer := sl.head
-	height := sl.height
 
-	// 从最高的索引开始 一步一步向下开始寻找值
-	var compareResult int
-	for {
-		if pointer.indexLevel[height-1].nextNode == nil { // 如果当前层的索引循环完成仍然找不到值 就尝试使索引下降一个高度
-			if height == 1 {
-				break
-			} else {
-				height -= 1 // 索引已经到最低 无法再下降 说明找不到元素
-				continue
-			}
+	// 从最高的索引开始 每层都走到最后一个小于 key 的节点 然后下降一个高度
+	for height := int(sl.height) - 1; height >= 0; height-- {
+		for pointer.indexLevel[height].nextNode != nil && key.Compare(pointer.indexLevel[height].nextNode.key) > 0 {
+			pointer = pointer.indexLevel[height].nextNode
 		}
-		compareResult = key.Compare(pointer.indexLevel[height-1].nextNode.key)
-		if compareResult < 0 { // key较小 尝试使索引下降一个高度
-			if height == 1 {
-				break
-			} else {
-				height -= 1
-				continue
-			}
-		} else if compareResult > 0 { // key 较大 尝试下降索引 如果没得下降就直接返回
-			if height == 1 {
-				return pointer.indexLevel[height-1].nextNode, nil
-			} else {
-				height -= 1
-				continue
-			}
-		} else {
-			result = pointer.indexLevel[height-1].nextNode
-			e = nil
-			return
+	}
+	result = pointer.indexLevel[0].nextNode
+	if result == nil {
+		return nil, errors.New("There is No Node is eligible: \n" + key.String())
+	}
+	return result, nil
+}
+
+// queryLessOrEqualNode 找到最后一个小于等于给定的 key 的节点 key 为空时返回最后一个节点
+func (sl *SkipList[T]) queryLessOrEqualNode(key Comparable) (result *skipListNode[T], e error) {
+	pointer := sl.head
+
+	// 从最高的索引开始 每层都走到最后一个小于等于 key 的节点 然后下降一个高度
+	for height := int(sl.height) - 1; height >= 0; height-- {
+		for pointer.indexLevel[height].nextNode != nil && (key == nil || key.Compare(pointer.indexLevel[height].nextNode.key) >= 0) {
+			pointer = pointer.indexLevel[height].nextNode
 		}
 	}
-	e = errors.New("There is No Node is eligible: \n" + key.String())
-	result = nil
-	return
+	if pointer == sl.head {
+		return nil, errors.New("There is No Node is eligible! \n")
+	}
+	return pointer, nil
 }
 
 // QueryNode 跳表的单节点查询方法 返回给定键所对应的值 pass
@@ -281,7 +274,7 @@ func (sl *SkipList[T]) QueryNode(key Comparable) (value T, err error) {
 	}
 }
 
-// QueryNodeInterval 在[key1, key2]这个范围内进行区间查询 返回这个区间内的所有value pass
+// QueryNodeInterval 在[key1, key2]这个范围内进行区间查询 返回这个区间内的所有value 区间内没有节点时返回空切片 pass
 func (sl *SkipList[T]) QueryNodeInterval(key1 Comparable, key2 Comparable) (values []T, err error) {
 	//if strings.Compare(key1, key2) > 0 { key1大于key2时交换 强制key1必须小于key2
 	if key1.Compare(key2) > 0 {
@@ -295,9 +288,9 @@ func (sl *SkipList[T]) QueryNodeInterval(key1 Comparable, key2 Comparable) (valu
 		}
 	}
 
-	node1, e := sl.queryGreaterOrEqualNode(key1) // 先找起点
-	if e != nil {
-		return nil, e
+	node1, e := sl.queryGreaterOrEqualNode(key1) // 先找起点 找不到或者起点已经超出区间的话 说明区间内没有节点
+	if e != nil || node1.key.Compare(key2) > 0 {
+		return []T{}, nil
 	}
 	values = append(values, node1.value)
 
@@ -316,6 +309,29 @@ func (sl *SkipList[T]) QueryNodeInterval(key1 Comparable, key2 Comparable) (valu
 	return values, nil
 }
 
+// ForEach 从给定的 key 开始遍历节点 对每个节点的值调用 handle handle 返回 false 时停止遍历
+//
+// isReverse 为 false 时从第一个大于等于 key 的节点开始向后遍历 key 为空时从第一个节点开始
+//
+// isReverse 为 true 时从最后一个小于等于 key 的节点开始向前遍历 key 为空时从最后一个节点开始
+func (sl *SkipList[T]) ForEach(key Comparable, isReverse bool, handle func(value T) bool) {
+	var node *skipListNode[T]
+	if isReverse {
+		node, _ = sl.queryLessOrEqualNode(key)
+	} else if key == nil {
+		node = sl.head.indexLevel[0].nextNode
+	} else {
+		node, _ = sl.queryGreaterOrEqualNode(key)
+	}
+	for node != nil && handle(node.value) {
+		if isReverse {
+			node = node.prevNode
+		} else {
+			node = node.indexLevel[0].nextNode
+		}
+	}
+}
+
 // SetNode 修改指定节点的值
 func (sl *SkipList[T]) SetNode(key Comparable, value T) (err error) {
 	setNode, e := sl.internalQueryNode(key)
@@ -330,102 +346,150 @@ func (sl *SkipList[T]) SetNode(key Comparable, value T) (err error) {
 // DeleteNode 删除指定节点 pass
 func (sl *SkipList[T]) DeleteNode(key Comparable) (err error) {
 
-	//sl.mtx.RLock()
-
-	update := make([]*index[T], sl.height)      // 存储要修改的各层索引
-	for i := uint32(0); i <= sl.height-1; i++ { // 开始寻找各层的指向要删除的节点的索引 从最底层找起
-		pointer := &sl.head.indexLevel[i]
-		for pointer.nextNode != nil && pointer.nextNode.key.Compare(key) < 0 {
-			pointer = &pointer.nextNode.indexLevel[i]
-		}
-		if i == 0 { // 只有在最下面的索引才能检查该元素是否存在
-			if pointer.nextNode == nil || pointer.nextNode.key.Compare(key) != 0 {
-				err = errors.New("Delete Key: " + key.String() + " is not Existed! \n")
-				//sl.mtx.RUnlock()
-				return
-			}
-		}
-		if pointer.nextNode != nil && pointer.nextNode.key.Compare(key) == 0 { // 只有确定了是要删除的节点才能进行更新 上面循环完成的两种情况都要考虑 不然就会空指针
-			update[i] = pointer
+	update := make([]*skipListNode[T], sl.height) // 存储各层中最后一个小于要删除的节点的节点
+	pointer := sl.head
+	for i := int(sl.height) - 1; i >= 0; i-- {
+		for pointer.indexLevel[i].nextNode != nil && pointer.indexLevel[i].nextNode.key.Compare(key) < 0 {
+			pointer = pointer.indexLevel[i].nextNode
 		}
+		update[i] = pointer
+	}
+	deleteNode := pointer.indexLevel[0].nextNode // 具体要删除的节点 只有在最下面的索引才能检查该元素是否存在
+	if deleteNode == nil || deleteNode.key.Compare(key) != 0 {
+		return errors.New("Delete Key: " + key.String() + " is not Existed! \n")
 	}
-	deleteNode := update[0].nextNode // 具体要删除的节点
-
-	//sl.mtx.RUnlock() // 寻找节点完成 开始删除
-	//sl.mtx.Lock()
 
 	for i, v := range update {
-		if v == nil {
-			continue
-		} else {
-			v.nextNode = deleteNode.indexLevel[i].nextNode // 修改指向
+		if v.indexLevel[i].nextNode == deleteNode { // 修改指向 跨度要加上被删除节点的跨度
+			v.indexLevel[i].span += deleteNode.indexLevel[i].span - 1
+			v.indexLevel[i].nextNode = deleteNode.indexLevel[i].nextNode
+		} else { // 这一层的索引跨过了被删除的节点 跨度减一即可
+			v.indexLevel[i].span -= 1
 		}
 	}
-	err = nil
+	if deleteNode.indexLevel[0].nextNode != nil {
+		deleteNode.indexLevel[0].nextNode.prevNode = deleteNode.prevNode
+	}
 	sl.length -= 1
 
-	if update[sl.height-1] != nil { // 如果删除的节点的索引高度和当前跳表的索引高度一致 就有高度下降的可能 需要重置高度
-		for i := range sl.head.indexLevel {
-			if sl.head.indexLevel[i].nextNode == nil {
-				sl.height = uint32(i)
-			}
-		}
+	// 删除的节点可能是最高的节点 需要重置高度
+	for sl.height > 1 && sl.head.indexLevel[sl.height-1].nextNode == nil {
+		sl.height -= 1
 	}
-	//sl.mtx.Unlock()
-
-	return
+	return nil
 }
 
 // AddNode 向跳表中添加节点 节点键值相同则为更新节点值 pass
 func (sl *SkipList[T]) AddNode(key Comparable, value T) {
 
-	// 准备阶段
+	// 确定每层索引插入位置 同时记录每层插入位置的排名 用于计算跨度
+	update := make([]*skipListNode[T], indexMaxHeight)
+	rank := make([]uint32, indexMaxHeight)
+	pointer := sl.head
+	for i := int(sl.height) - 1; i >= 0; i-- {
+		if i != int(sl.height)-1 {
+			rank[i] = rank[i+1]
+		}
+		for pointer.indexLevel[i].nextNode != nil && pointer.indexLevel[i].nextNode.key.Compare(key) < 0 {
+			rank[i] += pointer.indexLevel[i].span
+			pointer = pointer.indexLevel[i].nextNode
+		}
+		update[i] = pointer
+	}
+	if pointer.indexLevel[0].nextNode != nil && pointer.indexLevel[0].nextNode.key.Compare(key) == 0 { // 键相同 更新值即可
+		pointer.indexLevel[0].nextNode.value = value
+		return
+	}
+
 	indexHeight := sl.randomLevel()
+	if uint32(indexHeight) > sl.height { // 更新索引最高高度 新增的层的插入位置都是头节点
+		for i := int(sl.height); i < indexHeight; i++ {
+			rank[i] = 0
+			update[i] = sl.head
+			update[i].indexLevel[i].nextNode = nil
+			update[i].indexLevel[i].span = sl.length
+		}
+		sl.height = uint32(indexHeight)
+	}
+
+	// 开始插入
 	newNode := &skipListNode[T]{
 		indexLevel: make([]index[T], indexHeight),
 		key:        key,
 		value:      value,
 	}
-	update := make([]*index[T], indexHeight)
-	pointer := sl.head
+	for i := 0; i < indexHeight; i++ {
+		newNode.indexLevel[i].nextNode = update[i].indexLevel[i].nextNode
+		update[i].indexLevel[i].nextNode = newNode
+		newNode.indexLevel[i].span = update[i].indexLevel[i].span - (rank[0] - rank[i])
+		update[i].indexLevel[i].span = rank[0] - rank[i] + 1
+	}
+	for i := indexHeight; i < int(sl.height); i++ { // 更高的索引跨过了新节点
+		update[i].indexLevel[i].span += 1
+	}
+	if update[0] != sl.head {
+		newNode.prevNode = update[0]
+	}
+	if newNode.indexLevel[0].nextNode != nil {
+		newNode.indexLevel[0].nextNode.prevNode = newNode
+	}
+	sl.length += 1
+}
 
-	// 确定update 确定每层索引插入位置
-	//sl.mtx.RLock()
-	var compareResult int
-	for i := range update {
-		pointer = sl.head
-		for pointer.indexLevel[i].nextNode != nil {
-			//if strings.Compare(key, pointer.indexLevel[i].nextNode.key) < 0 { // 参数s1 s2 如果结果为-1 说明s1 < s2
-			compareResult = key.Compare(pointer.indexLevel[i].nextNode.key)
-			if compareResult < 0 {
-				update[i] = &pointer.indexLevel[i]
-				break
-			} else if compareResult == 0 { // 如果结果为0 说明s1 == s2
-				pointer.indexLevel[i].nextNode.value = value
-				return
-			}
+// Rank 返回给定键的排名 排名从0开始 键不存在时返回 error
+func (sl *SkipList[T]) Rank(key Comparable) (int, error) {
+	pointer := sl.head
+	rank := uint32(0)
+	for i := int(sl.height) - 1; i >= 0; i-- {
+		for pointer.indexLevel[i].nextNode != nil && pointer.indexLevel[i].nextNode.key.Compare(key) <= 0 {
+			rank += pointer.indexLevel[i].span
 			pointer = pointer.indexLevel[i].nextNode
 		}
-		if update[i] == nil { // 说明插入的元素是当前高度索引中最大的
-			update[i] = &pointer.indexLevel[i]
+		if pointer != sl.head && pointer.key.Compare(key) == 0 {
+			return int(rank) - 1, nil
 		}
 	}
-	//sl.mtx.RUnlock()
+	return 0, errors.New("Query Key: " + key.String() + " is not Existed! \n")
+}
 
-	// 开始插入
-	//sl.mtx.Lock()
-	for i := range update {
-		pointer = update[i].nextNode
-		update[i].nextNode = newNode
-		newNode.indexLevel[i].nextNode = pointer
+// nodeByRank 返回给定排名的节点 排名从0开始 排名超出范围时返回空
+func (sl *SkipList[T]) nodeByRank(rank int) *skipListNode[T] {
+	if rank < 0 || rank >= int(sl.length) {
+		return nil
 	}
-	if uint32(indexHeight) > sl.height { // 更新索引最高高度
-		sl.height = uint32(indexHeight)
+	pointer := sl.head
+	traversed := uint32(0)
+	target := uint32(rank + 1)
+	for i := int(sl.height) - 1; i >= 0; i-- {
+		for pointer.indexLevel[i].nextNode != nil && traversed+pointer.indexLevel[i].span <= target {
+			traversed += pointer.indexLevel[i].span
+			pointer = pointer.indexLevel[i].nextNode
+		}
+		if traversed == target {
+			return pointer
+		}
 	}
-	sl.length += 1
-	//sl.mtx.Unlock()
+	return nil
+}
 
-	return
+// QueryNodeByRank 返回排名在 [start, stop] 范围内的所有 value 排名从0开始 超出跳表长度的部分会被忽略
+func (sl *SkipList[T]) QueryNodeByRank(start int, stop int) []T {
+	if start < 0 {
+		start = 0
+	}
+	if stop >= int(sl.length) {
+		stop = int(sl.length) - 1
+	}
+	if start > stop {
+		return []T{}
+	}
+	values := make([]T, 0, stop-start+1)
+	node := sl.nodeByRank(start)
+	for i := start; i <= stop && node != nil; i++ {
+		values = append(values, node.value)
+		node = node.indexLevel[0].nextNode
+	}
+	return values
 }
 
 func (sl *SkipList[T]) Length() int {
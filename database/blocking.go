@@ -0,0 +1,267 @@
+package database
+
+import (
+	"MisakaDB/index"
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+列表的阻塞操作 BLPop BRPop BLMove BRPopLPush
+
+每个列表 key 有一个等待队列 队列里是阻塞在这个 key 上的客户端 按阻塞的先后顺序排列 一个客户端可以同时排在多个 key 的队列里
+
+阻塞操作先尝试直接弹出 如果所有 key 都是空的 或者有别的客户端排在前面 就把自己加入这些 key 的队列 然后等待结果 超时或者 ctx 被取消
+
+向列表压入元素的操作（LPush LInsert RPush LPushX RPushX 以及 LMove 和阻塞移动的目标列表）在释放 key 的锁之后调用 serveListWaiters
+
+serveListWaiters 持有 key 的锁 按队列顺序弹出元素 直接交给队首的客户端 这样先阻塞的客户端一定先拿到元素 不会被后来的客户端插队
+
+一个客户端被服务时 会同时从它所在的所有队列中移除 被服务之后客户端一定会收到结果 所以超时或者取消时要先尝试从队列里移除自己 移除失败说明已经被服务了 只能等待结果
+*/
+
+// ListEnd 列表的一端
+type ListEnd = index.ListEnd
+
+const (
+	ListLeft  = index.ListLeft
+	ListRight = index.ListRight
+)
+
+// listWaiter 一个阻塞在列表上的客户端
+type listWaiter struct {
+	keys        [][]byte
+	whereFrom   ListEnd
+	destination []byte // 为 nil 时是 BLPop BRPop 否则是 BLMove
+	whereTo     ListEnd
+
+	result   chan listWaiterResult // 缓冲为1 被服务时写入
+	isServed bool                  // 由 listWaiters 的锁保护
+}
+
+// listWaiterResult 交给阻塞的客户端的结果
+type listWaiterResult struct {
+	key   []byte
+	value []byte
+	e     error
+}
+
+// listWaiters 所有列表 key 的等待队列
+type listWaiters struct {
+	mutex  sync.Mutex
+	queues map[string][]*listWaiter
+}
+
+// isWaited 检查是否有客户端阻塞在 key 上
+func (lw *listWaiters) isWaited(key []byte) bool {
+	lw.mutex.Lock()
+	defer lw.mutex.Unlock()
+	return len(lw.queues[string(key)]) != 0
+}
+
+// add 把客户端加入它的所有 key 的队列尾部
+func (lw *listWaiters) add(waiter *listWaiter) {
+	lw.mutex.Lock()
+	defer lw.mutex.Unlock()
+	if lw.queues == nil {
+		lw.queues = make(map[string][]*listWaiter)
+	}
+	for _, key := range waiter.keys {
+		lw.queues[string(key)] = append(lw.queues[string(key)], waiter)
+	}
+}
+
+// first 返回 key 的队首 队列为空时返回 nil
+func (lw *listWaiters) first(key []byte) *listWaiter {
+	lw.mutex.Lock()
+	defer lw.mutex.Unlock()
+	queue := lw.queues[string(key)]
+	if len(queue) == 0 {
+		return nil
+	}
+	return queue[0]
+}
+
+// takeFirst 如果 waiter 仍然是 key 的队首 就把它标记为已服务并且从所有队列中移除
+func (lw *listWaiters) takeFirst(key []byte, waiter *listWaiter) bool {
+	lw.mutex.Lock()
+	defer lw.mutex.Unlock()
+	queue := lw.queues[string(key)]
+	if len(queue) == 0 || queue[0] != waiter {
+		return false
+	}
+	waiter.isServed = true
+	lw.removeLocked(waiter)
+	return true
+}
+
+// remove 超时或者取消时把客户端从所有队列中移除 客户端已经被服务时返回 false
+func (lw *listWaiters) remove(waiter *listWaiter) bool {
+	lw.mutex.Lock()
+	defer lw.mutex.Unlock()
+	if waiter.isServed {
+		return false
+	}
+	lw.removeLocked(waiter)
+	return true
+}
+
+// removeLocked 把客户端从所有队列中移除 调用者需要持有 lw.mutex
+func (lw *listWaiters) removeLocked(waiter *listWaiter) {
+	for _, key := range waiter.keys {
+		queue := lw.queues[string(key)]
+		for i := 0; i < len(queue); i++ {
+			if queue[i] == waiter {
+				queue = append(queue[:i], queue[i+1:]...)
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(lw.queues, string(key))
+		} else {
+			lw.queues[string(key)] = queue
+		}
+	}
+}
+
+// BLPop 从第一个非空的列表的头部弹出元素 返回元素所在的 key 和元素
+//
+// 所有列表都为空时阻塞 直到有元素可以弹出 超过 timeout 或者 ctx 被取消 timeout 为0时永不超时
+//
+// 超时返回的 key 和元素都是 nil error 也是 nil ctx 被取消时返回 ctx.Err()
+func (db *DB) BLPop(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, []byte, error) {
+	key, value, _, e := db.blockingPop(ctx, timeout, &listWaiter{
+		keys:      keys,
+		whereFrom: ListLeft,
+	})
+	return key, value, e
+}
+
+// BRPop 同 BLPop 但是从列表的尾部弹出元素
+func (db *DB) BRPop(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, []byte, error) {
+	key, value, _, e := db.blockingPop(ctx, timeout, &listWaiter{
+		keys:      keys,
+		whereFrom: ListRight,
+	})
+	return key, value, e
+}
+
+// BLMove 从 source 的 whereFrom 一端弹出元素 压入 destination 的 whereTo 一端 返回被移动的元素
+//
+// source 为空时阻塞 规则同 BLPop 超时时 ok 为 false 被移动的元素可能是空字符串 所以不能用元素是否为 nil 来判断超时
+func (db *DB) BLMove(ctx context.Context, source, destination []byte, whereFrom, whereTo ListEnd, timeout time.Duration) (value []byte, ok bool, e error) {
+	_, value, ok, e = db.blockingPop(ctx, timeout, &listWaiter{
+		keys:        [][]byte{source},
+		whereFrom:   whereFrom,
+		destination: destination,
+		whereTo:     whereTo,
+	})
+	return value, ok, e
+}
+
+// BRPopLPush 同 BLMove 从 source 的尾部弹出 压入 destination 的头部
+func (db *DB) BRPopLPush(ctx context.Context, source, destination []byte, timeout time.Duration) ([]byte, bool, error) {
+	return db.BLMove(ctx, source, destination, ListRight, ListLeft, timeout)
+}
+
+// blockingPop 阻塞操作的主体 先尝试直接弹出 不行的话就排队等待 弹出了元素时 ok 为 true 超时或者出错时为 false
+func (db *DB) blockingPop(ctx context.Context, timeout time.Duration, waiter *listWaiter) ([]byte, []byte, bool, error) {
+	unlock := db.lockKeys(waiter.lockKeys()...)
+	e := db.checkTypes(waiter.lockKeys(), TypeList)
+	if e != nil {
+		unlock()
+		return nil, nil, false, e
+	}
+	for _, key := range waiter.keys {
+		// 有别的客户端排在前面的 key 不能插队 这个 key 上的元素会由 serveListWaiters 按顺序交给它们
+		if !db.listIndex.Exist(key) || db.listWaiters.isWaited(key) {
+			continue
+		}
+		value, e := db.moveListElement(waiter, key)
+		unlock()
+		if e == nil && waiter.destination != nil {
+			db.serveListWaiters(waiter.destination)
+		}
+		return key, value, e == nil, e
+	}
+	waiter.result = make(chan listWaiterResult, 1)
+	db.listWaiters.add(waiter)
+	unlock()
+
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+	select {
+	case result := <-waiter.result:
+		return result.key, result.value, result.e == nil, result.e
+	case <-timeoutChan:
+		e = nil
+	case <-ctx.Done():
+		e = ctx.Err()
+	}
+	if !db.listWaiters.remove(waiter) {
+		// 在超时的同时被服务了 元素已经弹出 还是交给调用者
+		result := <-waiter.result
+		return result.key, result.value, result.e == nil, result.e
+	}
+	return nil, nil, false, e
+}
+
+// serveListWaiters key 有新元素之后 按阻塞的先后顺序把元素交给阻塞在 key 上的客户端 调用者不能持有 key 的锁
+func (db *DB) serveListWaiters(key []byte) {
+	for {
+		waiter := db.listWaiters.first(key)
+		if waiter == nil {
+			return
+		}
+		unlock := db.lockKeys(waiter.lockKeys()...) // key 一定在 waiter.keys 里
+		if !db.listIndex.Exist(key) {
+			unlock()
+			return
+		}
+		if !db.listWaiters.takeFirst(key, waiter) {
+			// 加锁期间队首变了 比如说超时退出了 重新取队首
+			unlock()
+			continue
+		}
+		var value []byte
+		e := db.checkTypes(waiter.lockKeys(), TypeList)
+		if e == nil {
+			value, e = db.moveListElement(waiter, key)
+		}
+		unlock()
+		waiter.result <- listWaiterResult{
+			key:   key,
+			value: value,
+			e:     e,
+		}
+		if e == nil && waiter.destination != nil && !bytes.Equal(waiter.destination, key) {
+			// 目标列表也可能有客户端在等待
+			db.serveListWaiters(waiter.destination)
+		}
+	}
+}
+
+// moveListElement 从 key 中弹出元素 如果是 BLMove 就压入目标列表 调用者需要持有 key 和目标列表的锁
+func (db *DB) moveListElement(waiter *listWaiter, key []byte) ([]byte, error) {
+	if waiter.destination != nil {
+		return db.listIndex.LMove(key, waiter.destination, waiter.whereFrom, waiter.whereTo)
+	}
+	if waiter.whereFrom == ListLeft {
+		return db.listIndex.LPop(key)
+	}
+	return db.listIndex.RPop(key)
+}
+
+// lockKeys 返回操作需要加锁的 key 包括目标列表
+func (waiter *listWaiter) lockKeys() [][]byte {
+	if waiter.destination == nil {
+		return waiter.keys
+	}
+	return append(waiter.keys[:len(waiter.keys):len(waiter.keys)], waiter.destination)
+}
@@ -0,0 +1,225 @@
+package database
+
+import (
+	"MisakaDB/logger"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBlockingPop(t *testing.T) {
+	dir := t.TempDir()
+	options := DefaultOptions()
+	options.LoggerPath = t.TempDir()
+
+	db, e := Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 列表不为空时直接弹出
+	e = db.LPush([]byte("testList"), -1, []byte("1"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	key, value, e := db.BLPop(context.Background(), time.Second, []byte("none"), []byte("testList"))
+	if e != nil || string(key) != "testList" || string(value) != "1" {
+		t.Error(string(key), string(value), e)
+	}
+
+	// 超时返回 nil
+	key, value, e = db.BRPop(context.Background(), 50*time.Millisecond, []byte("testList"))
+	if e != nil || key != nil || value != nil {
+		t.Error(string(key), string(value), e)
+	}
+
+	// 先阻塞的客户端先拿到元素
+	waiting := func(key string) int {
+		db.listWaiters.mutex.Lock()
+		defer db.listWaiters.mutex.Unlock()
+		return len(db.listWaiters.queues[key])
+	}
+	results := make(chan string, 3)
+	for i, name := range []string{"first", "second", "third"} {
+		name := name
+		go func() {
+			_, value, e := db.BLPop(context.Background(), 0, []byte("none"), []byte("testList"))
+			if e != nil {
+				t.Error(e)
+			}
+			results <- name + ":" + string(value)
+		}()
+		// 保证三个客户端按顺序进入队列
+		for waiting("testList") != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for _, v := range []string{"a", "b", "c"} {
+		e = db.LPush([]byte("testList"), -1, []byte(v))
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	// 结果写入 channel 的顺序取决于调度 所以只检查每个客户端拿到的元素
+	served := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		select {
+		case result := <-results:
+			served[result] = true
+		case <-time.After(time.Second):
+			t.Fatal("blocked client was not served")
+		}
+	}
+	for _, expected := range []string{"first:a", "second:b", "third:c"} {
+		if !served[expected] {
+			t.Error(expected, served)
+		}
+	}
+	if db.Exists([]byte("testList")) != 0 || waiting("none") != 0 {
+		t.Error("list should be empty and no client is waiting")
+	}
+
+	// 取消之后客户端离开队列 不会再拿走元素
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, _, e := db.BLPop(ctx, 0, []byte("testList"))
+		done <- e
+	}()
+	for !db.listWaiters.isWaited([]byte("testList")) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if e = <-done; !errors.Is(e, context.Canceled) {
+		t.Error(e)
+	}
+	if waiting("testList") != 0 || waiting("none") != 0 {
+		t.Error("canceled client is still waiting")
+	}
+	e = db.LPush([]byte("testList"), -1, []byte("d"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if n, _ := db.LLen([]byte("testList")); n != 1 {
+		t.Error(n)
+	}
+
+	// BLMove 阻塞之后把元素移到目标列表的尾部
+	moved := make(chan string, 1)
+	go func() {
+		value, ok, e := db.BLMove(context.Background(), []byte("testSource"), []byte("testList"), ListLeft, ListRight, time.Second)
+		if e != nil || !ok {
+			t.Error(ok, e)
+		}
+		moved <- string(value)
+	}()
+	for !db.listWaiters.isWaited([]byte("testSource")) {
+		time.Sleep(time.Millisecond)
+	}
+	e = db.LPush([]byte("testSource"), -1, []byte("e"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if value := <-moved; value != "e" {
+		t.Error(value)
+	}
+	result, e := db.LRange([]byte("testList"), 0, 2)
+	if e != nil || len(result) != 2 || string(result[0]) != "d" || string(result[1]) != "e" {
+		t.Error(result, e)
+	}
+
+	// 被移动的元素是空字符串时 不能当作超时
+	emptyMoved := make(chan bool, 1)
+	go func() {
+		value, ok, e := db.BLMove(context.Background(), []byte("testSource"), []byte("testEmpty"), ListLeft, ListRight, time.Second)
+		if e != nil || len(value) != 0 {
+			t.Error(value, e)
+		}
+		emptyMoved <- ok
+	}()
+	for !db.listWaiters.isWaited([]byte("testSource")) {
+		time.Sleep(time.Millisecond)
+	}
+	e = db.LPush([]byte("testSource"), -1, []byte(""))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if ok := <-emptyMoved; !ok {
+		t.Error("empty value is treated as timeout")
+	}
+	e = db.LPush([]byte("testSource"), -1, []byte(""))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if value, ok, e := db.BLMove(context.Background(), []byte("testSource"), []byte("testEmpty"), ListLeft, ListRight, time.Second); e != nil || !ok || len(value) != 0 {
+		t.Error(value, ok, e)
+	}
+	if value, ok, e := db.BLMove(context.Background(), []byte("testSource"), []byte("testEmpty"), ListLeft, ListRight, 10*time.Millisecond); e != nil || ok || value != nil {
+		t.Error(value, ok, e)
+	}
+	if n, _ := db.LLen([]byte("testEmpty")); n != 2 {
+		t.Error(n)
+	}
+
+	// 类型不对的 key
+	e = db.Set([]byte("testKey"), []byte("testValue"), -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, _, e = db.BRPopLPush(context.Background(), []byte("testList"), []byte("testKey"), time.Second)
+	if !errors.Is(e, logger.WrongType) {
+		t.Error(e)
+	}
+
+	// 重放之后列表的内容不变
+	e = db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+	db, e = Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer db.Close()
+	result, e = db.LRange([]byte("testList"), 0, 2)
+	if e != nil || len(result) != 2 || string(result[0]) != "d" || string(result[1]) != "e" {
+		t.Error(result, e)
+	}
+	if db.Exists([]byte("testSource")) != 0 {
+		t.Error("source should be empty")
+	}
+}
+
+func TestBlockingPopAfterFailedPush(t *testing.T) {
+	dir := t.TempDir()
+	options := DefaultOptions()
+	options.LoggerPath = t.TempDir()
+	options.RecordFileMaxSize = 256
+
+	db, e := Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer db.Close()
+
+	popped := make(chan string, 1)
+	go func() {
+		_, value, e := db.BLPop(context.Background(), time.Second, []byte("testList"))
+		if e != nil {
+			t.Error(e)
+		}
+		popped <- string(value)
+	}()
+	for !db.listWaiters.isWaited([]byte("testList")) {
+		time.Sleep(time.Millisecond)
+	}
+	// 第二个元素比文件还大 写不进去 但是第一个元素已经写入了 阻塞的客户端要拿到它
+	_, e = db.RPush([]byte("testList"), -1, []byte("a"), make([]byte, 512))
+	if !errors.Is(e, logger.FileBytesIsMaxedOut) {
+		t.Error(e)
+	}
+	if value := <-popped; value != "a" {
+		t.Error(value)
+	}
+}
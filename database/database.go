@@ -0,0 +1,308 @@
+package database
+
+import (
+	"MisakaDB/index"
+	"MisakaDB/logger"
+	"MisakaDB/storage"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+database 包是 MisakaDB 的嵌入式接口 可以不启动 RESP 服务器 直接在其它 Go 程序里使用
+
+	db, e := database.Open("/var/lib/misakadb", database.DefaultOptions())
+	if e != nil {
+		...
+	}
+	defer db.Close()
+	e = db.Set([]byte("key"), []byte("value"), -1)
+
+所有带有 expiredAt 参数的方法 expiredAt 都是毫秒级的 Unix 时间戳 -1 为永不过期
+
+RESP 服务器（package main）只负责解析命令和回复 所有的数据操作都通过这个包完成
+*/
+
+// Options 打开数据库时的配置项
+type Options struct {
+	RecordFileMaxSize   int64              // 文件的最大存储字节数
+	RecordFileIOMode    storage.FileIOType // 对文件的读写方式 可以是传统的IO 也可以是Mmap
+	LoggerPath          string             // 数据库的Log保存位置 该位置下有无其它文件都可以
+	SyncDuration        time.Duration      // 持久化文件定时同步的时间间隔
+	MergeDeadBytesRatio float64            // 归档文件中失效数据的比例超过该值时自动进行 merge
+	MergeCheckDuration  time.Duration      // 检查是否需要自动 merge 的时间间隔
+	IsRepair            bool               // 遇到损坏的文件时 是否从损坏的位置截断之后继续启动
+}
+
+// DefaultOptions 默认配置 路径按照 Linux 的习惯放在 /var 下
+func DefaultOptions() Options {
+	return Options{
+		RecordFileMaxSize:   65536,
+		RecordFileIOMode:    storage.TraditionalIOFile,
+		LoggerPath:          "/var/log/misakadb",
+		SyncDuration:        time.Second,
+		MergeDeadBytesRatio: 0.5,
+		MergeCheckDuration:  time.Minute,
+		IsRepair:            false,
+	}
+}
+
+// Validate 检查配置是否合法
+func (options Options) Validate() error {
+	if options.LoggerPath == "" {
+		return errors.New("log-dir: " + logger.ParameterIsNotAllowed.Error())
+	}
+	// 文件至少要能写下一个最小的 entry
+	if options.RecordFileMaxSize < storage.EntrySize(0, 0, -1) {
+		return errors.New("record-file-max-size: " + logger.ParameterIsNotAllowed.Error())
+	}
+	if options.RecordFileIOMode != storage.TraditionalIOFile && options.RecordFileIOMode != storage.MMapIOFile {
+		return errors.New("io-mode: " + logger.ParameterIsNotAllowed.Error())
+	}
+	if options.SyncDuration <= 0 {
+		return errors.New("sync-duration: " + logger.ParameterIsNotAllowed.Error())
+	}
+	if options.MergeDeadBytesRatio <= 0 || options.MergeDeadBytesRatio > 1 {
+		return errors.New("merge-dead-bytes-ratio: " + logger.ParameterIsNotAllowed.Error())
+	}
+	if options.MergeCheckDuration <= 0 {
+		return errors.New("merge-check-duration: " + logger.ParameterIsNotAllowed.Error())
+	}
+	return nil
+}
+
+// DB 一个打开的数据库 所有方法都是线程安全的
+type DB struct {
+	options Options
+	logger  *logger.Logger
+
+	hashIndex   *index.HashIndex
+	stringIndex *index.StringIndex
+	listIndex   *index.ListIndex
+	zsetIndex   *index.ZSetIndex
+	setIndex    *index.SetIndex
+
+	expiry *index.ExpiryScheduler // 所有索引共用的主动过期 见 index/expiry.go
+
+	keyLocks    [keyLockShards]sync.Mutex // 写操作期间持有的 key 锁 见 keyspace.go
+	listWaiters listWaiters               // 阻塞在列表上的客户端 见 blocking.go
+
+	closeMergeMonitor chan int
+	mergeMonitorDone  chan struct{} // mergeMonitor 退出时关闭
+	closeOnce         sync.Once
+}
+
+// Open 打开 dir 下的数据库 dir 不存在时会自动创建 注意该路径下不可以有其他人任何文件
+func Open(dir string, options Options) (*DB, error) {
+	if dir == "" {
+		return nil, errors.New("dir: " + logger.ParameterIsNotAllowed.Error())
+	}
+	e := options.Validate()
+	if e != nil {
+		return nil, e
+	}
+	db := &DB{
+		options: options,
+	}
+
+	// 保证文件夹存在
+	e = os.MkdirAll(options.LoggerPath, 0755)
+	if e != nil {
+		return nil, e
+	}
+	e = os.MkdirAll(dir, 0755)
+	if e != nil {
+		return nil, e
+	}
+
+	// 初始化logger
+	db.logger, e = logger.NewLogger(options.LoggerPath)
+	if e != nil {
+		return nil, e
+	}
+	logger.GenerateInfoLog("Logger is Ready!")
+
+	// 读取文件
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(dir, options.RecordFileMaxSize, options.RecordFileIOMode)
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error())
+		db.logger.StopLogger()
+		return nil, e
+	}
+	logger.GenerateInfoLog("Record Files are Ready!")
+
+	// 后面任何一步失败 都要把已经构建好的索引和已经打开的文件关掉 否则文件句柄和定时同步的协程会一直留着
+	isOpened := false
+	defer func() {
+		if !isOpened {
+			db.closeOnFailure(archiveFiles)
+		}
+	}()
+
+	// 开始构建索引 activeFiles 中没有的类型传入 nil 构建一个空的索引
+	db.hashIndex, e = index.BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], options.RecordFileIOMode, dir, options.RecordFileMaxSize, options.SyncDuration, options.IsRepair)
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), "Build Hash Index Failed!")
+		return nil, e
+	}
+	logger.GenerateInfoLog("Hash Index is Ready!")
+
+	db.stringIndex, e = index.BuildStringIndex(activeFiles[storage.String], archiveFiles[storage.String], options.RecordFileIOMode, dir, options.RecordFileMaxSize, options.SyncDuration, options.IsRepair)
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), "Build String Index Failed!")
+		return nil, e
+	}
+	logger.GenerateInfoLog("String Index is Ready!")
+
+	db.listIndex, e = index.BuildListIndex(activeFiles[storage.List], archiveFiles[storage.List], options.RecordFileIOMode, dir, options.RecordFileMaxSize, options.SyncDuration, options.IsRepair)
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), "Build List Index Failed!")
+		return nil, e
+	}
+	logger.GenerateInfoLog("List Index is Ready! ")
+
+	db.zsetIndex, e = index.BuildZSetIndex(activeFiles[storage.ZSet], archiveFiles[storage.ZSet], options.RecordFileIOMode, dir, options.RecordFileMaxSize, options.SyncDuration, options.IsRepair)
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), "Build ZSet Index Failed!")
+		return nil, e
+	}
+	logger.GenerateInfoLog("ZSet Index is Ready! ")
+
+	db.setIndex, e = index.BuildSetIndex(activeFiles[storage.Set], archiveFiles[storage.Set], options.RecordFileIOMode, dir, options.RecordFileMaxSize, options.SyncDuration, options.IsRepair)
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), "Build Set Index Failed!")
+		return nil, e
+	}
+	logger.GenerateInfoLog("Set Index is Ready! ")
+
+	// 开始主动过期
+	db.expiry = index.NewExpiryScheduler()
+	db.hashIndex.SetExpiryScheduler(db.expiry)
+	db.stringIndex.SetExpiryScheduler(db.expiry)
+	db.listIndex.SetExpiryScheduler(db.expiry)
+	db.zsetIndex.SetExpiryScheduler(db.expiry)
+	db.setIndex.SetExpiryScheduler(db.expiry)
+	db.expiry.Start()
+	logger.GenerateInfoLog("Expiry Scheduler is Ready! ")
+
+	// 开始定时检查是否需要 merge
+	db.closeMergeMonitor = make(chan int, 1)
+	db.mergeMonitorDone = make(chan struct{})
+	go db.mergeMonitor()
+
+	isOpened = true
+	return db, nil
+}
+
+// closeOnFailure Open 失败时调用 关闭已经构建好的索引 还没有构建索引的类型直接关闭读取到的文件 最后停止logger
+func (db *DB) closeOnFailure(archiveFiles map[storage.FileForData]map[uint32]*storage.RecordFile) {
+	closers := map[storage.FileForData]interface{ CloseIndex() error }{}
+	if db.hashIndex != nil {
+		closers[storage.Hash] = db.hashIndex
+	}
+	if db.stringIndex != nil {
+		closers[storage.String] = db.stringIndex
+	}
+	if db.listIndex != nil {
+		closers[storage.List] = db.listIndex
+	}
+	if db.zsetIndex != nil {
+		closers[storage.ZSet] = db.zsetIndex
+	}
+	if db.setIndex != nil {
+		closers[storage.Set] = db.setIndex
+	}
+	for _, dataType := range []storage.FileForData{storage.String, storage.Hash, storage.List, storage.Set, storage.ZSet} {
+		if closer, ok := closers[dataType]; ok {
+			e := closer.CloseIndex()
+			if e != nil {
+				logger.GenerateErrorLog(false, false, e.Error())
+			}
+			continue
+		}
+		for _, v := range archiveFiles[dataType] {
+			v.StopSyncRoutine()
+			e := v.Close()
+			if e != nil {
+				logger.GenerateErrorLog(false, false, e.Error(), strconv.Itoa(int(v.GetFileID())))
+			}
+		}
+	}
+	db.logger.StopLogger()
+}
+
+// Close 关闭数据库 所有文件都会同步到磁盘 重复调用不会出错
+func (db *DB) Close() error {
+	var e error
+	db.closeOnce.Do(func() {
+		// 停止定时 merge
+		db.closeMergeMonitor <- 1
+		close(db.closeMergeMonitor)
+		// 等待正在进行的 merge 结束 不然 merge 会用到已经关闭的文件
+		<-db.mergeMonitorDone
+
+		// 停止主动过期 之后不会再有过期写入
+		db.expiry.Stop()
+
+		// 关闭索引 索引里会挨个关闭文件的 某个索引关闭失败时也要继续关闭其它索引 返回所有的错误
+		e = errors.Join(
+			db.hashIndex.CloseIndex(),
+			db.stringIndex.CloseIndex(),
+			db.listIndex.CloseIndex(),
+			db.zsetIndex.CloseIndex(),
+			db.setIndex.CloseIndex(),
+		)
+
+		// 关闭logger 不论索引是否关闭成功
+		db.logger.StopLogger()
+	})
+	return e
+}
+
+// Merge 对所有索引进行 merge 如果 onlyNeeded 为 true 则只对失效数据比例超过配置中 MergeDeadBytesRatio 的索引进行 merge
+func (db *DB) Merge(onlyNeeded bool) error {
+	indexes := map[string]index.Merger{
+		"String": db.stringIndex,
+		"Hash":   db.hashIndex,
+		"List":   db.listIndex,
+		"ZSet":   db.zsetIndex,
+		"Set":    db.setIndex,
+	}
+	for name, v := range indexes {
+		if onlyNeeded {
+			ratio, e := v.DeadBytesRatio()
+			if e != nil {
+				logger.GenerateErrorLog(false, false, e.Error(), name)
+				return e
+			}
+			if ratio < db.options.MergeDeadBytesRatio {
+				continue
+			}
+			logger.GenerateInfoLog(name + " Index Dead Bytes Ratio: " + strconv.FormatFloat(ratio, 'f', 2, 64) + ", Start Merge!")
+		}
+		e := v.Merge()
+		if e != nil {
+			logger.GenerateErrorLog(false, false, e.Error(), name)
+			return e
+		}
+	}
+	return nil
+}
+
+// mergeMonitor 每隔配置中的 MergeCheckDuration 检查一次各个索引是否需要 merge
+func (db *DB) mergeMonitor() {
+	defer close(db.mergeMonitorDone)
+	ticker := time.NewTicker(db.options.MergeCheckDuration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = db.Merge(true)
+		case <-db.closeMergeMonitor:
+			return
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	options := DefaultOptions()
+	options.LoggerPath = t.TempDir()
+
+	db, e := Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 10; i++ {
+		e = db.Set([]byte("testKey"+strconv.Itoa(i)), []byte("testValue"+strconv.Itoa(i)), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+		e = db.HSet("testHash", "testField"+strconv.Itoa(i), "testValue"+strconv.Itoa(i), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+		e = db.LPush([]byte("testList"), -1, []byte(strconv.Itoa(i)))
+		if e != nil {
+			t.Fatal(e)
+		}
+		e = db.ZAdd([]byte("testZSet"), float64(i), []byte("testMember"+strconv.Itoa(i)), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	e = db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 重新打开 数据应该都还在
+	db, e = Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	value, e := db.Get([]byte("testKey3"))
+	if e != nil || value != "testValue3" {
+		t.Error(value, e)
+	}
+	value, e = db.HGet("testHash", "testField4")
+	if e != nil || value != "testValue4" {
+		t.Error(value, e)
+	}
+	length, e := db.LLen([]byte("testList"))
+	if e != nil || length != 10 {
+		t.Error(length, e)
+	}
+	score, e := db.ZScore([]byte("testZSet"), []byte("testMember5"))
+	if e != nil || score != 5 {
+		t.Error(score, e)
+	}
+}
+
+func TestOpenIllegalOptions(t *testing.T) {
+	options := DefaultOptions()
+	options.LoggerPath = t.TempDir()
+	options.SyncDuration = 0
+	_, e := Open(t.TempDir(), options)
+	t.Log(e)
+	if e == nil {
+		t.Error("illegal options are accepted")
+	}
+}
+
+func TestOpenBrokenFile(t *testing.T) {
+	dir := t.TempDir()
+	options := DefaultOptions()
+	options.LoggerPath = t.TempDir()
+
+	db, e := Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 10; i++ {
+		e = db.ZAdd([]byte("testZSet"), float64(i), []byte("testMember"+strconv.Itoa(i)), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	e = db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 损坏第一个 entry 这不是写到一半的尾部 不修复的话应该打开失败
+	filePath := filepath.Join(dir, "record.zset.000000001.misaka")
+	content, e := os.ReadFile(filePath)
+	if e != nil {
+		t.Fatal(e)
+	}
+	content[len(content)/4] ^= 0xff
+	e = os.WriteFile(filePath, content, 0644)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, e = Open(dir, options)
+	t.Log(e)
+	if e == nil {
+		t.Fatal("broken file is accepted")
+	}
+
+	// 失败的 Open 已经把文件都关掉了 修复模式下可以重新打开
+	options.IsRepair = true
+	db, e = Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestCloseAfterIndexError(t *testing.T) {
+	dir := t.TempDir()
+	options := DefaultOptions()
+	options.LoggerPath = t.TempDir()
+
+	db, e := Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// 第一个关闭的索引已经关闭过了 再关闭会失败 之后的索引仍然要关闭
+	e = db.hashIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = db.Close()
+	if e == nil {
+		t.Error("closing a closed index should fail")
+	}
+	_, e = db.SAdd([]byte("testSet"), []byte("a"))
+	if e == nil {
+		t.Error("set index is not closed")
+	}
+}
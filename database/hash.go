@@ -0,0 +1,293 @@
+package database
+
+import (
+	"MisakaDB/index"
+	"MisakaDB/logger"
+	"MisakaDB/util"
+	"errors"
+	"time"
+)
+
+// HashField hash 中的一个 field 和它的 value
+type HashField = index.HashField
+
+// HSet 给定key field value 设定值 如果key field都存在即为更新值
+func (db *DB) HSet(key string, field string, value string, expiredAt int64) error {
+	unlock := db.lockKeys([]byte(key))
+	defer unlock()
+	e := db.checkType([]byte(key), TypeHash)
+	if e != nil {
+		return e
+	}
+	return db.hashIndex.HSet(key, field, value, expiredAt)
+}
+
+// HSetNX 同HSet 但是只有在field不存在时才能写入
+func (db *DB) HSetNX(key string, field string, value string, expiredAt int64) error {
+	unlock := db.lockKeys([]byte(key))
+	defer unlock()
+	e := db.checkType([]byte(key), TypeHash)
+	if e != nil {
+		return e
+	}
+	return db.hashIndex.HSetNX(key, field, value, expiredAt)
+}
+
+// HGet 根据给定的key和field尝试获取value
+func (db *DB) HGet(key string, field string) (string, error) {
+	result, e := db.hashIndex.HGet(key, field)
+	return result, db.readError([]byte(key), TypeHash, e)
+}
+
+// HDel 删除hash里面的一个键值对
+func (db *DB) HDel(key string, field string) error {
+	unlock := db.lockKeys([]byte(key))
+	defer unlock()
+	e := db.checkType([]byte(key), TypeHash)
+	if e != nil {
+		return e
+	}
+	return db.hashIndex.HDel(key, field, true)
+}
+
+// HDelKey 删除整个hash
+func (db *DB) HDelKey(key string) error {
+	unlock := db.lockKeys([]byte(key))
+	defer unlock()
+	e := db.checkType([]byte(key), TypeHash)
+	if e != nil {
+		return e
+	}
+	return db.hashIndex.HDel(key, "", false)
+}
+
+// HLen 根据给定的key 寻找field的个数
+func (db *DB) HLen(key string) (int, error) {
+	result, e := db.hashIndex.HLen(key)
+	return result, db.readError([]byte(key), TypeHash, e)
+}
+
+// HExists 根据给定的key和field判断field是否存在
+func (db *DB) HExists(key string, field string) (bool, error) {
+	result, e := db.hashIndex.HExist(key, field)
+	return result, db.readError([]byte(key), TypeHash, e)
+}
+
+// HStrLen 根据给定的key和field 确定value的长度
+func (db *DB) HStrLen(key string, field string) (int, error) {
+	result, e := db.hashIndex.HStrLen(key, field)
+	return result, db.readError([]byte(key), TypeHash, e)
+}
+
+// HMSet 一次设定多个field 如果key field都存在即为更新值
+func (db *DB) HMSet(key string, fields []HashField, expiredAt int64) error {
+	unlock := db.lockKeys([]byte(key))
+	defer unlock()
+	e := db.checkType([]byte(key), TypeHash)
+	if e != nil {
+		return e
+	}
+	return db.hashIndex.HMSet(key, fields, expiredAt)
+}
+
+// HMGet 按顺序返回给定的field的value 不存在的field对应的value为nil hash不存在时全部为nil
+func (db *DB) HMGet(key string, fields ...string) ([][]byte, error) {
+	result, e := db.hashIndex.HMGet(key, fields...)
+	e = db.readError([]byte(key), TypeHash, e)
+	if errors.Is(e, logger.KeyIsNotExisted) {
+		return make([][]byte, len(fields)), nil
+	}
+	return result, e
+}
+
+// HGetAll 返回hash中所有的field和value hash不存在时返回空的结果
+func (db *DB) HGetAll(key string) ([]HashField, error) {
+	result, e := db.hashIndex.HGetAll(key)
+	if e != nil {
+		return nil, db.scanError([]byte(key), TypeHash, e)
+	}
+	return result, nil
+}
+
+// HKeys 返回hash中所有的field
+func (db *DB) HKeys(key string) ([][]byte, error) {
+	fields, e := db.HGetAll(key)
+	result := make([][]byte, 0, len(fields))
+	for _, v := range fields {
+		result = append(result, v.Field)
+	}
+	return result, e
+}
+
+// HVals 返回hash中所有的value
+func (db *DB) HVals(key string) ([][]byte, error) {
+	fields, e := db.HGetAll(key)
+	result := make([][]byte, 0, len(fields))
+	for _, v := range fields {
+		result = append(result, v.Value)
+	}
+	return result, e
+}
+
+// HIncrBy 给field的值加上increment并返回新的值 field不存在时视为0
+func (db *DB) HIncrBy(key string, field string, increment int64) (int64, error) {
+	unlock := db.lockKeys([]byte(key))
+	defer unlock()
+	e := db.checkType([]byte(key), TypeHash)
+	if e != nil {
+		return 0, e
+	}
+	return db.hashIndex.HIncrBy(key, field, increment)
+}
+
+// HIncrByFloat 同HIncrBy 但是值是浮点数
+func (db *DB) HIncrByFloat(key string, field string, increment float64) (float64, error) {
+	unlock := db.lockKeys([]byte(key))
+	defer unlock()
+	e := db.checkType([]byte(key), TypeHash)
+	if e != nil {
+		return 0, e
+	}
+	return db.hashIndex.HIncrByFloat(key, field, increment)
+}
+
+// HRandField 随机返回hash中的field 规则同 redis hash不存在时返回空的结果
+func (db *DB) HRandField(key string, count int) ([]HashField, error) {
+	result, e := db.hashIndex.HRandField(key, count)
+	if e != nil {
+		return nil, db.scanError([]byte(key), TypeHash, e)
+	}
+	return result, nil
+}
+
+// HExpire 修改 hash 中给定的 field 的过期时间 expiredAt 为毫秒时间戳 condition 的含义同 Expire 只不过比较的是 field 的过期时间
+//
+// 按顺序返回每个 field 的结果 和 redis 一致 -2 表示 field 不存在 0 表示不满足 condition 1 表示修改了过期时间 2 表示 expiredAt 已经过去 field 被删除
+func (db *DB) HExpire(key string, expiredAt int64, condition ExpireCondition, fields ...string) ([]int, error) {
+	unlock := db.lockKeys([]byte(key))
+	defer unlock()
+
+	current, e := db.hashFieldsExpiredAt(key, fields)
+	if e != nil {
+		return nil, e
+	}
+	result := make([]int, len(fields))
+	var changed []string
+	for i, field := range fields {
+		switch {
+		case current[i] == -2:
+			result[i] = -2
+		case !condition.isSatisfied(current[i], expiredAt):
+			result[i] = 0
+		case expiredAt <= time.Now().UnixMilli():
+			e = db.hashIndex.HDel(key, field, true)
+			if errors.Is(e, logger.FieldIsNotExisted) {
+				// 同一个 field 出现了多次
+				result[i] = -2
+				continue
+			} else if e != nil {
+				return nil, e
+			}
+			result[i] = 2
+		default:
+			result[i] = 1
+			changed = append(changed, field)
+		}
+	}
+	if len(changed) != 0 {
+		e = db.hashIndex.HExpire(key, expiredAt, changed...)
+		if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+			return nil, e
+		}
+	}
+	return result, nil
+}
+
+// HPersist 去掉 hash 中给定的 field 的过期时间 按顺序返回每个 field 的结果 -2 表示 field 不存在 -1 表示 field 没有过期时间 1 表示去掉了过期时间
+func (db *DB) HPersist(key string, fields ...string) ([]int, error) {
+	unlock := db.lockKeys([]byte(key))
+	defer unlock()
+
+	current, e := db.hashFieldsExpiredAt(key, fields)
+	if e != nil {
+		return nil, e
+	}
+	result := make([]int, len(fields))
+	var changed []string
+	for i, field := range fields {
+		switch current[i] {
+		case -2, -1:
+			result[i] = int(current[i])
+		default:
+			result[i] = 1
+			changed = append(changed, field)
+		}
+	}
+	if len(changed) != 0 {
+		e = db.hashIndex.HExpire(key, -1, changed...)
+		if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+			return nil, e
+		}
+	}
+	return result, nil
+}
+
+// HPTTL 按顺序返回 hash 中给定的 field 剩余的存活时间 单位是毫秒 field 不存在时为-2 没有过期时间时为-1
+func (db *DB) HPTTL(key string, fields ...string) ([]int64, error) {
+	result, e := db.hashFieldsExpiredAt(key, fields)
+	if e != nil {
+		return nil, e
+	}
+	now := time.Now().UnixMilli()
+	for i := range result {
+		if result[i] >= 0 {
+			result[i] = max(result[i]-now, 0)
+		}
+	}
+	return result, nil
+}
+
+// HTTL 同 HPTTL 但是单位是秒 和 TTL 一样四舍五入
+func (db *DB) HTTL(key string, fields ...string) ([]int64, error) {
+	result, e := db.HPTTL(key, fields...)
+	if e != nil {
+		return nil, e
+	}
+	for i := range result {
+		if result[i] >= 0 {
+			result[i] = (result[i] + 500) / 1000
+		}
+	}
+	return result, nil
+}
+
+// hashFieldsExpiredAt 按顺序返回 hash 中给定的 field 的过期时间 -1 表示没有过期时间 field 不存在时为-2 hash 不存在时全部为-2
+func (db *DB) hashFieldsExpiredAt(key string, fields []string) ([]int64, error) {
+	result, e := db.hashIndex.HTTL(key, fields...)
+	e = db.readError([]byte(key), TypeHash, e)
+	if errors.Is(e, logger.KeyIsNotExisted) {
+		result = make([]int64, len(fields))
+		for i := range result {
+			result[i] = -2
+		}
+		return result, nil
+	}
+	return result, e
+}
+
+// HScan 按字典序遍历 hash 中的 field 用法同 Scan hash 不存在时返回空的结果
+func (db *DB) HScan(key string, cursor uint64, pattern string, count int) (next uint64, fields []HashField, e error) {
+	result, e := db.hashIndex.HScan(key, []byte(util.PatternPrefix(pattern)), cursor, count)
+	if e != nil {
+		return 0, nil, db.scanError([]byte(key), TypeHash, e)
+	}
+	page, next := index.ScanPage(result, count)
+	var matched []string
+	for _, field := range page {
+		if matchPattern(pattern, field) {
+			matched = append(matched, field)
+		}
+	}
+	// 取出 field 之后 field 可能已经被删除或者过期了
+	return next, db.hashIndex.HScanValues(key, matched), nil
+}
@@ -0,0 +1,349 @@
+package database
+
+import (
+	"MisakaDB/index"
+	"MisakaDB/logger"
+	"MisakaDB/util"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+/*
+各个数据类型的索引各自独立 但是对外它们共享同一个键空间 一个 key 同时只能属于一种类型
+
+写操作之前先检查 key 是否已经属于其它类型 是的话返回 logger.WrongType
+读操作在自己的索引中找不到 key 时 再检查 key 是否属于其它类型 这样读操作在正常情况下不需要再查其它索引
+
+检查类型和写入不是一个原子操作 所以写操作期间要持有 key 对应的锁 锁按 key 的哈希值分片
+*/
+
+// key 的类型 和 redis TYPE 命令的返回值一致
+const (
+	TypeNone   = "none"
+	TypeString = "string"
+	TypeHash   = "hash"
+	TypeList   = "list"
+	TypeZSet   = "zset"
+	TypeSet    = "set"
+)
+
+// keyLockShards key 锁的分片数
+const keyLockShards = 256
+
+// Type 返回 key 的类型 key 不存在时返回 TypeNone
+func (db *DB) Type(key []byte) string {
+	switch {
+	case db.stringIndex.Exist(key):
+		return TypeString
+	case db.hashIndex.Exist(string(key)):
+		return TypeHash
+	case db.listIndex.Exist(key):
+		return TypeList
+	case db.zsetIndex.Exist(key):
+		return TypeZSet
+	case db.setIndex.Exist(key):
+		return TypeSet
+	}
+	return TypeNone
+}
+
+// Exists 返回给定的 key 中存在的个数 重复的 key 会重复计数
+func (db *DB) Exists(keys ...[]byte) int {
+	result := 0
+	for _, key := range keys {
+		if db.Type(key) != TypeNone {
+			result += 1
+		}
+	}
+	return result
+}
+
+// Del 删除给定的 key 不论它们是什么类型 返回实际删除的个数
+func (db *DB) Del(keys ...[]byte) (int, error) {
+	result := 0
+	for _, key := range keys {
+		isDeleted, e := db.delKey(key)
+		if e != nil {
+			return result, e
+		}
+		if isDeleted {
+			result += 1
+		}
+	}
+	return result, nil
+}
+
+// Unlink 同 Del 删除只是写入一个删除 entry 本来就不会阻塞太久 所以没有放到后台去做
+func (db *DB) Unlink(keys ...[]byte) (int, error) {
+	return db.Del(keys...)
+}
+
+// delKey 持有 key 的锁删除 key
+func (db *DB) delKey(key []byte) (bool, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	return db.deleteKey(key, db.Type(key))
+}
+
+// deleteKey 按类型删除 key 调用者需要持有 key 的锁
+func (db *DB) deleteKey(key []byte, keyType string) (bool, error) {
+	var e error
+	switch keyType {
+	case TypeString:
+		e = db.stringIndex.Del(key)
+	case TypeHash:
+		e = db.hashIndex.HDel(string(key), "", false)
+	case TypeList:
+		e = db.listIndex.Del(key)
+	case TypeZSet:
+		e = db.zsetIndex.Del(key)
+	case TypeSet:
+		e = db.setIndex.Del(key)
+	default:
+		return false, nil
+	}
+	if errors.Is(e, logger.KeyIsNotExisted) {
+		return false, nil
+	}
+	return e == nil, e
+}
+
+// ExpireCondition Expire 的 NX XX GT LT 选项 含义同 redis 没有过期时间的 key 视为永不过期
+type ExpireCondition int8
+
+const (
+	ExpireAlways ExpireCondition = iota // 总是修改
+	ExpireNX                            // 只有 key 没有过期时间时才修改
+	ExpireXX                            // 只有 key 有过期时间时才修改
+	ExpireGT                            // 只有新的过期时间比原来的晚时才修改 没有过期时间的 key 不会被修改
+	ExpireLT                            // 只有新的过期时间比原来的早时才修改 没有过期时间的 key 总是会被修改
+)
+
+// isSatisfied 检查原来的过期时间为 current 时 是否可以修改为 expiredAt -1 表示没有过期时间
+func (condition ExpireCondition) isSatisfied(current, expiredAt int64) bool {
+	switch condition {
+	case ExpireNX:
+		return current == -1
+	case ExpireXX:
+		return current != -1
+	case ExpireGT:
+		return current != -1 && expiredAt > current
+	case ExpireLT:
+		return current == -1 || expiredAt < current
+	}
+	return true
+}
+
+// Expire 修改 key 的过期时间 expiredAt 为毫秒时间戳 返回是否修改了过期时间
+//
+// key 不存在或者不满足 condition 时返回 false expiredAt 已经过去时直接删除 key 同样返回 true
+//
+// list hash zset 中的元素各自有过期时间 修改 key 的过期时间会修改其中所有元素的过期时间
+func (db *DB) Expire(key []byte, expiredAt int64, condition ExpireCondition) (bool, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	keyType := db.Type(key)
+	current, e := db.expiredAt(key, keyType)
+	if errors.Is(e, logger.KeyIsNotExisted) {
+		return false, nil
+	} else if e != nil {
+		return false, e
+	}
+	if !condition.isSatisfied(current, expiredAt) {
+		return false, nil
+	}
+	if expiredAt <= time.Now().UnixMilli() {
+		return db.deleteKey(key, keyType)
+	}
+	e = db.expireKey(key, keyType, expiredAt)
+	return e == nil, e
+}
+
+// Persist 去掉 key 的过期时间 key 不存在或者没有过期时间时返回 false
+func (db *DB) Persist(key []byte) (bool, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	keyType := db.Type(key)
+	current, e := db.expiredAt(key, keyType)
+	if errors.Is(e, logger.KeyIsNotExisted) || current == -1 {
+		return false, nil
+	} else if e != nil {
+		return false, e
+	}
+	e = db.expireKey(key, keyType, -1)
+	return e == nil, e
+}
+
+// PTTL 返回 key 剩余的存活时间 单位是毫秒 key 不存在时返回-2 没有过期时间时返回-1
+func (db *DB) PTTL(key []byte) (int64, error) {
+	current, e := db.expiredAt(key, db.Type(key))
+	if errors.Is(e, logger.KeyIsNotExisted) {
+		return -2, nil
+	} else if e != nil {
+		return 0, e
+	}
+	if current == -1 {
+		return -1, nil
+	}
+	return max(current-time.Now().UnixMilli(), 0), nil
+}
+
+// TTL 同 PTTL 但是单位是秒 和 redis 一样四舍五入
+func (db *DB) TTL(key []byte) (int64, error) {
+	result, e := db.PTTL(key)
+	if e != nil || result < 0 {
+		return result, e
+	}
+	return (result + 500) / 1000, nil
+}
+
+// expiredAt 按类型返回 key 的过期时间 -1 表示没有过期时间
+func (db *DB) expiredAt(key []byte, keyType string) (int64, error) {
+	switch keyType {
+	case TypeString:
+		return db.stringIndex.TTL(key)
+	case TypeHash:
+		return db.hashIndex.TTL(string(key))
+	case TypeList:
+		return db.listIndex.TTL(key)
+	case TypeZSet:
+		return db.zsetIndex.TTL(key)
+	case TypeSet:
+		return db.setIndex.TTL(key)
+	}
+	return 0, logger.KeyIsNotExisted
+}
+
+// expireKey 按类型修改 key 的过期时间 调用者需要持有 key 的锁
+func (db *DB) expireKey(key []byte, keyType string, expiredAt int64) error {
+	switch keyType {
+	case TypeString:
+		return db.stringIndex.Expire(key, expiredAt)
+	case TypeHash:
+		return db.hashIndex.Expire(string(key), expiredAt)
+	case TypeList:
+		return db.listIndex.Expire(key, expiredAt)
+	case TypeZSet:
+		return db.zsetIndex.Expire(key, expiredAt)
+	case TypeSet:
+		return db.setIndex.Expire(key, expiredAt)
+	}
+	return logger.KeyIsNotExisted
+}
+
+// Scan 按字典序遍历整个键空间 cursor 为0时开始一次新的遍历 每次大约遍历 count 个 key 返回其中和 pattern 匹配的 key 和下一次遍历的游标
+//
+// next 为0时说明已经遍历完了 pattern 为空时不做匹配 keyType 不为空时只遍历这一种类型的 key
+//
+// 游标是字典序中的位置 服务端不保存任何状态 整个遍历过程中一直存在的 key 都会被返回 并且只会返回一次 见 index/scan.go
+func (db *DB) Scan(cursor uint64, pattern string, count int, keyType string) (next uint64, keys [][]byte) {
+	page, next := index.ScanPage(db.scanKeys([]byte(util.PatternPrefix(pattern)), cursor, count, keyType), count)
+	for _, key := range page {
+		if matchPattern(pattern, key) {
+			keys = append(keys, []byte(key))
+		}
+	}
+	return next, keys
+}
+
+// scanKeys 合并各个索引中以 prefix 开头 位置不小于 cursor 的 key 按字典序排列 keyType 不为空时只返回这一种类型的 key
+func (db *DB) scanKeys(prefix []byte, cursor uint64, count int, keyType string) []string {
+	scanners := map[string]func(prefix []byte, cursor uint64, count int) []string{
+		TypeString: db.stringIndex.ScanKeys,
+		TypeHash:   db.hashIndex.ScanKeys,
+		TypeList:   db.listIndex.ScanKeys,
+		TypeZSet:   db.zsetIndex.ScanKeys,
+		TypeSet:    db.setIndex.ScanKeys,
+	}
+	var result []string
+	for scannerType, scan := range scanners {
+		if keyType == "" || keyType == scannerType {
+			result = append(result, scan(prefix, cursor, count)...)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// scanError 处理 HScan HGetAll 等读取集合成员的操作的错误 key 不存在时视为空的集合 返回 nil
+func (db *DB) scanError(key []byte, expected string, e error) error {
+	e = db.readError(key, expected, e)
+	if errors.Is(e, logger.KeyIsNotExisted) {
+		return nil
+	}
+	return e
+}
+
+// Keys 返回所有和 pattern 匹配的 key 按字典序排列
+func (db *DB) Keys(pattern string) [][]byte {
+	// 能和 pattern 匹配的 key 一定以它不含通配符的开头部分为前缀 每个索引只需要收集这个前缀下的 key
+	keys := db.scanKeys([]byte(util.PatternPrefix(pattern)), 0, 0, "")
+	var result [][]byte
+	for _, key := range keys {
+		if matchPattern(pattern, key) {
+			result = append(result, []byte(key))
+		}
+	}
+	return result
+}
+
+// checkType 写操作之前检查 key 的类型 key 不存在或者类型一致时返回 nil 调用者需要持有 key 的锁
+func (db *DB) checkType(key []byte, expected string) error {
+	keyType := db.Type(key)
+	if keyType != TypeNone && keyType != expected {
+		return logger.WrongType
+	}
+	return nil
+}
+
+// checkTypes 同 checkType 但是检查多个 key
+func (db *DB) checkTypes(keys [][]byte, expected string) error {
+	for _, key := range keys {
+		e := db.checkType(key, expected)
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// readError 读操作在自己的索引中找不到 key 时 检查 key 是否属于其它类型 是的话把错误换成 logger.WrongType
+func (db *DB) readError(key []byte, expected string, e error) error {
+	if errors.Is(e, logger.KeyIsNotExisted) && db.checkType(key, expected) != nil {
+		return logger.WrongType
+	}
+	return e
+}
+
+// lockKeys 锁住给定的 key 返回解锁函数 多个 key 按分片的顺序加锁 防止死锁
+func (db *DB) lockKeys(keys ...[]byte) func() {
+	shards := make([]int, 0, len(keys))
+	isLocked := make(map[int]bool)
+	for _, key := range keys {
+		h := fnv.New32a()
+		_, _ = h.Write(key)
+		shard := int(h.Sum32() % keyLockShards)
+		if !isLocked[shard] {
+			isLocked[shard] = true
+			shards = append(shards, shard)
+		}
+	}
+	sort.Ints(shards)
+	for _, shard := range shards {
+		db.keyLocks[shard].Lock()
+	}
+	return func() {
+		for i := len(shards) - 1; i >= 0; i-- {
+			db.keyLocks[shards[i]].Unlock()
+		}
+	}
+}
+
+// matchPattern pattern 为空时不做匹配
+func matchPattern(pattern string, input string) bool {
+	return pattern == "" || util.MatchPattern(pattern, input)
+}
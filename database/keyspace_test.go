@@ -0,0 +1,603 @@
+package database
+
+import (
+	"MisakaDB/index"
+	"MisakaDB/logger"
+	"MisakaDB/util"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyspace(t *testing.T) {
+	dir := t.TempDir()
+	options := DefaultOptions()
+	options.LoggerPath = t.TempDir()
+
+	db, e := Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = db.Set([]byte("testKey"), []byte("testValue"), -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = db.LPush([]byte("testList"), -1, []byte("testValue"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = db.ZAdd([]byte("testZSet"), 1, []byte("testMember"), -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = db.HSet("testHash", "testField", "testValue", -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 不同类型的操作应该返回 WrongType
+	e = db.LPush([]byte("testKey"), -1, []byte("testValue"))
+	if !errors.Is(e, logger.WrongType) {
+		t.Error(e)
+	}
+	_, e = db.Get([]byte("testList"))
+	if !errors.Is(e, logger.WrongType) {
+		t.Error(e)
+	}
+	_, e = db.ZCard([]byte("testHash"))
+	if !errors.Is(e, logger.WrongType) {
+		t.Error(e)
+	}
+	e = db.CheckList([]byte("testKey"))
+	if !errors.Is(e, logger.WrongType) {
+		t.Error(e)
+	}
+	e = db.CheckList([]byte("testList"))
+	if e != nil {
+		t.Error(e)
+	}
+
+	for key, expected := range map[string]string{"testKey": TypeString, "testList": TypeList, "testZSet": TypeZSet, "testHash": TypeHash, "none": TypeNone} {
+		if keyType := db.Type([]byte(key)); keyType != expected {
+			t.Error(key, keyType)
+		}
+	}
+	if n := db.Exists([]byte("testKey"), []byte("testList"), []byte("none"), []byte("testKey")); n != 3 {
+		t.Error(n)
+	}
+
+	// set 会覆盖其它类型的 key
+	e = db.Set([]byte("testList"), []byte("testValue"), -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if keyType := db.Type([]byte("testList")); keyType != TypeString {
+		t.Error(keyType)
+	}
+
+	n, e := db.Del([]byte("testList"), []byte("testZSet"), []byte("testHash"), []byte("none"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if n != 3 {
+		t.Error(n)
+	}
+	e = db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 删除在重启之后依然有效
+	db, e = Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	if n := db.Exists([]byte("testList"), []byte("testZSet"), []byte("testHash")); n != 0 {
+		t.Error(n)
+	}
+	if keyType := db.Type([]byte("testKey")); keyType != TypeString {
+		t.Error(keyType)
+	}
+
+	// *STORE 会覆盖其它类型的 destination 但是参与运算的 key 类型不对时报错
+	_, e = db.SAdd([]byte("testSet"), []byte("a"), []byte("b"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, e = db.SUnion([]byte("testSet"), []byte("testKey"))
+	if !errors.Is(e, logger.WrongType) {
+		t.Error(e)
+	}
+	n, e = db.SUnionStore([]byte("testKey"), []byte("testSet"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if keyType := db.Type([]byte("testKey")); n != 2 || keyType != TypeSet {
+		t.Error(n, keyType)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	dir := t.TempDir()
+	options := DefaultOptions()
+	options.LoggerPath = t.TempDir()
+
+	db, e := Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, e = db.SAdd([]byte("testSet"), []byte("testMember"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, e = range []error{
+		db.Set([]byte("testKey"), []byte("testValue"), -1),
+		db.LPush([]byte("testList"), -1, []byte("testValue")),
+		db.ZAdd([]byte("testZSet"), 1, []byte("testMember"), -1),
+		db.HSet("testHash", "testField", "testValue", -1),
+	} {
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	keys := []string{"testKey", "testList", "testZSet", "testHash", "testSet"}
+	later := time.Now().Add(time.Hour).UnixMilli()
+	earlier := time.Now().Add(time.Minute).UnixMilli()
+
+	for _, key := range keys {
+		if ttl, _ := db.TTL([]byte(key)); ttl != -1 {
+			t.Error(key, ttl)
+		}
+		// 没有过期时间时 XX 和 GT 都不会修改
+		for _, condition := range []ExpireCondition{ExpireXX, ExpireGT} {
+			isSet, e := db.Expire([]byte(key), later, condition)
+			if e != nil || isSet {
+				t.Error(key, condition, isSet, e)
+			}
+		}
+		isSet, e := db.Expire([]byte(key), later, ExpireNX)
+		if e != nil || !isSet {
+			t.Error(key, isSet, e)
+		}
+		// 已经有过期时间了 NX 和 GT 都不会修改 LT 会
+		for _, condition := range []ExpireCondition{ExpireNX, ExpireGT} {
+			isSet, e = db.Expire([]byte(key), earlier, condition)
+			if e != nil || isSet {
+				t.Error(key, condition, isSet, e)
+			}
+		}
+		isSet, e = db.Expire([]byte(key), earlier, ExpireLT)
+		if e != nil || !isSet {
+			t.Error(key, isSet, e)
+		}
+		if ttl, _ := db.TTL([]byte(key)); ttl < 59 || ttl > 60 {
+			t.Error(key, ttl)
+		}
+	}
+	isSet, e := db.Persist([]byte("testKey"))
+	if e != nil || !isSet {
+		t.Error(isSet, e)
+	}
+	isSet, e = db.Persist([]byte("testKey"))
+	if e != nil || isSet {
+		t.Error(isSet, e)
+	}
+	if ttl, _ := db.PTTL([]byte("none")); ttl != -2 {
+		t.Error(ttl)
+	}
+	isSet, e = db.Expire([]byte("none"), later, ExpireAlways)
+	if e != nil || isSet {
+		t.Error(isSet, e)
+	}
+	// 新添加的 set 成员沿用 set 的过期时间
+	_, e = db.SAdd([]byte("testSet"), []byte("testMember2"))
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 过期时间重启之后仍然有效
+	e = db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+	db, e = Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, key := range keys {
+		ttl, e := db.PTTL([]byte(key))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if key == "testKey" && ttl != -1 || key != "testKey" && (ttl <= 0 || ttl > time.Minute.Milliseconds()) {
+			t.Error(key, ttl)
+		}
+	}
+
+	// 过期时间已经过去时直接删除 key
+	isSet, e = db.Expire([]byte("testList"), time.Now().UnixMilli()-1000, ExpireAlways)
+	if e != nil || !isSet {
+		t.Error(isSet, e)
+	}
+	if db.Exists([]byte("testList")) != 0 {
+		t.Error("expired key is not deleted")
+	}
+	// 到期之后由主动过期删除 包括之后添加的 set 成员
+	_, e = db.Expire([]byte("testSet"), time.Now().Add(100*time.Millisecond).UnixMilli(), ExpireAlways)
+	if e != nil {
+		t.Fatal(e)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if db.setIndex.Exist([]byte("testSet")) || db.Exists([]byte("testSet")) != 0 {
+		t.Error("set is not expired")
+	}
+	_ = db.Close()
+}
+
+func TestHashFieldExpire(t *testing.T) {
+	dir := t.TempDir()
+	options := DefaultOptions()
+	options.LoggerPath = t.TempDir()
+
+	db, e := Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = db.HMSet("testHash", []HashField{
+		{Field: []byte("testField1"), Value: []byte("testValue")},
+		{Field: []byte("testField2"), Value: []byte("testValue")},
+		{Field: []byte("testField3"), Value: []byte("testValue")},
+		{Field: []byte("testField4"), Value: []byte("testValue")},
+	}, -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	check := func(result []int, expected ...int) {
+		t.Helper()
+		if len(result) != len(expected) {
+			t.Fatal(result, expected)
+		}
+		for i := range result {
+			if result[i] != expected[i] {
+				t.Error(i, result, expected)
+			}
+		}
+	}
+	hour := time.Now().Add(time.Hour).UnixMilli()
+	result, e := db.HExpire("testHash", hour, ExpireNX, "testField1", "testField2", "none")
+	if e != nil {
+		t.Fatal(e)
+	}
+	check(result, 1, 1, -2)
+	result, e = db.HExpire("testHash", hour+1000, ExpireGT, "testField1", "testField3")
+	if e != nil {
+		t.Fatal(e)
+	}
+	check(result, 1, 0)
+	result, e = db.HExpire("testHash", time.Now().UnixMilli()-1000, ExpireAlways, "testField4")
+	if e != nil {
+		t.Fatal(e)
+	}
+	check(result, 2)
+	result, e = db.HPersist("testHash", "testField2", "testField3", "testField4")
+	if e != nil {
+		t.Fatal(e)
+	}
+	check(result, 1, -1, -2)
+	result, e = db.HExpire("none", hour, ExpireAlways, "testField1")
+	if e != nil {
+		t.Fatal(e)
+	}
+	check(result, -2)
+	_, e = db.HTTL("none", "testField1")
+	if e != nil {
+		t.Error(e)
+	}
+	e = db.Set([]byte("testKey"), []byte("testValue"), -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, e = db.HExpire("testKey", hour, ExpireAlways, "testField1")
+	if !errors.Is(e, logger.WrongType) {
+		t.Error(e)
+	}
+
+	// 重新打开之后过期时间仍然保留
+	e = db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+	db, e = Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	ttl, e := db.HPTTL("testHash", "testField1", "testField2", "testField3", "testField4")
+	if e != nil || len(ttl) != 4 {
+		t.Fatal(ttl, e)
+	}
+	if ttl[0] <= time.Hour.Milliseconds() || ttl[0] > time.Hour.Milliseconds()+1000 || ttl[1] != -1 || ttl[2] != -1 || ttl[3] != -2 {
+		t.Error(ttl)
+	}
+	if ttl, e := db.HTTL("testHash", "testField1"); e != nil || ttl[0] != 3601 {
+		t.Error(ttl, e)
+	}
+
+	// 到期之后由主动过期删除
+	result, e = db.HExpire("testHash", time.Now().Add(100*time.Millisecond).UnixMilli(), ExpireAlways, "testField2")
+	if e != nil {
+		t.Fatal(e)
+	}
+	check(result, 1)
+	time.Sleep(300 * time.Millisecond)
+	if n, e := db.HLen("testHash"); e != nil || n != 2 {
+		t.Error(n, e)
+	}
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	options := DefaultOptions()
+	options.LoggerPath = t.TempDir()
+
+	db, e := Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	// 每种类型各20个 key
+	alwaysExisted := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		suffix := strconv.Itoa(i)
+		_, e = db.SAdd([]byte("set:"+suffix), []byte("testMember"))
+		if e != nil {
+			t.Fatal(e)
+		}
+		for _, e = range []error{
+			db.Set([]byte("string:"+suffix), []byte("testValue"), -1),
+			db.LPush([]byte("list:"+suffix), -1, []byte("testValue")),
+			db.ZAdd([]byte("zset:"+suffix), 1, []byte("testMember"), -1),
+			db.HSet("hash:"+suffix, "testField", "testValue", -1),
+		} {
+			if e != nil {
+				t.Fatal(e)
+			}
+		}
+		for _, prefix := range []string{"set:", "string:", "list:", "zset:", "hash:"} {
+			alwaysExisted[prefix+suffix] = true
+		}
+	}
+
+	// 每次遍历7个 两次遍历之间删除和添加 key 一直存在的 key 都要返回 并且只返回一次
+	var cursor uint64
+	returned := make(map[string]bool)
+	for round := 0; ; round++ {
+		next, keys := db.Scan(cursor, "", 7, "")
+		for _, key := range keys {
+			if returned[string(key)] {
+				t.Error("returned twice", string(key))
+			}
+			returned[string(key)] = true
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+		deleted := []byte("string:" + strconv.Itoa(19-round%20))
+		_, e = db.Del(deleted)
+		if e != nil {
+			t.Fatal(e)
+		}
+		delete(alwaysExisted, string(deleted))
+		e = db.Set([]byte("string:new"+strconv.Itoa(round)), []byte("testValue"), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	for key := range alwaysExisted {
+		if !returned[key] {
+			t.Error("not returned", key)
+		}
+	}
+
+	// MATCH 和 TYPE
+	next, keys := db.Scan(0, "hash:1*", 100, "")
+	if next != 0 || len(keys) != 11 {
+		t.Error(next, len(keys))
+	}
+	next, keys = db.Scan(0, "*:1?", 100, TypeZSet)
+	if next != 0 || len(keys) != 10 || string(keys[0]) != "zset:10" {
+		t.Error(next, len(keys))
+	}
+	// 服务端不保存游标 同一个游标可以重复使用 也可以用来遍历别的类型
+	next, keys = db.Scan(0, "", 1, "")
+	if next == 0 || len(keys) != 1 || string(keys[0]) != "hash:0" {
+		t.Fatal(next, len(keys))
+	}
+	for i := 0; i < 2; i++ {
+		_, again := db.Scan(next, "", 1, "")
+		if len(again) != 1 || string(again[0]) != "hash:1" {
+			t.Error(len(again))
+		}
+	}
+	_, keys = db.Scan(next, "", 1, TypeZSet)
+	if len(keys) != 1 || string(keys[0]) != "zset:0" {
+		t.Error(len(keys))
+	}
+	// 前8个字节相同的 key 在同一页中返回
+	for _, key := range []string{"session:a", "session:b", "session:c", "sessions"} {
+		e = db.Set([]byte(key), []byte("testValue"), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	next, keys = db.Scan(0, "session*", 1, "")
+	if next == 0 || len(keys) != 3 {
+		t.Error(next, len(keys))
+	}
+	next, keys = db.Scan(next, "session*", 1, "")
+	if next != 0 || len(keys) != 1 || string(keys[0]) != "sessions" {
+		t.Error(next, len(keys))
+	}
+	keys = db.Keys("[hl]*:[^1-9]")
+	if len(keys) != 2 || string(keys[0]) != "hash:0" || string(keys[1]) != "list:0" {
+		t.Error(len(keys))
+	}
+	if len(db.Keys("")) != db.Exists(db.Keys("*")...) {
+		t.Error(len(db.Keys("")))
+	}
+}
+
+func TestCollectionScan(t *testing.T) {
+	dir := t.TempDir()
+	options := DefaultOptions()
+	options.LoggerPath = t.TempDir()
+
+	db, e := Open(dir, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	alwaysExisted := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		field := "field" + strconv.Itoa(i)
+		e = db.HSet("testHash", field, "value"+strconv.Itoa(i), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+		e = db.ZAdd([]byte("testZSet"), float64(i), []byte(field), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+		_, e = db.SAdd([]byte("testSet"), []byte(field))
+		if e != nil {
+			t.Fatal(e)
+		}
+		alwaysExisted[field] = true
+	}
+
+	// 每次遍历7个 两次遍历之间删除和添加 field 一直存在的 field 都要返回 并且只返回一次
+	var cursor uint64
+	returned := make(map[string]bool)
+	for round := 0; ; round++ {
+		next, fields, e := db.HScan("testHash", cursor, "", 7)
+		if e != nil {
+			t.Fatal(e)
+		}
+		for _, v := range fields {
+			if returned[string(v.Field)] {
+				t.Error("returned twice", string(v.Field))
+			}
+			returned[string(v.Field)] = true
+			if strings.HasPrefix(string(v.Field), "field") && string(v.Value) != "value"+strings.TrimPrefix(string(v.Field), "field") {
+				t.Error(string(v.Field), string(v.Value))
+			}
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+		deleted := "field" + strconv.Itoa(49-round)
+		e = db.HDel("testHash", deleted)
+		if e != nil {
+			t.Fatal(e)
+		}
+		delete(alwaysExisted, deleted)
+		e = db.HSet("testHash", "new"+strconv.Itoa(round), "value", -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	for field := range alwaysExisted {
+		if !returned[field] {
+			t.Error("not returned", field)
+		}
+	}
+
+	// 值为空的 field 也要返回
+	e = db.HSet("emptyHash", "testField", "", -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, fields, e := db.HScan("emptyHash", 0, "", 10)
+	if e != nil || len(fields) != 1 || len(fields[0].Value) != 0 {
+		t.Error(fields, e)
+	}
+
+	next, members, e := db.ZScan([]byte("testZSet"), 0, "field4?", 100)
+	if e != nil || next != 0 || len(members) != 10 || string(members[0].Member) != "field40" || members[0].Score != 40 {
+		t.Error(next, len(members), e)
+	}
+	next, setMembers, e := db.SScan([]byte("testSet"), 0, "*", 10)
+	if e != nil || next == 0 || len(setMembers) != 10 {
+		t.Error(next, len(setMembers), e)
+	}
+	// 遍历过程中被删除的成员不会再返回
+	_, e = db.SRem([]byte("testSet"), setMembers[0], []byte("field9"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	next, setMembers, e = db.SScan([]byte("testSet"), next, "*", 0)
+	if e != nil || next != 0 || len(setMembers) != 39 {
+		t.Error(next, len(setMembers), e)
+	}
+	// 服务端不保存游标 同一个游标可以重复使用
+	for i := 0; i < 2; i++ {
+		_, fields, e = db.HScan("testHash", index.ScanCursor("field1"), "", 1)
+		if e != nil || len(fields) != 1 || string(fields[0].Field) != "field1" {
+			t.Error(fields, e)
+		}
+	}
+	next, setMembers, e = db.SScan([]byte("none"), 0, "", 10)
+	if e != nil || next != 0 || len(setMembers) != 0 {
+		t.Error(next, len(setMembers), e)
+	}
+	_, _, e = db.SScan([]byte("testHash"), 0, "", 10)
+	if !errors.Is(e, logger.WrongType) {
+		t.Error(e)
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern  string
+		input    string
+		expected bool
+	}{
+		{"*", "", true},
+		{"a*b", "ab", true},
+		{"a*b", "acccb", true},
+		{"a*b", "acccbc", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"[abc]x", "bx", true},
+		{"[^abc]x", "bx", false},
+		{"[a-c]x", "cx", true},
+		{"[c-a]x", "bx", true},
+		{"a\\*", "a*", true},
+		{"a\\*", "ab", false},
+		{"[\\]]", "]", true},
+		{"a[b", "ab", true},
+	} {
+		if result := util.MatchPattern(test.pattern, test.input); result != test.expected {
+			t.Error(test.pattern, test.input, result)
+		}
+	}
+	if prefix := util.PatternPrefix("ab\\*c*d"); prefix != "ab*c" {
+		t.Error(prefix)
+	}
+}
@@ -0,0 +1,194 @@
+package database
+
+// LInsert 在 index 指定的位置插入元素 比如说列表里有1 2 3 4这几个元素 如果 index 指定为2插入一个10 那么插入后列表是1 2 10 3 4
+func (db *DB) LInsert(key []byte, index int, value []byte, expiredAt int64) error {
+	unlock := db.lockKeys(key)
+	e := db.checkType(key, TypeList)
+	if e == nil {
+		e = db.listIndex.LInsert(key, index, value, expiredAt)
+	}
+	unlock()
+	if e != nil {
+		return e
+	}
+	// 唤醒阻塞在这个 key 上的客户端 见 blocking.go
+	db.serveListWaiters(key)
+	return nil
+}
+
+// LPop 弹出列表的第一个元素
+func (db *DB) LPop(key []byte) ([]byte, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeList)
+	if e != nil {
+		return nil, e
+	}
+	return db.listIndex.LPop(key)
+}
+
+// LPush 在列表头部插入元素 列表不存在时创建列表
+func (db *DB) LPush(key []byte, expiredAt int64, value []byte) error {
+	unlock := db.lockKeys(key)
+	e := db.checkType(key, TypeList)
+	if e == nil {
+		e = db.listIndex.LPush(key, expiredAt, value)
+	}
+	unlock()
+	if e != nil {
+		return e
+	}
+	// 唤醒阻塞在这个 key 上的客户端 见 blocking.go
+	db.serveListWaiters(key)
+	return nil
+}
+
+// RPush 在列表尾部依次插入元素 列表不存在时创建列表 返回插入之后列表的长度
+func (db *DB) RPush(key []byte, expiredAt int64, values ...[]byte) (int, error) {
+	return db.push(key, expiredAt, values, ListRight, false)
+}
+
+// LPushX 同 LPush 但是只在列表已经存在时插入 可以一次插入多个元素 返回插入之后列表的长度 列表不存在时返回0
+func (db *DB) LPushX(key []byte, expiredAt int64, values ...[]byte) (int, error) {
+	return db.push(key, expiredAt, values, ListLeft, true)
+}
+
+// RPushX 同 RPush 但是只在列表已经存在时插入 列表不存在时返回0
+func (db *DB) RPushX(key []byte, expiredAt int64, values ...[]byte) (int, error) {
+	return db.push(key, expiredAt, values, ListRight, true)
+}
+
+// push 持有 key 的锁依次插入多个元素 onlyExisted 为 true 时列表不存在就什么都不做
+func (db *DB) push(key []byte, expiredAt int64, values [][]byte, whereTo ListEnd, onlyExisted bool) (int, error) {
+	unlock := db.lockKeys(key)
+	e := db.checkType(key, TypeList)
+	if e != nil {
+		unlock()
+		return 0, e
+	}
+	if onlyExisted && !db.listIndex.Exist(key) {
+		unlock()
+		return 0, nil
+	}
+	for _, value := range values {
+		if whereTo == ListLeft {
+			e = db.listIndex.LPush(key, expiredAt, value)
+		} else {
+			e = db.listIndex.RPush(key, expiredAt, value)
+		}
+		if e != nil {
+			unlock()
+			// 前面的元素已经写入了 阻塞的客户端同样要拿到它们
+			db.serveListWaiters(key)
+			return 0, e
+		}
+	}
+	length, e := db.listIndex.LLen(key)
+	unlock()
+	db.serveListWaiters(key)
+	if e != nil {
+		return 0, e
+	}
+	return length, nil
+}
+
+// RPop 弹出列表的最后一个元素
+func (db *DB) RPop(key []byte) ([]byte, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeList)
+	if e != nil {
+		return nil, e
+	}
+	return db.listIndex.RPop(key)
+}
+
+// LMove 从 source 的 whereFrom 一端弹出元素 压入 destination 的 whereTo 一端 返回被移动的元素 source 不存在时返回 logger.KeyIsNotExisted
+func (db *DB) LMove(source, destination []byte, whereFrom, whereTo ListEnd) ([]byte, error) {
+	unlock := db.lockKeys(source, destination)
+	e := db.checkTypes([][]byte{source, destination}, TypeList)
+	if e != nil {
+		unlock()
+		return nil, e
+	}
+	value, e := db.listIndex.LMove(source, destination, whereFrom, whereTo)
+	unlock()
+	if e != nil {
+		return nil, e
+	}
+	db.serveListWaiters(destination)
+	return value, nil
+}
+
+// RPopLPush 同 LMove 从 source 的尾部弹出 压入 destination 的头部
+func (db *DB) RPopLPush(source, destination []byte) ([]byte, error) {
+	return db.LMove(source, destination, ListRight, ListLeft)
+}
+
+// LTrim 只保留 [start, stop] 范围内的元素 start 和 stop 可以是负数 规则同 redis
+func (db *DB) LTrim(key []byte, start, stop int) error {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeList)
+	if e != nil {
+		return e
+	}
+	return db.listIndex.LTrim(key, start, stop)
+}
+
+// LPos 返回列表中等于 element 的元素的下标 rank count maxLen 的规则同 redis 的 LPOS 命令
+func (db *DB) LPos(key []byte, element []byte, rank, count, maxLen int) ([]int, error) {
+	result, e := db.listIndex.LPos(key, element, rank, count, maxLen)
+	return result, db.readError(key, TypeList, e)
+}
+
+// LSet 修改 index 指定位置的元素 不支持修改过期时间
+func (db *DB) LSet(key []byte, index int, value []byte) error {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeList)
+	if e != nil {
+		return e
+	}
+	return db.listIndex.LSet(key, index, value)
+}
+
+// LRem 删除列表中等于 value 的元素 删除个数由 count 指定 规则同 redis
+func (db *DB) LRem(key []byte, count int, value []byte) error {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeList)
+	if e != nil {
+		return e
+	}
+	return db.listIndex.LRem(key, count, value)
+}
+
+// LIndex 查询 index 指定位置的元素
+func (db *DB) LIndex(key []byte, index int) ([]byte, error) {
+	result, e := db.listIndex.LIndex(key, index)
+	return result, db.readError(key, TypeList, e)
+}
+
+// LLen 查询列表长度
+func (db *DB) LLen(key []byte) (int, error) {
+	result, e := db.listIndex.LLen(key)
+	return result, db.readError(key, TypeList, e)
+}
+
+// LRange 按范围查询列表内的元素 查询范围是 [start, end)
+func (db *DB) LRange(key []byte, start, end int) ([][]byte, error) {
+	result, e := db.listIndex.LRange(key, start, end)
+	return result, db.readError(key, TypeList, e)
+}
+
+// CheckList 按文件中的历史重新构建列表 和内存中的列表对比 不一致时返回 ListHistoryIsBroken 会读取列表的所有文件 见 index/list_history.go
+func (db *DB) CheckList(key []byte) error {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeList)
+	if e != nil {
+		return e
+	}
+	return db.listIndex.CheckList(key)
+}
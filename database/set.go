@@ -0,0 +1,183 @@
+package database
+
+import (
+	"MisakaDB/index"
+	"MisakaDB/util"
+)
+
+// SAdd 向 set 中添加成员 set 不存在则创建 返回实际添加的成员个数
+func (db *DB) SAdd(key []byte, members ...[]byte) (int, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeSet)
+	if e != nil {
+		return 0, e
+	}
+	return db.setIndex.SAdd(key, members...)
+}
+
+// SRem 从 set 中删除成员 返回实际删除的成员个数
+func (db *DB) SRem(key []byte, members ...[]byte) (int, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeSet)
+	if e != nil {
+		return 0, e
+	}
+	return db.setIndex.SRem(key, members...)
+}
+
+// SMembers 返回 set 中的所有成员 顺序不固定
+func (db *DB) SMembers(key []byte) ([][]byte, error) {
+	result, e := db.setIndex.SMembers(key)
+	return result, db.readError(key, TypeSet, e)
+}
+
+// SIsMember 检查 member 是否是 set 的成员
+func (db *DB) SIsMember(key []byte, member []byte) (bool, error) {
+	result, e := db.setIndex.SIsMember(key, member)
+	return result, db.readError(key, TypeSet, e)
+}
+
+// SMIsMember 同 SIsMember 但是一次检查多个成员
+func (db *DB) SMIsMember(key []byte, members ...[]byte) ([]bool, error) {
+	result, e := db.setIndex.SMIsMember(key, members...)
+	return result, db.readError(key, TypeSet, e)
+}
+
+// SCard 返回 set 的成员个数
+func (db *DB) SCard(key []byte) (int, error) {
+	result, e := db.setIndex.SCard(key)
+	return result, db.readError(key, TypeSet, e)
+}
+
+// SPop 随机删除并返回 count 个成员
+func (db *DB) SPop(key []byte, count int) ([][]byte, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeSet)
+	if e != nil {
+		return nil, e
+	}
+	return db.setIndex.SPop(key, count)
+}
+
+// SRandMember 随机返回 count 个成员 count 为负数时成员可能重复
+func (db *DB) SRandMember(key []byte, count int) ([][]byte, error) {
+	result, e := db.setIndex.SRandMember(key, count)
+	return result, db.readError(key, TypeSet, e)
+}
+
+// SMove 把 member 从 source 移动到 destination member 不在 source 中时返回 false
+func (db *DB) SMove(source []byte, destination []byte, member []byte) (bool, error) {
+	unlock := db.lockKeys(source, destination)
+	defer unlock()
+	e := db.checkType(source, TypeSet)
+	if e != nil {
+		return false, e
+	}
+	e = db.checkType(destination, TypeSet)
+	if e != nil {
+		return false, e
+	}
+	return db.setIndex.SMove(source, destination, member)
+}
+
+// SInter 返回所有给定 set 的交集 不存在的 set 视为空集
+func (db *DB) SInter(keys ...[]byte) ([][]byte, error) {
+	e := db.checkTypes(keys, TypeSet)
+	if e != nil {
+		return nil, e
+	}
+	return db.setIndex.SInter(keys...), nil
+}
+
+// SUnion 返回所有给定 set 的并集 不存在的 set 视为空集
+func (db *DB) SUnion(keys ...[]byte) ([][]byte, error) {
+	e := db.checkTypes(keys, TypeSet)
+	if e != nil {
+		return nil, e
+	}
+	return db.setIndex.SUnion(keys...), nil
+}
+
+// SDiff 返回第一个 set 和其它所有 set 的差集 不存在的 set 视为空集
+func (db *DB) SDiff(keys ...[]byte) ([][]byte, error) {
+	e := db.checkTypes(keys, TypeSet)
+	if e != nil {
+		return nil, e
+	}
+	return db.setIndex.SDiff(keys...), nil
+}
+
+// SInterCard 返回交集的成员个数 limit 不为0时 个数达到 limit 就停止计算
+func (db *DB) SInterCard(limit int, keys ...[]byte) (int, error) {
+	e := db.checkTypes(keys, TypeSet)
+	if e != nil {
+		return 0, e
+	}
+	return db.setIndex.SInterCard(limit, keys...)
+}
+
+// SInterStore 同 SInter 但是把结果存入 destination destination 原来是其它类型的话会被覆盖
+func (db *DB) SInterStore(destination []byte, keys ...[]byte) (int, error) {
+	return db.setStore(db.setIndex.SInterStore, destination, keys)
+}
+
+// SUnionStore 同 SUnion 但是把结果存入 destination destination 原来是其它类型的话会被覆盖
+func (db *DB) SUnionStore(destination []byte, keys ...[]byte) (int, error) {
+	return db.setStore(db.setIndex.SUnionStore, destination, keys)
+}
+
+// SDiffStore 同 SDiff 但是把结果存入 destination destination 原来是其它类型的话会被覆盖
+func (db *DB) SDiffStore(destination []byte, keys ...[]byte) (int, error) {
+	return db.setStore(db.setIndex.SDiffStore, destination, keys)
+}
+
+// setStore 持有所有 key 的锁执行 *STORE 类的命令
+func (db *DB) setStore(store func(destination []byte, keys ...[]byte) (int, error), destination []byte, keys [][]byte) (int, error) {
+	unlock := db.lockKeys(append([][]byte{destination}, keys...)...)
+	defer unlock()
+	e := db.checkTypes(keys, TypeSet)
+	if e != nil {
+		return 0, e
+	}
+	// 和 redis 一样 destination 不论原来是什么类型都会被覆盖
+	destinationType := db.Type(destination)
+	if destinationType != TypeNone && destinationType != TypeSet {
+		_, e = db.deleteKey(destination, destinationType)
+		if e != nil {
+			return 0, e
+		}
+	}
+	return store(destination, keys...)
+}
+
+// SScan 按字典序遍历 set 中的成员 用法同 Scan set 不存在时返回空的结果
+func (db *DB) SScan(key []byte, cursor uint64, pattern string, count int) (next uint64, members [][]byte, e error) {
+	result, e := db.setIndex.SScan(key, []byte(util.PatternPrefix(pattern)), cursor, count)
+	if e != nil {
+		return 0, nil, db.scanError(key, TypeSet, e)
+	}
+	page, next := index.ScanPage(result, count)
+	var matched [][]byte
+	for _, member := range page {
+		if matchPattern(pattern, member) {
+			matched = append(matched, []byte(member))
+		}
+	}
+	if len(matched) == 0 {
+		return next, nil, nil
+	}
+	// 取出成员之后成员可能已经被删除了
+	isMember, e := db.setIndex.SMIsMember(key, matched...)
+	if e != nil {
+		return next, nil, db.scanError(key, TypeSet, e)
+	}
+	for i, member := range matched {
+		if isMember[i] {
+			members = append(members, member)
+		}
+	}
+	return next, members, nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import "MisakaDB/logger"
+
+// Set 给定key和value 设定值 如果key存在则为更新值 如果key属于其它类型 则先删除原来的key
+func (db *DB) Set(key []byte, value []byte, expiredAt int64) error {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	keyType := db.Type(key)
+	if keyType != TypeNone && keyType != TypeString {
+		_, e := db.deleteKey(key, keyType)
+		if e != nil {
+			return e
+		}
+	}
+	return db.stringIndex.Set(key, value, expiredAt)
+}
+
+// SetNX 只有在key不存在时设置key的值 key存在时（不论是什么类型）返回 logger.KeyIsExisted
+func (db *DB) SetNX(key []byte, value []byte, expiredAt int64) error {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	if db.Type(key) != TypeNone {
+		return logger.KeyIsExisted
+	}
+	return db.stringIndex.SetNX(key, value, expiredAt)
+}
+
+// Get 根据给定的key尝试获取value key不存在时返回 logger.KeyIsNotExisted
+func (db *DB) Get(key []byte) (string, error) {
+	result, e := db.stringIndex.Get(key)
+	return result, db.readError(key, TypeString, e)
+}
+
+// GetRange 返回key中字符串值的子字符
+func (db *DB) GetRange(key []byte, start int, end int) (string, error) {
+	result, e := db.stringIndex.GetRange(key, start, end)
+	return result, db.readError(key, TypeString, e)
+}
+
+// GetSet 先按key获取旧的值 然后再设置新的值并且返回旧值
+func (db *DB) GetSet(key []byte, newValue []byte) (string, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeString)
+	if e != nil {
+		return "", e
+	}
+	return db.stringIndex.GetSet(key, newValue)
+}
+
+// Append 在key存在的情况下 向其已经存在的value追加一个字符串
+func (db *DB) Append(key []byte, appendValue []byte) error {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeString)
+	if e != nil {
+		return e
+	}
+	return db.stringIndex.Append(key, appendValue)
+}
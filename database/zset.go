@@ -0,0 +1,267 @@
+package database
+
+import (
+	"MisakaDB/index"
+	"MisakaDB/util"
+)
+
+// ScoreBound score 区间的边界 IsExclusive 为 true 时是开区间的边界 即不包含 Score 本身
+type ScoreBound = index.ScoreBound
+
+// ZSetMember 有序集合的成员和它的 score
+type ZSetMember = index.ZSetMember
+
+// LexBound member 字典序区间的边界 Infinity 为 -1 时表示负无穷 为 1 时表示正无穷
+type LexBound = index.LexBound
+
+// Aggregate 合并多个有序集合时 同一个 member 的多个 score 的计算方式
+type Aggregate = index.Aggregate
+
+const (
+	AggregateSum = index.AggregateSum
+	AggregateMin = index.AggregateMin
+	AggregateMax = index.AggregateMax
+)
+
+// ZAdd 按给定参数添加元素 如果元素存在则更新 如果有序集合不存在则创建
+func (db *DB) ZAdd(key []byte, score float64, member []byte, expiredAt int64) error {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeZSet)
+	if e != nil {
+		return e
+	}
+	return db.zsetIndex.ZAdd(key, score, member, expiredAt)
+}
+
+// ZRem 按给定的 key 和 member 删除元素 如果删除后有序列表不再拥有元素则自动删除有序列表
+func (db *DB) ZRem(key []byte, member []byte) error {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeZSet)
+	if e != nil {
+		return e
+	}
+	return db.zsetIndex.ZRem(key, member)
+}
+
+// ZScore 按给定的 key 和 member 获取对应元素的 score
+func (db *DB) ZScore(key []byte, member []byte) (float64, error) {
+	result, e := db.zsetIndex.ZScore(key, member)
+	return result, db.readError(key, TypeZSet, e)
+}
+
+// ZCard 获取 zset 的有效成员数
+func (db *DB) ZCard(key []byte) (int, error) {
+	result, e := db.zsetIndex.ZCard(key)
+	return result, db.readError(key, TypeZSet, e)
+}
+
+// ZCount 获取 score 在 min 和 max 之间的所有 member 个数
+func (db *DB) ZCount(key []byte, min, max ScoreBound) (int, error) {
+	result, e := db.zsetIndex.ZCount(key, min, max)
+	return result, db.readError(key, TypeZSet, e)
+}
+
+// ZRangeByScore 获取 score 在 min 和 max 之间的所有成员和 score isRev 为 true 时按 score 从大到小返回
+//
+// 跳过前 offset 个成员之后最多返回 count 个成员 count 为负数时返回所有成员
+func (db *DB) ZRangeByScore(key []byte, min, max ScoreBound, isRev bool, offset, count int) ([]ZSetMember, error) {
+	result, e := db.zsetIndex.ZRangeByScore(key, min, max, isRev, offset, count)
+	return result, db.readError(key, TypeZSet, e)
+}
+
+// ZRangeByLex 获取 member 在 min 和 max 之间的所有成员和 score 只有在所有成员的 score 都相同时结果才有意义 其它规则同 ZRangeByScore
+func (db *DB) ZRangeByLex(key []byte, min, max LexBound, isRev bool, offset, count int) ([]ZSetMember, error) {
+	result, e := db.zsetIndex.ZRangeByLex(key, min, max, isRev, offset, count)
+	return result, db.readError(key, TypeZSet, e)
+}
+
+// ZRank 获取 member 按 score 从小到大的排名 排名从0开始
+func (db *DB) ZRank(key []byte, member []byte) (int, error) {
+	result, e := db.zsetIndex.ZRank(key, member)
+	return result, db.readError(key, TypeZSet, e)
+}
+
+// ZRevRank 获取 member 按 score 从大到小的排名 排名从0开始
+func (db *DB) ZRevRank(key []byte, member []byte) (int, error) {
+	result, e := db.zsetIndex.ZRevRank(key, member)
+	return result, db.readError(key, TypeZSet, e)
+}
+
+// ZRange 获取排名在 [start, stop] 范围内的所有成员和 score 负数表示从末尾开始数 isRev 为 true 时按 score 从大到小排名
+func (db *DB) ZRange(key []byte, start, stop int, isRev bool) ([]ZSetMember, error) {
+	result, e := db.zsetIndex.ZRange(key, start, stop, isRev)
+	return result, db.readError(key, TypeZSet, e)
+}
+
+// ZRemRangeByRank 删除排名在 [start, stop] 范围内的所有成员 返回删除的成员个数
+func (db *DB) ZRemRangeByRank(key []byte, start, stop int) (int, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeZSet)
+	if e != nil {
+		return 0, e
+	}
+	return db.zsetIndex.ZRemRangeByRank(key, start, stop)
+}
+
+// ZIncrBy 给 member 的 score 加上 increment 并返回新的 score member 不存在时视为 score 为0 有序集合不存在则创建
+func (db *DB) ZIncrBy(key []byte, increment float64, member []byte) (float64, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeZSet)
+	if e != nil {
+		return 0, e
+	}
+	return db.zsetIndex.ZIncrBy(key, increment, member)
+}
+
+// ZPopMin 删除并返回 score 最小的 count 个成员 按 score 从小到大排列
+func (db *DB) ZPopMin(key []byte, count int) ([]ZSetMember, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeZSet)
+	if e != nil {
+		return nil, e
+	}
+	return db.zsetIndex.ZPopMin(key, count)
+}
+
+// ZPopMax 删除并返回 score 最大的 count 个成员 按 score 从大到小排列
+func (db *DB) ZPopMax(key []byte, count int) ([]ZSetMember, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeZSet)
+	if e != nil {
+		return nil, e
+	}
+	return db.zsetIndex.ZPopMax(key, count)
+}
+
+// ZMScore 一次获取多个 member 的 score 结果的顺序和给定 member 的顺序一致 不存在的 member 对应的结果为空
+func (db *DB) ZMScore(key []byte, members ...[]byte) ([]*float64, error) {
+	result, e := db.zsetIndex.ZMScore(key, members...)
+	return result, db.readError(key, TypeZSet, e)
+}
+
+// ZRandMember 随机返回 count 个成员和它们的 score count 为负数时成员可能重复
+func (db *DB) ZRandMember(key []byte, count int) ([]ZSetMember, error) {
+	result, e := db.zsetIndex.ZRandMember(key, count)
+	return result, db.readError(key, TypeZSet, e)
+}
+
+// ZLexCount 获取 member 在 min 和 max 之间的成员个数 只有在所有成员的 score 都相同时结果才有意义
+func (db *DB) ZLexCount(key []byte, min, max LexBound) (int, error) {
+	result, e := db.zsetIndex.ZLexCount(key, min, max)
+	return result, db.readError(key, TypeZSet, e)
+}
+
+// ZRemRangeByLex 删除 member 在 min 和 max 之间的所有成员 返回删除的成员个数
+func (db *DB) ZRemRangeByLex(key []byte, min, max LexBound) (int, error) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+	e := db.checkType(key, TypeZSet)
+	if e != nil {
+		return 0, e
+	}
+	return db.zsetIndex.ZRemRangeByLex(key, min, max)
+}
+
+// ZUnion 返回所有给定有序集合的并集 按 score 从小到大排列 不存在的有序集合视为空集
+//
+// weights 为每个有序集合的 score 的乘数 为空时全部视为1 aggregate 决定同一个 member 的多个 score 怎么合并
+func (db *DB) ZUnion(keys [][]byte, weights []float64, aggregate Aggregate) ([]ZSetMember, error) {
+	e := db.checkTypes(keys, TypeZSet)
+	if e != nil {
+		return nil, e
+	}
+	return db.zsetIndex.ZUnion(keys, weights, aggregate)
+}
+
+// ZInter 返回所有给定有序集合的交集 规则同 ZUnion
+func (db *DB) ZInter(keys [][]byte, weights []float64, aggregate Aggregate) ([]ZSetMember, error) {
+	e := db.checkTypes(keys, TypeZSet)
+	if e != nil {
+		return nil, e
+	}
+	return db.zsetIndex.ZInter(keys, weights, aggregate)
+}
+
+// ZDiff 返回第一个有序集合和其它所有有序集合的差集 score 为成员在第一个有序集合中的 score
+func (db *DB) ZDiff(keys [][]byte) ([]ZSetMember, error) {
+	e := db.checkTypes(keys, TypeZSet)
+	if e != nil {
+		return nil, e
+	}
+	return db.zsetIndex.ZDiff(keys)
+}
+
+// ZUnionStore 同 ZUnion 但是把结果存入 destination destination 原来是其它类型的话会被覆盖
+func (db *DB) ZUnionStore(destination []byte, keys [][]byte, weights []float64, aggregate Aggregate) (int, error) {
+	return db.zsetStore(destination, keys, func() (int, error) {
+		return db.zsetIndex.ZUnionStore(destination, keys, weights, aggregate)
+	})
+}
+
+// ZInterStore 同 ZInter 但是把结果存入 destination destination 原来是其它类型的话会被覆盖
+func (db *DB) ZInterStore(destination []byte, keys [][]byte, weights []float64, aggregate Aggregate) (int, error) {
+	return db.zsetStore(destination, keys, func() (int, error) {
+		return db.zsetIndex.ZInterStore(destination, keys, weights, aggregate)
+	})
+}
+
+// ZDiffStore 同 ZDiff 但是把结果存入 destination destination 原来是其它类型的话会被覆盖
+func (db *DB) ZDiffStore(destination []byte, keys [][]byte) (int, error) {
+	return db.zsetStore(destination, keys, func() (int, error) {
+		return db.zsetIndex.ZDiffStore(destination, keys)
+	})
+}
+
+// zsetStore 持有所有 key 的锁执行 *STORE 类的命令
+func (db *DB) zsetStore(destination []byte, keys [][]byte, store func() (int, error)) (int, error) {
+	unlock := db.lockKeys(append([][]byte{destination}, keys...)...)
+	defer unlock()
+	e := db.checkTypes(keys, TypeZSet)
+	if e != nil {
+		return 0, e
+	}
+	// 和 redis 一样 destination 不论原来是什么类型都会被覆盖
+	destinationType := db.Type(destination)
+	if destinationType != TypeNone && destinationType != TypeZSet {
+		_, e = db.deleteKey(destination, destinationType)
+		if e != nil {
+			return 0, e
+		}
+	}
+	return store()
+}
+
+// ZScan 按字典序遍历有序集合中的成员 用法同 Scan 有序集合不存在时返回空的结果
+func (db *DB) ZScan(key []byte, cursor uint64, pattern string, count int) (next uint64, members []ZSetMember, e error) {
+	result, e := db.zsetIndex.ZScan(key, []byte(util.PatternPrefix(pattern)), cursor, count)
+	if e != nil {
+		return 0, nil, db.scanError(key, TypeZSet, e)
+	}
+	page, next := index.ScanPage(result, count)
+	var matched [][]byte
+	for _, member := range page {
+		if matchPattern(pattern, member) {
+			matched = append(matched, []byte(member))
+		}
+	}
+	if len(matched) == 0 {
+		return next, nil, nil
+	}
+	// 取出成员之后成员可能已经被删除了
+	scores, e := db.zsetIndex.ZMScore(key, matched...)
+	if e != nil {
+		return next, nil, db.scanError(key, TypeZSet, e)
+	}
+	for i, member := range matched {
+		if scores[i] != nil {
+			members = append(members, ZSetMember{Member: member, Score: *scores[i]})
+		}
+	}
+	return next, members, nil
+}
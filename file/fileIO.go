@@ -86,5 +86,14 @@ func (f *FileIO) Length() (int64, error) {
 	return fileStat.Size(), nil
 }
 
+// Truncate 将文件截断到指定长度
+func (f *FileIO) Truncate(size int64) error {
+	e := f.file.Truncate(size)
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), strconv.FormatInt(size, 10), f.file.Name())
+	}
+	return e
+}
+
 // 检查接口实现
 var _ FileWriter = (*FileIO)(nil)
@@ -8,6 +8,7 @@ type FileWriter interface {
 	Delete() error                        // 删除文件
 	Close() error                         // 关闭文件
 	Length() (int64, error)               // 返回该文件的长度
+	Truncate(size int64) error            // 将文件截断到指定长度 只用于丢弃文件尾部残缺的数据
 }
 
 // attention 实现FileWriter接口的结构体不需要并发安全 因为它和index一一对应 而index会带一个读写锁
@@ -120,3 +120,15 @@ func (mf *MMapFile) Close() error {
 func (mf *MMapFile) Length() (int64, error) {
 	return mf.fileContentSize, nil
 }
+
+// Truncate 将文件的有效内容截断到指定长度 被截掉的部分清零 文件真正的截断在 Close 时进行
+func (mf *MMapFile) Truncate(size int64) error {
+	if size < 0 || size > mf.fileContentSize {
+		return logger.OffsetIsIllegal
+	}
+	for i := size; i < mf.fileContentSize; i++ {
+		mf.mmapArray[i] = 0
+	}
+	mf.fileContentSize = size
+	return nil
+}
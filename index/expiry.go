@@ -0,0 +1,297 @@
+package index
+
+import (
+	"MisakaDB/logger"
+	"container/heap"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+/*
+主动过期
+
+所有索引共用一个 ExpiryScheduler 它按过期时间维护一个小根堆 堆里的每一项是某个索引的某个 key 以及这个 key 中最早的过期时间
+
+索引在写入带有过期时间的内容时调用 schedule 同一个 key 在堆里只有一项 新的过期时间更早时才会更新
+
+后台协程在堆顶到期时醒来 开始一轮过期 每次从堆顶取出最多 expireCycleKeys 个已经到期的 key 交给对应索引的 ExpireKey
+
+ExpireKey 删除 key 中所有已经过期的内容 同时写入删除 entry 然后返回剩下的内容中最早的过期时间 调度器据此把 key 重新放回堆里
+
+和 redis 一样 每一轮过期都有时间预算 每 expireCycleDuration 中最多花费 expireCycleBudget 在过期上 用完了就先让出 等下一个周期再继续 不会因为大量 key 同时过期而一直占着索引的锁
+
+redis 不知道哪些 key 先过期 所以只能随机抽样 这里有堆 每次取出的都是最早到期的 key
+
+读取时发现已经过期的内容仍然会立即删除 主动过期只是保证没有被读取的过期内容也会被及时删除 并且在文件里留下删除 entry
+
+锁的顺序是先索引的锁再调度器的锁 调度器调用 ExpireKey 时不持有自己的锁
+
+修改过期时间
+
+每个索引的 Expire 修改整个 key 的过期时间 写入一个 TypeExpire entry ExpiredAt 为新的过期时间 值为写入时的时间戳
+
+key 中的内容各自有过期时间 所以 key 的过期时间是其中最后一个过期的内容的过期时间 有永不过期的内容时 key 也永不过期
+
+已经过期的内容不一定在文件里留下了删除 entry 所以重放时先保留已经过期的内容 因为之后的 TypeExpire entry 可能修改它的过期时间
+TypeExpire entry 只修改在它写入时还没有过期的内容 重放结束之后再删除仍然过期的内容
+*/
+
+const (
+	expireCycleKeys     = 20                     // 每次从堆顶取出的 key 的个数
+	expireCycleDuration = 100 * time.Millisecond // 过期的周期
+	expireCycleBudget   = 25 * time.Millisecond  // 每个周期中最多花费在过期上的时间
+	expireRetryDuration = time.Second            // ExpireKey 失败之后 隔多久再重试
+)
+
+// Expirer 支持主动过期的索引需要实现的接口
+type Expirer interface {
+	// SetExpiryScheduler 使用 es 进行主动过期 同时把索引中已有的带有过期时间的 key 交给 es
+	SetExpiryScheduler(es *ExpiryScheduler)
+	// ExpireKey 删除 key 中所有在 now 之前过期的内容 同时写入删除 entry 返回 key 中剩下的内容里最早的过期时间 没有时返回-1
+	ExpireKey(key string, now int64) (int64, error)
+}
+
+// expiryItem 堆中的一项
+type expiryItem struct {
+	expirer   Expirer
+	key       string
+	expiredAt int64
+	index     int // 在堆中的位置 由 expiryHeap 维护
+}
+
+// expiryItemKey 用来在 items 中查找堆中的项
+type expiryItemKey struct {
+	expirer Expirer
+	key     string
+}
+
+// expiryHeap 按过期时间排序的小根堆 实现 heap.Interface
+type expiryHeap []*expiryItem
+
+func (h expiryHeap) Len() int {
+	return len(h)
+}
+
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].expiredAt < h[j].expiredAt
+}
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	item := x.(*expiryItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+// ExpiryScheduler 所有索引共用的主动过期调度器
+type ExpiryScheduler struct {
+	mutex sync.Mutex
+	heap  expiryHeap
+	items map[expiryItemKey]*expiryItem
+
+	wake          chan struct{} // 堆顶变得更早时通知后台协程
+	closeChan     chan struct{}
+	closeOnce     sync.Once
+	closeFinished chan struct{}
+}
+
+// NewExpiryScheduler 新建一个调度器 需要调用 Start 之后才会开始主动过期
+func NewExpiryScheduler() *ExpiryScheduler {
+	return &ExpiryScheduler{
+		items:         make(map[expiryItemKey]*expiryItem),
+		wake:          make(chan struct{}, 1),
+		closeChan:     make(chan struct{}),
+		closeFinished: make(chan struct{}),
+	}
+}
+
+// Start 启动后台协程
+func (es *ExpiryScheduler) Start() {
+	go es.run()
+}
+
+// Stop 停止后台协程 返回时不会再有正在执行的 ExpireKey 重复调用不会出错
+func (es *ExpiryScheduler) Stop() {
+	es.closeOnce.Do(func() {
+		close(es.closeChan)
+		<-es.closeFinished
+	})
+}
+
+// schedule 让 expirer 在 expiredAt 之后过期 key 如果 key 已经在堆里并且过期时间更早 就什么都不做 es 为 nil 或者 expiredAt 为-1时也什么都不做
+func (es *ExpiryScheduler) schedule(expirer Expirer, key string, expiredAt int64) {
+	if es == nil || expiredAt == -1 {
+		return
+	}
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	itemKey := expiryItemKey{expirer: expirer, key: key}
+	if item, ok := es.items[itemKey]; ok {
+		if item.expiredAt <= expiredAt {
+			return
+		}
+		item.expiredAt = expiredAt
+		heap.Fix(&es.heap, item.index)
+	} else {
+		item = &expiryItem{
+			expirer:   expirer,
+			key:       key,
+			expiredAt: expiredAt,
+		}
+		es.items[itemKey] = item
+		heap.Push(&es.heap, item)
+	}
+	if es.heap[0].expiredAt == expiredAt {
+		select {
+		case es.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Len 返回堆中 key 的个数
+func (es *ExpiryScheduler) Len() int {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	return len(es.heap)
+}
+
+// popExpired 从堆顶取出最多 count 个在 now 之前过期的 key
+func (es *ExpiryScheduler) popExpired(now int64, count int) []*expiryItem {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	var result []*expiryItem
+	for len(result) < count && len(es.heap) != 0 && isExpired(es.heap[0].expiredAt, now) {
+		item := heap.Pop(&es.heap).(*expiryItem)
+		delete(es.items, expiryItemKey{expirer: item.expirer, key: item.key})
+		result = append(result, item)
+	}
+	return result
+}
+
+// nextWait 返回距离堆顶过期还有多久 堆为空时返回 expireCycleDuration
+func (es *ExpiryScheduler) nextWait() time.Duration {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	if len(es.heap) == 0 {
+		return expireCycleDuration
+	}
+	// isExpired 要求过期时间严格早于当前时间 所以多等1毫秒
+	wait := time.Until(time.UnixMilli(es.heap[0].expiredAt + 1))
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// run 后台协程 堆顶到期或者被唤醒时执行一轮过期
+//
+// 一轮过期用完了时间预算之后 直到这个周期结束之前都不会再开始新的一轮 期间被唤醒也只是继续等待
+func (es *ExpiryScheduler) run() {
+	defer close(es.closeFinished)
+	wait := expireCycleDuration
+	var periodEnd time.Time // 用完了预算的周期结束的时间
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-es.closeChan:
+			timer.Stop()
+			return
+		case <-es.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+		if rest := time.Until(periodEnd); rest > 0 {
+			wait = rest
+			continue
+		}
+		start := time.Now()
+		var isExhausted bool
+		wait, isExhausted = es.cycle()
+		if isExhausted {
+			periodEnd = start.Add(expireCycleDuration)
+			wait = time.Until(periodEnd)
+		}
+	}
+}
+
+// cycle 执行一轮过期 直到没有到期的 key 或者用完了时间预算 返回距离堆顶到期还要等多久 用完了时间预算时 isExhausted 为 true
+func (es *ExpiryScheduler) cycle() (wait time.Duration, isExhausted bool) {
+	start := time.Now()
+	for {
+		select {
+		case <-es.closeChan:
+			return expireCycleDuration, false
+		default:
+		}
+		now := time.Now().UnixMilli()
+		items := es.popExpired(now, expireCycleKeys)
+		if len(items) == 0 {
+			return es.nextWait(), false
+		}
+		for _, item := range items {
+			next, e := item.expirer.ExpireKey(item.key, now)
+			if e != nil {
+				// 写入失败的话 过一会儿再试
+				logger.GenerateErrorLog(false, false, e.Error(), "Expire Key Failed", item.key)
+				next = time.Now().Add(expireRetryDuration).UnixMilli()
+			}
+			es.schedule(item.expirer, item.key, next)
+		}
+		if time.Since(start) >= expireCycleBudget {
+			// 预算用完了 剩下的到下一个周期再处理
+			return 0, true
+		}
+	}
+}
+
+// earlierExpiredAt 返回两个过期时间中更早的一个 -1 表示永不过期 比任何时间都晚
+func earlierExpiredAt(a, b int64) int64 {
+	if a == -1 || (b != -1 && b < a) {
+		return b
+	}
+	return a
+}
+
+// laterExpiredAt 返回两个过期时间中更晚的一个 -1 表示永不过期 比任何时间都晚
+func laterExpiredAt(a, b int64) int64 {
+	if a == -1 || b == -1 {
+		return -1
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// encodeExpireTime 把写入 TypeExpire entry 时的时间戳编码为 entry 的值
+func encodeExpireTime(now int64) []byte {
+	return binary.AppendVarint(nil, now)
+}
+
+// decodeExpireTime 解码 TypeExpire entry 的值 返回写入时的时间戳
+func decodeExpireTime(value []byte) (int64, error) {
+	now, n := binary.Varint(value)
+	if n <= 0 {
+		logger.GenerateErrorLog(false, false, logger.ExpireEntryIsBroken.Error())
+		return 0, logger.ExpireEntryIsBroken
+	}
+	return now, nil
+}
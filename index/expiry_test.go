@@ -0,0 +1,353 @@
+package index
+
+import (
+	"MisakaDB/logger"
+	"MisakaDB/storage"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExpiryScheduler(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	es := NewExpiryScheduler()
+	es.Start()
+	defer es.Stop()
+
+	stringIndex, e := BuildStringIndex(nil, nil, storage.TraditionalIOFile, folderPath, 4096, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	hashIndex, e := BuildHashIndex(nil, nil, storage.TraditionalIOFile, folderPath, 4096, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	listIndex, e := BuildListIndex(nil, nil, storage.TraditionalIOFile, folderPath, 4096, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	zsetIndex, e := BuildZSetIndex(nil, nil, storage.TraditionalIOFile, folderPath, 4096, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	stringIndex.SetExpiryScheduler(es)
+	hashIndex.SetExpiryScheduler(es)
+	listIndex.SetExpiryScheduler(es)
+	zsetIndex.SetExpiryScheduler(es)
+
+	// 每种类型各写入一个会过期的和一个不会过期的 之后不再读取 只能靠主动过期删除
+	expiredAt := time.Now().Add(100 * time.Millisecond).UnixMilli()
+	for _, e = range []error{
+		stringIndex.Set([]byte("testKey1"), []byte("testValue"), expiredAt),
+		stringIndex.Set([]byte("testKey2"), []byte("testValue"), -1),
+		hashIndex.HSet("testKey", "testField1", "testValue", expiredAt),
+		hashIndex.HSet("testKey", "testField2", "testValue", -1),
+		hashIndex.HSet("testKey2", "testField", "testValue", expiredAt),
+		listIndex.RPush([]byte("testList"), expiredAt, []byte("a")),
+		listIndex.RPush([]byte("testList"), -1, []byte("b")),
+		zsetIndex.ZAdd([]byte("testZSet"), 1, []byte("a"), expiredAt),
+		zsetIndex.ZAdd([]byte("testZSet"), 2, []byte("b"), -1),
+	} {
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	t.Log(es.Len())
+	if es.Len() != 5 {
+		t.Error(es.Len())
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	if es.Len() != 0 {
+		t.Error(es.Len())
+	}
+	if _, ok := stringIndex.index.Search([]byte("testKey1")); ok {
+		t.Error("string is not expired")
+	}
+	if _, ok := stringIndex.index.Search([]byte("testKey2")); !ok {
+		t.Error("string is expired")
+	}
+	if _, ok := hashIndex.index["testKey"]["testField1"]; ok || len(hashIndex.index["testKey"]) != 1 {
+		t.Error("hash is not expired", len(hashIndex.index["testKey"]))
+	}
+	if _, ok := hashIndex.index["testKey2"]; ok {
+		t.Error("empty hash is not deleted")
+	}
+	if list := listIndex.index["testList"]; list == nil || list.Len() != 1 || string(list.Get(0).value) != "b" {
+		t.Error("list is not expired")
+	}
+	if targetZset := zsetIndex.index["testZSet"]; targetZset == nil || len(targetZset.dict) != 1 || targetZset.dict["b"] == nil {
+		t.Error("zset is not expired")
+	}
+
+	for _, index := range []interface{ CloseIndex() error }{stringIndex, hashIndex, listIndex, zsetIndex} {
+		e = index.CloseIndex()
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	// 每个过期的内容都留下了一个删除 entry
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 4096, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	expected := map[storage.FileForData]int{storage.String: 1, storage.Hash: 2, storage.List: 1, storage.ZSet: 1}
+	for dataType, count := range expected {
+		deleteCount := 0
+		_, e = loadRecordFiles(activeFiles[dataType], archiveFiles[dataType], func(entry *storage.Entry, fileID uint32, offset int64) error {
+			if entry.EntryType == storage.TypeDelete || entry.EntryType == storage.TypeListRemove {
+				deleteCount += 1
+			}
+			return nil
+		}, false, false)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if deleteCount != count {
+			t.Error(dataType, deleteCount, count)
+		}
+	}
+}
+
+// failedExpirer 第一次 ExpireKey 时失败的 Expirer
+type failedExpirer struct {
+	calls []int64
+}
+
+func (fe *failedExpirer) SetExpiryScheduler(es *ExpiryScheduler) {}
+
+func (fe *failedExpirer) ExpireKey(key string, now int64) (int64, error) {
+	fe.calls = append(fe.calls, now)
+	if len(fe.calls) == 1 {
+		return -1, logger.FileBytesIsMaxedOut
+	}
+	return -1, nil
+}
+
+func TestExpirySchedulerRetry(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	es := NewExpiryScheduler()
+	fe := &failedExpirer{}
+	now := time.Now().UnixMilli()
+
+	// 更晚的过期时间不会覆盖更早的
+	es.schedule(fe, "testKey", now+1000)
+	es.schedule(fe, "testKey", now-10)
+	es.schedule(fe, "testKey", now+2000)
+	es.schedule(fe, "testKey2", -1)
+	if es.Len() != 1 || es.heap[0].expiredAt != now-10 {
+		t.Fatal(es.Len(), es.heap[0].expiredAt)
+	}
+
+	// 失败之后过 expireRetryDuration 再重试
+	es.cycle()
+	if len(fe.calls) != 1 || es.Len() != 1 {
+		t.Fatal(fe.calls, es.Len())
+	}
+	if wait := es.nextWait(); wait < expireRetryDuration-100*time.Millisecond || wait > expireRetryDuration+100*time.Millisecond {
+		t.Error(wait)
+	}
+	es.heap[0].expiredAt = now - 10
+	es.cycle()
+	if len(fe.calls) != 2 || es.Len() != 0 {
+		t.Error(fe.calls, es.Len())
+	}
+}
+
+func TestExpireReplay(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	// 文件很小 大部分 entry 都会从 hint 重放
+	stringIndex, e := BuildStringIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	hashIndex, e := BuildHashIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	expiredAt := time.Now().Add(100 * time.Millisecond).UnixMilli()
+	for i := 0; i < 20; i++ {
+		e = stringIndex.Set([]byte("testKey"+strconv.Itoa(i)), []byte("testValue"), expiredAt)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	for _, e = range []error{
+		hashIndex.HSet("testKey", "testField1", "testValue", expiredAt),
+		hashIndex.HSet("testKey", "testField2", "testValue", -1),
+		// 在过期之前去掉过期时间 重放时虽然已经过了原来的过期时间 也不能删除
+		stringIndex.Expire([]byte("testKey0"), -1),
+		stringIndex.Expire([]byte("testKey1"), time.Now().Add(time.Hour).UnixMilli()),
+	} {
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	// testField1 已经过期 但是没有删除 entry 之后的 TypeExpire entry 不能让它复活
+	e = hashIndex.Expire("testKey", -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = stringIndex.Expire([]byte("testKey2"), -1)
+	if !errors.Is(e, logger.KeyIsNotExisted) {
+		t.Error(e)
+	}
+	e = stringIndex.Merge()
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, index := range []interface{ CloseIndex() error }{stringIndex, hashIndex} {
+		e = index.CloseIndex()
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	stringIndex, e = BuildStringIndex(activeFiles[storage.String], archiveFiles[storage.String], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = stringIndex.CloseIndex()
+	}()
+	hashIndex, e = BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = hashIndex.CloseIndex()
+	}()
+
+	if ttl, e := stringIndex.TTL([]byte("testKey0")); e != nil || ttl != -1 {
+		t.Error(ttl, e)
+	}
+	if ttl, e := stringIndex.TTL([]byte("testKey1")); e != nil || ttl < time.Now().UnixMilli() {
+		t.Error(ttl, e)
+	}
+	for i := 2; i < 20; i++ {
+		if stringIndex.Exist([]byte("testKey" + strconv.Itoa(i))) {
+			t.Error(i)
+		}
+	}
+	if ttl, e := hashIndex.TTL("testKey"); e != nil || ttl != -1 {
+		t.Error(ttl, e)
+	}
+	if _, ok := hashIndex.index["testKey"]["testField1"]; ok {
+		t.Error("expired field is restored")
+	}
+}
+
+func TestHashFieldExpireReplay(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	hashIndex, e := BuildHashIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	expiredAt := time.Now().Add(time.Hour).UnixMilli()
+	for _, e = range []error{
+		hashIndex.HSet("testKey", "", "testValue", -1),
+		hashIndex.HSet("testKey", "testField", "testValue", -1),
+		// field 为空字符串 重放时不能当作修改整个 hash 的过期时间
+		hashIndex.HExpire("testKey", expiredAt, ""),
+	} {
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	e = hashIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	hashIndex, e = BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = hashIndex.CloseIndex()
+	}()
+
+	ttl, e := hashIndex.HTTL("testKey", "", "testField")
+	if e != nil || len(ttl) != 2 || ttl[0] != expiredAt || ttl[1] != -1 {
+		t.Error(ttl, e)
+	}
+}
+
+// slowExpirer 每次 ExpireKey 都要花费 delay 的 Expirer
+type slowExpirer struct {
+	mutex sync.Mutex
+	delay time.Duration
+	calls []time.Time
+}
+
+func (se *slowExpirer) SetExpiryScheduler(es *ExpiryScheduler) {}
+
+func (se *slowExpirer) ExpireKey(key string, now int64) (int64, error) {
+	se.mutex.Lock()
+	se.calls = append(se.calls, time.Now())
+	se.mutex.Unlock()
+	time.Sleep(se.delay)
+	return -1, nil
+}
+
+func TestExpirySchedulerBudget(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	es := NewExpiryScheduler()
+	se := &slowExpirer{delay: 2 * time.Millisecond}
+	now := time.Now().UnixMilli()
+	// 一次取出的 key 就会用完预算
+	for i := 0; i < expireCycleKeys*2; i++ {
+		es.schedule(se, "testKey"+strconv.Itoa(i), now-1000)
+	}
+	es.Start()
+	defer es.Stop()
+
+	// 用完预算之后 不断地被唤醒也要等到这个周期结束
+	for i := 0; i < 20; i++ {
+		time.Sleep(5 * time.Millisecond)
+		es.schedule(se, "wakeKey"+strconv.Itoa(i), now-2000-int64(i))
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+	if len(se.calls) != expireCycleKeys*2+20 {
+		t.Fatal(len(se.calls))
+	}
+	if gap := se.calls[expireCycleKeys].Sub(se.calls[0]); gap < expireCycleDuration-5*time.Millisecond {
+		t.Error(gap)
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"MisakaDB/logger"
 	"MisakaDB/storage"
 	"MisakaDB/util"
+	"encoding/binary"
 	"errors"
+	"math"
+	"math/rand"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -19,10 +23,12 @@ type HashIndex struct {
 	baseFolderPath string
 	fileMaxSize    int64
 	syncDuration   time.Duration
+
+	expiry *ExpiryScheduler
 }
 
-// BuildHashIndex 给定当前活跃文件和归档文件 重新构建Hash类型的索引 该方法只会在数据库启动时被调用 如果不存在旧的文件 则新建一个活跃文件
-func BuildHashIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*storage.RecordFile, fileIOMode storage.FileIOType, baseFolderPath string, fileMaxSize int64, syncDuration time.Duration) (*HashIndex, error) {
+// BuildHashIndex 给定当前活跃文件和归档文件 重新构建Hash类型的索引 该方法只会在数据库启动时被调用 如果不存在旧的文件 则新建一个活跃文件 isRepair 为 true 时遇到损坏的文件会截断而不是报错
+func BuildHashIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*storage.RecordFile, fileIOMode storage.FileIOType, baseFolderPath string, fileMaxSize int64, syncDuration time.Duration, isRepair bool) (*HashIndex, error) {
 	result := &HashIndex{
 		activeFile:     activeFile,
 		archivedFile:   archivedFile,
@@ -33,10 +39,6 @@ func BuildHashIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*sto
 		syncDuration:   syncDuration,
 	}
 
-	var offset int64
-	var fileLength int64
-	var entryLength int64
-	var entry *storage.Entry
 	var e error
 
 	// 如果活跃文件都读取不到的话 肯定也没有归档文件了 直接返回即可
@@ -52,26 +54,31 @@ func BuildHashIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*sto
 	}
 
 	// 读取所有归档文件的entry 因为活跃文件也在这个归档文件里 所以不再单独读取活跃文件
-	for i := uint32(1); i <= uint32(len(archivedFile)); i++ {
-		recordFile, ok := archivedFile[uint32(i)]
-		if ok == false {
-			continue
+	hintedFiles, e := loadRecordFiles(result.activeFile, result.archivedFile, result.handleEntry, true, isRepair)
+	if e != nil {
+		return nil, e
+	}
+	// 重放时保留了已经过期的 field 现在可以删掉了
+	now := time.Now().UnixMilli()
+	for key, fields := range result.index {
+		for field, node := range fields {
+			if isExpired(node.expiredAt, now) {
+				delete(fields, field)
+			}
 		}
-		offset = 0
-		fileLength, e = recordFile.Length()
-		if e != nil {
-			return nil, e
+		if len(fields) == 0 {
+			delete(result.index, key)
 		}
-		for offset < fileLength {
-			entry, entryLength, e = recordFile.ReadIntoEntry(offset)
-			if e != nil {
-				return nil, e
-			}
-			e = result.handleEntry(entry, recordFile.GetFileID(), offset)
-			if e != nil {
-				return nil, e
+	}
+	// 从 hint 重放出来的节点还没有值 按节点记录的位置读出来
+	for _, fields := range result.index {
+		for _, node := range fields {
+			if hintedFiles[node.fileID] {
+				e = loadNodeValue(result.archivedFile, node)
+				if e != nil {
+					return nil, e
+				}
 			}
-			offset += entryLength
 		}
 	}
 	result.activeFile.StartSyncRoutine(syncDuration)
@@ -97,6 +104,28 @@ func (hi *HashIndex) CloseIndex() error {
 
 // HSet 给定key field value 设定值 如果key field都存在即为更新值
 func (hi *HashIndex) HSet(key string, field string, value string, expiredAt int64) error {
+	hi.mutex.Lock()
+	defer hi.mutex.Unlock()
+
+	return hi.setField(key, field, value, expiredAt)
+}
+
+// HMSet 同HSet 但是一次设定多个field 每个field写入一个entry 写入失败时之前的field已经生效
+func (hi *HashIndex) HMSet(key string, fields []HashField, expiredAt int64) error {
+	hi.mutex.Lock()
+	defer hi.mutex.Unlock()
+
+	for _, v := range fields {
+		e := hi.setField(key, string(v.Field), string(v.Value), expiredAt)
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// setField 写入entry并设定值 调用者需要持有写锁
+func (hi *HashIndex) setField(key string, field string, value string, expiredAt int64) error {
 	entry := &storage.Entry{
 		EntryType: storage.TypeRecord,
 		ExpiredAt: expiredAt,
@@ -107,9 +136,6 @@ func (hi *HashIndex) HSet(key string, field string, value string, expiredAt int6
 		expiredAt: expiredAt,
 	}
 
-	hi.mutex.Lock()
-	defer hi.mutex.Unlock()
-
 	// 写入文件 同时记录offset和fileID
 	offset, e := hi.writeEntry(entry)
 	if e != nil {
@@ -126,6 +152,7 @@ func (hi *HashIndex) HSet(key string, field string, value string, expiredAt int6
 		hi.index[key] = make(map[string]*indexNode)
 		hi.index[key][field] = indexN
 	}
+	hi.expiry.schedule(hi, key, expiredAt)
 	return nil
 }
 
@@ -158,6 +185,7 @@ func (hi *HashIndex) HGet(key string, field string) (string, error) {
 	indexN, ok := hi.index[key][field]
 	if ok != true {
 		logger.GenerateErrorLog(false, false, logger.FieldIsNotExisted.Error(), key, field)
+		hi.mutex.RUnlock()
 		return "", logger.FieldIsNotExisted
 	}
 
@@ -196,7 +224,7 @@ func (hi *HashIndex) HDel(key string, field string, deleteField bool) error {
 		entry := &storage.Entry{
 			EntryType: storage.TypeDelete,
 			Key:       util.EncodeKeyAndField(key, field),
-			Value:     []byte{},
+			Value:     []byte{hashFieldDeleteFlag},
 			ExpiredAt: 0,
 		}
 		// 尝试写入删除Entry 删除Entry不需要记录offset
@@ -210,7 +238,7 @@ func (hi *HashIndex) HDel(key string, field string, deleteField bool) error {
 	} else {
 		// 删hash
 		entry := &storage.Entry{
-			EntryType: storage.TypeDelete,
+			EntryType: storage.TypeDeleteKey,
 			Key:       util.EncodeKeyAndField(key, ""),
 			Value:     []byte{},
 			ExpiredAt: 0,
@@ -226,6 +254,70 @@ func (hi *HashIndex) HDel(key string, field string, deleteField bool) error {
 	}
 }
 
+// Exist 检查key是否存在 并且至少有一个没有过期的field
+func (hi *HashIndex) Exist(key string) bool {
+	hi.mutex.RLock()
+	defer hi.mutex.RUnlock()
+
+	return hi.exist(key, time.Now().UnixMilli())
+}
+
+// exist 检查 key 在 now 是否至少有一个没有过期的 field 调用者需要持有锁
+func (hi *HashIndex) exist(key string, now int64) bool {
+	for _, v := range hi.index[key] {
+		if !isExpired(v.expiredAt, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScanKeys 返回以 prefix 开头 位置不小于 cursor 并且没有过期的 key 中 ScanPage 需要的部分 见 scan.go
+func (hi *HashIndex) ScanKeys(prefix []byte, cursor uint64, count int) []string {
+	hi.mutex.RLock()
+	defer hi.mutex.RUnlock()
+
+	now := time.Now().UnixMilli()
+	return mapScan(hi.index, prefix, cursor, count, func(key string, _ map[string]*indexNode) bool {
+		return hi.exist(key, now)
+	})
+}
+
+// HashField hash 中的一个 field 和它的 value
+type HashField struct {
+	Field []byte
+	Value []byte
+}
+
+// HScan 返回 hash 中以 prefix 开头 位置不小于 cursor 并且没有过期的 field 中 ScanPage 需要的部分 见 scan.go
+func (hi *HashIndex) HScan(key string, prefix []byte, cursor uint64, count int) ([]string, error) {
+	hi.mutex.RLock()
+	defer hi.mutex.RUnlock()
+
+	now := time.Now().UnixMilli()
+	if !hi.exist(key, now) {
+		return nil, logger.KeyIsNotExisted
+	}
+	return mapScan(hi.index[key], prefix, cursor, count, func(_ string, node *indexNode) bool {
+		return !isExpired(node.expiredAt, now)
+	}), nil
+}
+
+// HScanValues 返回给定的 field 中仍然存在并且没有过期的 field 和它们的 value 顺序不变 用于取出 HSCAN 的一页
+func (hi *HashIndex) HScanValues(key string, fields []string) []HashField {
+	hi.mutex.RLock()
+	defer hi.mutex.RUnlock()
+
+	now := time.Now().UnixMilli()
+	var result []HashField
+	for _, field := range fields {
+		if node, ok := hi.index[key][field]; ok && !isExpired(node.expiredAt, now) {
+			result = append(result, HashField{Field: []byte(field), Value: node.value})
+		}
+	}
+	return result
+}
+
 // HLen 根据给定的key 寻找field的个数
 func (hi *HashIndex) HLen(key string) (int, error) {
 	hi.mutex.RLock()
@@ -262,14 +354,125 @@ func (hi *HashIndex) HStrLen(key string, field string) (int, error) {
 	return len(value), nil
 }
 
+// HGetAll 返回hash中所有没有过期的field和value
+func (hi *HashIndex) HGetAll(key string) ([]HashField, error) {
+	hi.mutex.RLock()
+	defer hi.mutex.RUnlock()
+
+	now := time.Now().UnixMilli()
+	var result []HashField
+	for field, node := range hi.index[key] {
+		if !isExpired(node.expiredAt, now) {
+			result = append(result, HashField{Field: []byte(field), Value: node.value})
+		}
+	}
+	if len(result) == 0 {
+		return nil, logger.KeyIsNotExisted
+	}
+	return result, nil
+}
+
+// HMGet 按顺序返回给定的field的value 不存在或者已经过期的field对应的value为nil
+func (hi *HashIndex) HMGet(key string, fields ...string) ([][]byte, error) {
+	hi.mutex.RLock()
+	defer hi.mutex.RUnlock()
+
+	now := time.Now().UnixMilli()
+	if !hi.exist(key, now) {
+		return nil, logger.KeyIsNotExisted
+	}
+	result := make([][]byte, len(fields))
+	for i, field := range fields {
+		if node, ok := hi.index[key][field]; ok && !isExpired(node.expiredAt, now) {
+			result[i] = node.value
+		}
+	}
+	return result, nil
+}
+
+// HIncrBy 给field的值加上increment并返回新的值 field不存在时视为0 hash不存在则创建 field原有的过期时间保持不变
+func (hi *HashIndex) HIncrBy(key string, field string, increment int64) (int64, error) {
+	hi.mutex.Lock()
+	defer hi.mutex.Unlock()
+
+	var current int64
+	expiredAt := int64(-1)
+	if node, ok := hi.index[key][field]; ok && !isExpired(node.expiredAt, time.Now().UnixMilli()) {
+		var e error
+		current, e = strconv.ParseInt(string(node.value), 10, 64)
+		if e != nil {
+			return 0, logger.HashValueIsNotInteger
+		}
+		expiredAt = node.expiredAt
+	}
+	if (increment > 0 && current > math.MaxInt64-increment) || (increment < 0 && current < math.MinInt64-increment) {
+		return 0, logger.IncrementIsOverflowed
+	}
+	result := current + increment
+	e := hi.setField(key, field, strconv.FormatInt(result, 10), expiredAt)
+	if e != nil {
+		return 0, e
+	}
+	return result, nil
+}
+
+// HIncrByFloat 同HIncrBy 但是值是浮点数 结果为NaN或者无穷大时返回错误
+func (hi *HashIndex) HIncrByFloat(key string, field string, increment float64) (float64, error) {
+	hi.mutex.Lock()
+	defer hi.mutex.Unlock()
+
+	var current float64
+	expiredAt := int64(-1)
+	if node, ok := hi.index[key][field]; ok && !isExpired(node.expiredAt, time.Now().UnixMilli()) {
+		var e error
+		current, e = strconv.ParseFloat(string(node.value), 64)
+		if e != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return 0, logger.HashValueIsNotFloat
+		}
+		expiredAt = node.expiredAt
+	}
+	result := current + increment
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, logger.IncrementIsNaNOrInf
+	}
+	e := hi.setField(key, field, util.FormatScore(result), expiredAt)
+	if e != nil {
+		return 0, e
+	}
+	return result, nil
+}
+
+// HRandField 随机返回hash中的field 规则同 redis count 为正数时返回不重复的最多 count 个 为负数时返回可能重复的 -count 个
+func (hi *HashIndex) HRandField(key string, count int) ([]HashField, error) {
+	fields, e := hi.HGetAll(key)
+	if e != nil {
+		return nil, e
+	}
+	if count < 0 {
+		result := make([]HashField, -count)
+		for i := range result {
+			result[i] = fields[rand.Intn(len(fields))]
+		}
+		return result, nil
+	}
+	rand.Shuffle(len(fields), func(i, j int) {
+		fields[i], fields[j] = fields[j], fields[i]
+	})
+	if count < len(fields) {
+		fields = fields[:count]
+	}
+	return fields, nil
+}
+
 // writeEntry 尝试将entry写入文件 如果活跃文件写满则自动新开一个文件继续尝试写入 如果写入成功则返回nil和写入前的offset
 func (hi *HashIndex) writeEntry(entry *storage.Entry) (int64, error) {
 	offset := hi.activeFile.GetOffset()
 	e := hi.activeFile.WriteEntryIntoFile(entry)
 	// 如果文件已满
 	if errors.Is(e, logger.FileBytesIsMaxedOut) {
-		// 先结束旧文件的定时同步
+		// 先结束旧文件的定时同步 并且写入旧文件的 hint 文件
 		hi.activeFile.StopSyncRoutine()
+		sealRecordFile(hi.activeFile)
 		// 开一个新的文件 这个新的活跃文件的序号自动在之前的活跃文件上 + 1
 		hi.activeFile, e = storage.NewRecordFile(hi.fileIOMode, storage.Hash, hi.activeFile.GetFileID()+1, hi.baseFolderPath, hi.fileMaxSize)
 		if e != nil {
@@ -291,6 +494,53 @@ func (hi *HashIndex) writeEntry(entry *storage.Entry) (int64, error) {
 	return offset, nil
 }
 
+// Merge 将存活的 entry 重写到新文件中 并且删除旧文件 merge 期间持有写锁
+func (hi *HashIndex) Merge() error {
+	hi.mutex.Lock()
+	defer hi.mutex.Unlock()
+
+	var relocations []relocation
+	mw := newMergeWriter(storage.Hash, hi.fileIOMode, hi.baseFolderPath, hi.fileMaxSize, hi.archivedFile)
+	now := time.Now().UnixMilli()
+	for _, fields := range hi.index {
+		for _, node := range fields {
+			if isExpired(node.expiredAt, now) { // 过期的就不再重写了
+				continue
+			}
+			r, e := mw.rewriteNode(hi.archivedFile, node)
+			if e != nil {
+				mw.abort()
+				return e
+			}
+			relocations = append(relocations, r)
+		}
+	}
+
+	activeFile, archivedFile, e := mw.commit(hi.activeFile, hi.archivedFile, hi.syncDuration, relocations)
+	if e != nil {
+		return e
+	}
+	hi.activeFile = activeFile
+	hi.archivedFile = archivedFile
+	return nil
+}
+
+// DeadBytesRatio 估算归档文件中已经失效的字节数所占的比例
+func (hi *HashIndex) DeadBytesRatio() (float64, error) {
+	hi.mutex.RLock()
+	defer hi.mutex.RUnlock()
+
+	var liveSize int64
+	for key, fields := range hi.index {
+		for field, node := range fields {
+			if node.fileID != hi.activeFile.GetFileID() {
+				liveSize += storage.EntrySize(len(util.EncodeKeyAndField(key, field)), len(node.value), node.expiredAt)
+			}
+		}
+	}
+	return deadBytesRatio(hi.activeFile, hi.archivedFile, liveSize)
+}
+
 // handleEntry 接收Entry 并且写入Hash索引
 //
 // 它只对索引进行操作
@@ -305,24 +555,43 @@ func (hi *HashIndex) handleEntry(entry *storage.Entry, fileID uint32, offset int
 	defer hi.mutex.Unlock()
 
 	switch entry.EntryType {
+	case storage.TypeDeleteKey:
+		delete(hi.index, key)
 	case storage.TypeDelete:
-		{
-			if field != "" { // 一个是按key删掉整个hash 一个实按field删一个value
-				delete(hi.index[key], field)
-			} else {
-				delete(hi.index, key)
+		// 现在删除一个 field 的 entry 的值为 hashFieldDeleteFlag 旧版本删除整个 hash 时写入的是 field 为空并且没有值的 TypeDelete
+		// field 为空时需要看值才能区分 hint 中没有值 所以从文件中读出完整的 entry 这种 entry 很少 不会拖慢启动
+		if field == "" && len(entry.Value) == 0 {
+			recordFile, ok := hi.archivedFile[fileID]
+			if !ok {
+				logger.GenerateErrorLog(false, false, logger.FileIsNotExist.Error(), strconv.Itoa(int(fileID)))
+				return logger.FileIsNotExist
+			}
+			entry, _, e = recordFile.ReadIntoEntry(offset)
+			if e != nil {
+				return e
 			}
 		}
-	case storage.TypeRecord:
-
-		// 这里之所以只对RecordEntry进行检查 是因为对map的delete函数 如果传入的map本身就是空或者要删除的键找不到值 它就直接返回了 并不会报错
-		// 所以DeleteEntry不需要过期检查 过期就过期吧 过期了也只是no-op而已
-		// 如果过期时间为-1则说明永不过期
-		if entry.ExpiredAt < time.Now().UnixMilli() && entry.ExpiredAt != -1 {
-			// attention 过期logger
-			return nil
+		if field != "" || (len(entry.Value) != 0 && entry.Value[0] == hashFieldDeleteFlag) {
+			delete(hi.index[key], field)
+		} else {
+			delete(hi.index, key)
 		}
+	case storage.TypeExpire:
+		// HExpire 写入的 entry 带有 hashFieldExpireFlag 只修改一个 field 没有标记并且 field 为空时修改整个 hash 的过期时间
+		// 早先写入的 HExpire entry 没有标记 但是它们的 field 不为空 仍然只修改一个 field
+		writtenAt, e := decodeExpireTime(entry.Value)
+		if e != nil {
+			return e
+		}
+		isWholeHash := field == "" && !isFieldExpire(entry.Value)
+		for targetField, node := range hi.index[key] {
+			if (isWholeHash || field == targetField) && !isExpired(node.expiredAt, writtenAt) {
+				node.expiredAt = entry.ExpiredAt
+			}
+		}
+	case storage.TypeRecord:
 
+		// 已经过期的 field 也要先写入索引 之后的 TypeExpire entry 可能修改它的过期时间 重放结束之后再统一删除
 		if _, ok := hi.index[key]; ok {
 			hi.index[key][field] = &indexNode{
 				value:     entry.Value,
@@ -342,3 +611,167 @@ func (hi *HashIndex) handleEntry(entry *storage.Entry, fileID uint32, offset int
 	}
 	return nil
 }
+
+// SetExpiryScheduler 使用 es 进行主动过期 同时把有过期 field 的 hash 交给 es
+func (hi *HashIndex) SetExpiryScheduler(es *ExpiryScheduler) {
+	hi.mutex.Lock()
+	defer hi.mutex.Unlock()
+
+	hi.expiry = es
+	for key, fields := range hi.index {
+		next := int64(-1)
+		for _, node := range fields {
+			next = earlierExpiredAt(next, node.expiredAt)
+		}
+		es.schedule(hi, key, next)
+	}
+}
+
+// ExpireKey 删除 hash 中所有在 now 之前过期的 field 同时写入删除 entry 返回剩下的 field 中最早的过期时间
+func (hi *HashIndex) ExpireKey(key string, now int64) (int64, error) {
+	hi.mutex.Lock()
+	defer hi.mutex.Unlock()
+
+	next := int64(-1)
+	for field, node := range hi.index[key] {
+		if !isExpired(node.expiredAt, now) {
+			next = earlierExpiredAt(next, node.expiredAt)
+			continue
+		}
+		_, e := hi.writeEntry(&storage.Entry{
+			EntryType: storage.TypeDelete,
+			Key:       util.EncodeKeyAndField(key, field),
+			Value:     []byte{hashFieldDeleteFlag},
+			ExpiredAt: 0,
+		})
+		if e != nil {
+			return -1, e
+		}
+		delete(hi.index[key], field)
+	}
+	if len(hi.index[key]) == 0 {
+		delete(hi.index, key)
+	}
+	return next, nil
+}
+
+// Expire 修改 hash 中所有 field 的过期时间 expiredAt 为-1时去掉过期时间
+func (hi *HashIndex) Expire(key string, expiredAt int64) error {
+	hi.mutex.Lock()
+	defer hi.mutex.Unlock()
+
+	now := time.Now().UnixMilli()
+	var fields []*indexNode
+	for _, node := range hi.index[key] {
+		if !isExpired(node.expiredAt, now) {
+			fields = append(fields, node)
+		}
+	}
+	if len(fields) == 0 {
+		return logger.KeyIsNotExisted
+	}
+	_, e := hi.writeEntry(&storage.Entry{
+		EntryType: storage.TypeExpire,
+		Key:       util.EncodeKeyAndField(key, ""),
+		Value:     encodeExpireTime(now),
+		ExpiredAt: expiredAt,
+	})
+	if e != nil {
+		return e
+	}
+	for _, node := range fields {
+		node.expiredAt = expiredAt
+	}
+	hi.expiry.schedule(hi, key, expiredAt)
+	return nil
+}
+
+// HExpire 修改给定的 field 的过期时间 每个 field 写入一个 TypeExpire entry 键中带有 field expiredAt 为-1时去掉过期时间
+//
+// entry 的值在时间戳后面加上 hashFieldExpireFlag 和 Expire 写入的 entry 区分开 否则空字符串 field 的 entry 会被当作修改整个 hash
+//
+// 不存在或者已经过期的 field 会被跳过 hash 不存在时返回 logger.KeyIsNotExisted
+func (hi *HashIndex) HExpire(key string, expiredAt int64, fields ...string) error {
+	hi.mutex.Lock()
+	defer hi.mutex.Unlock()
+
+	now := time.Now().UnixMilli()
+	if !hi.exist(key, now) {
+		return logger.KeyIsNotExisted
+	}
+	for _, field := range fields {
+		node, ok := hi.index[key][field]
+		if !ok || isExpired(node.expiredAt, now) {
+			continue
+		}
+		_, e := hi.writeEntry(&storage.Entry{
+			EntryType: storage.TypeExpire,
+			Key:       util.EncodeKeyAndField(key, field),
+			Value:     append(encodeExpireTime(now), hashFieldExpireFlag),
+			ExpiredAt: expiredAt,
+		})
+		if e != nil {
+			return e
+		}
+		node.expiredAt = expiredAt
+	}
+	hi.expiry.schedule(hi, key, expiredAt)
+	return nil
+}
+
+// hashFieldDeleteFlag 删除一个 field 的 TypeDelete entry 的值 和旧版本删除整个 hash 的 entry 区分开 否则删除空字符串 field 会被当作删除整个 hash
+const hashFieldDeleteFlag byte = 1
+
+// hashFieldExpireFlag 写在 HExpire 写入的 TypeExpire entry 的时间戳后面 表示只修改一个 field 的过期时间
+const hashFieldExpireFlag byte = 1
+
+// isFieldExpire 检查 TypeExpire entry 的值在时间戳后面是否带有 hashFieldExpireFlag
+func isFieldExpire(value []byte) bool {
+	_, n := binary.Varint(value)
+	return n > 0 && len(value) > n && value[n] == hashFieldExpireFlag
+}
+
+// HTTL 按顺序返回给定的 field 的过期时间 -1 表示永不过期 field 不存在或者已经过期时为-2 hash 不存在时返回 logger.KeyIsNotExisted
+func (hi *HashIndex) HTTL(key string, fields ...string) ([]int64, error) {
+	hi.mutex.RLock()
+	defer hi.mutex.RUnlock()
+
+	now := time.Now().UnixMilli()
+	if !hi.exist(key, now) {
+		return nil, logger.KeyIsNotExisted
+	}
+	result := make([]int64, len(fields))
+	for i, field := range fields {
+		if node, ok := hi.index[key][field]; ok && !isExpired(node.expiredAt, now) {
+			result[i] = node.expiredAt
+		} else {
+			result[i] = -2
+		}
+	}
+	return result, nil
+}
+
+// TTL 返回 hash 的过期时间 即最后一个过期的 field 的过期时间 -1 表示永不过期
+func (hi *HashIndex) TTL(key string) (int64, error) {
+	hi.mutex.RLock()
+	defer hi.mutex.RUnlock()
+
+	now := time.Now().UnixMilli()
+	isFound := false
+	var result int64
+	for _, node := range hi.index[key] {
+		if isExpired(node.expiredAt, now) {
+			continue
+		}
+		if !isFound {
+			isFound = true
+			result = node.expiredAt
+		} else {
+			result = laterExpiredAt(result, node.expiredAt)
+		}
+	}
+	if !isFound {
+		return 0, logger.KeyIsNotExisted
+	}
+	return result, nil
+}
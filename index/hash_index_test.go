@@ -3,6 +3,9 @@ package index
 import (
 	"MisakaDB/logger"
 	"MisakaDB/storage"
+	"MisakaDB/util"
+	"errors"
+	"math"
 	"math/rand/v2"
 	"strconv"
 	"testing"
@@ -17,7 +20,7 @@ func TestBuildHashIndex(t *testing.T) {
 	//}
 
 	rand.Int()
-	hashIndex, e := BuildHashIndex(nil, nil, storage.TraditionalIOFile, "D:\\", 65536, time.Second)
+	hashIndex, e := BuildHashIndex(nil, nil, storage.TraditionalIOFile, "D:\\", 65536, time.Second, false)
 	if e != nil {
 		t.Error(e)
 		return
@@ -41,7 +44,7 @@ func TestBuildHashIndex2(t *testing.T) {
 		t.Error(e)
 		return
 	}
-	hashIndex, e := BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.TraditionalIOFile, "D:\\MisakaDBTest", 65536, time.Second)
+	hashIndex, e := BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.TraditionalIOFile, "D:\\MisakaDBTest", 65536, time.Second, false)
 	if e != nil {
 		t.Error(e)
 		return
@@ -61,7 +64,7 @@ func TestBuildHashIndex3(t *testing.T) {
 		t.Error(e)
 		return
 	}
-	hashIndex, e := BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.TraditionalIOFile, "D:\\MisakaDBTest", 65536, time.Second)
+	hashIndex, e := BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.TraditionalIOFile, "D:\\MisakaDBTest", 65536, time.Second, false)
 	if e != nil {
 		t.Error(e)
 		return
@@ -84,7 +87,7 @@ func TestBuildHashIndex4(t *testing.T) {
 		t.Error(e)
 		return
 	}
-	hashIndex, e := BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.TraditionalIOFile, "D:\\MisakaDBTest", 65536, time.Second)
+	hashIndex, e := BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.TraditionalIOFile, "D:\\MisakaDBTest", 65536, time.Second, false)
 	if e != nil {
 		t.Error(e)
 		return
@@ -127,7 +130,7 @@ func TestBuildHashIndex5(t *testing.T) {
 		t.Error(e)
 		return
 	}
-	hashIndex, e := BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.MMapIOFile, "/home/MisakaDB", 10983040, time.Second)
+	hashIndex, e := BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.MMapIOFile, "/home/MisakaDB", 10983040, time.Second, false)
 	if e != nil {
 		t.Error(e)
 		return
@@ -183,3 +186,193 @@ func TestBuildHashIndex5(t *testing.T) {
 
 	_ = hashIndex.CloseIndex()
 }
+
+func TestHashIndexBulk(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+	hashIndex, e := BuildHashIndex(nil, nil, storage.TraditionalIOFile, folderPath, 65536, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	e = hashIndex.HMSet("testKey", []HashField{
+		{Field: []byte("testField1"), Value: []byte("1")},
+		{Field: []byte("testField2"), Value: []byte("1.5")},
+		{Field: []byte("testField3"), Value: []byte("testValue")},
+	}, -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	expiredAt := time.Now().Add(time.Hour).UnixMilli()
+	e = hashIndex.HSet("testKey", "testField4", "10", expiredAt)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	values, e := hashIndex.HMGet("testKey", "testField3", "none", "testField1")
+	if e != nil || len(values) != 3 || string(values[0]) != "testValue" || values[1] != nil || string(values[2]) != "1" {
+		t.Error(values, e)
+	}
+	fields, e := hashIndex.HGetAll("testKey")
+	if e != nil || len(fields) != 4 {
+		t.Error(len(fields), e)
+	}
+
+	for _, test := range []struct {
+		field     string
+		increment int64
+		expected  int64
+		e         error
+	}{
+		{"testField1", 5, 6, nil},
+		{"none", -3, -3, nil},
+		{"testField2", 1, 0, logger.HashValueIsNotInteger},
+		{"testField1", math.MaxInt64, 0, logger.IncrementIsOverflowed},
+		{"testField4", 1, 11, nil},
+	} {
+		result, e := hashIndex.HIncrBy("testKey", test.field, test.increment)
+		if !errors.Is(e, test.e) || result != test.expected {
+			t.Error(test.field, result, e)
+		}
+	}
+	result, e := hashIndex.HIncrByFloat("testKey", "testField2", 0.25)
+	if e != nil || result != 1.75 {
+		t.Error(result, e)
+	}
+	_, e = hashIndex.HIncrByFloat("testKey", "testField3", 1)
+	if !errors.Is(e, logger.HashValueIsNotFloat) {
+		t.Error(e)
+	}
+	_, e = hashIndex.HIncrByFloat("testKey", "testField5", math.MaxFloat64)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// 很大的值使用科学计数法 不会展开成几百位
+	if value, e := hashIndex.HGet("testKey", "testField5"); e != nil || value != "1.7976931348623157e+308" {
+		t.Error(value, e)
+	}
+	_, e = hashIndex.HIncrByFloat("testKey", "testField5", math.MaxFloat64)
+	if !errors.Is(e, logger.IncrementIsNaNOrInf) {
+		t.Error(e)
+	}
+
+	fields, e = hashIndex.HRandField("testKey", 3)
+	if e != nil || len(fields) != 3 || string(fields[0].Field) == string(fields[1].Field) {
+		t.Error(len(fields), e)
+	}
+	fields, e = hashIndex.HRandField("testKey", -10)
+	if e != nil || len(fields) != 10 {
+		t.Error(len(fields), e)
+	}
+	_, e = hashIndex.HRandField("none", 1)
+	if !errors.Is(e, logger.KeyIsNotExisted) {
+		t.Error(e)
+	}
+
+	e = hashIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 65536, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	hashIndex, e = BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.TraditionalIOFile, folderPath, 65536, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = hashIndex.CloseIndex()
+	}()
+	// 自增之后的值和原来的过期时间都要保留下来
+	values, e = hashIndex.HMGet("testKey", "testField1", "none", "testField4")
+	if e != nil || string(values[0]) != "6" || string(values[1]) != "-3" || string(values[2]) != "11" {
+		t.Error(values, e)
+	}
+	if node := hashIndex.index["testKey"]["testField4"]; node == nil || node.expiredAt != expiredAt {
+		t.Error("expiredAt is changed")
+	}
+}
+
+func TestHashEmptyFieldReplay(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+	// 文件很小 前面写入的 entry 会从 hint 重放 后面写入的 entry 在活跃文件中
+	hashIndex, e := BuildHashIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	writeKeys := func(prefix string) {
+		// 空字符串 field 过期 删除 都不能影响同一个 hash 中的其它 field
+		for _, e = range []error{
+			hashIndex.HSet(prefix+"Expired", "keep", "testValue", -1),
+			hashIndex.HSet(prefix+"Expired", "", "testValue", time.Now().Add(50*time.Millisecond).UnixMilli()),
+			hashIndex.HSet(prefix+"Deleted", "keep", "testValue", -1),
+			hashIndex.HSet(prefix+"Deleted", "", "testValue", -1),
+			hashIndex.HDel(prefix+"Deleted", "", true),
+			hashIndex.HSet(prefix+"Whole", "testField", "testValue", -1),
+			hashIndex.HDel(prefix+"Whole", "", false),
+			// 旧版本删除整个 hash 时写入的 entry
+			hashIndex.HSet(prefix+"Legacy", "testField", "testValue", -1),
+		} {
+			if e != nil {
+				t.Fatal(e)
+			}
+		}
+		_, e = hashIndex.writeEntry(&storage.Entry{
+			EntryType: storage.TypeDelete,
+			Key:       util.EncodeKeyAndField(prefix+"Legacy", ""),
+			Value:     []byte{},
+		})
+		if e != nil {
+			t.Fatal(e)
+		}
+		time.Sleep(100 * time.Millisecond)
+		_, e = hashIndex.ExpireKey(prefix+"Expired", time.Now().UnixMilli())
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	writeKeys("hinted")
+	for i := 0; i < 20; i++ {
+		e = hashIndex.HSet("padding", strconv.Itoa(i), "testValue", -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	writeKeys("active")
+	e = hashIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	hashIndex, e = BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = hashIndex.CloseIndex()
+	}()
+	for _, prefix := range []string{"hinted", "active"} {
+		for _, key := range []string{prefix + "Expired", prefix + "Deleted"} {
+			if fields := hashIndex.index[key]; len(fields) != 1 || fields["keep"] == nil {
+				t.Error(key, len(fields))
+			}
+		}
+		for _, key := range []string{prefix + "Whole", prefix + "Legacy"} {
+			if _, ok := hashIndex.index[key]; ok {
+				t.Error(key, "is not deleted")
+			}
+		}
+	}
+}
@@ -0,0 +1,586 @@
+package index
+
+import (
+	"MisakaDB/customDataStructure/quickList"
+	"MisakaDB/logger"
+	"MisakaDB/storage"
+	"MisakaDB/util"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"time"
+)
+
+/*
+列表的持久化
+
+早先列表的 entry 是基于位置的 lset 记录的是下标 lrem 记录的是删除发生时的下标 过期记录的是元素的值
+
+重放时只要有一个 entry 和当时的列表对不上 比如说过期和别的操作的先后顺序乱了 或者某个 entry 没有写完整 之后的所有内容都会错位 而且不会报错
+
+所以现在每个元素在压入时分配一个 ID ID 在整个 ListIndex 中唯一 只增不减 元素被移动到别的列表时也保持不变
+
+写入文件的 entry 都通过 ID 引用元素 插入记录的是插在哪个元素之前 修剪记录的是保留范围两端的元素 弹出 删除和过期都是按 ID 移除元素
+
+这样重放的结果只取决于 entry 本身 引用的元素不存在 或者压入的元素已经存在时 说明这个 entry 已经不可能生效了 直接跳过 同一个 entry 重放多次也不会有影响
+
+merge 时按顺序重写每个元素 元素保留原来的 ID
+
+CheckList 按文件中的历史重新构建一个列表 和内存中的列表对比 检查历史中是否有引用了不存在的元素的 entry
+
+旧文件中基于位置的 entry 仍然按原来的方式重放 重放时按顺序为元素分配 ID 重放的顺序是固定的 所以每次启动分配到的 ID 都一样
+*/
+
+// listReplayer 按 entry 重放列表 BuildListIndex 和 CheckList 共用
+type listReplayer struct {
+	lists    map[string]*quickList.QuickList[*listNode]
+	nextID   uint64
+	elements map[uint64]string // 存活的元素的 ID 和它所在的列表 只在重放时使用
+
+	// emptyValues 值为空的元素的 ID 和写入这个值的 entry 的位置
+	// 从 hint 重放的压入 插入和修改 entry 没有元素的值 重放结束后按这里记录的位置把值读出来 见 loadHintedValues
+	emptyValues map[uint64]listValueLocation
+}
+
+// listValueLocation 元素的值所在的 entry 的位置 numbers 是值前面编码的数字的个数
+type listValueLocation struct {
+	fileID  uint32
+	offset  int64
+	numbers int
+}
+
+func newListReplayer() *listReplayer {
+	return &listReplayer{
+		lists:       make(map[string]*quickList.QuickList[*listNode]),
+		nextID:      1,
+		elements:    make(map[uint64]string),
+		emptyValues: make(map[uint64]listValueLocation),
+	}
+}
+
+// handleEntry 从文件中还原列表时 按 entry 对列表进行操作 跳过已经不可能生效的 entry
+func (lr *listReplayer) handleEntry(entry *storage.Entry, fileID uint32, offset int64) error {
+	e := lr.apply(entry, fileID, offset)
+	if errors.Is(e, logger.ElementIsNotExisted) || errors.Is(e, logger.ElementIsExisted) {
+		logger.GenerateErrorLog(false, false, e.Error(), "Skip List Entry", string(entry.Key), strconv.Itoa(int(fileID)), strconv.FormatInt(offset, 10))
+		return nil
+	}
+	return e
+}
+
+// apply 重放一个 entry 引用的元素不存在时返回 ElementIsNotExisted 压入已经存在的元素时返回 ElementIsExisted 这两种情况下不会修改列表
+func (lr *listReplayer) apply(entry *storage.Entry, fileID uint32, offset int64) error {
+	key := string(entry.Key)
+	switch entry.EntryType {
+	case storage.TypeDeleteKey: // merge 重写列表之前写入的 或者是删除整个列表
+		lr.deleteList(key)
+
+	case storage.TypeListPush: // 对应 lpush rpush 以及 merge
+		numbers, value, e := decodeListValue(entry.Value, 2)
+		if e != nil {
+			return e
+		}
+		whereTo, e := decodeListEnd(numbers[1])
+		if e != nil {
+			return e
+		}
+		if _, ok := lr.elements[numbers[0]]; ok {
+			return logger.ElementIsExisted
+		}
+		i := 0
+		if whereTo == ListRight {
+			i = lr.length(key)
+		}
+		lr.insert(key, i, lr.newNode(numbers[0], value, entry.ExpiredAt, fileID, offset))
+		lr.setValueLocation(numbers[0], value, fileID, offset, 2)
+
+	case storage.TypeListInsert: // 对应 linsert 插在 ID 为 numbers[1] 的元素之前 为0时插在尾部
+		numbers, value, e := decodeListValue(entry.Value, 2)
+		if e != nil {
+			return e
+		}
+		targetList, ok := lr.lists[key]
+		if !ok {
+			return logger.ElementIsNotExisted
+		}
+		i := targetList.Len()
+		if numbers[1] != 0 {
+			i = lr.find(key, numbers[1])
+			if i == -1 {
+				return logger.ElementIsNotExisted
+			}
+		}
+		if _, ok = lr.elements[numbers[0]]; ok {
+			return logger.ElementIsExisted
+		}
+		lr.insert(key, i, lr.newNode(numbers[0], value, entry.ExpiredAt, fileID, offset))
+		lr.setValueLocation(numbers[0], value, fileID, offset, 2)
+
+	case storage.TypeListSet: // 对应 lset
+		numbers, value, e := decodeListValue(entry.Value, 1)
+		if e != nil {
+			return e
+		}
+		i := lr.find(key, numbers[0])
+		if i == -1 {
+			return logger.ElementIsNotExisted
+		}
+		node := lr.lists[key].Get(i)
+		node.value = value
+		node.expiredAt = entry.ExpiredAt
+		node.fileID = fileID
+		node.offset = offset
+		lr.setValueLocation(numbers[0], value, fileID, offset, 1)
+
+	case storage.TypeListRemove: // 对应 lpop rpop lrem 和过期
+		numbers, _, e := decodeListValue(entry.Value, 1)
+		if e != nil {
+			return e
+		}
+		i := lr.find(key, numbers[0])
+		if i == -1 {
+			return logger.ElementIsNotExisted
+		}
+		lr.remove(key, i)
+
+	case storage.TypeListMove: // 对应 lmove 值是目标列表
+		numbers, destination, e := decodeListValue(entry.Value, 2)
+		if e != nil {
+			return e
+		}
+		whereTo, e := decodeListEnd(numbers[1])
+		if e != nil {
+			return e
+		}
+		i := lr.find(key, numbers[0])
+		if i == -1 {
+			return logger.ElementIsNotExisted
+		}
+		lr.move(key, i, string(destination), whereTo, fileID, offset)
+
+	case storage.TypeListTrim: // 对应 ltrim 保留 ID 为 numbers[0] 和 numbers[1] 的元素之间的部分
+		numbers, _, e := decodeListValue(entry.Value, 2)
+		if e != nil {
+			return e
+		}
+		start, stop := lr.find(key, numbers[0]), lr.find(key, numbers[1])
+		if start == -1 || stop == -1 {
+			return logger.ElementIsNotExisted
+		}
+		if start > stop {
+			return logger.ListEntryIsBroken
+		}
+		lr.trim(key, start, stop+1)
+
+	case storage.TypeExpire: // 对应 expire 只修改写入时还没有过期的元素
+		writtenAt, e := decodeExpireTime(entry.Value)
+		if e != nil {
+			return e
+		}
+		targetList, ok := lr.lists[key]
+		if !ok {
+			return logger.ElementIsNotExisted
+		}
+		targetList.ForEach(0, func(i int, node *listNode) bool {
+			if !isExpired(node.expiredAt, writtenAt) {
+				node.expiredAt = entry.ExpiredAt
+			}
+			return true
+		})
+
+	default:
+		return lr.applyPositional(entry, fileID, offset)
+	}
+	return nil
+}
+
+// applyPositional 重放旧文件中基于位置的 entry 新压入的元素按顺序分配 ID
+func (lr *listReplayer) applyPositional(entry *storage.Entry, fileID uint32, offset int64) error {
+	key := string(entry.Key)
+	targetList, ok := lr.lists[key]
+	if !ok {
+		if entry.EntryType != storage.TypeLPush {
+			return logger.KeyIsNotExisted
+		}
+		targetList = quickList.NewQuickList[*listNode]()
+	}
+
+	switch entry.EntryType {
+	case storage.TypeDelete: // 对应 lrem
+		// entry 里面的值是要删的元素的 index
+		removeIndex, e := strconv.Atoi(string(entry.Value))
+		if e != nil {
+			return e
+		}
+		if removeIndex < 0 || removeIndex >= targetList.Len() {
+			return logger.IndexIsIllegal
+		}
+		lr.remove(key, removeIndex)
+	case storage.TypeRecord: // 对应 lset
+		value, indexString, e := util.DecodeKeyAndField(entry.Value)
+		if e != nil {
+			return e
+		}
+		index, e := strconv.Atoi(indexString)
+		if e != nil {
+			return e
+		}
+		if index < 0 || index >= targetList.Len() {
+			return logger.IndexIsIllegal
+		}
+		node := targetList.Get(index)
+		node.value = []byte(value)
+		node.expiredAt = entry.ExpiredAt
+		node.offset = offset
+		node.fileID = fileID
+	case storage.TypeLInsert:
+		value, indexString, e := util.DecodeKeyAndField(entry.Value)
+		if e != nil {
+			return e
+		}
+		index, e := strconv.Atoi(indexString)
+		if e != nil {
+			return e
+		}
+		if index < 0 || index > targetList.Len() {
+			return logger.IndexIsIllegal
+		}
+		lr.insert(key, index, lr.newNode(lr.nextID, []byte(value), entry.ExpiredAt, fileID, offset))
+	case storage.TypeLPop:
+		lr.remove(key, 0)
+	case storage.TypeLPush:
+		lr.insert(key, 0, lr.newNode(lr.nextID, entry.Value, entry.ExpiredAt, fileID, offset))
+	case storage.TypeListExpired:
+		deleteIndex := -1
+		targetList.ForEach(0, func(i int, node *listNode) bool {
+			if util.BytesArrayCompare(node.value, entry.Value) {
+				deleteIndex = i
+				return false
+			}
+			return true
+		})
+		if deleteIndex != -1 {
+			lr.remove(key, deleteIndex)
+		}
+	}
+	return nil
+}
+
+// setValueLocation 记录值为空的元素的值是在哪里写入的 值不为空时清除之前的记录
+func (lr *listReplayer) setValueLocation(id uint64, value []byte, fileID uint32, offset int64, numbers int) {
+	if len(value) != 0 {
+		delete(lr.emptyValues, id)
+		return
+	}
+	lr.emptyValues[id] = listValueLocation{
+		fileID:  fileID,
+		offset:  offset,
+		numbers: numbers,
+	}
+}
+
+// loadHintedValues 重放结束后 为值是从 hint 重放出来的元素读取值 hintedFiles 是通过 hint 文件重放的文件
+//
+// 值本来就是空的元素也会被记录下来 但是只有记录的位置在 hintedFiles 中时才会读取 所以不会影响结果
+func (lr *listReplayer) loadHintedValues(archivedFile map[uint32]*storage.RecordFile, hintedFiles map[uint32]bool) error {
+	var e error
+	for _, targetList := range lr.lists {
+		targetList.ForEach(0, func(_ int, node *listNode) bool {
+			location, ok := lr.emptyValues[node.id]
+			if !ok || !hintedFiles[location.fileID] {
+				return true
+			}
+			recordFile, ok := archivedFile[location.fileID]
+			if !ok {
+				logger.GenerateErrorLog(false, false, logger.FileIsNotExist.Error(), strconv.Itoa(int(location.fileID)))
+				e = logger.FileIsNotExist
+				return false
+			}
+			var entry *storage.Entry
+			entry, _, e = recordFile.ReadIntoEntry(location.offset)
+			if e != nil {
+				return false
+			}
+			_, node.value, e = decodeListValue(entry.Value, location.numbers)
+			return e == nil
+		})
+		if e != nil {
+			return e
+		}
+	}
+	lr.emptyValues = make(map[uint64]listValueLocation)
+	return nil
+}
+
+// newNode 创建 ID 为 id 的节点 同时保证之后分配的 ID 比它大
+func (lr *listReplayer) newNode(id uint64, value []byte, expiredAt int64, fileID uint32, offset int64) *listNode {
+	if id >= lr.nextID {
+		lr.nextID = id + 1
+	}
+	return &listNode{
+		indexNode: indexNode{
+			value:     value,
+			fileID:    fileID,
+			offset:    offset,
+			expiredAt: expiredAt,
+		},
+		id: id,
+	}
+}
+
+// length 返回列表的长度 列表不存在时为0
+func (lr *listReplayer) length(key string) int {
+	targetList, ok := lr.lists[key]
+	if !ok {
+		return 0
+	}
+	return targetList.Len()
+}
+
+// find 返回列表中 ID 为 id 的元素的下标 不存在时返回-1
+func (lr *listReplayer) find(key string, id uint64) int {
+	if lr.elements[id] != key {
+		return -1
+	}
+	return findListElement(lr.lists[key], id)
+}
+
+// insert 把节点插入到列表的 i 处 列表不存在时创建列表
+func (lr *listReplayer) insert(key string, i int, node *listNode) {
+	targetList, ok := lr.lists[key]
+	if !ok {
+		targetList = quickList.NewQuickList[*listNode]()
+		lr.lists[key] = targetList
+	}
+	targetList.Insert(i, node)
+	lr.elements[node.id] = key
+}
+
+// remove 移除列表的 i 处的元素 列表为空之后删除列表
+func (lr *listReplayer) remove(key string, i int) {
+	targetList := lr.lists[key]
+	if i < 0 || i >= targetList.Len() {
+		return
+	}
+	delete(lr.elements, targetList.Remove(i).id)
+	if targetList.Len() == 0 {
+		delete(lr.lists, key)
+	}
+}
+
+// move 把 source 的 i 处的元素移到 destination 的 whereTo 一端
+func (lr *listReplayer) move(source string, i int, destination string, whereTo ListEnd, fileID uint32, offset int64) {
+	if i < 0 || i >= lr.length(source) {
+		return
+	}
+	movedNode := moveListElement(lr.lists, source, i, destination, whereTo, fileID, offset)
+	lr.elements[movedNode.id] = destination
+}
+
+// trim 只保留列表的 [start, stop) 范围内的元素 范围为空时删除整个列表
+func (lr *listReplayer) trim(key string, start, stop int) {
+	if start >= stop {
+		lr.deleteList(key)
+		return
+	}
+	targetList := lr.lists[key]
+	targetList.ForEach(0, func(i int, node *listNode) bool {
+		if i < start || i >= stop {
+			delete(lr.elements, node.id)
+		}
+		return true
+	})
+	targetList.Trim(start, stop)
+}
+
+// deleteList 删除整个列表
+func (lr *listReplayer) deleteList(key string) {
+	targetList, ok := lr.lists[key]
+	if !ok {
+		return
+	}
+	targetList.ForEach(0, func(_ int, node *listNode) bool {
+		delete(lr.elements, node.id)
+		return true
+	})
+	delete(lr.lists, key)
+}
+
+// findListElement 返回列表中 ID 为 id 的元素的下标 不存在时返回-1 弹出的一定是两端的元素 所以先检查两端
+func findListElement(targetList *quickList.QuickList[*listNode], id uint64) int {
+	if targetList == nil || targetList.Len() == 0 {
+		return -1
+	}
+	if targetList.Get(0).id == id {
+		return 0
+	}
+	if targetList.Get(targetList.Len()-1).id == id {
+		return targetList.Len() - 1
+	}
+	result := -1
+	targetList.ForEach(0, func(i int, node *listNode) bool {
+		if node.id == id {
+			result = i
+			return false
+		}
+		return true
+	})
+	return result
+}
+
+// moveListElement 把 source 的 i 处的元素移到 destination 的 whereTo 一端 返回移动后的节点 元素保留原来的 ID 但是不保留过期时间
+func moveListElement(lists map[string]*quickList.QuickList[*listNode], source string, i int, destination string, whereTo ListEnd, fileID uint32, offset int64) *listNode {
+	sourceList := lists[source]
+	movedNode := sourceList.Remove(i)
+	if sourceList.Len() == 0 {
+		delete(lists, source)
+	}
+
+	// 先更新 source 再取 destination 这样两者是同一个列表时也没问题
+	newNode := &listNode{
+		indexNode: indexNode{
+			value:     movedNode.value,
+			fileID:    fileID,
+			offset:    offset,
+			expiredAt: -1,
+		},
+		id: movedNode.id,
+	}
+	destinationList, ok := lists[destination]
+	if !ok {
+		destinationList = quickList.NewQuickList[*listNode]()
+		lists[destination] = destinationList
+	}
+	if whereTo == ListLeft {
+		destinationList.PushFront(newNode)
+	} else {
+		destinationList.PushBack(newNode)
+	}
+	return newNode
+}
+
+// encodeListValue 把元素 ID 等数字和值编码在一起 数字依次用 uvarint 编码 值放在最后
+func encodeListValue(value []byte, numbers ...uint64) []byte {
+	result := make([]byte, 0, len(numbers)*binary.MaxVarintLen64+len(value))
+	for _, v := range numbers {
+		result = binary.AppendUvarint(result, v)
+	}
+	return append(result, value...)
+}
+
+// listHintValue 返回 list 的 entry 需要写入 hint 的值 压入 插入和修改元素的 entry 只需要前面的数字 其它 entry 需要完整的值
+func listHintValue(entry *storage.Entry) []byte {
+	n := 0
+	switch entry.EntryType {
+	case storage.TypeListPush, storage.TypeListInsert:
+		n = 2
+	case storage.TypeListSet:
+		n = 1
+	default:
+		return entry.Value
+	}
+	numbers, _, e := decodeListValue(entry.Value, n)
+	if e != nil {
+		return entry.Value
+	}
+	return encodeListValue(nil, numbers...)
+}
+
+// decodeListValue 解析 encodeListValue 编码的 n 个数字和值
+func decodeListValue(input []byte, n int) ([]uint64, []byte, error) {
+	numbers := make([]uint64, n)
+	for i := 0; i < n; i++ {
+		number, length := binary.Uvarint(input)
+		if length <= 0 {
+			logger.GenerateErrorLog(false, false, logger.ListEntryIsBroken.Error(), util.TurnByteArrayToString(input))
+			return nil, nil, logger.ListEntryIsBroken
+		}
+		numbers[i] = number
+		input = input[length:]
+	}
+	return numbers, input, nil
+}
+
+// decodeListEnd 把 entry 中的数字转换为列表的一端
+func decodeListEnd(input uint64) (ListEnd, error) {
+	if ListEnd(input) != ListLeft && ListEnd(input) != ListRight {
+		return ListLeft, logger.ListEntryIsBroken
+	}
+	return ListEnd(input), nil
+}
+
+// CheckList 按文件中的历史重新构建列表 key 和内存中的列表对比 元素的 ID 和值都一致时返回 nil
+//
+// 历史中和 key 有关的 entry 引用了不存在的元素 或者重放的结果和内存中的列表不一致时 记录具体的位置并返回 ListHistoryIsBroken
+//
+// 已经过期的元素不参与对比 检查期间持有读锁 并且会读取列表的所有文件
+func (li *ListIndex) CheckList(key []byte) error {
+	li.mutex.RLock()
+	defer li.mutex.RUnlock()
+
+	replayer := newListReplayer()
+	for _, fileID := range storage.SortedFileIDs(li.archivedFile) {
+		recordFile := li.archivedFile[fileID]
+		length := recordFile.GetOffset()
+		if recordFile != li.activeFile {
+			var e error
+			length, e = recordFile.Length()
+			if e != nil {
+				return e
+			}
+		}
+		var offset int64
+		for offset < length {
+			entry, entryLength, e := recordFile.ReadIntoEntry(offset)
+			if e != nil {
+				return e
+			}
+			e = replayer.apply(entry, fileID, offset)
+			if e != nil && isListEntryOf(entry, key) {
+				logger.GenerateErrorLog(false, false, logger.ListHistoryIsBroken.Error(), e.Error(), string(key), strconv.Itoa(int(fileID)), strconv.FormatInt(offset, 10))
+				return logger.ListHistoryIsBroken
+			}
+			offset += entryLength
+		}
+	}
+
+	// 已经过期的元素在内存中可能还没有被删除 在历史中也可能没有过期 entry（过期发生在数据库关闭期间）
+	unix := time.Now().UnixMilli()
+	alive := func(targetList *quickList.QuickList[*listNode]) []*listNode {
+		var result []*listNode
+		if targetList == nil {
+			return result
+		}
+		targetList.ForEach(0, func(_ int, node *listNode) bool {
+			if node.expiredAt == -1 || node.expiredAt > unix {
+				result = append(result, node)
+			}
+			return true
+		})
+		return result
+	}
+	expected, actual := alive(replayer.lists[string(key)]), alive(li.index[string(key)])
+	if len(expected) != len(actual) {
+		logger.GenerateErrorLog(false, false, logger.ListHistoryIsBroken.Error(), string(key), "Length", strconv.Itoa(len(expected)), strconv.Itoa(len(actual)))
+		return logger.ListHistoryIsBroken
+	}
+	for i := range expected {
+		if expected[i].id != actual[i].id || !util.BytesArrayCompare(expected[i].value, actual[i].value) {
+			logger.GenerateErrorLog(false, false, logger.ListHistoryIsBroken.Error(), string(key), "Index", strconv.Itoa(i))
+			return logger.ListHistoryIsBroken
+		}
+	}
+	return nil
+}
+
+// isListEntryOf 检查 entry 是否会修改列表 key 包括把元素移入 key 的 entry
+func isListEntryOf(entry *storage.Entry, key []byte) bool {
+	if util.BytesArrayCompare(entry.Key, key) {
+		return true
+	}
+	if entry.EntryType != storage.TypeListMove {
+		return false
+	}
+	_, destination, e := decodeListValue(entry.Value, 2)
+	return e == nil && util.BytesArrayCompare(destination, key)
+}
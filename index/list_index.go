@@ -1,42 +1,37 @@
 package index
 
 import (
+	"MisakaDB/customDataStructure/quickList"
 	"MisakaDB/logger"
 	"MisakaDB/storage"
 	"MisakaDB/util"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
-	"strconv"
 	"sync"
 	"time"
 )
 
 /*
-为了解决每个元素的过期问题
+列表的每个元素都可以有自己的过期时间
 
-我在后台启动一个协程 该协程会监控一个 channel
+压入带有过期时间的元素时 把列表交给 ExpiryScheduler 到期之后由 ExpireKey 删除列表中所有过期的元素 同时为每个元素写入 TypeListRemove
 
-每次插入新值类的操作之后都启动一个协程 该协程等待过期时间后会向该 channel 发送是哪个 key 的哪个元素过期了
+还原列表之后还需要对所有的元素再遍历一次 因为有些过期是有可能发生在数据库关闭期间的 这些元素直接删除 因为过期前后都不会有新的写入
 
-后台的这个协程通过 channel 获取该信息后立即更新 index 同时向文件中写入过期的 entry
-
-这样在还原列表的时候我就能准确把握过期和别的操作的时间顺序
-
-除此之外 还原列表之后我还是需要对所有的元素再遍历一次 因为有些过期是有可能发生在数据库关闭期间的 而且就算是没过期 也需要使其加入上面的过期机制中
-
-这套方法的超时误差大概在2ms左右 而且还存在一个问题 就是 expiredChanMonitor 函数本身执行是需要时间的 如果有大量的元素在同一时间过期 同时还有读写请求的话
-
-势必会造成协程之间的抢锁 而为了避免饥饿现象 锁应该会分配给读写请求 所以做不到绝对的安全
+列表的读取不检查元素是否过期 所以过期的误差取决于 ExpiryScheduler 正常情况下在几毫秒以内 有大量元素同时过期时会受到过期时间预算的限制
 */
 
-type expiredInfo struct {
-	key         []byte
-	expiredNode *indexNode
+// listNode 列表中的元素 id 在整个 ListIndex 中唯一 不随元素的位置变化 entry 都通过 id 引用元素 见 list_history.go
+type listNode struct {
+	indexNode
+	id uint64
 }
 
 type ListIndex struct {
-	index        map[string][]*indexNode
+	index        map[string]*quickList.QuickList[*listNode] // 见 customDataStructure/quickList
+	nextID       uint64                                     // 下一个新元素的 ID 从1开始
 	mutex        sync.RWMutex
 	activeFile   *storage.RecordFile
 	archivedFile map[uint32]*storage.RecordFile
@@ -46,32 +41,28 @@ type ListIndex struct {
 	fileMaxSize    int64
 	syncDuration   time.Duration
 
-	expiredAtChan chan *expiredInfo
-	closeMonitor  chan int
+	expiry *ExpiryScheduler
 }
 
-// BuildListIndex 给定当前活跃文件和归档文件 重新构建List类型的索引 该方法只会在数据库启动时被调用 如果不存在旧的文件 则新建一个活跃文件
-func BuildListIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*storage.RecordFile, fileIOMode storage.FileIOType, baseFolderPath string, fileMaxSize int64, syncDuration time.Duration) (*ListIndex, error) {
+// BuildListIndex 给定当前活跃文件和归档文件 重新构建List类型的索引 该方法只会在数据库启动时被调用 如果不存在旧的文件 则新建一个活跃文件 isRepair 为 true 时遇到损坏的文件会截断而不是报错
+func BuildListIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*storage.RecordFile, fileIOMode storage.FileIOType, baseFolderPath string, fileMaxSize int64, syncDuration time.Duration, isRepair bool) (*ListIndex, error) {
 
 	result := &ListIndex{
-		index:          make(map[string][]*indexNode),
+		index:          make(map[string]*quickList.QuickList[*listNode]),
+		nextID:         1,
 		activeFile:     activeFile,
 		archivedFile:   archivedFile,
 		fileIOMode:     fileIOMode,
 		baseFolderPath: baseFolderPath,
 		fileMaxSize:    fileMaxSize,
 		syncDuration:   syncDuration,
-		expiredAtChan:  make(chan *expiredInfo, 1),
-		closeMonitor:   make(chan int, 1),
 	}
 
 	var (
 		e           error
-		offset      int64
-		fileLength  int64
-		entryLength int64
-		entry       *storage.Entry
+		hintedFiles map[uint32]bool
 	)
+	replayer := newListReplayer()
 
 	if activeFile == nil {
 		result.activeFile, e = storage.NewRecordFile(fileIOMode, storage.List, 1, result.baseFolderPath, result.fileMaxSize)
@@ -84,104 +75,80 @@ func BuildListIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*sto
 		goto ReadFileFished
 	}
 
-	for i := uint32(0); i < uint32(len(archivedFile)); i++ {
-		recordFile, ok := archivedFile[i]
-		if !ok {
-			continue
-		}
-		offset = 0
-		fileLength, e = recordFile.Length()
-		if e != nil {
-			return nil, e
-		}
-		for offset < fileLength {
-			entry, entryLength, e = recordFile.ReadIntoEntry(offset)
-			if e != nil {
-				return nil, e
-			}
-			e = result.handleEntry(entry, recordFile.GetFileID(), offset)
-			if e != nil {
-				return nil, e
-			}
-			offset += entryLength
-		}
+	hintedFiles, e = loadRecordFiles(result.activeFile, result.archivedFile, replayer.handleEntry, true, isRepair)
+	if e != nil {
+		return nil, e
+	}
+	e = replayer.loadHintedValues(result.archivedFile, hintedFiles)
+	if e != nil {
+		return nil, e
 	}
+	result.index, result.nextID = replayer.lists, replayer.nextID
 
 ReadFileFished:
 	result.refreshList()
 	result.activeFile.StartSyncRoutine(result.syncDuration)
-	go result.expiredChanMonitor()
 
 	return result, nil
 }
 
-// expiredChanMonitor 监控 channel 如果有过期消息发过来就处理 具体包括修改 index 向文件中写入过期 entry
-func (li *ListIndex) expiredChanMonitor() {
-	var expiredNode *expiredInfo
-	var e error
-	var i int
-	for {
-		select {
-		case expiredNode = <-li.expiredAtChan:
-			li.mutex.RLock()
-
-			key := string(expiredNode.key)
-
-			targetList, ok := li.index[key]
-			if !ok {
-				li.mutex.RUnlock()
-				continue
-			}
-
-			i = 0
-			for ; i < len(targetList); i++ {
-				if targetList[i] == expiredNode.expiredNode { // 指针比较总比字节数组循环快吧
-					// 找到过期值
-					break
-				}
-			}
-
-			li.mutex.RUnlock()
-			li.mutex.Lock()
-
-			// 写入文件
-			_, e = li.writeEntry(&storage.Entry{
-				Key:       expiredNode.key,
-				Value:     expiredNode.expiredNode.value,
-				EntryType: storage.TypeListExpired,
-				ExpiredAt: 0,
-			})
-			if e != nil {
-				logger.GenerateErrorLog(false, false, e.Error())
-				continue
-			}
-
-			// 正式开始删除
-			for ; i < len(targetList)-1; i++ {
-				targetList[i] = targetList[i+1]
-			}
-			// 写回去
-			li.index[key] = targetList[:len(targetList)-1]
+// SetExpiryScheduler 使用 es 进行主动过期 同时把有过期元素的列表交给 es
+func (li *ListIndex) SetExpiryScheduler(es *ExpiryScheduler) {
+	li.mutex.Lock()
+	defer li.mutex.Unlock()
 
-			li.mutex.Unlock()
-		case <-li.closeMonitor:
-			return
-		}
+	li.expiry = es
+	for key, targetList := range li.index {
+		next := int64(-1)
+		targetList.ForEach(0, func(_ int, node *listNode) bool {
+			next = earlierExpiredAt(next, node.expiredAt)
+			return true
+		})
+		es.schedule(li, key, next)
 	}
 }
 
-// delayExpiredMessage 延迟发送过期消息到 channel 中
+// ExpireKey 删除列表中所有在 now 之前过期的元素 同时为每个元素写入 TypeListRemove 返回剩下的元素中最早的过期时间
 //
-// 比如说列表里有1 2 3 4这几个元素 如果 index 指定为2过期 那么过期处理后列表是1 2 4
-func (li *ListIndex) delayExpiredMessage(key []byte, expiredNode *indexNode) {
-	time.Sleep(time.Until(time.UnixMilli(expiredNode.expiredAt)))
-	li.expiredAtChan <- &expiredInfo{
-		key:         key,
-		expiredNode: expiredNode,
+// 比如说列表里有1 2 3 4这几个元素 如果2过期 那么过期处理后列表是1 3 4
+func (li *ListIndex) ExpireKey(key string, now int64) (int64, error) {
+	li.mutex.Lock()
+	defer li.mutex.Unlock()
+
+	targetList, ok := li.index[key]
+	if !ok {
+		return -1, nil
+	}
+	var expiredIndex []int
+	next := int64(-1)
+	targetList.ForEach(0, func(i int, node *listNode) bool {
+		if isExpired(node.expiredAt, now) {
+			expiredIndex = append(expiredIndex, i)
+		} else {
+			next = earlierExpiredAt(next, node.expiredAt)
+		}
+		return true
+	})
+	// 前面每删一个 后面的 index 就要减1
+	for i, index := range expiredIndex {
+		_, e := li.writeEntry(&storage.Entry{
+			Key:       []byte(key),
+			Value:     encodeListValue(nil, targetList.Get(index-i).id),
+			EntryType: storage.TypeListRemove,
+			ExpiredAt: 0,
+		})
+		if e != nil {
+			return next, e
+		}
+		targetList.Remove(index - i)
 	}
+	if targetList.Len() == 0 {
+		delete(li.index, key)
+	}
+	return next, nil
 }
 
-// CloseIndex 关闭 List 索引 同时停止定时Sync 关闭文件 关闭内部 channel
+// CloseIndex 关闭 List 索引 同时停止定时Sync 关闭文件
 func (li *ListIndex) CloseIndex() (err error) {
 	defer func() {
 		if e := recover(); e != nil {
@@ -205,9 +172,6 @@ func (li *ListIndex) CloseIndex() (err error) {
 			return e
 		}
 	}
-	li.closeMonitor <- 1
-	close(li.closeMonitor)
-	close(li.expiredAtChan)
 	return nil
 }
 
@@ -217,6 +181,7 @@ func (li *ListIndex) writeEntry(entry *storage.Entry) (int64, error) {
 	e := li.activeFile.WriteEntryIntoFile(entry)
 	if errors.Is(e, logger.FileBytesIsMaxedOut) {
 		li.activeFile.StopSyncRoutine()
+		sealRecordFile(li.activeFile)
 		li.activeFile, e = storage.NewRecordFile(li.fileIOMode, storage.List, li.activeFile.GetFileID()+1, li.baseFolderPath, li.fileMaxSize)
 		if e != nil {
 			return 0, e
@@ -234,142 +199,112 @@ func (li *ListIndex) writeEntry(entry *storage.Entry) (int64, error) {
 	return offset, nil
 }
 
-// handleEntry 从文件中还原列表时 按 entry 对 index 进行操作
-func (li *ListIndex) handleEntry(entry *storage.Entry, fileID uint32, offset int64) error {
-	//li.mutex.Lock()
-	//defer li.mutex.Unlock()
-	// handleEntry 只会在初始化还原列表的时候被顺序调用 所以不用锁也没事
-
-	// 切片的自动扩容只会发生在 append 函数中
-
-	targetSlice, ok := li.index[string(entry.Key)]
-	if !ok && entry.EntryType != storage.TypeLPush {
-		return logger.KeyIsNotExisted
+// newNode 创建写入活跃文件 offset 处的新节点
+func (li *ListIndex) newNode(id uint64, value []byte, expiredAt int64, offset int64) *listNode {
+	return &listNode{
+		indexNode: indexNode{
+			value:     value,
+			fileID:    li.activeFile.GetFileID(),
+			offset:    offset,
+			expiredAt: expiredAt,
+		},
+		id: id,
 	}
+}
 
-	switch entry.EntryType {
-	case storage.TypeDelete: // 对应 lrem
-		// entry 里面的值是要删的元素的 index
-		removeIndex, e := strconv.Atoi(string(entry.Key))
-		if e != nil {
-			return e
-		}
-		targetSlice = append(targetSlice[:removeIndex], targetSlice[removeIndex+1:]...)
+// Merge 将内存中的列表整体重写到新文件中 并且删除旧文件 merge 期间持有写锁
+//
+// 每个列表都是先写入一个 TypeDeleteKey 再按从头到尾的顺序写入 TypeListPush 元素保留原来的 ID
+func (li *ListIndex) Merge() error {
+	li.mutex.Lock()
+	defer li.mutex.Unlock()
 
-	case storage.TypeRecord: // 对应 lset
-		// 需要解析 index
-		value, indexString, e := util.DecodeKeyAndField(entry.Value)
-		if e != nil {
-			return e
-		}
-		index, e := strconv.Atoi(indexString)
-		if e != nil {
-			return e
-		}
-		targetSlice[index].value = []byte(value)
-		targetSlice[index].expiredAt = entry.ExpiredAt
-		targetSlice[index].offset = offset
-		targetSlice[index].fileID = fileID
-		return nil
-	case storage.TypeLInsert:
-		// 需要解析 index
-		value, indexString, e := util.DecodeKeyAndField(entry.Value)
+	var relocations []relocation
+	mw := newMergeWriter(storage.List, li.fileIOMode, li.baseFolderPath, li.fileMaxSize, li.archivedFile)
+	for key, targetList := range li.index {
+		_, _, e := mw.writeEntry(&storage.Entry{
+			Key:       []byte(key),
+			Value:     nil,
+			EntryType: storage.TypeDeleteKey,
+			ExpiredAt: 0,
+		})
 		if e != nil {
+			mw.abort()
 			return e
 		}
-		index, e := strconv.Atoi(indexString)
+		// 即将过期的元素也要重写 它们之后还会由 ExpireKey 删除
+		targetList.ForEach(0, func(_ int, node *listNode) bool {
+			var fileID uint32
+			var offset int64
+			fileID, offset, e = mw.writeEntry(&storage.Entry{
+				Key:       []byte(key),
+				Value:     encodeListValue(node.value, node.id, uint64(ListRight)),
+				EntryType: storage.TypeListPush,
+				ExpiredAt: node.expiredAt,
+			})
+			if e != nil {
+				return false
+			}
+			relocations = append(relocations, relocation{
+				node:   &node.indexNode,
+				fileID: fileID,
+				offset: offset,
+			})
+			return true
+		})
 		if e != nil {
+			mw.abort()
 			return e
 		}
-		targetSlice = append(targetSlice, targetSlice[len(targetSlice)-1])
-		for i := len(targetSlice) - 2; i > index; i-- {
-			targetSlice[i] = targetSlice[i-1]
-		}
-		targetSlice[index] = &indexNode{
-			value:     []byte(value),
-			fileID:    fileID,
-			offset:    offset,
-			expiredAt: entry.ExpiredAt,
-		}
-	case storage.TypeLPop:
-		if len(targetSlice) == 1 || len(targetSlice) == 0 {
-			delete(li.index, string(entry.Key))
-			return nil
-		}
-		targetSlice = append(targetSlice[1:])
-		return nil
-	case storage.TypeLPush:
-		if targetSlice == nil {
-			targetSlice = []*indexNode{{
-				value:     entry.Value,
-				fileID:    fileID,
-				offset:    offset,
-				expiredAt: entry.ExpiredAt,
-			}}
-			li.index[string(entry.Key)] = targetSlice
-			return nil
-		}
-		targetSlice = append(targetSlice, targetSlice[len(targetSlice)-1])
-		for i := len(targetSlice) - 2; i > 0; i-- {
-			targetSlice[i] = targetSlice[i-1]
-		}
-		targetSlice[0] = &indexNode{
-			value:     entry.Value,
-			fileID:    fileID,
-			offset:    offset,
-			expiredAt: entry.ExpiredAt,
-		}
-	case storage.TypeListExpired:
-		deleteIndex := 0
-		for i := 0; i < len(targetSlice); i++ {
-			if util.BytesArrayCompare(targetSlice[i].value, entry.Value) {
-				deleteIndex = i
-				break
-			}
-		}
+	}
 
-		for ; deleteIndex < len(targetSlice)-1; deleteIndex++ {
-			targetSlice[deleteIndex] = targetSlice[deleteIndex+1]
-		}
-		targetSlice = append(targetSlice[:len(targetSlice)-1])
+	activeFile, archivedFile, e := mw.commit(li.activeFile, li.archivedFile, li.syncDuration, relocations)
+	if e != nil {
+		return e
 	}
-	li.index[string(entry.Key)] = targetSlice
+	li.activeFile = activeFile
+	li.archivedFile = archivedFile
 	return nil
 }
 
+// DeadBytesRatio 估算归档文件中已经失效的字节数所占的比例
+func (li *ListIndex) DeadBytesRatio() (float64, error) {
+	li.mutex.RLock()
+	defer li.mutex.RUnlock()
+
+	var liveSize int64
+	for key, targetList := range li.index {
+		targetList.ForEach(0, func(_ int, node *listNode) bool {
+			if node.fileID != li.activeFile.GetFileID() {
+				// 值的前面还有元素 ID 等数字 按最长的情况估算
+				liveSize += storage.EntrySize(len(key), len(node.value)+2*binary.MaxVarintLen64, node.expiredAt)
+			}
+			return true
+		})
+	}
+	return deadBytesRatio(li.activeFile, li.archivedFile, liveSize)
+}
+
 // refreshListRange 重整 list 对 index 中的每个 list 的全部元素进行遍历 检查是否过期 如果过期就删除
 //
 // 该函数只会被从文件中还原列表之后调用
 func (li *ListIndex) refreshList() {
 	// 该函数的作用是 遍历 index 里面的元素 检查是否过期
 	// 如果过期就删除 这个函数要处理的是有过期 但是没有过期 entry 的元素 也就是该元素的过期时间是在数据库关闭期间发生的 这个可以直接删 因为过期前后都不会有新的写入
-	// 如果有设置过期 但是还没到时间 就发消息到 channel 里面
-	var targetSlice []*indexNode
-	var i int
-	var unix int64
-	for key := range li.index {
-		targetSlice = li.index[key]
-		i = 0
-		for i < len(targetSlice) {
-			if targetSlice[i].expiredAt == -1 {
-				i += 1
-				continue
+	// 没过期的元素在 SetExpiryScheduler 时交给 ExpiryScheduler
+	unix := time.Now().UnixMilli()
+	for key, targetList := range li.index {
+		i := 0
+		for i < targetList.Len() {
+			if isExpired(targetList.Get(i).expiredAt, unix) {
+				targetList.Remove(i)
 			} else {
-				unix = time.Now().UnixMilli()
-				if targetSlice[i].expiredAt <= unix {
-					// 过期 直接删除
-					for j := i; j < len(targetSlice)-1; j++ {
-						targetSlice[j] = targetSlice[j+1]
-					}
-					targetSlice = append(targetSlice[:len(targetSlice)-1])
-				} else {
-					// 没过期
-					li.delayExpiredMessage([]byte(key), targetSlice[i])
-					i += 1
-				}
+				i += 1
 			}
 		}
-		li.index[key] = targetSlice
+		if targetList.Len() == 0 {
+			delete(li.index, key)
+		}
 	}
 }
 
@@ -377,48 +312,40 @@ func (li *ListIndex) refreshList() {
 //
 // 比如说列表里有1 2 3 4这几个元素 如果 index 指定为2插入一个10 那么插入后列表是1 2 10 3 4
 func (li *ListIndex) LInsert(key []byte, index int, value []byte, expiredAt int64) error {
-	li.mutex.RLock()
+	li.mutex.Lock()
+	defer li.mutex.Unlock()
 
-	targetSlice, ok := li.index[string(key)]
+	targetList, ok := li.index[string(key)]
 	if !ok {
-		li.mutex.RUnlock()
 		return logger.KeyIsNotExisted
 	}
-	if index > len(targetSlice) {
-		li.mutex.RUnlock()
+	if index < 0 || index > targetList.Len() {
 		return logger.IndexIsIllegal
 	}
 
-	li.mutex.RUnlock()
-	li.mutex.Lock()
-	defer li.mutex.Unlock()
-
+	// 记录插在哪个元素之前 插在尾部时为0
+	var beforeID uint64
+	if index < targetList.Len() {
+		beforeID = targetList.Get(index).id
+	}
+	id := li.nextID
 	newEntry := &storage.Entry{
 		Key:       key,
-		Value:     util.EncodeKeyAndField(string(value), strconv.Itoa(index)),
-		EntryType: storage.TypeLInsert,
+		Value:     encodeListValue(value, id, beforeID),
+		EntryType: storage.TypeListInsert,
 		ExpiredAt: expiredAt,
 	}
 	offset, e := li.writeEntry(newEntry)
 	if e != nil {
 		return e
 	}
-	targetSlice = append(targetSlice, targetSlice[len(targetSlice)-1])
-	for i := len(targetSlice) - 2; i >= index; i-- {
-		targetSlice[i+1] = targetSlice[i]
-	}
-	targetSlice[index] = &indexNode{
-		value:     value,
-		fileID:    li.activeFile.GetFileID(),
-		offset:    offset,
-		expiredAt: expiredAt,
-	}
-
-	li.index[string(key)] = targetSlice
+	li.nextID += 1
+	newNode := li.newNode(id, value, expiredAt, offset)
+	targetList.Insert(index, newNode)
 
 	if expiredAt != -1 {
 		// 有实际的过期时间
-		go li.delayExpiredMessage(key, targetSlice[index])
+		li.expiry.schedule(li, string(key), expiredAt)
 	}
 
 	return nil
@@ -430,129 +357,255 @@ func (li *ListIndex) LInsert(key []byte, index int, value []byte, expiredAt int6
 //
 // 此外 该函数也承担删除整个列表的操作 只要列表中只有一个元素或者没有元素 该函数都会从 index 中移除列表
 func (li *ListIndex) LPop(key []byte) ([]byte, error) {
-	li.mutex.RLock()
+	return li.pop(key, ListLeft)
+}
 
-	targetSlice, ok := li.index[string(key)]
-	if !ok {
-		li.mutex.RUnlock()
-		return nil, logger.KeyIsNotExisted
-	}
+// LPush 压入操作 特别说明是从 list 的首部压入元素
+//
+// 比如说列表里有1 2 3 4这几个元素 压入10列表是10 1 2 3 4
+//
+// # LPush 的多个元素一起 push 的操作是在该函数的上一层反复调用该函数实现的
+//
+// 该函数也承担创建一个列表的操作 如果列表不存在 就创建一个列表
+func (li *ListIndex) LPush(key []byte, expiredAt int64, value []byte) error {
+	return li.push(key, expiredAt, value, ListLeft)
+}
+
+// ListEnd 列表的一端 阻塞弹出和移动元素时用来指定从哪一端操作
+type ListEnd int8
+
+const (
+	ListLeft ListEnd = iota
+	ListRight
+)
+
+// RPop 弹出操作 从 list 的尾部弹出元素
+//
+// 比如说列表里有1 2 3 4这几个元素 弹出后列表是1 2 3
+//
+// 和 LPop 一样 列表中的最后一个元素被弹出之后 会从 index 中移除列表
+func (li *ListIndex) RPop(key []byte) ([]byte, error) {
+	return li.pop(key, ListRight)
+}
+
+// RPush 压入操作 从 list 的尾部压入元素
+//
+// 比如说列表里有1 2 3 4这几个元素 压入10列表是1 2 3 4 10
+//
+// 和 LPush 一样 如果列表不存在 就创建一个列表
+func (li *ListIndex) RPush(key []byte, expiredAt int64, value []byte) error {
+	return li.push(key, expiredAt, value, ListRight)
+}
 
-	li.mutex.RUnlock()
+// pop 从 whereFrom 一端弹出元素 LPop 和 RPop 共用
+func (li *ListIndex) pop(key []byte, whereFrom ListEnd) ([]byte, error) {
 	li.mutex.Lock()
 	defer li.mutex.Unlock()
 
-	newEntry := &storage.Entry{
+	targetList, ok := li.index[string(key)]
+	if !ok {
+		return nil, logger.KeyIsNotExisted
+	}
+
+	i := 0
+	if whereFrom == ListRight {
+		i = targetList.Len() - 1
+	}
+	node := targetList.Get(i)
+	_, e := li.writeEntry(&storage.Entry{
 		Key:       key,
-		Value:     nil,
-		EntryType: storage.TypeLPop,
+		Value:     encodeListValue(nil, node.id),
+		EntryType: storage.TypeListRemove,
 		ExpiredAt: 0,
-	}
-	_, e := li.writeEntry(newEntry)
+	})
 	if e != nil {
 		return nil, e
 	}
-	if len(targetSlice) == 0 {
-		delete(li.index, string(key))
-		return nil, nil
-	} else {
-		result := targetSlice[0].value
-		targetSlice[0] = nil
-		if len(targetSlice) == 1 {
-			delete(li.index, string(key))
-			return result, nil
-		}
-		for i := 1; i < len(targetSlice); i++ {
-			targetSlice[i-1] = targetSlice[i]
-		}
 
-		targetSlice = append(targetSlice[:len(targetSlice)-1])
-		li.index[string(key)] = targetSlice
-		return result, nil
+	targetList.Remove(i)
+	if targetList.Len() == 0 {
+		delete(li.index, string(key))
 	}
+	return node.value, nil
 }
 
-// LPush 压入操作 特别说明是从 list 的首部压入元素
-//
-// 比如说列表里有1 2 3 4这几个元素 压入10列表是10 1 2 3 4
-//
-// # LPush 的多个元素一起 push 的操作是在该函数的上一层反复调用该函数实现的
-//
-// 该函数也承担创建一个列表的操作 如果列表不存在 就创建一个列表
-func (li *ListIndex) LPush(key []byte, expiredAt int64, value []byte) error {
+// push 向 whereTo 一端压入元素 列表不存在时创建列表 LPush 和 RPush 共用
+func (li *ListIndex) push(key []byte, expiredAt int64, value []byte, whereTo ListEnd) error {
 	li.mutex.Lock()
 	defer li.mutex.Unlock()
 
-	var e error
-	var offset int64
-	offset, e = li.writeEntry(&storage.Entry{
+	id := li.nextID
+	offset, e := li.writeEntry(&storage.Entry{
 		Key:       key,
-		Value:     value,
-		EntryType: storage.TypeLPush,
+		Value:     encodeListValue(value, id, uint64(whereTo)),
+		EntryType: storage.TypeListPush,
 		ExpiredAt: expiredAt,
 	})
 	if e != nil {
 		return e
 	}
+	li.nextID += 1
 
-	targetSlice, ok := li.index[string(key)]
+	targetList, ok := li.index[string(key)]
 	if !ok {
-		targetSlice = []*indexNode{{
-			value:     value,
-			fileID:    li.activeFile.GetFileID(),
-			offset:    offset,
-			expiredAt: expiredAt,
-		}}
+		targetList = quickList.NewQuickList[*listNode]()
+		li.index[string(key)] = targetList
+	}
+	newNode := li.newNode(id, value, expiredAt, offset)
+	if whereTo == ListLeft {
+		targetList.PushFront(newNode)
 	} else {
-		// 把后面的元素挪一挪
-		targetSlice = append(targetSlice, targetSlice[len(targetSlice)-1])
-		for i := len(targetSlice) - 2; i > 0; i-- {
-			targetSlice[i+1] = targetSlice[i]
-		}
-		// 然后再 push
-		targetSlice[0] = &indexNode{
-			value:     value,
-			fileID:    li.activeFile.GetFileID(),
-			offset:    offset,
-			expiredAt: expiredAt,
-		}
+		targetList.PushBack(newNode)
 	}
-	li.index[string(key)] = targetSlice
 	if expiredAt != -1 {
 		// 有实际的过期时间
-		go li.delayExpiredMessage(key, targetSlice[0])
+		li.expiry.schedule(li, string(key), expiredAt)
 	}
 	return nil
 }
 
+// LMove 从 source 的 whereFrom 一端弹出元素 压入 destination 的 whereTo 一端 返回被移动的元素 source 和 destination 可以是同一个列表
+//
+// 比如说 source 是1 2 3 destination 是4 5 从 source 的尾部移到 destination 的头部之后 source 是1 2 destination 是3 4 5
+//
+// 只写入一个 TypeListMove entry 被移动的元素保留原来的 ID 但是不保留原来的过期时间
+func (li *ListIndex) LMove(source, destination []byte, whereFrom, whereTo ListEnd) ([]byte, error) {
+	li.mutex.Lock()
+	defer li.mutex.Unlock()
+
+	sourceList, ok := li.index[string(source)]
+	if !ok {
+		return nil, logger.KeyIsNotExisted
+	}
+	i := 0
+	if whereFrom == ListRight {
+		i = sourceList.Len() - 1
+	}
+
+	offset, e := li.writeEntry(&storage.Entry{
+		Key:       source,
+		Value:     encodeListValue(destination, sourceList.Get(i).id, uint64(whereTo)),
+		EntryType: storage.TypeListMove,
+		ExpiredAt: 0,
+	})
+	if e != nil {
+		return nil, e
+	}
+	return moveListElement(li.index, string(source), i, string(destination), whereTo, li.activeFile.GetFileID(), offset).value, nil
+}
+
+// LTrim 只保留 [start, stop] 范围内的元素 start 和 stop 的规则同 redis 可以是负数 范围为空时删除整个列表
+//
+// 比如说列表里有1 2 3 4这几个元素 start 为1 stop 为-2 修剪后列表是2 3
+//
+// 写入文件的是保留范围两端的元素的 ID 范围为空时和 Del 一样写入 TypeDeleteKey
+func (li *ListIndex) LTrim(key []byte, start, stop int) error {
+	li.mutex.Lock()
+	defer li.mutex.Unlock()
+
+	targetList, ok := li.index[string(key)]
+	if !ok {
+		return logger.KeyIsNotExisted
+	}
+	start, stop, ok = rankRange(start, stop, targetList.Len())
+	if !ok {
+		start, stop = 0, 0
+	} else {
+		stop += 1
+	}
+	if start == 0 && stop == targetList.Len() {
+		// 没有元素需要删除
+		return nil
+	}
+
+	newEntry := &storage.Entry{
+		Key:       key,
+		Value:     []byte{},
+		EntryType: storage.TypeDeleteKey,
+		ExpiredAt: 0,
+	}
+	if start < stop {
+		newEntry.Value = encodeListValue(nil, targetList.Get(start).id, targetList.Get(stop-1).id)
+		newEntry.EntryType = storage.TypeListTrim
+	}
+	_, e := li.writeEntry(newEntry)
+	if e != nil {
+		return e
+	}
+	if start >= stop {
+		delete(li.index, string(key))
+		return nil
+	}
+	targetList.Trim(start, stop)
+	return nil
+}
+
+// LPos 返回列表中等于 element 的元素的下标 规则同 redis
+//
+// rank 指定从第几个匹配的元素开始返回 为负数时从尾部开始向前搜索 不能为0
+//
+// count 指定最多返回几个下标 为0时返回所有匹配的下标 maxLen 指定最多比较几个元素 为0时不限制
+func (li *ListIndex) LPos(key []byte, element []byte, rank, count, maxLen int) ([]int, error) {
+	li.mutex.RLock()
+	defer li.mutex.RUnlock()
+
+	if rank == 0 || count < 0 || maxLen < 0 {
+		return nil, logger.ParameterIsNotAllowed
+	}
+	targetList, ok := li.index[string(key)]
+	if !ok {
+		return nil, logger.KeyIsNotExisted
+	}
+
+	result := make([]int, 0)
+	compared := 0
+	handle := func(i int, node *listNode) bool {
+		if maxLen != 0 && compared == maxLen {
+			return false
+		}
+		compared += 1
+		if !util.BytesArrayCompare(node.value, element) {
+			return true
+		}
+		if rank > 1 {
+			rank -= 1
+			return true
+		}
+		result = append(result, i)
+		return count == 0 || len(result) < count
+	}
+	if rank > 0 {
+		targetList.ForEach(0, handle)
+	} else {
+		rank = -rank
+		targetList.ForEachReverse(targetList.Len()-1, handle)
+	}
+	return result, nil
+}
+
 // LSet 修改操作
 //
 // 比如说列表里有1 2 3 4这几个元素 设置 index 为2的元素为10 修改列表是1 2 10 4
 //
 // 不支持修改过期时间
 func (li *ListIndex) LSet(key []byte, index int, value []byte) error {
-	li.mutex.RLock()
+	li.mutex.Lock()
+	defer li.mutex.Unlock()
 
-	targetSlice, ok := li.index[string(key)]
+	targetList, ok := li.index[string(key)]
 	if !ok {
-		li.mutex.RUnlock()
 		return logger.KeyIsNotExisted
 	}
-	if index >= len(targetSlice) {
-		li.mutex.RUnlock()
+	if index < 0 || index >= targetList.Len() {
 		return logger.IndexIsIllegal
 	}
 
-	li.mutex.RUnlock()
-	li.mutex.Lock()
-	defer li.mutex.Unlock()
-
-	setIndexNode := targetSlice[index]
+	setIndexNode := targetList.Get(index)
 
 	offset, e := li.writeEntry(&storage.Entry{
 		Key:       key,
-		Value:     util.EncodeKeyAndField(string(value), strconv.Itoa(index)),
-		EntryType: storage.TypeRecord,
+		Value:     encodeListValue(value, setIndexNode.id),
+		EntryType: storage.TypeListSet,
 		ExpiredAt: setIndexNode.expiredAt,
 	})
 	if e != nil {
@@ -572,78 +625,58 @@ func (li *ListIndex) LSet(key []byte, index int, value []byte) error {
 // 被删除的元素的 value 必须和传入的 value 一致
 //
 // 当 count != 0 时 如果被删除的元素个数不满足 count 就会返回 RemoveCountIsNotEnough 错误 返回该错误时 并不会影响索引中存储的值
-//
-// 注意 返回的 error 可能是多重错误 既有 RemoveCountIsNotEnough 也有文件写入错误
 func (li *ListIndex) LRem(key []byte, count int, value []byte) error {
-	li.mutex.RLock()
+	li.mutex.Lock()
+	defer li.mutex.Unlock()
 
-	targetSlice, ok := li.index[string(key)]
+	targetList, ok := li.index[string(key)]
 	if !ok {
-		li.mutex.RUnlock()
 		return logger.KeyIsNotExisted
 	}
-	li.mutex.RUnlock()
-	li.mutex.Lock()
-	defer li.mutex.Unlock()
 
-	removeIndexNode := make([]int, count)
-	if count >= 0 {
-		// 从头开始搜索
-		i := 0
-		for i < len(targetSlice) {
-			if util.BytesArrayCompare(targetSlice[i].value, value) {
-				removeIndexNode = append(removeIndexNode, i)
-				targetSlice = append(targetSlice[:i], targetSlice[i+1:]...) // 删除
-
-				// 检查 count
-				if len(removeIndexNode) == count && count > 0 {
-					break
-				}
-			} else {
-				i += 1
-			}
+	// 先找出所有要删的元素的 index 够数了再删
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	var removeIndex []int
+	handle := func(i int, node *listNode) bool {
+		if util.BytesArrayCompare(node.value, value) {
+			removeIndex = append(removeIndex, i)
 		}
+		return limit == 0 || len(removeIndex) < limit
+	}
+	if count >= 0 {
+		targetList.ForEach(0, handle)
 	} else {
-		// 从尾开始搜索
-		i := len(targetSlice) - 1
-		for i >= 0 {
-			if util.BytesArrayCompare(targetSlice[i].value, value) {
-				removeIndexNode = append(removeIndexNode, i)
-				targetSlice = append(targetSlice[:i], targetSlice[i+1:]...) // 删除
-
-				// 检查 count
-				if len(removeIndexNode) == -count {
-					break
-				}
-			} else {
-				i -= 1
-			}
-		}
+		targetList.ForEachReverse(targetList.Len()-1, handle)
 	}
-	var e error
-	if count != 0 && (len(removeIndexNode) != -count || len(removeIndexNode) != count) {
+	if count != 0 && len(removeIndex) != limit {
 		// 没删够
 		return logger.RemoveCountIsNotEnough
 	}
 
-	li.index[string(key)] = targetSlice
-
-	// 每次存的都是相对于那次删除发生时的 index
-	// 假设列表是 1 2 2 4 我要删的是 count = 2 value = 2
-	// 那么写入文件的就是两次删除时的 index 即两个1
-	// removeIndexNode 里面的顺序即为删除发生的顺序
-	for i := 0; i < len(removeIndexNode); i++ {
-		_, e = li.writeEntry(&storage.Entry{
+	// 写入文件的是元素的 ID 但是删除时还是按 index 删
+	// 从头开始删时 前面每删一个 后面的 index 就要减1 从尾开始删时 index 不受影响
+	for i := 0; i < len(removeIndex); i++ {
+		if count >= 0 {
+			removeIndex[i] -= i
+		}
+		_, e := li.writeEntry(&storage.Entry{
 			Key:       key,
-			Value:     []byte(strconv.Itoa(removeIndexNode[i])),
-			EntryType: storage.TypeDelete,
+			Value:     encodeListValue(nil, targetList.Get(removeIndex[i]).id),
+			EntryType: storage.TypeListRemove,
 			ExpiredAt: 0,
 		})
 		if e != nil {
-			errors.Join(e)
+			return e
 		}
+		targetList.Remove(removeIndex[i])
 	}
-	return e
+	if targetList.Len() == 0 {
+		delete(li.index, string(key))
+	}
+	return nil
 }
 
 // LIndex 按 index 进行查询操作
@@ -653,14 +686,55 @@ func (li *ListIndex) LIndex(key []byte, index int) (value []byte, err error) {
 	li.mutex.RLock()
 	defer li.mutex.RUnlock()
 
-	targetSlice, ok := li.index[string(key)]
+	targetList, ok := li.index[string(key)]
 	if !ok {
 		return nil, logger.KeyIsNotExisted
 	}
-	if index >= len(targetSlice) {
+	if index < 0 || index >= targetList.Len() {
 		return nil, logger.IndexIsIllegal
 	}
-	return targetSlice[index].value, nil
+	return targetList.Get(index).value, nil
+}
+
+// Del 删除整个列表
+func (li *ListIndex) Del(key []byte) error {
+	li.mutex.Lock()
+	defer li.mutex.Unlock()
+
+	_, ok := li.index[string(key)]
+	if !ok {
+		return logger.KeyIsNotExisted
+	}
+	_, e := li.writeEntry(&storage.Entry{
+		Key:       key,
+		Value:     []byte{},
+		EntryType: storage.TypeDeleteKey,
+		ExpiredAt: 0,
+	})
+	if e != nil {
+		return e
+	}
+	delete(li.index, string(key))
+	return nil
+}
+
+// Exist 检查列表是否存在
+func (li *ListIndex) Exist(key []byte) bool {
+	li.mutex.RLock()
+	defer li.mutex.RUnlock()
+
+	targetList, ok := li.index[string(key)]
+	return ok && targetList.Len() != 0
+}
+
+// ScanKeys 返回以 prefix 开头 位置不小于 cursor 的列表中 ScanPage 需要的部分 见 scan.go
+func (li *ListIndex) ScanKeys(prefix []byte, cursor uint64, count int) []string {
+	li.mutex.RLock()
+	defer li.mutex.RUnlock()
+
+	return mapScan(li.index, prefix, cursor, count, func(_ string, targetList *quickList.QuickList[*listNode]) bool {
+		return targetList.Len() != 0
+	})
 }
 
 // LLen 查询列表长度
@@ -668,11 +742,11 @@ func (li *ListIndex) LLen(key []byte) (int, error) {
 	li.mutex.RLock()
 	defer li.mutex.RUnlock()
 
-	targetSlice, ok := li.index[string(key)]
+	targetList, ok := li.index[string(key)]
 	if !ok {
 		return 0, logger.KeyIsNotExisted
 	}
-	return len(targetSlice), nil
+	return targetList.Len(), nil
 }
 
 // LRange 按范围查询列表内的元素 查询范围是 [start, end)
@@ -682,16 +756,74 @@ func (li *ListIndex) LRange(key []byte, start, end int) ([][]byte, error) {
 	li.mutex.RLock()
 	defer li.mutex.RUnlock()
 
-	targetSlice, ok := li.index[string(key)]
+	targetList, ok := li.index[string(key)]
 	if !ok {
 		return nil, logger.KeyIsNotExisted
 	}
-	if end > len(targetSlice) {
+	if start < 0 || start > end || end > targetList.Len() {
 		return nil, logger.IndexIsIllegal
 	}
-	result := make([][]byte, end-start)
-	for i := 0; i < end-start; i++ {
-		result[i] = targetSlice[start+i].value
+	result := make([][]byte, 0, end-start)
+	for _, node := range targetList.Range(start, end) {
+		result = append(result, node.value)
+	}
+	return result, nil
+}
+
+// Expire 修改列表中所有元素的过期时间 expiredAt 为-1时去掉过期时间
+func (li *ListIndex) Expire(key []byte, expiredAt int64) error {
+	li.mutex.Lock()
+	defer li.mutex.Unlock()
+
+	now := time.Now().UnixMilli()
+	nodes := li.aliveNodes(key, now)
+	if len(nodes) == 0 {
+		return logger.KeyIsNotExisted
+	}
+	_, e := li.writeEntry(&storage.Entry{
+		EntryType: storage.TypeExpire,
+		Key:       key,
+		Value:     encodeExpireTime(now),
+		ExpiredAt: expiredAt,
+	})
+	if e != nil {
+		return e
+	}
+	for _, node := range nodes {
+		node.expiredAt = expiredAt
+	}
+	li.expiry.schedule(li, string(key), expiredAt)
+	return nil
+}
+
+// TTL 返回列表的过期时间 即最后一个过期的元素的过期时间 -1 表示永不过期
+func (li *ListIndex) TTL(key []byte) (int64, error) {
+	li.mutex.RLock()
+	defer li.mutex.RUnlock()
+
+	nodes := li.aliveNodes(key, time.Now().UnixMilli())
+	if len(nodes) == 0 {
+		return 0, logger.KeyIsNotExisted
+	}
+	result := nodes[0].expiredAt
+	for _, node := range nodes[1:] {
+		result = laterExpiredAt(result, node.expiredAt)
 	}
 	return result, nil
 }
+
+// aliveNodes 返回列表中在 now 还没有过期的元素 调用者需要持有锁
+func (li *ListIndex) aliveNodes(key []byte, now int64) []*listNode {
+	targetList, ok := li.index[string(key)]
+	if !ok {
+		return nil
+	}
+	var result []*listNode
+	targetList.ForEach(0, func(i int, node *listNode) bool {
+		if !isExpired(node.expiredAt, now) {
+			result = append(result, node)
+		}
+		return true
+	})
+	return result
+}
@@ -1,7 +1,10 @@
 package index
 
 import (
+	"MisakaDB/logger"
 	"MisakaDB/storage"
+	"MisakaDB/util"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -17,7 +20,7 @@ func TestTime(t *testing.T) {
 }
 
 func TestListIndex(t *testing.T) {
-	listIndex, e := BuildListIndex(nil, nil, storage.TraditionalIOFile, "D:\\", 65536, time.Second)
+	listIndex, e := BuildListIndex(nil, nil, storage.TraditionalIOFile, "D:\\", 65536, time.Second, false)
 	if e != nil {
 		t.Error(e)
 		return
@@ -37,3 +40,284 @@ func TestListIndex(t *testing.T) {
 	t.Log(value)
 	t.Log(value == nil)
 }
+
+func TestListIndexRightAndMove(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	listIndex, e := BuildListIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// testList 为 a b c a d a
+	for _, v := range []string{"a", "b", "c", "a", "d", "a"} {
+		e = listIndex.RPush([]byte("testList"), -1, []byte(v))
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	positions, e := listIndex.LPos([]byte("testList"), []byte("a"), 1, 0, 0)
+	if e != nil || len(positions) != 3 || positions[0] != 0 || positions[1] != 3 || positions[2] != 5 {
+		t.Error(positions, e)
+	}
+	positions, e = listIndex.LPos([]byte("testList"), []byte("a"), -2, 1, 0)
+	if e != nil || len(positions) != 1 || positions[0] != 3 {
+		t.Error(positions, e)
+	}
+	positions, e = listIndex.LPos([]byte("testList"), []byte("d"), 1, 1, 3)
+	if e != nil || len(positions) != 0 {
+		t.Error(positions, e)
+	}
+
+	// testList 为 b c a d testTarget 为 a
+	value, e := listIndex.RPop([]byte("testList"))
+	if e != nil || string(value) != "a" {
+		t.Error(string(value), e)
+	}
+	value, e = listIndex.LMove([]byte("testList"), []byte("testTarget"), ListLeft, ListRight)
+	if e != nil || string(value) != "a" {
+		t.Error(string(value), e)
+	}
+	// 同一个列表的移动就是旋转 testList 为 d b c a
+	value, e = listIndex.LMove([]byte("testList"), []byte("testList"), ListRight, ListLeft)
+	if e != nil || string(value) != "d" {
+		t.Error(string(value), e)
+	}
+	_, e = listIndex.LMove([]byte("none"), []byte("testTarget"), ListLeft, ListLeft)
+	if !errors.Is(e, logger.KeyIsNotExisted) {
+		t.Error(e)
+	}
+	// testList 为 b c
+	e = listIndex.LTrim([]byte("testList"), 1, -2)
+	if e != nil {
+		t.Fatal(e)
+	}
+	check := func() {
+		result, e := listIndex.LRange([]byte("testList"), 0, 2)
+		if e != nil || len(result) != 2 || string(result[0]) != "b" || string(result[1]) != "c" {
+			t.Error(result, e)
+		}
+		result, e = listIndex.LRange([]byte("testTarget"), 0, 1)
+		if e != nil || len(result) != 1 || string(result[0]) != "a" {
+			t.Error(result, e)
+		}
+		if listIndex.Exist([]byte("testEmpty")) {
+			t.Error("testEmpty should be trimmed")
+		}
+	}
+	e = listIndex.LPush([]byte("testEmpty"), -1, []byte("a"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = listIndex.LTrim([]byte("testEmpty"), 1, 0)
+	if e != nil {
+		t.Fatal(e)
+	}
+	check()
+	e = listIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 从文件重建索引 结果应该一样
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	listIndex, e = BuildListIndex(activeFiles[storage.List], archiveFiles[storage.List], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = listIndex.CloseIndex()
+	}()
+	check()
+}
+
+func TestListIndexElementID(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	es := NewExpiryScheduler()
+	es.Start()
+	defer es.Stop()
+
+	listIndex, e := BuildListIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	listIndex.SetExpiryScheduler(es)
+	reopen := func() {
+		e := listIndex.CloseIndex()
+		if e != nil {
+			t.Fatal(e)
+		}
+		activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+		if e != nil {
+			t.Fatal(e)
+		}
+		listIndex, e = BuildListIndex(activeFiles[storage.List], archiveFiles[storage.List], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+		if e != nil {
+			t.Fatal(e)
+		}
+		listIndex.SetExpiryScheduler(es)
+	}
+	check := func(key string, expected ...string) {
+		t.Helper()
+		result, e := listIndex.LRange([]byte(key), 0, len(expected))
+		if e != nil || len(result) != len(expected) {
+			t.Fatal(result, e)
+		}
+		for i := range expected {
+			if string(result[i]) != expected[i] {
+				t.Error(i, string(result[i]), expected[i])
+			}
+		}
+		if n, _ := listIndex.LLen([]byte(key)); n != len(expected) {
+			t.Error(n, len(expected))
+		}
+		e = listIndex.CheckList([]byte(key))
+		if e != nil {
+			t.Error(key, e)
+		}
+	}
+
+	// testList 为 a b c d 元素 ID 依次为1到4
+	for _, v := range []string{"a", "b", "c", "d"} {
+		e = listIndex.RPush([]byte("testList"), -1, []byte(v))
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	// testList 为 e a x y d 其中 e 会过期
+	e = listIndex.LInsert([]byte("testList"), 1, []byte("x"), -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = listIndex.LSet([]byte("testList"), 2, []byte("y"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = listIndex.LRem([]byte("testList"), 1, []byte("c"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = listIndex.LPush([]byte("testList"), time.Now().Add(100*time.Millisecond).UnixMilli(), []byte("e"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	time.Sleep(300 * time.Millisecond)
+	// testList 为 x y testTarget 为 d
+	_, e = listIndex.LMove([]byte("testList"), []byte("testTarget"), ListRight, ListLeft)
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = listIndex.LTrim([]byte("testList"), 1, -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	check("testList", "x", "y")
+	check("testTarget", "d")
+	reopen()
+	check("testList", "x", "y")
+	check("testTarget", "d")
+
+	// 重复压入 x 删除已经被删除的 a 重放时都会被跳过 但是 CheckList 能发现
+	_, e = listIndex.writeEntry(&storage.Entry{
+		Key:       []byte("testList"),
+		Value:     encodeListValue([]byte("x"), 5, uint64(ListRight)),
+		EntryType: storage.TypeListPush,
+		ExpiredAt: -1,
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, e = listIndex.writeEntry(&storage.Entry{
+		Key:       []byte("testList"),
+		Value:     encodeListValue(nil, 1),
+		EntryType: storage.TypeListRemove,
+		ExpiredAt: 0,
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = listIndex.CheckList([]byte("testList"))
+	if !errors.Is(e, logger.ListHistoryIsBroken) {
+		t.Error(e)
+	}
+	if e = listIndex.CheckList([]byte("testTarget")); e != nil {
+		t.Error(e)
+	}
+	reopen()
+	result, e := listIndex.LRange([]byte("testList"), 0, 2)
+	if e != nil || len(result) != 2 || string(result[0]) != "x" || string(result[1]) != "y" {
+		t.Error(result, e)
+	}
+	_ = listIndex.CloseIndex()
+}
+
+func TestListIndexPositionalEntry(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	// 旧版本写入的基于位置的 entry 仍然可以重放
+	listIndex, e := BuildListIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, entry := range []*storage.Entry{
+		{Key: []byte("testList"), Value: []byte("b"), EntryType: storage.TypeLPush, ExpiredAt: -1},
+		{Key: []byte("testList"), Value: []byte("a"), EntryType: storage.TypeLPush, ExpiredAt: -1},
+		{Key: []byte("testList"), Value: []byte("c"), EntryType: storage.TypeLPush, ExpiredAt: -1},
+		{Key: []byte("testList"), Value: util.EncodeKeyAndField("z", "1"), EntryType: storage.TypeRecord, ExpiredAt: -1},
+		{Key: []byte("testList"), Value: nil, EntryType: storage.TypeLPop, ExpiredAt: 0},
+	} {
+		_, e = listIndex.writeEntry(entry)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	e = listIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	for round := 0; round < 2; round++ {
+		activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+		if e != nil {
+			t.Fatal(e)
+		}
+		listIndex, e = BuildListIndex(activeFiles[storage.List], archiveFiles[storage.List], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+		if e != nil {
+			t.Fatal(e)
+		}
+		// 第一轮是 z b 之后按 ID 弹出 z 第二轮是 b
+		result, e := listIndex.LRange([]byte("testList"), 0, 2-round)
+		if e != nil || string(result[0]) != []string{"z", "b"}[round] {
+			t.Error(round, result, e)
+		}
+		e = listIndex.CheckList([]byte("testList"))
+		if e != nil {
+			t.Error(e)
+		}
+		if round == 0 {
+			_, e = listIndex.LPop([]byte("testList"))
+			if e != nil {
+				t.Fatal(e)
+			}
+		}
+		e = listIndex.CloseIndex()
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+}
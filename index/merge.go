@@ -0,0 +1,231 @@
+package index
+
+import (
+	"MisakaDB/logger"
+	"MisakaDB/storage"
+	"errors"
+	"strconv"
+	"time"
+)
+
+/*
+merge 的思路如下
+
+每次写入都是向活跃文件追加一个新的 entry 被覆盖或者被删除的 entry 永远留在文件里 所以文件只会越来越大 启动时重放的 entry 也越来越多
+
+merge 时先持有索引的写锁 然后把索引中仍然存活的节点所指向的 entry 依次重写到一组新文件中
+
+新文件的 ID 从当前最大的文件 ID + 1 开始分配 重写完成后再新开一个活跃文件 所以新文件和新活跃文件的 ID 一定比所有旧文件都大
+
+新文件全部同步到磁盘之后 才会删除旧文件 新文件里只有存活的数据 没有 TypeDelete 之类的删除记录 所以删除旧文件的顺序很重要
+
+旧文件按照 ID 从小到大依次删除 每删除一个都同步一次文件夹 这样在任何时刻磁盘上剩下的旧文件都是 ID 最大的那一部分 如果一个包含删除记录的文件已经被删除了 那么比它更旧的文件一定也已经被删除了
+
+所以即使在删除旧文件的过程中进程崩溃 下次启动时先重放剩下的旧文件 再重放新文件 被删除的数据也不会复活 得到的索引和 merge 之前是一样的
+
+attention list 的 entry 是基于位置的操作 没办法单独重写某一个 entry 所以 list 是按照内存中的列表整体重写的 每个列表前面都会写入一个 TypeDeleteKey
+*/
+
+// Merger 支持 merge 的索引需要实现的接口
+type Merger interface {
+	// Merge 将存活的 entry 重写到新文件中 并且删除旧文件
+	Merge() error
+	// DeadBytesRatio 估算归档文件（不包括活跃文件）中已经失效的字节数所占的比例
+	DeadBytesRatio() (float64, error)
+}
+
+// relocation 记录 merge 时索引节点的新位置 只有所有新文件都写入成功之后才会更新到索引节点上
+type relocation struct {
+	node   *indexNode
+	fileID uint32
+	offset int64
+}
+
+// mergeWriter 在 merge 时顺序向新文件写入 entry 写满自动换新文件
+type mergeWriter struct {
+	dataType       storage.FileForData
+	fileIOMode     storage.FileIOType
+	baseFolderPath string
+	fileMaxSize    int64
+
+	nextFileID  uint32
+	currentFile *storage.RecordFile
+	files       map[uint32]*storage.RecordFile
+}
+
+// newMergeWriter 新建一个 mergeWriter 新文件的 ID 从给定文件中最大的 ID + 1 开始
+func newMergeWriter(dataType storage.FileForData, fileIOMode storage.FileIOType, baseFolderPath string, fileMaxSize int64, archivedFile map[uint32]*storage.RecordFile) *mergeWriter {
+	result := &mergeWriter{
+		dataType:       dataType,
+		fileIOMode:     fileIOMode,
+		baseFolderPath: baseFolderPath,
+		fileMaxSize:    fileMaxSize,
+		nextFileID:     1,
+		files:          make(map[uint32]*storage.RecordFile),
+	}
+	for fileID := range archivedFile {
+		if fileID >= result.nextFileID {
+			result.nextFileID = fileID + 1
+		}
+	}
+	return result
+}
+
+// writeEntry 向新文件写入 entry 返回写入的文件 ID 和 offset
+func (mw *mergeWriter) writeEntry(entry *storage.Entry) (uint32, int64, error) {
+	if mw.currentFile == nil {
+		e := mw.openNextFile()
+		if e != nil {
+			return 0, 0, e
+		}
+	}
+	offset := mw.currentFile.GetOffset()
+	e := mw.currentFile.WriteEntryIntoFile(entry)
+	if errors.Is(e, logger.FileBytesIsMaxedOut) {
+		e = mw.openNextFile()
+		if e != nil {
+			return 0, 0, e
+		}
+		offset = mw.currentFile.GetOffset()
+		e = mw.currentFile.WriteEntryIntoFile(entry)
+	}
+	if e != nil {
+		return 0, 0, e
+	}
+	return mw.currentFile.GetFileID(), offset, nil
+}
+
+// rewriteNode 从旧文件中读取节点所指向的 entry 并且重写到新文件中
+func (mw *mergeWriter) rewriteNode(archivedFile map[uint32]*storage.RecordFile, node *indexNode) (relocation, error) {
+	recordFile, ok := archivedFile[node.fileID]
+	if !ok {
+		logger.GenerateErrorLog(false, false, logger.FileIsNotExist.Error(), strconv.Itoa(int(node.fileID)))
+		return relocation{}, logger.FileIsNotExist
+	}
+	entry, _, e := recordFile.ReadIntoEntry(node.offset)
+	if e != nil {
+		return relocation{}, e
+	}
+	// 过期时间可能被 TypeExpire entry 修改过 以节点上的为准
+	entry.ExpiredAt = node.expiredAt
+	fileID, offset, e := mw.writeEntry(entry)
+	if e != nil {
+		return relocation{}, e
+	}
+	return relocation{
+		node:   node,
+		fileID: fileID,
+		offset: offset,
+	}, nil
+}
+
+// openNextFile 新开一个文件用于写入 之前写满的文件会写入 hint 文件
+func (mw *mergeWriter) openNextFile() error {
+	if mw.currentFile != nil {
+		sealRecordFile(mw.currentFile)
+	}
+	recordFile, e := storage.NewRecordFile(mw.fileIOMode, mw.dataType, mw.nextFileID, mw.baseFolderPath, mw.fileMaxSize)
+	if e != nil {
+		return e
+	}
+	mw.nextFileID += 1
+	mw.currentFile = recordFile
+	mw.files[recordFile.GetFileID()] = recordFile
+	return nil
+}
+
+// commit 同步所有新文件 新开一个活跃文件 删除旧文件 最后更新索引节点的位置 返回新的活跃文件和新的归档文件
+func (mw *mergeWriter) commit(oldActiveFile *storage.RecordFile, oldArchivedFile map[uint32]*storage.RecordFile, syncDuration time.Duration, relocations []relocation) (*storage.RecordFile, map[uint32]*storage.RecordFile, error) {
+	if mw.currentFile != nil {
+		sealRecordFile(mw.currentFile)
+	}
+	// 先保证新文件全部落盘
+	for _, v := range mw.files {
+		e := v.Sync()
+		if e != nil {
+			mw.abort()
+			return nil, nil, e
+		}
+	}
+
+	// 新的活跃文件
+	activeFile, e := storage.NewRecordFile(mw.fileIOMode, mw.dataType, mw.nextFileID, mw.baseFolderPath, mw.fileMaxSize)
+	if e != nil {
+		mw.abort()
+		return nil, nil, e
+	}
+	mw.files[activeFile.GetFileID()] = activeFile
+	activeFile.StartSyncRoutine(syncDuration)
+
+	// 新文件的创建要先落盘 否则崩溃之后可能旧文件已经删掉了 新文件却不在文件夹里
+	e = storage.SyncFolder(mw.baseFolderPath)
+	if e != nil {
+		mw.abort()
+		return nil, nil, e
+	}
+
+	// 按照 ID 从小到大删除旧文件 每删除一个都同步文件夹 保证磁盘上剩下的旧文件总是最新的那一部分
+	// 删除失败只记录 不影响 merge 的结果 但是后面更新的旧文件就不能再删了 它们里面的删除记录可能还要用来覆盖这个文件
+	oldActiveFile.StopSyncRoutine()
+	for _, fileID := range storage.SortedFileIDs(oldArchivedFile) {
+		e = oldArchivedFile[fileID].Delete()
+		if e == nil {
+			e = storage.SyncFolder(mw.baseFolderPath)
+		}
+		if e != nil {
+			logger.GenerateErrorLog(false, false, e.Error(), strconv.Itoa(int(fileID)))
+			break
+		}
+	}
+
+	for _, v := range relocations {
+		v.node.fileID = v.fileID
+		v.node.offset = v.offset
+	}
+	logger.GenerateInfoLog("Merge Finished! Data Type: " + strconv.Itoa(int(mw.dataType)) + ", Files: " + strconv.Itoa(len(oldArchivedFile)) + " -> " + strconv.Itoa(len(mw.files)))
+	return activeFile, mw.files, nil
+}
+
+// abort merge 失败时删除所有已经写入的新文件
+func (mw *mergeWriter) abort() {
+	for _, v := range mw.files {
+		e := v.Delete()
+		if e != nil {
+			logger.GenerateErrorLog(false, false, e.Error(), strconv.Itoa(int(v.GetFileID())))
+		}
+	}
+	mw.files = make(map[uint32]*storage.RecordFile)
+}
+
+// deadBytesRatio 根据归档文件（不包括活跃文件）的总长度和其中存活数据的长度 计算失效数据的比例
+func deadBytesRatio(activeFile *storage.RecordFile, archivedFile map[uint32]*storage.RecordFile, liveSize int64) (float64, error) {
+	var totalSize int64
+	for fileID, v := range archivedFile {
+		if fileID == activeFile.GetFileID() {
+			continue
+		}
+		length, e := v.Length()
+		if e != nil {
+			return 0, e
+		}
+		totalSize += length
+	}
+	if totalSize == 0 || liveSize >= totalSize {
+		return 0, nil
+	}
+	return 1 - float64(liveSize)/float64(totalSize), nil
+}
+
+// isExpired 检查给定的过期时间戳是否已经过期 -1 为永不过期
+func isExpired(expiredAt int64, now int64) bool {
+	return expiredAt != -1 && expiredAt < now
+}
+
+// 检查接口实现
+var (
+	_ Merger = (*StringIndex)(nil)
+	_ Merger = (*HashIndex)(nil)
+	_ Merger = (*ListIndex)(nil)
+	_ Merger = (*ZSetIndex)(nil)
+	_ Merger = (*SetIndex)(nil)
+)
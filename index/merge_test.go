@@ -0,0 +1,124 @@
+package index
+
+import (
+	"MisakaDB/logger"
+	"MisakaDB/storage"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStringIndexMerge(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	stringIndex, e := BuildStringIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// 反复覆盖同样的几个键 产生大量失效数据
+	for i := 0; i < 100; i++ {
+		e = stringIndex.Set([]byte("testKey"+strconv.Itoa(i%5)), []byte("testValue"+strconv.Itoa(i)), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	ratio, e := stringIndex.DeadBytesRatio()
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Log(ratio)
+	filesBefore := len(stringIndex.archivedFile)
+
+	e = stringIndex.Merge()
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Log(filesBefore, len(stringIndex.archivedFile))
+	if len(stringIndex.archivedFile) >= filesBefore {
+		t.Error("merge did not reduce record files")
+	}
+	e = stringIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 从 merge 后的文件重新构建索引
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	stringIndex, e = BuildStringIndex(activeFiles[storage.String], archiveFiles[storage.String], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = stringIndex.CloseIndex()
+	}()
+	for i := 95; i < 100; i++ {
+		value, e := stringIndex.Get([]byte("testKey" + strconv.Itoa(i%5)))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if value != "testValue"+strconv.Itoa(i) {
+			t.Error(value)
+		}
+	}
+}
+
+func TestListIndexMerge(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	listIndex, e := BuildListIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 30; i++ {
+		e = listIndex.LPush([]byte("testList"), -1, []byte(strconv.Itoa(i)))
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		_, e = listIndex.LPop([]byte("testList"))
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	e = listIndex.Merge()
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = listIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	listIndex, e = BuildListIndex(activeFiles[storage.List], archiveFiles[storage.List], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = listIndex.CloseIndex()
+	}()
+	result, e := listIndex.LRange([]byte("testList"), 0, 10)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := range result {
+		if string(result[i]) != strconv.Itoa(9-i) {
+			t.Error(string(result[i]))
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package index
+
+import (
+	"MisakaDB/logger"
+	"MisakaDB/storage"
+	"errors"
+	"strconv"
+)
+
+/*
+启动时重建索引的思路如下
+
+按文件 ID 从小到大的顺序读取所有文件 对于活跃文件 一定是逐个读取 entry 进行重放
+
+对于归档文件 如果该类型的索引支持 hint 并且 hint 文件存在且校验通过 就只读取 hint 文件 把 hint 当作一个没有值的 entry 进行重放
+
+重放完成后 索引节点中只有从 hint 重放出来的节点是没有值的 这时再按节点记录的位置把值读出来 这样只需要读取存活的 entry
+
+hint 文件不存在或者校验不通过时 退回到逐个读取 entry 的方式 并且顺便为该归档文件补上 hint 文件
+
+如果进程在写入 entry 的过程中退出 活跃文件的尾部会留下一个残缺的 entry 这种情况下直接把残缺的部分截掉 记录被截掉的内容之后继续启动
+
+除此之外的损坏（活跃文件中间的 entry 损坏 或者归档文件中的 entry 损坏）默认直接报错 只有指定了 repair 时才会从损坏的位置截断文件 继续启动
+
+set 的成员没有值 所以从 hint 重放之后也不需要再读取值
+
+list 和 zset 重放时离不开 entry 的值 所以它们的 hint 带上了值中重放需要的部分 见 storage/hint.go
+
+zset 的值就是成员和分数 hint 带上完整的值 从 hint 重放之后不需要再读取值
+
+list 的值前面是元素 ID 等数字 后面是元素本身 压入 插入和修改元素的 hint 只带上前面的数字 重放结束后再按位置读出存活元素的值 见 list_history.go
+*/
+
+func init() {
+	storage.SetHintValueFunc(storage.List, listHintValue)
+}
+
+// entryHandler 处理从文件中读取到的 entry 即各个索引的 handleEntry
+type entryHandler func(entry *storage.Entry, fileID uint32, offset int64) error
+
+// loadRecordFiles 按文件 ID 从小到大的顺序读取所有文件 重建索引 返回通过 hint 文件重放的文件 ID
+func loadRecordFiles(activeFile *storage.RecordFile, archivedFile map[uint32]*storage.RecordFile, handleEntry entryHandler, useHint bool, isRepair bool) (map[uint32]bool, error) {
+	hintedFiles := make(map[uint32]bool)
+	for _, fileID := range storage.SortedFileIDs(archivedFile) {
+		recordFile := archivedFile[fileID]
+		if useHint && recordFile != activeFile {
+			hints, e := recordFile.ReadHintFile()
+			if e == nil {
+				e = loadHints(hints, recordFile, handleEntry)
+				if e != nil {
+					return nil, e
+				}
+				hintedFiles[fileID] = true
+				continue
+			}
+			if !errors.Is(e, logger.FileIsNotExist) {
+				logger.GenerateInfoLog("Hint File of " + strconv.Itoa(int(fileID)) + " is Unavailable, Fall Back to Read Entries: " + e.Error())
+			}
+		}
+
+		e := loadEntries(recordFile, handleEntry, recordFile == activeFile, isRepair)
+		if e != nil {
+			return nil, e
+		}
+		if useHint && recordFile != activeFile {
+			// 补上 hint 文件 下次启动就不用再读整个文件了 写入失败也不影响启动
+			e = recordFile.WriteHintFile()
+			if e != nil {
+				logger.GenerateErrorLog(false, false, e.Error(), strconv.Itoa(int(fileID)))
+			}
+		}
+	}
+	return hintedFiles, nil
+}
+
+// loadEntries 逐个读取文件中的 entry 进行重放 读取失败时按照是否是活跃文件和是否指定了 repair 决定是截断文件还是报错
+func loadEntries(recordFile *storage.RecordFile, handleEntry entryHandler, isActive bool, isRepair bool) error {
+	var (
+		offset      int64
+		entry       *storage.Entry
+		entryLength int64
+	)
+	fileLength, e := recordFile.Length()
+	if e != nil {
+		return e
+	}
+	for offset < fileLength {
+		entry, entryLength, e = recordFile.ReadIntoEntry(offset)
+		if e != nil {
+			if isActive && recordFile.IsTornTail(offset, entryLength, e) {
+				return truncateRecordFile(recordFile, offset, fileLength, e)
+			}
+			if isRepair {
+				logger.GenerateErrorLog(false, false, "Record File is Broken, Repair it by Truncating! ", strconv.Itoa(int(recordFile.GetFileID())), strconv.FormatInt(offset, 10))
+				return truncateRecordFile(recordFile, offset, fileLength, e)
+			}
+			logger.GenerateErrorLog(false, false, e.Error(), "Record File is Broken, Restart with Repair Option to Truncate it! ", strconv.Itoa(int(recordFile.GetFileID())), strconv.FormatInt(offset, 10))
+			return e
+		}
+		e = handleEntry(entry, recordFile.GetFileID(), offset)
+		if e != nil {
+			return e
+		}
+		offset += entryLength
+	}
+	return nil
+}
+
+// truncateRecordFile 从 offset 开始截断文件 丢弃之后的所有内容 并且记录丢弃了什么
+func truncateRecordFile(recordFile *storage.RecordFile, offset int64, fileLength int64, readError error) error {
+	logger.GenerateInfoLog("Drop " + strconv.FormatInt(fileLength-offset, 10) + " Bytes in [" + strconv.FormatInt(offset, 10) + ", " + strconv.FormatInt(fileLength, 10) + ") of Record File " + strconv.Itoa(int(recordFile.GetFileID())) + " Cause of: " + readError.Error())
+	return recordFile.Truncate(offset)
+}
+
+// loadHints 把 hint 当作没有值的 entry 进行重放 list 和 zset 的 hint 带有值中重放需要的部分
+//
+// TypeExpire entry 的值是写入时的时间戳 重放时需要用到 所以从文件中读出完整的 entry 这种 entry 很少 不会拖慢启动
+func loadHints(hints []*storage.Hint, recordFile *storage.RecordFile, handleEntry entryHandler) error {
+	for _, v := range hints {
+		entry := &storage.Entry{
+			Key:       v.Key,
+			Value:     v.Value,
+			EntryType: v.EntryType,
+			ExpiredAt: v.ExpiredAt,
+		}
+		if v.EntryType == storage.TypeExpire {
+			var e error
+			entry, _, e = recordFile.ReadIntoEntry(v.Offset)
+			if e != nil {
+				return e
+			}
+		}
+		e := handleEntry(entry, recordFile.GetFileID(), v.Offset)
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// loadNodeValue 从节点记录的位置读取 entry 把值补到节点上 用于从 hint 重放出来的节点
+func loadNodeValue(archivedFile map[uint32]*storage.RecordFile, node *indexNode) error {
+	recordFile, ok := archivedFile[node.fileID]
+	if !ok {
+		logger.GenerateErrorLog(false, false, logger.FileIsNotExist.Error(), strconv.Itoa(int(node.fileID)))
+		return logger.FileIsNotExist
+	}
+	entry, _, e := recordFile.ReadIntoEntry(node.offset)
+	if e != nil {
+		return e
+	}
+	node.value = entry.Value
+	return nil
+}
+
+// sealRecordFile 活跃文件写满之后 为它写入 hint 文件 写入失败只记录 下次启动时会退回到逐个读取 entry 的方式
+func sealRecordFile(recordFile *storage.RecordFile) {
+	e := recordFile.WriteHintFile()
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), strconv.Itoa(int(recordFile.GetFileID())))
+	}
+}
@@ -0,0 +1,283 @@
+package index
+
+import (
+	"MisakaDB/logger"
+	"MisakaDB/storage"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBuildHashIndexFromHint(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	hashIndex, e := BuildHashIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 50; i++ {
+		e = hashIndex.HSet("testKey", "testField"+strconv.Itoa(i%10), "testValue"+strconv.Itoa(i), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	e = hashIndex.HDel("testKey", "testField0", true)
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = hashIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	hintFiles, _ := filepath.Glob(filepath.Join(folderPath, "hint.hash.*"))
+	t.Log(len(hintFiles))
+	if len(hintFiles) == 0 {
+		t.Fatal("no hint file is written")
+	}
+	// 破坏其中一个 hint 文件 这个文件应该退回到逐个读取 entry 的方式
+	e = os.WriteFile(hintFiles[0], []byte("broken"), 0644)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	hashIndex, e = BuildHashIndex(activeFiles[storage.Hash], archiveFiles[storage.Hash], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = hashIndex.CloseIndex()
+	}()
+	exist, e := hashIndex.HExist("testKey", "testField0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if exist {
+		t.Error("deleted field is restored")
+	}
+	for i := 41; i < 50; i++ {
+		value, e := hashIndex.HGet("testKey", "testField"+strconv.Itoa(i%10))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if value != "testValue"+strconv.Itoa(i) {
+			t.Error(value)
+		}
+	}
+}
+
+func TestBuildStringIndexWithTornTail(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	stringIndex, e := BuildStringIndex(nil, nil, storage.TraditionalIOFile, folderPath, 4096, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 10; i++ {
+		e = stringIndex.Set([]byte("testKey"+strconv.Itoa(i)), []byte("testValue"+strconv.Itoa(i)), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	e = stringIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 模拟写入 entry 的过程中进程退出 活跃文件尾部留下半个 entry
+	recordFiles, _ := filepath.Glob(filepath.Join(folderPath, "record.string.*"))
+	if len(recordFiles) != 1 {
+		t.Fatal(recordFiles)
+	}
+	before, e := os.Stat(recordFiles[0])
+	if e != nil {
+		t.Fatal(e)
+	}
+	entry := &storage.Entry{
+		Key:       []byte("tornKey"),
+		Value:     []byte("tornValue"),
+		EntryType: storage.TypeRecord,
+		ExpiredAt: -1,
+	}
+	encoded, _ := entry.Encode()
+	f, e := os.OpenFile(recordFiles[0], os.O_APPEND|os.O_WRONLY, 0644)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, e = f.Write(encoded[:len(encoded)-3])
+	_ = f.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 4096, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	stringIndex, e = BuildStringIndex(activeFiles[storage.String], archiveFiles[storage.String], storage.TraditionalIOFile, folderPath, 4096, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = stringIndex.CloseIndex()
+	}()
+	after, e := os.Stat(recordFiles[0])
+	if e != nil {
+		t.Fatal(e)
+	}
+	if after.Size() != before.Size() {
+		t.Error(before.Size(), after.Size())
+	}
+	for i := 0; i < 10; i++ {
+		value, e := stringIndex.Get([]byte("testKey" + strconv.Itoa(i)))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if value != "testValue"+strconv.Itoa(i) {
+			t.Error(value)
+		}
+	}
+	_, e = stringIndex.Get([]byte("tornKey"))
+	if e == nil {
+		t.Error("torn entry should be dropped")
+	}
+}
+
+func TestBuildListAndZSetIndexFromHint(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	listIndex, e := BuildListIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	zsetIndex, e := BuildZSetIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 40; i++ {
+		e = listIndex.RPush([]byte("testList"), -1, []byte("testValue"+strconv.Itoa(i)))
+		if e != nil {
+			t.Fatal(e)
+		}
+		e = zsetIndex.ZAdd([]byte("testZSet"), float64(i%7), []byte("testMember"+strconv.Itoa(i%10)), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	// 修改 移动和删除的元素 值分别来自不同的文件 空值的元素也要能正确还原
+	e = listIndex.LSet([]byte("testList"), 3, []byte("newValue"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = listIndex.LSet([]byte("testList"), 5, []byte(""))
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, e = listIndex.LMove([]byte("testList"), []byte("otherList"), ListLeft, ListRight)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, e = listIndex.RPop([]byte("testList"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = zsetIndex.ZRem([]byte("testZSet"), []byte("testMember0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	expectedList, e := listIndex.LRange([]byte("testList"), 0, 38)
+	if e != nil {
+		t.Fatal(e)
+	}
+	expectedZSet, e := zsetIndex.ZRange([]byte("testZSet"), 0, -1, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = listIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = zsetIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	for _, pattern := range []string{"hint.list.*", "hint.zset.*"} {
+		hintFiles, _ := filepath.Glob(filepath.Join(folderPath, pattern))
+		t.Log(pattern, len(hintFiles))
+		if len(hintFiles) == 0 {
+			t.Fatal("no hint file is written")
+		}
+	}
+
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	listIndex, e = BuildListIndex(activeFiles[storage.List], archiveFiles[storage.List], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = listIndex.CloseIndex()
+	}()
+	zsetIndex, e = BuildZSetIndex(activeFiles[storage.ZSet], archiveFiles[storage.ZSet], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = zsetIndex.CloseIndex()
+	}()
+
+	list, e := listIndex.LRange([]byte("testList"), 0, 38)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(list) != len(expectedList) {
+		t.Fatal(len(list), len(expectedList))
+	}
+	for i := range list {
+		if string(list[i]) != string(expectedList[i]) {
+			t.Error(i, string(list[i]), string(expectedList[i]))
+		}
+	}
+	other, e := listIndex.LRange([]byte("otherList"), 0, 1)
+	if e != nil || len(other) != 1 || string(other[0]) != "testValue0" {
+		t.Error(other, e)
+	}
+	e = listIndex.CheckList([]byte("testList"))
+	if e != nil {
+		t.Error(e)
+	}
+
+	zset, e := zsetIndex.ZRange([]byte("testZSet"), 0, -1, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(zset) != len(expectedZSet) {
+		t.Fatal(len(zset), len(expectedZSet))
+	}
+	for i := range zset {
+		if string(zset[i].Member) != string(expectedZSet[i].Member) || zset[i].Score != expectedZSet[i].Score {
+			t.Error(i, zset[i], expectedZSet[i])
+		}
+	}
+}
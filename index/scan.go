@@ -0,0 +1,164 @@
+package index
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"sort"
+	"strings"
+)
+
+/*
+遍历 key
+
+SCAN 的游标是一个位置 不在服务端保存任何状态 key 的位置是 key 的前8个字节 不足8个字节时在后面补0 按大端序解释得到的数字 见 ScanCursor
+key 按字典序排列时 位置不会变小 所以游标就是字典序中的一个位置 下一页从位置不小于游标的第一个 key 开始 游标永远不会失效
+
+前8个字节相同的 key 位置相同 它们总是在同一页中返回 下一页的游标是这一页之后的第一个 key 的位置 一定比这一页中所有 key 的位置都大
+所以不论遍历期间 key 怎么变化 整个遍历过程中一直存在的 key 一定会被返回 并且只会返回一次 代价是前8个字节相同的 key 很多时 一页会比 COUNT 大很多
+
+每个索引收集位置不小于游标的 key 中最小的 count 个 再加上和第 count 个位置相同的 key 以及之后的第一个 key 按字典序排列
+多个索引的结果合并之后由 ScanPage 取出一页 有之后的第一个 key 才能知道下一页的游标 以及遍历是否已经结束
+
+String 的索引是 ART 从游标对应的 key 开始按字典序遍历 收集够了就停下 其它类型的索引是 map 没有顺序 需要遍历整个 map 两次
+第一次找出最小的 count 个 key 第二次收集位置不超过其中最大的 key 的 key 两次都只需要 count 大小的内存
+
+HScan SScan ZScan 以同样的方式遍历集合中的成员 成员同样保存在 map 中
+*/
+
+// ScanCursor 返回 key 在遍历中的位置 也就是从 key 开始的下一页的游标
+func ScanCursor(key string) uint64 {
+	var buffer [8]byte
+	copy(buffer[:], key)
+	return binary.BigEndian.Uint64(buffer[:])
+}
+
+// scanStart 返回位置不小于 cursor 的 key 中可能的最小的 key 一个 key 不小于它当且仅当 key 的位置不小于 cursor
+func scanStart(cursor uint64) string {
+	var buffer [8]byte
+	binary.BigEndian.PutUint64(buffer[:], cursor)
+	return strings.TrimRight(string(buffer[:]), "\x00")
+}
+
+// ScanPage 从按字典序排列的 keys 中取出一页 keys 是各个索引返回的结果合并之后的结果
+//
+// 一页是前 count 个 key 再加上和第 count 个位置相同的 key 遍历结束时 next 为0 count 不大于0时返回全部
+func ScanPage(keys []string, count int) (page []string, next uint64) {
+	if count <= 0 || len(keys) <= count {
+		return keys, 0
+	}
+	end := count
+	last := ScanCursor(keys[count-1])
+	for end < len(keys) && ScanCursor(keys[end]) == last {
+		end += 1
+	}
+	if end == len(keys) {
+		return keys, 0
+	}
+	return keys[:end], ScanCursor(keys[end])
+}
+
+// scanCollector 按字典序依次接收 key 收集 ScanPage 需要的 key
+type scanCollector struct {
+	count int
+	keys  []string
+	last  uint64 // 第 count 个 key 的位置
+}
+
+// add 收集 key 返回是否还需要之后的 key
+func (sc *scanCollector) add(key string) bool {
+	sc.keys = append(sc.keys, key)
+	switch {
+	case sc.count <= 0 || len(sc.keys) < sc.count:
+		return true
+	case len(sc.keys) == sc.count:
+		sc.last = ScanCursor(key)
+		return true
+	}
+	// 位置变了的话 这就是之后的第一个 key
+	return ScanCursor(key) == sc.last
+}
+
+// scanHeap 大根堆 用来找出最小的 count 个 key 实现 heap.Interface
+type scanHeap []string
+
+func (h scanHeap) Len() int {
+	return len(h)
+}
+
+func (h scanHeap) Less(i, j int) bool {
+	return h[i] > h[j]
+}
+
+func (h scanHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *scanHeap) Push(x any) {
+	*h = append(*h, x.(string))
+}
+
+func (h *scanHeap) Pop() any {
+	old := *h
+	result := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return result
+}
+
+// mapScan 从 index 中收集以 prefix 开头 位置不小于 cursor 并且 isAlive 的 key 中 ScanPage 需要的部分 按字典序排列 调用者需要持有锁
+func mapScan[V any](index map[string]V, prefix []byte, cursor uint64, count int, isAlive func(key string, value V) bool) []string {
+	start := scanStart(cursor)
+	isCandidate := func(key string, value V) bool {
+		return key >= start && strings.HasPrefix(key, string(prefix)) && isAlive(key, value)
+	}
+
+	var result []string
+	if count <= 0 {
+		for key, value := range index {
+			if isCandidate(key, value) {
+				result = append(result, key)
+			}
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	// 第一次找出最小的 count 个 key
+	smallest := make(scanHeap, 0, min(count, len(index)))
+	for key, value := range index {
+		if !isCandidate(key, value) {
+			continue
+		}
+		if len(smallest) < count {
+			heap.Push(&smallest, key)
+		} else if key < smallest[0] {
+			smallest[0] = key
+			heap.Fix(&smallest, 0)
+		}
+	}
+	if len(smallest) < count {
+		result = smallest
+		sort.Strings(result)
+		return result
+	}
+
+	// 第二次收集位置不超过第 count 个 key 的 key 以及之后的第一个 key
+	last := ScanCursor(smallest[0])
+	var after string
+	hasAfter := false
+	for key, value := range index {
+		if !isCandidate(key, value) {
+			continue
+		}
+		if ScanCursor(key) <= last {
+			result = append(result, key)
+		} else if !hasAfter || key < after {
+			after = key
+			hasAfter = true
+		}
+	}
+	if hasAfter {
+		result = append(result, after)
+	}
+	sort.Strings(result)
+	return result
+}
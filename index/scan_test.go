@@ -0,0 +1,72 @@
+package index
+
+import (
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMapScan(t *testing.T) {
+	// 字母很少 长度在8个字节上下 会有很多前8个字节相同的 key
+	index := make(map[string]bool)
+	for len(index) < 500 {
+		var builder strings.Builder
+		for i := rand.IntN(12); i >= 0; i-- {
+			builder.WriteByte("ab"[rand.IntN(2)])
+		}
+		index[builder.String()] = true
+	}
+	sortedKeys := make([]string, 0, len(index))
+	for key := range index {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+	isAlive := func(key string, _ bool) bool {
+		return true
+	}
+
+	for _, count := range []int{1, 3, 10, 1000} {
+		var cursor uint64
+		returned := make(map[string]bool)
+		for {
+			keys := mapScan(index, nil, cursor, count, isAlive)
+			// 按字典序遍历的结果和 map 的结果相同
+			collector := &scanCollector{count: count}
+			for _, key := range sortedKeys {
+				if key >= scanStart(cursor) && !collector.add(key) {
+					break
+				}
+			}
+			if strings.Join(keys, ",") != strings.Join(collector.keys, ",") {
+				t.Fatal(count, cursor, len(keys), len(collector.keys))
+			}
+
+			page, next := ScanPage(keys, count)
+			for _, key := range page {
+				if returned[key] {
+					t.Fatal("returned twice", key)
+				}
+				returned[key] = true
+			}
+			if next == 0 {
+				break
+			}
+			if next <= cursor {
+				t.Fatal("cursor is not increased", cursor, next)
+			}
+			cursor = next
+		}
+		if len(returned) != len(index) {
+			t.Error(count, len(returned))
+		}
+	}
+
+	// prefix 之外的 key 不会返回
+	keys := mapScan(index, []byte("ba"), 0, 0, isAlive)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "ba") {
+			t.Error(key)
+		}
+	}
+}
@@ -0,0 +1,730 @@
+package index
+
+import (
+	"MisakaDB/logger"
+	"MisakaDB/storage"
+	"MisakaDB/util"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/*
+set 的持久化方式和 hash 基本一样 只是 set 的成员没有值
+
+添加成员 写入 TypeRecord entry 键为 key 和 member 编码之后的结果 值为空
+删除成员 写入 TypeDelete entry 键同上
+删除整个 set 写入 TypeDeleteKey entry 键为 key 和空字符串编码之后的结果
+
+set 的成员不能单独设置过期时间 只能通过 Expire 修改整个 set 的过期时间 写入 TypeExpire entry 键同上
+所以同一个 set 的成员的过期时间总是相同的 新添加的成员沿用 set 的过期时间 检查 set 是否过期时只需要检查其中一个成员
+*/
+
+type SetIndex struct {
+	index        map[string]map[string]*indexNode
+	mutex        sync.RWMutex
+	activeFile   *storage.RecordFile
+	archivedFile map[uint32]*storage.RecordFile
+
+	fileIOMode     storage.FileIOType
+	baseFolderPath string
+	fileMaxSize    int64
+	syncDuration   time.Duration
+
+	expiry *ExpiryScheduler
+}
+
+// BuildSetIndex 给定当前活跃文件和归档文件 重新构建Set类型的索引 该方法只会在数据库启动时被调用 如果不存在旧的文件 则新建一个活跃文件 isRepair 为 true 时遇到损坏的文件会截断而不是报错
+func BuildSetIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*storage.RecordFile, fileIOMode storage.FileIOType, baseFolderPath string, fileMaxSize int64, syncDuration time.Duration, isRepair bool) (*SetIndex, error) {
+	result := &SetIndex{
+		index:          make(map[string]map[string]*indexNode),
+		activeFile:     activeFile,
+		archivedFile:   archivedFile,
+		fileIOMode:     fileIOMode,
+		baseFolderPath: baseFolderPath,
+		fileMaxSize:    fileMaxSize,
+		syncDuration:   syncDuration,
+	}
+
+	var e error
+
+	// 如果活跃文件都读取不到的话 肯定也没有归档文件了 直接返回即可
+	if activeFile == nil {
+		result.activeFile, e = storage.NewRecordFile(result.fileIOMode, storage.Set, 1, result.baseFolderPath, result.fileMaxSize)
+		if e != nil {
+			return nil, e
+		}
+		result.archivedFile = make(map[uint32]*storage.RecordFile)
+		result.archivedFile[1] = result.activeFile
+		result.activeFile.StartSyncRoutine(syncDuration)
+		return result, nil
+	}
+
+	// set 的成员没有值 所以从 hint 重放之后不需要再读取值
+	_, e = loadRecordFiles(result.activeFile, result.archivedFile, result.handleEntry, true, isRepair)
+	if e != nil {
+		return nil, e
+	}
+	// 重放时保留了已经过期的 set 现在可以删掉了
+	for key := range result.index {
+		if result.getSet(key) == nil {
+			delete(result.index, key)
+		}
+	}
+	result.activeFile.StartSyncRoutine(syncDuration)
+
+	return result, nil
+}
+
+// CloseIndex 关闭Set索引 同时停止定时Sync 关闭文件
+func (si *SetIndex) CloseIndex() error {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+	for _, v := range si.archivedFile {
+		if v.IsSyncing {
+			v.StopSyncRoutine()
+		}
+		e := v.Close()
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// SAdd 向 set 中添加成员 set 不存在则创建 返回实际添加的成员个数 已经存在的成员不计数
+func (si *SetIndex) SAdd(key []byte, members ...[]byte) (int, error) {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	e := si.expireSet(string(key))
+	if e != nil {
+		return 0, e
+	}
+	return si.addMembers(string(key), members)
+}
+
+// SRem 从 set 中删除成员 返回实际删除的成员个数 删除后 set 为空则自动删除 set
+func (si *SetIndex) SRem(key []byte, members ...[]byte) (int, error) {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	if si.getSet(string(key)) == nil {
+		return 0, logger.KeyIsNotExisted
+	}
+	return si.removeMembers(string(key), members)
+}
+
+// SMembers 返回 set 中的所有成员 顺序不固定
+func (si *SetIndex) SMembers(key []byte) ([][]byte, error) {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	targetSet := si.getSet(string(key))
+	if targetSet == nil {
+		return nil, logger.KeyIsNotExisted
+	}
+	result := make([][]byte, 0, len(targetSet))
+	for member := range targetSet {
+		result = append(result, []byte(member))
+	}
+	return result, nil
+}
+
+// SScan 返回 set 中以 prefix 开头 位置不小于 cursor 的成员中 ScanPage 需要的部分 见 scan.go
+func (si *SetIndex) SScan(key []byte, prefix []byte, cursor uint64, count int) ([]string, error) {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	targetSet := si.getSet(string(key))
+	if targetSet == nil {
+		return nil, logger.KeyIsNotExisted
+	}
+	return mapScan(targetSet, prefix, cursor, count, func(string, *indexNode) bool {
+		return true
+	}), nil
+}
+
+// SIsMember 检查 member 是否是 set 的成员
+func (si *SetIndex) SIsMember(key []byte, member []byte) (bool, error) {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	targetSet := si.getSet(string(key))
+	if targetSet == nil {
+		return false, logger.KeyIsNotExisted
+	}
+	_, ok := targetSet[string(member)]
+	return ok, nil
+}
+
+// SMIsMember 同 SIsMember 但是一次检查多个成员 结果的顺序和给定成员的顺序一致
+func (si *SetIndex) SMIsMember(key []byte, members ...[]byte) ([]bool, error) {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	targetSet := si.getSet(string(key))
+	if targetSet == nil {
+		return nil, logger.KeyIsNotExisted
+	}
+	result := make([]bool, len(members))
+	for i, member := range members {
+		_, result[i] = targetSet[string(member)]
+	}
+	return result, nil
+}
+
+// SCard 返回 set 的成员个数
+func (si *SetIndex) SCard(key []byte) (int, error) {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	targetSet := si.getSet(string(key))
+	if targetSet == nil {
+		return 0, logger.KeyIsNotExisted
+	}
+	return len(targetSet), nil
+}
+
+// SPop 随机删除并返回 count 个成员 count 大于成员个数时返回全部成员
+func (si *SetIndex) SPop(key []byte, count int) ([][]byte, error) {
+	if count < 0 {
+		return nil, logger.ParameterIsNotAllowed
+	}
+
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	targetSet := si.getSet(string(key))
+	if targetSet == nil {
+		return nil, logger.KeyIsNotExisted
+	}
+	result := randomMembers(targetSet, count, false)
+	_, e := si.removeMembers(string(key), result)
+	if e != nil {
+		return nil, e
+	}
+	return result, nil
+}
+
+// SRandMember 随机返回 count 个成员 规则同 redis
+//
+// count 为正数时返回的成员互不相同 count 大于成员个数时返回全部成员
+//
+// count 为负数时返回 -count 个成员 成员可能重复
+func (si *SetIndex) SRandMember(key []byte, count int) ([][]byte, error) {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	targetSet := si.getSet(string(key))
+	if targetSet == nil {
+		return nil, logger.KeyIsNotExisted
+	}
+	if count < 0 {
+		return randomMembers(targetSet, -count, true), nil
+	}
+	return randomMembers(targetSet, count, false), nil
+}
+
+// SMove 把 member 从 source 移动到 destination 整个移动在一次加锁中完成 member 不在 source 中时返回 false
+func (si *SetIndex) SMove(source []byte, destination []byte, member []byte) (bool, error) {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	sourceSet := si.getSet(string(source))
+	if sourceSet == nil {
+		return false, logger.KeyIsNotExisted
+	}
+	if _, ok := sourceSet[string(member)]; !ok {
+		return false, nil
+	}
+	if string(source) == string(destination) {
+		return true, nil
+	}
+	e := si.expireSet(string(destination))
+	if e != nil {
+		return false, e
+	}
+	// 先添加再删除 中途失败的话最多是 member 同时存在于两个 set 中 不会丢失
+	_, e = si.addMembers(string(destination), [][]byte{member})
+	if e != nil {
+		return false, e
+	}
+	_, e = si.removeMembers(string(source), [][]byte{member})
+	if e != nil {
+		return false, e
+	}
+	return true, nil
+}
+
+// setOperation 集合运算的种类
+type setOperation int8
+
+const (
+	setInter setOperation = iota
+	setUnion
+	setDiff
+)
+
+// SInter 返回所有给定 set 的交集 不存在的 set 视为空集
+func (si *SetIndex) SInter(keys ...[]byte) [][]byte {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	return membersToSlice(si.computeSet(setInter, keys, 0))
+}
+
+// SUnion 返回所有给定 set 的并集 不存在的 set 视为空集
+func (si *SetIndex) SUnion(keys ...[]byte) [][]byte {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	return membersToSlice(si.computeSet(setUnion, keys, 0))
+}
+
+// SDiff 返回第一个 set 和其它所有 set 的差集 不存在的 set 视为空集
+func (si *SetIndex) SDiff(keys ...[]byte) [][]byte {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	return membersToSlice(si.computeSet(setDiff, keys, 0))
+}
+
+// SInterCard 返回交集的成员个数 limit 不为0时 个数达到 limit 就停止计算
+func (si *SetIndex) SInterCard(limit int, keys ...[]byte) (int, error) {
+	if limit < 0 {
+		return 0, logger.ParameterIsNotAllowed
+	}
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	return len(si.computeSet(setInter, keys, limit)), nil
+}
+
+// SInterStore 同 SInter 但是把结果存入 destination 返回结果的成员个数
+func (si *SetIndex) SInterStore(destination []byte, keys ...[]byte) (int, error) {
+	return si.computeAndStore(setInter, destination, keys)
+}
+
+// SUnionStore 同 SUnion 但是把结果存入 destination 返回结果的成员个数
+func (si *SetIndex) SUnionStore(destination []byte, keys ...[]byte) (int, error) {
+	return si.computeAndStore(setUnion, destination, keys)
+}
+
+// SDiffStore 同 SDiff 但是把结果存入 destination 返回结果的成员个数
+func (si *SetIndex) SDiffStore(destination []byte, keys ...[]byte) (int, error) {
+	return si.computeAndStore(setDiff, destination, keys)
+}
+
+// computeAndStore 计算集合运算的结果 然后用结果替换掉 destination 原来的内容 结果为空时 destination 会被删除
+//
+// 计算和写入在同一次加锁中完成 destination 也可以是参与运算的 set 之一
+func (si *SetIndex) computeAndStore(operation setOperation, destination []byte, keys [][]byte) (int, error) {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	result := membersToSlice(si.computeSet(operation, keys, 0))
+	if _, ok := si.index[string(destination)]; ok {
+		_, e := si.writeEntry(&storage.Entry{
+			EntryType: storage.TypeDeleteKey,
+			Key:       util.EncodeKeyAndField(string(destination), ""),
+			Value:     []byte{},
+			ExpiredAt: -1,
+		})
+		if e != nil {
+			return 0, e
+		}
+		delete(si.index, string(destination))
+	}
+	return si.addMembers(string(destination), result)
+}
+
+// computeSet 计算集合运算 不存在的 set 视为空集 limit 不为0时 结果的个数达到 limit 就停止计算 调用者需要持有锁
+func (si *SetIndex) computeSet(operation setOperation, keys [][]byte, limit int) map[string]struct{} {
+	result := make(map[string]struct{})
+	if len(keys) == 0 {
+		return result
+	}
+	isFull := func() bool {
+		return limit != 0 && len(result) >= limit
+	}
+
+	switch operation {
+	case setInter:
+		// 从最小的 set 开始遍历 检查成员是否在其它所有 set 中
+		smallest := si.getSet(string(keys[0]))
+		for _, key := range keys[1:] {
+			if len(si.getSet(string(key))) < len(smallest) {
+				smallest = si.getSet(string(key))
+			}
+		}
+		for member := range smallest {
+			isInAll := true
+			for _, key := range keys {
+				if _, ok := si.getSet(string(key))[member]; !ok {
+					isInAll = false
+					break
+				}
+			}
+			if isInAll {
+				result[member] = struct{}{}
+				if isFull() {
+					break
+				}
+			}
+		}
+	case setUnion:
+		for _, key := range keys {
+			for member := range si.getSet(string(key)) {
+				result[member] = struct{}{}
+			}
+		}
+	case setDiff:
+		for member := range si.getSet(string(keys[0])) {
+			isInOthers := false
+			for _, key := range keys[1:] {
+				if _, ok := si.getSet(string(key))[member]; ok {
+					isInOthers = true
+					break
+				}
+			}
+			if !isInOthers {
+				result[member] = struct{}{}
+			}
+		}
+	}
+	return result
+}
+
+// membersToSlice 把集合运算的结果转换为切片
+func membersToSlice(members map[string]struct{}) [][]byte {
+	result := make([][]byte, 0, len(members))
+	for member := range members {
+		result = append(result, []byte(member))
+	}
+	return result
+}
+
+// Del 删除整个 set
+func (si *SetIndex) Del(key []byte) error {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	if _, ok := si.index[string(key)]; !ok {
+		return logger.KeyIsNotExisted
+	}
+	_, e := si.writeEntry(&storage.Entry{
+		EntryType: storage.TypeDeleteKey,
+		Key:       util.EncodeKeyAndField(string(key), ""),
+		Value:     []byte{},
+		ExpiredAt: -1,
+	})
+	if e != nil {
+		return e
+	}
+	delete(si.index, string(key))
+	return nil
+}
+
+// Exist 检查 set 是否存在
+func (si *SetIndex) Exist(key []byte) bool {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	return si.getSet(string(key)) != nil
+}
+
+// ScanKeys 返回以 prefix 开头 位置不小于 cursor 并且没有过期的 set 中 ScanPage 需要的部分 见 scan.go
+func (si *SetIndex) ScanKeys(prefix []byte, cursor uint64, count int) []string {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	return mapScan(si.index, prefix, cursor, count, func(key string, _ map[string]*indexNode) bool {
+		return si.getSet(key) != nil
+	})
+}
+
+// addMembers 写入成员 新成员沿用 set 的过期时间 调用者需要持有写锁 并且保证 set 没有过期
+func (si *SetIndex) addMembers(key string, members [][]byte) (int, error) {
+	expiredAt := si.setExpiredAt(key)
+	result := 0
+	for _, member := range members {
+		if _, ok := si.index[key][string(member)]; ok {
+			continue
+		}
+		offset, e := si.writeEntry(&storage.Entry{
+			EntryType: storage.TypeRecord,
+			Key:       util.EncodeKeyAndField(key, string(member)),
+			Value:     []byte{},
+			ExpiredAt: expiredAt,
+		})
+		if e != nil {
+			return result, e
+		}
+		if _, ok := si.index[key]; !ok {
+			si.index[key] = make(map[string]*indexNode)
+		}
+		si.index[key][string(member)] = &indexNode{
+			fileID:    si.activeFile.GetFileID(),
+			offset:    offset,
+			expiredAt: expiredAt,
+		}
+		result += 1
+	}
+	return result, nil
+}
+
+// removeMembers 删除成员 删除后 set 为空则删除 set 调用者需要持有写锁
+func (si *SetIndex) removeMembers(key string, members [][]byte) (int, error) {
+	result := 0
+	for _, member := range members {
+		if _, ok := si.index[key][string(member)]; !ok {
+			continue
+		}
+		_, e := si.writeEntry(&storage.Entry{
+			EntryType: storage.TypeDelete,
+			Key:       util.EncodeKeyAndField(key, string(member)),
+			Value:     []byte{},
+			ExpiredAt: -1,
+		})
+		if e != nil {
+			return result, e
+		}
+		delete(si.index[key], string(member))
+		result += 1
+	}
+	if len(si.index[key]) == 0 {
+		delete(si.index, key)
+	}
+	return result, nil
+}
+
+// randomMembers 从 set 中随机选出 count 个成员 allowRepeat 为 false 时选出的成员互不相同
+func randomMembers(targetSet map[string]*indexNode, count int, allowRepeat bool) [][]byte {
+	members := make([][]byte, 0, len(targetSet))
+	for member := range targetSet {
+		members = append(members, []byte(member))
+	}
+	if len(members) == 0 {
+		return [][]byte{}
+	}
+	if allowRepeat {
+		result := make([][]byte, count)
+		for i := range result {
+			result[i] = members[rand.Intn(len(members))]
+		}
+		return result
+	}
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if count < len(members) {
+		members = members[:count]
+	}
+	return members
+}
+
+// writeEntry 尝试将entry写入文件 如果活跃文件写满则自动新开一个文件继续尝试写入 如果写入成功则返回nil和写入前的offset
+func (si *SetIndex) writeEntry(entry *storage.Entry) (int64, error) {
+	offset := si.activeFile.GetOffset()
+	e := si.activeFile.WriteEntryIntoFile(entry)
+	// 如果文件已满
+	if errors.Is(e, logger.FileBytesIsMaxedOut) {
+		// 先结束旧文件的定时同步 并且写入旧文件的 hint 文件
+		si.activeFile.StopSyncRoutine()
+		sealRecordFile(si.activeFile)
+		// 开一个新的文件 这个新的活跃文件的序号自动在之前的活跃文件上 + 1
+		si.activeFile, e = storage.NewRecordFile(si.fileIOMode, storage.Set, si.activeFile.GetFileID()+1, si.baseFolderPath, si.fileMaxSize)
+		if e != nil {
+			return 0, e
+		}
+		si.archivedFile[si.activeFile.GetFileID()] = si.activeFile
+		si.activeFile.StartSyncRoutine(si.syncDuration)
+		offset = si.activeFile.GetOffset()
+		e = si.activeFile.WriteEntryIntoFile(entry)
+		if e != nil {
+			return 0, e
+		}
+	} else if e != nil {
+		return 0, e
+	}
+	return offset, nil
+}
+
+// Merge 将存活的 entry 重写到新文件中 并且删除旧文件 merge 期间持有写锁
+func (si *SetIndex) Merge() error {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	var relocations []relocation
+	mw := newMergeWriter(storage.Set, si.fileIOMode, si.baseFolderPath, si.fileMaxSize, si.archivedFile)
+	for _, members := range si.index {
+		for _, node := range members {
+			r, e := mw.rewriteNode(si.archivedFile, node)
+			if e != nil {
+				mw.abort()
+				return e
+			}
+			relocations = append(relocations, r)
+		}
+	}
+
+	activeFile, archivedFile, e := mw.commit(si.activeFile, si.archivedFile, si.syncDuration, relocations)
+	if e != nil {
+		return e
+	}
+	si.activeFile = activeFile
+	si.archivedFile = archivedFile
+	return nil
+}
+
+// DeadBytesRatio 估算归档文件中已经失效的字节数所占的比例
+func (si *SetIndex) DeadBytesRatio() (float64, error) {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	var liveSize int64
+	for key, members := range si.index {
+		for member, node := range members {
+			if node.fileID != si.activeFile.GetFileID() {
+				liveSize += storage.EntrySize(len(util.EncodeKeyAndField(key, member)), 0, node.expiredAt)
+			}
+		}
+	}
+	return deadBytesRatio(si.activeFile, si.archivedFile, liveSize)
+}
+
+// handleEntry 接收Entry 并且写入Set索引
+func (si *SetIndex) handleEntry(entry *storage.Entry, fileID uint32, offset int64) error {
+	key, member, e := util.DecodeKeyAndField(entry.Key)
+	if e != nil {
+		return e
+	}
+
+	switch entry.EntryType {
+	case storage.TypeDeleteKey:
+		delete(si.index, key)
+	case storage.TypeDelete:
+		delete(si.index[key], member)
+		if len(si.index[key]) == 0 {
+			delete(si.index, key)
+		}
+	case storage.TypeExpire:
+		writtenAt, e := decodeExpireTime(entry.Value)
+		if e != nil {
+			return e
+		}
+		for _, node := range si.index[key] {
+			if !isExpired(node.expiredAt, writtenAt) {
+				node.expiredAt = entry.ExpiredAt
+			}
+		}
+	case storage.TypeRecord:
+		// 已经过期的成员也要先写入索引 之后的 TypeExpire entry 可能修改它的过期时间 重放结束之后再统一删除
+		if _, ok := si.index[key]; !ok {
+			si.index[key] = make(map[string]*indexNode)
+		}
+		si.index[key][member] = &indexNode{
+			fileID:    fileID,
+			offset:    offset,
+			expiredAt: entry.ExpiredAt,
+		}
+	}
+	return nil
+}
+
+// getSet 返回没有过期的 set 不存在或者已经过期时返回 nil 调用者需要持有锁
+func (si *SetIndex) getSet(key string) map[string]*indexNode {
+	targetSet := si.index[key]
+	if len(targetSet) == 0 || isExpired(si.setExpiredAt(key), time.Now().UnixMilli()) {
+		return nil
+	}
+	return targetSet
+}
+
+// setExpiredAt 返回 set 的过期时间 set 的成员的过期时间都是相同的 所以取任意一个成员的即可 set 不存在时返回-1 调用者需要持有锁
+func (si *SetIndex) setExpiredAt(key string) int64 {
+	for _, node := range si.index[key] {
+		return node.expiredAt
+	}
+	return -1
+}
+
+// expireSet 如果 set 已经过期 就写入删除 entry 并且删除 set 调用者需要持有写锁
+func (si *SetIndex) expireSet(key string) error {
+	if len(si.index[key]) == 0 || si.getSet(key) != nil {
+		return nil
+	}
+	_, e := si.writeEntry(&storage.Entry{
+		EntryType: storage.TypeDeleteKey,
+		Key:       util.EncodeKeyAndField(key, ""),
+		Value:     []byte{},
+		ExpiredAt: -1,
+	})
+	if e != nil {
+		return e
+	}
+	delete(si.index, key)
+	return nil
+}
+
+// Expire 修改 set 的过期时间 expiredAt 为-1时去掉过期时间
+func (si *SetIndex) Expire(key []byte, expiredAt int64) error {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	targetSet := si.getSet(string(key))
+	if targetSet == nil {
+		return logger.KeyIsNotExisted
+	}
+	_, e := si.writeEntry(&storage.Entry{
+		EntryType: storage.TypeExpire,
+		Key:       util.EncodeKeyAndField(string(key), ""),
+		Value:     encodeExpireTime(time.Now().UnixMilli()),
+		ExpiredAt: expiredAt,
+	})
+	if e != nil {
+		return e
+	}
+	for _, node := range targetSet {
+		node.expiredAt = expiredAt
+	}
+	si.expiry.schedule(si, string(key), expiredAt)
+	return nil
+}
+
+// TTL 返回 set 的过期时间 -1 表示永不过期
+func (si *SetIndex) TTL(key []byte) (int64, error) {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	if si.getSet(string(key)) == nil {
+		return 0, logger.KeyIsNotExisted
+	}
+	return si.setExpiredAt(string(key)), nil
+}
+
+// SetExpiryScheduler 使用 es 进行主动过期 同时把有过期时间的 set 交给 es
+func (si *SetIndex) SetExpiryScheduler(es *ExpiryScheduler) {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	si.expiry = es
+	for key := range si.index {
+		es.schedule(si, key, si.setExpiredAt(key))
+	}
+}
+
+// ExpireKey 如果 set 在 now 之前过期 就写入删除 entry 并且删除 set 返回 set 剩下的过期时间
+func (si *SetIndex) ExpireKey(key string, now int64) (int64, error) {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	expiredAt := si.setExpiredAt(key)
+	if !isExpired(expiredAt, now) {
+		// 过期之前被修改了过期时间 或者已经被删除了
+		return expiredAt, nil
+	}
+	return -1, si.expireSet(key)
+}
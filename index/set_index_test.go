@@ -0,0 +1,190 @@
+package index
+
+import (
+	"MisakaDB/logger"
+	"MisakaDB/storage"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSetIndex(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	setIndex, e := BuildSetIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 20; i++ {
+		n, e := setIndex.SAdd([]byte("testSet"), []byte("testMember"+strconv.Itoa(i)), []byte("testMember"+strconv.Itoa(i/2)))
+		if e != nil {
+			t.Fatal(e)
+		}
+		t.Log(n)
+	}
+	n, e := setIndex.SRem([]byte("testSet"), []byte("testMember0"), []byte("testMember1"), []byte("notExist"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if n != 2 {
+		t.Error(n)
+	}
+	isMoved, e := setIndex.SMove([]byte("testSet"), []byte("testSet2"), []byte("testMember2"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !isMoved {
+		t.Error("member is not moved")
+	}
+	popped, e := setIndex.SPop([]byte("testSet"), 3)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(popped) != 3 {
+		t.Error(len(popped))
+	}
+	randMembers, e := setIndex.SRandMember([]byte("testSet"), -30)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(randMembers) != 30 {
+		t.Error(len(randMembers))
+	}
+	e = setIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 从文件重建索引 结果应该一样
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	setIndex, e = BuildSetIndex(activeFiles[storage.Set], archiveFiles[storage.Set], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = setIndex.CloseIndex()
+	}()
+	card, e := setIndex.SCard([]byte("testSet"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if card != 20-2-1-3 {
+		t.Error(card)
+	}
+	for _, v := range popped {
+		isMember, e := setIndex.SIsMember([]byte("testSet"), v)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if isMember {
+			t.Error(string(v))
+		}
+	}
+	result, e := setIndex.SMIsMember([]byte("testSet2"), []byte("testMember2"), []byte("testMember3"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !result[0] || result[1] {
+		t.Error(result)
+	}
+}
+
+func TestSetIndexOperation(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	setIndex, e := BuildSetIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 10; i++ {
+		_, e = setIndex.SAdd([]byte("set1"), []byte(strconv.Itoa(i)))
+		if e != nil {
+			t.Fatal(e)
+		}
+		_, e = setIndex.SAdd([]byte("set2"), []byte(strconv.Itoa(i+5)))
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	if result := setIndex.SInter([]byte("set1"), []byte("set2")); len(result) != 5 {
+		t.Error(len(result))
+	}
+	if result := setIndex.SUnion([]byte("set1"), []byte("set2"), []byte("notExist")); len(result) != 15 {
+		t.Error(len(result))
+	}
+	if result := setIndex.SDiff([]byte("set1"), []byte("set2")); len(result) != 5 {
+		t.Error(len(result))
+	}
+	if result := setIndex.SInter([]byte("set1"), []byte("notExist")); len(result) != 0 {
+		t.Error(len(result))
+	}
+	card, e := setIndex.SInterCard(3, []byte("set1"), []byte("set2"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if card != 3 {
+		t.Error(card)
+	}
+
+	// destination 同时参与运算
+	n, e := setIndex.SInterStore([]byte("set1"), []byte("set1"), []byte("set2"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if n != 5 {
+		t.Error(n)
+	}
+	n, e = setIndex.SDiffStore([]byte("set3"), []byte("set2"), []byte("set1"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if n != 5 {
+		t.Error(n)
+	}
+	// 结果为空时 destination 被删除
+	n, e = setIndex.SInterStore([]byte("set3"), []byte("set1"), []byte("set3"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if n != 0 || setIndex.Exist([]byte("set3")) {
+		t.Error("set3 should be deleted")
+	}
+	e = setIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 从文件重建索引 存储的结果应该还在
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	setIndex, e = BuildSetIndex(activeFiles[storage.Set], archiveFiles[storage.Set], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = setIndex.CloseIndex()
+	}()
+	card, e = setIndex.SCard([]byte("set1"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if card != 5 {
+		t.Error(card)
+	}
+	if setIndex.Exist([]byte("set3")) {
+		t.Error("set3 should not exist")
+	}
+}
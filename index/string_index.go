@@ -4,6 +4,7 @@ import (
 	"MisakaDB/customDataStructure/adaptiveRadixTree"
 	"MisakaDB/logger"
 	"MisakaDB/storage"
+	"bytes"
 	"errors"
 	"sync"
 	"time"
@@ -19,10 +20,12 @@ type StringIndex struct {
 	baseFolderPath string
 	fileMaxSize    int64
 	syncDuration   time.Duration
+
+	expiry *ExpiryScheduler
 }
 
-// BuildStringIndex 给定当前活跃文件和归档文件 重新构建String类型的索引 该方法只会在数据库启动时被调用 如果不存在旧的文件 则新建一个活跃文件
-func BuildStringIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*storage.RecordFile, fileIOMode storage.FileIOType, baseFolderPath string, fileMaxSize int64, syncDuration time.Duration) (*StringIndex, error) {
+// BuildStringIndex 给定当前活跃文件和归档文件 重新构建String类型的索引 该方法只会在数据库启动时被调用 如果不存在旧的文件 则新建一个活跃文件 isRepair 为 true 时遇到损坏的文件会截断而不是报错
+func BuildStringIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*storage.RecordFile, fileIOMode storage.FileIOType, baseFolderPath string, fileMaxSize int64, syncDuration time.Duration, isRepair bool) (*StringIndex, error) {
 
 	result := &StringIndex{
 		index:          adaptiveRadixTree.New[*indexNode](),
@@ -34,13 +37,7 @@ func BuildStringIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*s
 		syncDuration:   syncDuration,
 	}
 
-	var (
-		e           error
-		offset      int64
-		fileLength  int64
-		entryLength int64
-		entry       *storage.Entry
-	)
+	var e error
 
 	// 如果活跃文件都读取不到的话 肯定也没有归档文件了 直接返回即可
 	if activeFile == nil {
@@ -56,27 +53,31 @@ func BuildStringIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*s
 
 	// 有归档文件的话 挨个读取归档文件 构建索引
 	// 读取所有归档文件的entry 因为活跃文件也在这个归档文件里 所以不再单独读取活跃文件
-	for i := uint32(1); i <= uint32(len(archivedFile)); i++ {
-		recordFile, ok := archivedFile[i]
-		if ok == false {
-			continue
-		}
-		offset = 0
-		fileLength, e = recordFile.Length()
-		if e != nil {
-			return nil, e
+	hintedFiles, e := loadRecordFiles(result.activeFile, result.archivedFile, result.handleEntry, true, isRepair)
+	if e != nil {
+		return nil, e
+	}
+	// 重放时保留了已经过期的值 现在可以删掉了
+	var expiredKeys [][]byte
+	now := time.Now().UnixMilli()
+	result.index.ForEach(func(node adaptiveRadixTree.Node[*indexNode]) bool {
+		if isExpired(node.Value().expiredAt, now) {
+			expiredKeys = append(expiredKeys, node.Key())
 		}
-		for offset < fileLength {
-			entry, entryLength, e = recordFile.ReadIntoEntry(offset)
-			if e != nil {
-				return nil, e
-			}
-			e = result.handleEntry(entry, recordFile.GetFileID(), offset)
-			if e != nil {
-				return nil, e
-			}
-			offset += entryLength
+		return true
+	})
+	for _, key := range expiredKeys {
+		result.index.Delete(key)
+	}
+	// 从 hint 重放出来的节点还没有值 按节点记录的位置读出来
+	result.index.ForEach(func(node adaptiveRadixTree.Node[*indexNode]) bool {
+		if hintedFiles[node.Value().fileID] {
+			e = loadNodeValue(result.archivedFile, node.Value())
 		}
+		return e == nil
+	})
+	if e != nil {
+		return nil, e
 	}
 	result.activeFile.StartSyncRoutine(syncDuration)
 
@@ -125,6 +126,7 @@ func (si *StringIndex) Set(key []byte, value []byte, expiredAt int64) error {
 
 	// 写入索引
 	_, _ = si.index.Insert(key, indexN)
+	si.expiry.schedule(si, string(key), expiredAt)
 	return nil
 }
 
@@ -275,14 +277,18 @@ func (si *StringIndex) Append(key []byte, appendValue []byte) error {
 
 // Del 如果key存在 则删除key对应的value
 func (si *StringIndex) Del(key []byte) error {
-	var isOperationSuccess bool
-	si.mutex.RLock()
-	value, isOperationSuccess := si.index.Delete(key)
-	if !isOperationSuccess {
-		si.mutex.RUnlock()
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	value, isFound := si.index.Search(key)
+	if !isFound {
+		return logger.KeyIsNotExisted
+	}
+	// 已经过期的值 重放时本来就会被跳过 不需要再写删除 entry
+	if isExpired(value.expiredAt, time.Now().UnixMilli()) {
+		si.index.Delete(key)
 		return logger.KeyIsNotExisted
 	}
-	si.mutex.RUnlock()
 
 	entry := &storage.Entry{
 		EntryType: storage.TypeDelete,
@@ -290,24 +296,58 @@ func (si *StringIndex) Del(key []byte) error {
 		Value:     value.value,
 		ExpiredAt: 0,
 	}
-
-	si.mutex.Lock()
 	_, e := si.writeEntry(entry)
 	if e != nil {
 		return e
 	}
-	si.mutex.Unlock()
+	si.index.Delete(key)
 	return nil
 }
 
+// Exist 检查key是否存在并且没有过期
+func (si *StringIndex) Exist(key []byte) bool {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	value, isFound := si.index.Search(key)
+	return isFound && !isExpired(value.expiredAt, time.Now().UnixMilli())
+}
+
+// ScanKeys 返回以 prefix 开头 位置不小于 cursor 并且没有过期的 key 中 ScanPage 需要的部分 见 scan.go
+//
+// ART 按字典序遍历 从 prefix 和游标对应的 key 中更大的一个开始 收集够了就停下
+func (si *StringIndex) ScanKeys(prefix []byte, cursor uint64, count int) []string {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	start := []byte(scanStart(cursor))
+	if bytes.Compare(prefix, start) > 0 {
+		start = prefix
+	}
+	now := time.Now().UnixMilli()
+	collector := &scanCollector{count: count}
+	si.index.ForEachFrom(start, func(node adaptiveRadixTree.Node[*indexNode]) bool {
+		if !bytes.HasPrefix(node.Key(), prefix) {
+			// 后面的 key 都比 prefix 开头的 key 大
+			return false
+		}
+		if isExpired(node.Value().expiredAt, now) {
+			return true
+		}
+		return collector.add(string(node.Key()))
+	})
+	return collector.keys
+}
+
 // writeEntry 尝试将entry写入文件 如果活跃文件写满则自动新开一个文件继续尝试写入 如果写入成功则返回nil和写入前的offset
 func (si *StringIndex) writeEntry(entry *storage.Entry) (int64, error) {
 	offset := si.activeFile.GetOffset()
 	e := si.activeFile.WriteEntryIntoFile(entry)
 	// 如果文件已满
 	if errors.Is(e, logger.FileBytesIsMaxedOut) {
-		// 先结束旧文件的定时同步
+		// 先结束旧文件的定时同步 并且写入旧文件的 hint 文件
 		si.activeFile.StopSyncRoutine()
+		sealRecordFile(si.activeFile)
 		// 开一个新的文件 这个新的活跃文件的序号自动在之前的活跃文件上 + 1
 		si.activeFile, e = storage.NewRecordFile(si.fileIOMode, storage.String, si.activeFile.GetFileID()+1, si.baseFolderPath, si.fileMaxSize)
 		if e != nil {
@@ -329,6 +369,58 @@ func (si *StringIndex) writeEntry(entry *storage.Entry) (int64, error) {
 	return offset, nil
 }
 
+// Merge 将存活的 entry 重写到新文件中 并且删除旧文件 merge 期间持有写锁
+func (si *StringIndex) Merge() error {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	var (
+		e           error
+		r           relocation
+		relocations []relocation
+	)
+	mw := newMergeWriter(storage.String, si.fileIOMode, si.baseFolderPath, si.fileMaxSize, si.archivedFile)
+	now := time.Now().UnixMilli()
+	si.index.ForEach(func(node adaptiveRadixTree.Node[*indexNode]) bool {
+		if isExpired(node.Value().expiredAt, now) { // 过期的就不再重写了
+			return true
+		}
+		r, e = mw.rewriteNode(si.archivedFile, node.Value())
+		if e != nil {
+			return false
+		}
+		relocations = append(relocations, r)
+		return true
+	})
+	if e != nil {
+		mw.abort()
+		return e
+	}
+
+	activeFile, archivedFile, e := mw.commit(si.activeFile, si.archivedFile, si.syncDuration, relocations)
+	if e != nil {
+		return e
+	}
+	si.activeFile = activeFile
+	si.archivedFile = archivedFile
+	return nil
+}
+
+// DeadBytesRatio 估算归档文件中已经失效的字节数所占的比例
+func (si *StringIndex) DeadBytesRatio() (float64, error) {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	var liveSize int64
+	si.index.ForEach(func(node adaptiveRadixTree.Node[*indexNode]) bool {
+		if node.Value().fileID != si.activeFile.GetFileID() {
+			liveSize += storage.EntrySize(len(node.Key()), len(node.Value().value), node.Value().expiredAt)
+		}
+		return true
+	})
+	return deadBytesRatio(si.activeFile, si.archivedFile, liveSize)
+}
+
 // handleEntry 接收Entry 并且写入String索引 注意它只对索引进行操作
 func (si *StringIndex) handleEntry(entry *storage.Entry, fileID uint32, offset int64) error {
 
@@ -341,20 +433,96 @@ func (si *StringIndex) handleEntry(entry *storage.Entry, fileID uint32, offset i
 			_, _ = si.index.Delete(entry.Key)
 		}
 	case storage.TypeRecord:
-
-		// DeleteEntry 不需要过期检查的原因和 HashIndex 的原因相近
-		// 如果过期时间为-1则说明永不过期
-		if entry.ExpiredAt < time.Now().UnixMilli() && entry.ExpiredAt != -1 {
-			// attention 过期logger
-			return nil
-		}
-
+		// 已经过期的值也要先写入索引 之后的 TypeExpire entry 可能修改它的过期时间 重放结束之后再统一删除
 		_, _ = si.index.Insert(entry.Key, &indexNode{
 			value:     entry.Value,
 			expiredAt: entry.ExpiredAt,
 			fileID:    fileID,
 			offset:    offset,
 		})
+	case storage.TypeExpire:
+		writtenAt, e := decodeExpireTime(entry.Value)
+		if e != nil {
+			return e
+		}
+		value, isFound := si.index.Search(entry.Key)
+		if isFound && !isExpired(value.expiredAt, writtenAt) {
+			value.expiredAt = entry.ExpiredAt
+		}
 	}
 	return nil
 }
+
+// Expire 修改 key 的过期时间 expiredAt 为-1时去掉过期时间
+func (si *StringIndex) Expire(key []byte, expiredAt int64) error {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	now := time.Now().UnixMilli()
+	value, isFound := si.index.Search(key)
+	if !isFound || isExpired(value.expiredAt, now) {
+		return logger.KeyIsNotExisted
+	}
+	_, e := si.writeEntry(&storage.Entry{
+		EntryType: storage.TypeExpire,
+		Key:       key,
+		Value:     encodeExpireTime(now),
+		ExpiredAt: expiredAt,
+	})
+	if e != nil {
+		return e
+	}
+	value.expiredAt = expiredAt
+	si.expiry.schedule(si, string(key), expiredAt)
+	return nil
+}
+
+// TTL 返回 key 的过期时间 -1 表示永不过期
+func (si *StringIndex) TTL(key []byte) (int64, error) {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	value, isFound := si.index.Search(key)
+	if !isFound || isExpired(value.expiredAt, time.Now().UnixMilli()) {
+		return 0, logger.KeyIsNotExisted
+	}
+	return value.expiredAt, nil
+}
+
+// SetExpiryScheduler 使用 es 进行主动过期 同时把有过期时间的 key 交给 es
+func (si *StringIndex) SetExpiryScheduler(es *ExpiryScheduler) {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	si.expiry = es
+	si.index.ForEach(func(node adaptiveRadixTree.Node[*indexNode]) bool {
+		es.schedule(si, string(node.Key()), node.Value().expiredAt)
+		return true
+	})
+}
+
+// ExpireKey 如果 key 在 now 之前过期 就写入删除 entry 并删除 key 返回 key 剩下的过期时间
+func (si *StringIndex) ExpireKey(key string, now int64) (int64, error) {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	value, isFound := si.index.Search([]byte(key))
+	if !isFound {
+		return -1, nil
+	}
+	if !isExpired(value.expiredAt, now) {
+		// 过期之前被覆盖了
+		return value.expiredAt, nil
+	}
+	_, e := si.writeEntry(&storage.Entry{
+		EntryType: storage.TypeDelete,
+		Key:       []byte(key),
+		Value:     []byte{},
+		ExpiredAt: 0,
+	})
+	if e != nil {
+		return -1, e
+	}
+	si.index.Delete([]byte(key))
+	return -1, nil
+}
@@ -19,7 +19,7 @@ func TestBuildStringIndex(t *testing.T) {
 		t.Error(e)
 		return
 	}
-	stringIndex, e := BuildStringIndex(activeFiles[storage.String], archiveFiles[storage.String], storage.TraditionalIOFile, "D:\\MisakaDBTest", 50000000, time.Second)
+	stringIndex, e := BuildStringIndex(activeFiles[storage.String], archiveFiles[storage.String], storage.TraditionalIOFile, "D:\\MisakaDBTest", 50000000, time.Second, false)
 	if e != nil {
 		t.Error(e)
 		return
@@ -6,32 +6,145 @@ import (
 	"MisakaDB/storage"
 	"MisakaDB/util"
 	"errors"
-	"strconv"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 type zsetNode struct {
 	indexNode
-	score int
+	score float64
 }
 
+// ZSetMember 有序集合的成员和它的 score
+type ZSetMember struct {
+	Member []byte
+	Score  float64
+}
+
+// ScoreBound score 区间的边界 IsExclusive 为 true 时是开区间的边界 即不包含 Score 本身
+type ScoreBound struct {
+	Score       float64
+	IsExclusive bool
+}
+
+// LexBound member 字典序区间的边界 Infinity 为 -1 时表示负无穷 为 1 时表示正无穷 此时 Member 和 IsExclusive 都会被忽略
+type LexBound struct {
+	Member      []byte
+	IsExclusive bool
+	Infinity    int8
+}
+
+// zsetScore 跳表的键 按 (score, member) 排序 score 相同的成员按 member 的字典序排序 这样 score 相同的成员不会互相覆盖
 type zsetScore struct {
-	score int
+	score    float64
+	member   string
+	boundary int8 // 不为0时只用于区间查询的边界 -1 比 score 相同的所有成员都小 1 比 score 相同的所有成员都大
 }
 
 func (z zsetScore) Compare(other skipList.Comparable) int {
-	return z.score - other.(zsetScore).score
+	o := other.(zsetScore)
+	switch {
+	case z.score < o.score:
+		return -1
+	case z.score > o.score:
+		return 1
+	case z.boundary != o.boundary:
+		return int(z.boundary) - int(o.boundary)
+	}
+	return strings.Compare(z.member, o.member)
 }
 
 func (z zsetScore) String() string {
-	return strconv.Itoa(z.score)
+	return util.FormatScore(z.score) + " " + z.member
+}
+
+// zsetLex 字典序区间的边界 只和跳表中的 zsetScore 比较 member 所以只有在所有成员的 score 都相同时才有意义 这一点和 redis 一样
+type zsetLex struct {
+	member   string
+	infinity int8
+	boundary int8 // -1 比相同的 member 小 1 比相同的 member 大
+}
+
+func (z zsetLex) Compare(other skipList.Comparable) int {
+	if z.infinity != 0 {
+		return int(z.infinity)
+	}
+	result := strings.Compare(z.member, other.(zsetScore).member)
+	if result != 0 {
+		return result
+	}
+	return int(z.boundary)
+}
+
+func (z zsetLex) String() string {
+	return z.member
+}
+
+// lexInterval 返回 member 在 min 和 max 之间的所有成员在跳表中对应的闭区间
+func lexInterval(min, max LexBound) (lower zsetLex, upper zsetLex) {
+	lower = zsetLex{member: string(min.Member), infinity: min.Infinity, boundary: -1}
+	if min.IsExclusive {
+		lower.boundary = 1
+	}
+	upper = zsetLex{member: string(max.Member), infinity: max.Infinity, boundary: 1}
+	if max.IsExclusive {
+		upper.boundary = -1
+	}
+	return lower, upper
+}
+
+// scoreKey 返回成员在跳表中对应的键
+func (z *zsetNode) scoreKey() zsetScore {
+	return zsetScore{score: z.score, member: string(z.value)}
+}
+
+// scoreInterval 返回 score 在 min 和 max 之间的所有成员在跳表中对应的闭区间 区间为空时 ok 为 false
+func scoreInterval(min, max ScoreBound) (lower zsetScore, upper zsetScore, ok bool) {
+	lower = zsetScore{score: min.Score, boundary: -1}
+	if min.IsExclusive {
+		lower.boundary = 1
+	}
+	upper = zsetScore{score: max.Score, boundary: 1}
+	if max.IsExclusive {
+		upper.boundary = -1
+	}
+	return lower, upper, lower.Compare(upper) < 0
 }
 
 type zset struct {
-	dict      map[string]*zsetNode
-	skipList  *skipList.SkipList[*zsetNode]
-	expireNum int // 过期计数 计算有过期删除的这个需求的 member 的数量 即 expiredAt 字段不为-1的 member 数量 如果它是0 获取有序集合信息的时候就不需要检查是否过期
+	dict          map[string]*zsetNode
+	skipList      *skipList.SkipList[*zsetNode]
+	expireNum     int   // 过期计数 计算有过期删除的这个需求的 member 的数量 即 expiredAt 字段不为-1的 member 数量 如果它是0 获取有序集合信息的时候就不需要检查是否过期
+	nextExpiredAt int64 // 最早的过期时间 成员被删除时不会更新 所以只是一个下界 在它之前获取有序集合信息的时候也不需要检查是否过期
+}
+
+// newZset 新建一个空的有序集合
+func newZset() *zset {
+	return &zset{
+		dict:          make(map[string]*zsetNode),
+		skipList:      skipList.NewSkipList[*zsetNode](),
+		nextExpiredAt: -1,
+	}
+}
+
+// setExpiredAt 修改成员的过期时间 同时维护 expireNum 和 nextExpiredAt
+func (z *zset) setExpiredAt(node *zsetNode, expiredAt int64) {
+	if node.expiredAt == -1 && expiredAt != -1 {
+		z.expireNum += 1
+	} else if node.expiredAt != -1 && expiredAt == -1 {
+		z.expireNum -= 1
+	}
+	node.expiredAt = expiredAt
+	z.nextExpiredAt = earlierExpiredAt(z.nextExpiredAt, expiredAt)
+}
+
+// hasExpired 检查有序集合中是否可能有在 now 之前过期的成员
+func (z *zset) hasExpired(now int64) bool {
+	return z.expireNum != 0 && isExpired(z.nextExpiredAt, now)
 }
 
 type ZSetIndex struct {
@@ -45,10 +158,12 @@ type ZSetIndex struct {
 	baseFolderPath string
 	fileMaxSize    int64
 	syncDuration   time.Duration
+
+	expiry *ExpiryScheduler
 }
 
-// BuildZSetIndex 给定当前活跃文件和归档文件 重新构建ZSet类型的索引 该方法只会在数据库启动时被调用 如果不存在旧的文件 则新建一个活跃文件
-func BuildZSetIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*storage.RecordFile, fileIOMode storage.FileIOType, baseFolderPath string, fileMaxSize int64, syncDuration time.Duration) (*ZSetIndex, error) {
+// BuildZSetIndex 给定当前活跃文件和归档文件 重新构建ZSet类型的索引 该方法只会在数据库启动时被调用 如果不存在旧的文件 则新建一个活跃文件 isRepair 为 true 时遇到损坏的文件会截断而不是报错
+func BuildZSetIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*storage.RecordFile, fileIOMode storage.FileIOType, baseFolderPath string, fileMaxSize int64, syncDuration time.Duration, isRepair bool) (*ZSetIndex, error) {
 
 	result := &ZSetIndex{
 		index:          make(map[string]*zset),
@@ -60,16 +175,10 @@ func BuildZSetIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*sto
 		syncDuration:   syncDuration,
 	}
 
-	var (
-		e           error
-		offset      int64
-		fileLength  int64
-		entryLength int64
-		entry       *storage.Entry
-	)
+	var e error
 
 	if activeFile == nil {
-		result.activeFile, e = storage.NewRecordFile(fileIOMode, storage.List, 1, result.baseFolderPath, result.fileMaxSize)
+		result.activeFile, e = storage.NewRecordFile(fileIOMode, storage.ZSet, 1, result.baseFolderPath, result.fileMaxSize)
 		if e != nil {
 			return nil, e
 		}
@@ -79,26 +188,17 @@ func BuildZSetIndex(activeFile *storage.RecordFile, archivedFile map[uint32]*sto
 		return result, nil
 	}
 
-	for i := uint32(0); i < uint32(len(archivedFile)); i++ {
-		recordFile, ok := archivedFile[i]
-		if !ok {
-			continue
-		}
-		offset = 0
-		fileLength, e = recordFile.Length()
-		if e != nil {
-			return nil, e
-		}
-		for offset < fileLength {
-			entry, entryLength, e = recordFile.ReadIntoEntry(offset)
-			if e != nil {
-				return nil, e
-			}
-			e = result.handleEntry(entry, recordFile.GetFileID(), offset)
-			if e != nil {
-				return nil, e
+	_, e = loadRecordFiles(result.activeFile, result.archivedFile, result.handleEntry, true, isRepair)
+	if e != nil {
+		return nil, e
+	}
+	// 重放时保留了已经过期的成员 现在可以删掉了
+	now := time.Now().UnixMilli()
+	for key, targetZset := range result.index {
+		for member, node := range targetZset.dict {
+			if isExpired(node.expiredAt, now) {
+				result.deleteReplayedMember(key, member)
 			}
-			offset += entryLength
 		}
 	}
 
@@ -127,7 +227,8 @@ func (zi *ZSetIndex) writeEntry(entry *storage.Entry) (int64, error) {
 	e := zi.activeFile.WriteEntryIntoFile(entry)
 	if errors.Is(e, logger.FileBytesIsMaxedOut) {
 		zi.activeFile.StopSyncRoutine()
-		zi.activeFile, e = storage.NewRecordFile(zi.fileIOMode, storage.List, zi.activeFile.GetFileID()+1, zi.baseFolderPath, zi.fileMaxSize)
+		sealRecordFile(zi.activeFile)
+		zi.activeFile, e = storage.NewRecordFile(zi.fileIOMode, storage.ZSet, zi.activeFile.GetFileID()+1, zi.baseFolderPath, zi.fileMaxSize)
 		if e != nil {
 			return 0, e
 		}
@@ -144,38 +245,108 @@ func (zi *ZSetIndex) writeEntry(entry *storage.Entry) (int64, error) {
 	return offset, nil
 }
 
-// handleEntry 从文件中还原列表时 按 entry 对 index 进行操作
-func (zi *ZSetIndex) handleEntry(entry *storage.Entry, fileID uint32, offset int64) error {
+// Merge 将存活的 entry 重写到新文件中 并且删除旧文件 merge 期间持有写锁
+func (zi *ZSetIndex) Merge() error {
+	zi.mutex.Lock()
+	defer zi.mutex.Unlock()
 
-	if entry.ExpiredAt < time.Now().UnixMilli() && entry.ExpiredAt != -1 {
-		return nil
+	var relocations []relocation
+	mw := newMergeWriter(storage.ZSet, zi.fileIOMode, zi.baseFolderPath, zi.fileMaxSize, zi.archivedFile)
+	now := time.Now().UnixMilli()
+	for _, targetZset := range zi.index {
+		for _, node := range targetZset.dict {
+			if isExpired(node.expiredAt, now) { // 过期的就不再重写了
+				continue
+			}
+			r, e := mw.rewriteNode(zi.archivedFile, &node.indexNode)
+			if e != nil {
+				mw.abort()
+				return e
+			}
+			relocations = append(relocations, r)
+		}
 	}
 
-	switch entry.EntryType {
-	case storage.TypeDelete:
-		targetZset := zi.index[string(entry.Key)]
-		_ = targetZset.skipList.DeleteNode(zsetScore{score: targetZset.dict[string(entry.Value)].score})
-		delete(targetZset.dict, string(entry.Value))
+	activeFile, archivedFile, e := mw.commit(zi.activeFile, zi.archivedFile, zi.syncDuration, relocations)
+	if e != nil {
+		return e
+	}
+	zi.activeFile = activeFile
+	zi.archivedFile = archivedFile
+	return nil
+}
 
-		if targetZset.skipList.Length() == 0 {
-			delete(zi.index, string(entry.Key))
+// DeadBytesRatio 估算归档文件中已经失效的字节数所占的比例
+func (zi *ZSetIndex) DeadBytesRatio() (float64, error) {
+	zi.mutex.RLock()
+	defer zi.mutex.RUnlock()
+
+	var liveSize int64
+	for key, targetZset := range zi.index {
+		for member, node := range targetZset.dict {
+			if node.fileID != zi.activeFile.GetFileID() {
+				liveSize += storage.EntrySize(len(key), len(util.EncodeKeyAndField(member, util.FormatScore(node.score))), node.expiredAt)
+			}
 		}
+	}
+	return deadBytesRatio(zi.activeFile, zi.archivedFile, liveSize)
+}
+
+// deleteReplayedMember 还原时删除成员 成员不存在时什么都不做
+func (zi *ZSetIndex) deleteReplayedMember(key string, member string) {
+	targetZset, ok := zi.index[key]
+	if !ok {
+		return
+	}
+	targetNode, ok := targetZset.dict[member]
+	if !ok {
+		return
+	}
+	_ = targetZset.skipList.DeleteNode(targetNode.scoreKey())
+	delete(targetZset.dict, member)
+	if targetNode.expiredAt != -1 {
+		targetZset.expireNum -= 1
+	}
+	if targetZset.skipList.Length() == 0 {
+		delete(zi.index, key)
+	}
+}
+
+// handleEntry 从文件中还原列表时 按 entry 对 index 进行操作
+func (zi *ZSetIndex) handleEntry(entry *storage.Entry, fileID uint32, offset int64) error {
+
+	switch entry.EntryType {
+	case storage.TypeDeleteKey:
+		delete(zi.index, string(entry.Key))
+		return nil
+	case storage.TypeDelete:
+		// merge 之后旧文件可能没删干净 或者对应的成员在还原时已经过期 所以这里要允许删除不存在的成员
+		zi.deleteReplayedMember(string(entry.Key), string(entry.Value))
 		return nil
 	case storage.TypeRecord:
 		memberString, scoreString, e := util.DecodeKeyAndField(entry.Value)
 		if e != nil {
 			return e
 		}
-		score, _ := strconv.Atoi(scoreString)
+		// 已经过期的成员也要先写入索引 之后的 TypeExpire entry 可能修改它的过期时间 重放结束之后再统一删除
+		// 旧版本的 score 是用 strconv.Itoa 写入的整数 同样可以按浮点数解析
+		score, e := util.ParseScore(scoreString)
+		if e != nil {
+			return e
+		}
 
 		targetZset, ok := zi.index[string(entry.Key)]
 		if !ok {
-			targetZset = &zset{
-				dict:     make(map[string]*zsetNode),
-				skipList: skipList.NewSkipList[*zsetNode](),
-			}
+			targetZset = newZset()
 			zi.index[string(entry.Key)] = targetZset
 		}
+		// 成员已经存在的话 要先删掉旧的 score 对应的节点
+		if oldNode, ok := targetZset.dict[memberString]; ok {
+			_ = targetZset.skipList.DeleteNode(oldNode.scoreKey())
+			if oldNode.expiredAt != -1 {
+				targetZset.expireNum -= 1
+			}
+		}
 		targetNode := &zsetNode{
 			indexNode: indexNode{
 				value:     []byte(memberString),
@@ -186,7 +357,26 @@ func (zi *ZSetIndex) handleEntry(entry *storage.Entry, fileID uint32, offset int
 			score: score,
 		}
 		targetZset.dict[memberString] = targetNode
-		targetZset.skipList.AddNode(zsetScore{score: score}, targetNode)
+		targetZset.skipList.AddNode(targetNode.scoreKey(), targetNode)
+		if entry.ExpiredAt != -1 {
+			targetZset.expireNum += 1
+			targetZset.nextExpiredAt = earlierExpiredAt(targetZset.nextExpiredAt, entry.ExpiredAt)
+		}
+		return nil
+	case storage.TypeExpire:
+		writtenAt, e := decodeExpireTime(entry.Value)
+		if e != nil {
+			return e
+		}
+		targetZset, ok := zi.index[string(entry.Key)]
+		if !ok {
+			return nil
+		}
+		for _, node := range targetZset.dict {
+			if !isExpired(node.expiredAt, writtenAt) {
+				targetZset.setExpiredAt(node, entry.ExpiredAt)
+			}
+		}
 		return nil
 	default:
 		return nil
@@ -194,22 +384,160 @@ func (zi *ZSetIndex) handleEntry(entry *storage.Entry, fileID uint32, offset int
 }
 
 // ZAdd 按给定参数添加元素 如果元素存在则更新 如果有序集合不存在则创建
-func (zi *ZSetIndex) ZAdd(key []byte, score int, member []byte, expiredAt int64) error {
+func (zi *ZSetIndex) ZAdd(key []byte, score float64, member []byte, expiredAt int64) error {
+	zi.mutex.Lock()
+	defer zi.mutex.Unlock()
+
+	return zi.addMember(key, score, member, expiredAt)
+}
+
+// ZRem 按给定的 key 和 member 删除元素 如果删除后有序列表不再拥有元素则自动删除有序列表
+func (zi *ZSetIndex) ZRem(key []byte, member []byte) error {
+	zi.mutex.Lock()
+	defer zi.mutex.Unlock()
+
+	targetZset, ok := zi.index[string(key)]
+	if !ok {
+		return logger.KeyIsNotExisted
+	}
+
+	targetNode, ok := targetZset.dict[string(member)]
+	if !ok {
+		return logger.MemberIsNotExisted
+	}
+
+	return zi.removeMember(key, targetZset, targetNode)
+}
+
+// ZIncrBy 给 member 的 score 加上 increment 并返回新的 score member 不存在时视为 score 为0 有序集合不存在则创建 member 原有的过期时间保持不变
+func (zi *ZSetIndex) ZIncrBy(key []byte, increment float64, member []byte) (float64, error) {
+	zi.mutex.Lock()
+	defer zi.mutex.Unlock()
+
+	score := increment
+	expiredAt := int64(-1)
+	if targetZset, ok := zi.index[string(key)]; ok {
+		if targetNode, ok := targetZset.dict[string(member)]; ok && !isExpired(targetNode.expiredAt, time.Now().UnixMilli()) {
+			score += targetNode.score
+			expiredAt = targetNode.expiredAt
+		}
+	}
+	// inf 加上 -inf 的结果是 nan
+	if math.IsNaN(score) {
+		return 0, logger.ScoreIsNaN
+	}
+	e := zi.addMember(key, score, member, expiredAt)
+	if e != nil {
+		return 0, e
+	}
+	return score, nil
+}
+
+// ZPopMin 删除并返回 score 最小的 count 个成员 按 score 从小到大排列
+func (zi *ZSetIndex) ZPopMin(key []byte, count int) ([]ZSetMember, error) {
+	return zi.pop(key, count, false)
+}
+
+// ZPopMax 删除并返回 score 最大的 count 个成员 按 score 从大到小排列
+func (zi *ZSetIndex) ZPopMax(key []byte, count int) ([]ZSetMember, error) {
+	return zi.pop(key, count, true)
+}
+
+// pop 删除并返回有序集合一端的 count 个成员 isMax 为 true 时从 score 最大的一端开始
+func (zi *ZSetIndex) pop(key []byte, count int, isMax bool) ([]ZSetMember, error) {
+	if count < 0 {
+		return nil, logger.ParameterIsNotAllowed
+	}
 	zi.mutex.Lock()
 	defer zi.mutex.Unlock()
 
 	targetZset, ok := zi.index[string(key)]
 	if !ok {
-		targetZset = &zset{
-			dict:     make(map[string]*zsetNode),
-			skipList: skipList.NewSkipList[*zsetNode](),
+		return nil, logger.KeyIsNotExisted
+	}
+	e := zi.expireMembers(key, targetZset, time.Now().UnixMilli())
+	if e != nil {
+		return nil, e
+	}
+	result := make([]ZSetMember, 0, count)
+	targetZset.skipList.ForEach(nil, isMax, func(node *zsetNode) bool {
+		if len(result) >= count {
+			return false
+		}
+		result = append(result, ZSetMember{Member: node.value, Score: node.score})
+		return true
+	})
+	for _, v := range result {
+		e := zi.removeMember(key, targetZset, targetZset.dict[string(v.Member)])
+		if e != nil {
+			return nil, e
+		}
+	}
+	return result, nil
+}
+
+// ZMScore 同 ZScore 但是一次获取多个 member 的 score 结果的顺序和给定 member 的顺序一致 不存在的 member 对应的结果为空
+func (zi *ZSetIndex) ZMScore(key []byte, members ...[]byte) ([]*float64, error) {
+	targetZset, ok := zi.readZset(key)
+	defer zi.mutex.RUnlock()
+	if !ok {
+		return nil, logger.KeyIsNotExisted
+	}
+	result := make([]*float64, len(members))
+	for i, member := range members {
+		if targetNode, ok := targetZset.dict[string(member)]; ok {
+			score := targetNode.score
+			result[i] = &score
+		}
+	}
+	return result, nil
+}
+
+// ZRandMember 随机返回 count 个成员和它们的 score 规则同 redis
+//
+// count 为正数时返回的成员互不相同 count 大于成员个数时返回全部成员
+//
+// count 为负数时返回 -count 个成员 成员可能重复
+func (zi *ZSetIndex) ZRandMember(key []byte, count int) ([]ZSetMember, error) {
+	targetZset, ok := zi.readZset(key)
+	defer zi.mutex.RUnlock()
+	if !ok {
+		return nil, logger.KeyIsNotExisted
+	}
+	members := make([]ZSetMember, 0, len(targetZset.dict))
+	for _, node := range targetZset.dict {
+		members = append(members, ZSetMember{Member: node.value, Score: node.score})
+	}
+	if len(members) == 0 {
+		return []ZSetMember{}, nil
+	}
+	if count < 0 {
+		result := make([]ZSetMember, -count)
+		for i := range result {
+			result[i] = members[rand.Intn(len(members))]
 		}
+		return result, nil
+	}
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if count < len(members) {
+		members = members[:count]
+	}
+	return members, nil
+}
+
+// addMember 写入 entry 并添加成员 如果成员存在则更新 如果有序集合不存在则创建 调用者需要持有写锁
+func (zi *ZSetIndex) addMember(key []byte, score float64, member []byte, expiredAt int64) error {
+	targetZset, ok := zi.index[string(key)]
+	if !ok {
+		targetZset = newZset()
 		zi.index[string(key)] = targetZset
 	}
 
 	offset, e := zi.writeEntry(&storage.Entry{
 		Key:       key,
-		Value:     util.EncodeKeyAndField(string(member), strconv.Itoa(score)),
+		Value:     util.EncodeKeyAndField(string(member), util.FormatScore(score)),
 		EntryType: storage.TypeRecord,
 		ExpiredAt: expiredAt,
 	})
@@ -227,61 +555,49 @@ func (zi *ZSetIndex) ZAdd(key []byte, score int, member []byte, expiredAt int64)
 		},
 		score: score,
 	}
+	// 成员已经存在的话 要先删掉旧的 score 对应的节点
+	if oldNode, ok := targetZset.dict[string(member)]; ok {
+		_ = targetZset.skipList.DeleteNode(oldNode.scoreKey())
+		if oldNode.expiredAt != -1 {
+			targetZset.expireNum -= 1
+		}
+	}
 	targetZset.dict[string(member)] = targetNode
-	targetZset.skipList.AddNode(zsetScore{score: score}, targetNode)
+	targetZset.skipList.AddNode(targetNode.scoreKey(), targetNode)
 	if expiredAt != -1 {
 		targetZset.expireNum += 1
+		targetZset.nextExpiredAt = earlierExpiredAt(targetZset.nextExpiredAt, expiredAt)
+		zi.expiry.schedule(zi, string(key), expiredAt)
 	}
 
 	return nil
 }
 
-// ZRem 按给定的 key 和 member 删除元素 如果删除后有序列表不再拥有元素则自动删除有序列表
-func (zi *ZSetIndex) ZRem(key []byte, member []byte) error {
-	zi.mutex.RLock()
-
-	targetZset, ok := zi.index[string(key)]
-	if !ok {
-		return logger.KeyIsNotExisted
-	}
-
-	targetNode, ok := targetZset.dict[string(member)]
-	if !ok {
-		return logger.MemberIsNotExisted
-	}
-
-	zi.mutex.RUnlock()
-	zi.mutex.Lock()
-	defer zi.mutex.Unlock()
-
-	e := targetZset.skipList.DeleteNode(zsetScore{score: targetNode.score})
+// removeMember 写入 entry 并删除成员 删除后有序集合为空则自动删除有序集合 调用者需要持有写锁
+func (zi *ZSetIndex) removeMember(key []byte, targetZset *zset, targetNode *zsetNode) error {
+	_, e := zi.writeEntry(&storage.Entry{
+		Key:       key,
+		Value:     targetNode.value,
+		EntryType: storage.TypeDelete,
+		ExpiredAt: 0,
+	})
 	if e != nil {
 		return e
 	}
-	delete(targetZset.dict, string(member))
+
+	_ = targetZset.skipList.DeleteNode(targetNode.scoreKey())
+	delete(targetZset.dict, string(targetNode.value))
 	if targetNode.expiredAt != -1 {
 		targetZset.expireNum -= 1
 	}
-
 	if targetZset.skipList.Length() == 0 {
 		delete(zi.index, string(key))
 	}
-
-	_, e = zi.writeEntry(&storage.Entry{
-		Key:       key,
-		Value:     member,
-		EntryType: storage.TypeDelete,
-		ExpiredAt: 0,
-	})
-	if e != nil {
-		return e
-	}
-
 	return nil
 }
 
 // ZScore 按给定的 key 和 member 获取对应元素的 score
-func (zi *ZSetIndex) ZScore(key []byte, member []byte) (int, error) {
+func (zi *ZSetIndex) ZScore(key []byte, member []byte) (float64, error) {
 	zi.mutex.RLock()
 
 	targetZset, ok := zi.index[string(key)]
@@ -299,9 +615,13 @@ func (zi *ZSetIndex) ZScore(key []byte, member []byte) (int, error) {
 		// 过期
 		zi.mutex.RUnlock()
 		zi.mutex.Lock()
-		_ = targetZset.skipList.DeleteNode(zsetScore{score: targetNode.score})
-		delete(targetZset.dict, string(member))
-		targetZset.expireNum -= 1
+		// 升级锁的间隙里成员可能已经被删除或者更新了
+		if zi.index[string(key)] == targetZset && targetZset.dict[string(member)] == targetNode {
+			e := zi.removeMember(key, targetZset, targetNode)
+			if e != nil {
+				logger.GenerateErrorLog(false, false, e.Error(), string(key), string(member))
+			}
+		}
 		zi.mutex.Unlock()
 		return 0, logger.MemberIsExpired
 	}
@@ -309,44 +629,103 @@ func (zi *ZSetIndex) ZScore(key []byte, member []byte) (int, error) {
 	return targetNode.score, nil
 }
 
-// ZCard 获取 zset 的有效成员数
-func (zi *ZSetIndex) ZCard(key []byte) (int, error) {
+// Del 删除整个有序集合
+func (zi *ZSetIndex) Del(key []byte) error {
+	zi.mutex.Lock()
+	defer zi.mutex.Unlock()
+
+	_, ok := zi.index[string(key)]
+	if !ok {
+		return logger.KeyIsNotExisted
+	}
+	return zi.deleteZset(key)
+}
+
+// deleteZset 写入 entry 并删除整个有序集合 调用者需要持有写锁
+func (zi *ZSetIndex) deleteZset(key []byte) error {
+	_, e := zi.writeEntry(&storage.Entry{
+		Key:       key,
+		Value:     []byte{},
+		EntryType: storage.TypeDeleteKey,
+		ExpiredAt: 0,
+	})
+	if e != nil {
+		return e
+	}
+	delete(zi.index, string(key))
+	return nil
+}
+
+// Exist 检查有序集合是否存在 并且至少有一个没有过期的成员
+func (zi *ZSetIndex) Exist(key []byte) bool {
 	zi.mutex.RLock()
+	defer zi.mutex.RUnlock()
 
-	targetZset, ok := zi.index[string(key)]
+	return zi.exist(string(key), time.Now().UnixMilli())
+}
+
+// exist 检查有序集合在 now 是否至少有一个没有过期的成员 调用者需要持有锁
+func (zi *ZSetIndex) exist(key string, now int64) bool {
+	targetZset, ok := zi.index[key]
 	if !ok {
-		zi.mutex.RUnlock()
-		return 0, logger.KeyIsNotExisted
+		return false
 	}
-	if targetZset.expireNum == 0 {
-		zi.mutex.RUnlock()
-		return targetZset.skipList.Length(), nil
-	} else {
-		zi.mutex.RUnlock()
-		zi.mutex.Lock()
-		targetZset.refreshZset()
-		zi.mutex.Unlock()
-		return targetZset.skipList.Length(), nil
+	for _, v := range targetZset.dict {
+		if !isExpired(v.expiredAt, now) {
+			return true
+		}
 	}
+	return false
 }
 
-// ZCount 获取 score 在 [min, max] 区间内的所有 member 个数
-func (zi *ZSetIndex) ZCount(key []byte, min, max int) (int, error) {
+// ScanKeys 返回以 prefix 开头 位置不小于 cursor 并且没有过期的有序集合中 ScanPage 需要的部分 见 scan.go
+func (zi *ZSetIndex) ScanKeys(prefix []byte, cursor uint64, count int) []string {
 	zi.mutex.RLock()
+	defer zi.mutex.RUnlock()
 
-	targetZset, ok := zi.index[string(key)]
+	now := time.Now().UnixMilli()
+	return mapScan(zi.index, prefix, cursor, count, func(key string, _ *zset) bool {
+		return zi.exist(key, now)
+	})
+}
+
+// ZScan 返回有序集合中以 prefix 开头 位置不小于 cursor 并且没有过期的成员中 ScanPage 需要的部分 见 scan.go
+func (zi *ZSetIndex) ZScan(key []byte, prefix []byte, cursor uint64, count int) ([]string, error) {
+	zi.mutex.RLock()
+	defer zi.mutex.RUnlock()
+
+	now := time.Now().UnixMilli()
+	if !zi.exist(string(key), now) {
+		return nil, logger.KeyIsNotExisted
+	}
+	return mapScan(zi.index[string(key)].dict, prefix, cursor, count, func(_ string, node *zsetNode) bool {
+		return !isExpired(node.expiredAt, now)
+	}), nil
+}
+
+// ZCard 获取 zset 的有效成员数
+func (zi *ZSetIndex) ZCard(key []byte) (int, error) {
+	targetZset, ok := zi.readZset(key)
+	defer zi.mutex.RUnlock()
+	if !ok {
+		return 0, logger.KeyIsNotExisted
+	}
+	return targetZset.skipList.Length(), nil
+}
+
+// ZCount 获取 score 在 min 和 max 之间的所有 member 个数
+func (zi *ZSetIndex) ZCount(key []byte, min, max ScoreBound) (int, error) {
+	targetZset, ok := zi.readZset(key)
 	if !ok {
 		zi.mutex.RUnlock()
 		return 0, logger.KeyIsNotExisted
 	}
-	if targetZset.expireNum != 0 {
+	lower, upper, ok := scoreInterval(min, max)
+	if !ok {
 		zi.mutex.RUnlock()
-		zi.mutex.Lock()
-		targetZset.refreshZset()
-		zi.mutex.Unlock()
-		zi.mutex.RLock()
+		return 0, nil
 	}
-	nodes, e := targetZset.skipList.QueryNodeInterval(zsetScore{score: min}, zsetScore{score: max})
+	nodes, e := targetZset.skipList.QueryNodeInterval(lower, upper)
 	if e != nil {
 		zi.mutex.RUnlock()
 		return 0, e
@@ -355,46 +734,513 @@ func (zi *ZSetIndex) ZCount(key []byte, min, max int) (int, error) {
 	return len(nodes), nil
 }
 
-// ZRange 获取 score 在 [min, max] 区间内的所有 member
-func (zi *ZSetIndex) ZRange(key []byte, min, max int) ([][]byte, error) {
-	zi.mutex.RLock()
+// ZRangeByScore 获取 score 在 min 和 max 之间的所有成员和 score isRev 为 true 时按 score 从大到小返回
+//
+// 跳过前 offset 个成员之后最多返回 count 个成员 count 为负数时返回所有成员
+func (zi *ZSetIndex) ZRangeByScore(key []byte, min, max ScoreBound, isRev bool, offset, count int) ([]ZSetMember, error) {
+	targetZset, ok := zi.readZset(key)
+	defer zi.mutex.RUnlock()
+	if !ok {
+		return nil, logger.KeyIsNotExisted
+	}
+	lower, upper, _ := scoreInterval(min, max)
+	return targetZset.rangeBetween(lower, upper, isRev, offset, count), nil
+}
+
+// ZRangeByLex 获取 member 在 min 和 max 之间的所有成员和 score 只有在所有成员的 score 都相同时结果才有意义 其它规则同 ZRangeByScore
+func (zi *ZSetIndex) ZRangeByLex(key []byte, min, max LexBound, isRev bool, offset, count int) ([]ZSetMember, error) {
+	targetZset, ok := zi.readZset(key)
+	defer zi.mutex.RUnlock()
+	if !ok {
+		return nil, logger.KeyIsNotExisted
+	}
+	lower, upper := lexInterval(min, max)
+	return targetZset.rangeBetween(lower, upper, isRev, offset, count), nil
+}
+
+// ZLexCount 获取 member 在 min 和 max 之间的成员个数 只有在所有成员的 score 都相同时结果才有意义
+func (zi *ZSetIndex) ZLexCount(key []byte, min, max LexBound) (int, error) {
+	targetZset, ok := zi.readZset(key)
+	defer zi.mutex.RUnlock()
+	if !ok {
+		return 0, logger.KeyIsNotExisted
+	}
+	lower, upper := lexInterval(min, max)
+	return len(targetZset.rangeBetween(lower, upper, false, 0, -1)), nil
+}
+
+// ZRemRangeByLex 删除 member 在 min 和 max 之间的所有成员 返回删除的成员个数 删除后有序集合为空则自动删除有序集合
+func (zi *ZSetIndex) ZRemRangeByLex(key []byte, min, max LexBound) (int, error) {
+	zi.mutex.Lock()
+	defer zi.mutex.Unlock()
 
 	targetZset, ok := zi.index[string(key)]
 	if !ok {
-		zi.mutex.RUnlock()
+		return 0, logger.KeyIsNotExisted
+	}
+	e := zi.expireMembers(key, targetZset, time.Now().UnixMilli())
+	if e != nil {
+		return 0, e
+	}
+	lower, upper := lexInterval(min, max)
+	members := targetZset.rangeBetween(lower, upper, false, 0, -1)
+	for _, v := range members {
+		e := zi.removeMember(key, targetZset, targetZset.dict[string(v.Member)])
+		if e != nil {
+			return 0, e
+		}
+	}
+	return len(members), nil
+}
+
+// Aggregate 合并多个有序集合时 同一个 member 的多个 score 的计算方式
+type Aggregate int8
+
+const (
+	AggregateSum Aggregate = iota
+	AggregateMin
+	AggregateMax
+)
+
+// zsetOperation 有序集合运算的种类
+type zsetOperation int8
+
+const (
+	zsetUnion zsetOperation = iota
+	zsetInter
+	zsetDiff
+)
+
+// ZUnion 返回所有给定有序集合的并集 按 score 从小到大排列 不存在的有序集合视为空集
+//
+// weights 为每个有序集合的 score 的乘数 为空时全部视为1 aggregate 决定同一个 member 的多个 score 怎么合并
+func (zi *ZSetIndex) ZUnion(keys [][]byte, weights []float64, aggregate Aggregate) ([]ZSetMember, error) {
+	zi.mutex.RLock()
+	defer zi.mutex.RUnlock()
+
+	return zi.computeZset(zsetUnion, keys, weights, aggregate)
+}
+
+// ZInter 返回所有给定有序集合的交集 规则同 ZUnion
+func (zi *ZSetIndex) ZInter(keys [][]byte, weights []float64, aggregate Aggregate) ([]ZSetMember, error) {
+	zi.mutex.RLock()
+	defer zi.mutex.RUnlock()
+
+	return zi.computeZset(zsetInter, keys, weights, aggregate)
+}
+
+// ZDiff 返回第一个有序集合和其它所有有序集合的差集 score 为成员在第一个有序集合中的 score
+func (zi *ZSetIndex) ZDiff(keys [][]byte) ([]ZSetMember, error) {
+	zi.mutex.RLock()
+	defer zi.mutex.RUnlock()
+
+	return zi.computeZset(zsetDiff, keys, nil, AggregateSum)
+}
+
+// ZUnionStore 同 ZUnion 但是把结果存入 destination 返回结果的成员个数
+func (zi *ZSetIndex) ZUnionStore(destination []byte, keys [][]byte, weights []float64, aggregate Aggregate) (int, error) {
+	return zi.computeAndStore(zsetUnion, destination, keys, weights, aggregate)
+}
+
+// ZInterStore 同 ZInter 但是把结果存入 destination 返回结果的成员个数
+func (zi *ZSetIndex) ZInterStore(destination []byte, keys [][]byte, weights []float64, aggregate Aggregate) (int, error) {
+	return zi.computeAndStore(zsetInter, destination, keys, weights, aggregate)
+}
+
+// ZDiffStore 同 ZDiff 但是把结果存入 destination 返回结果的成员个数
+func (zi *ZSetIndex) ZDiffStore(destination []byte, keys [][]byte) (int, error) {
+	return zi.computeAndStore(zsetDiff, destination, keys, nil, AggregateSum)
+}
+
+// computeAndStore 计算有序集合运算的结果 然后用结果替换掉 destination 原来的内容 结果为空时 destination 会被删除
+//
+// 计算和写入在同一次加锁中完成 destination 也可以是参与运算的有序集合之一 结果中的成员都不会过期
+func (zi *ZSetIndex) computeAndStore(operation zsetOperation, destination []byte, keys [][]byte, weights []float64, aggregate Aggregate) (int, error) {
+	zi.mutex.Lock()
+	defer zi.mutex.Unlock()
+
+	result, e := zi.computeZset(operation, keys, weights, aggregate)
+	if e != nil {
+		return 0, e
+	}
+	if _, ok := zi.index[string(destination)]; ok {
+		e = zi.deleteZset(destination)
+		if e != nil {
+			return 0, e
+		}
+	}
+	for _, v := range result {
+		e = zi.addMember(destination, v.Score, v.Member, -1)
+		if e != nil {
+			return 0, e
+		}
+	}
+	return len(result), nil
+}
+
+// computeZset 计算有序集合运算 结果按 score 从小到大排列 不存在的有序集合视为空集 已经过期的成员会被忽略 调用者需要持有锁
+func (zi *ZSetIndex) computeZset(operation zsetOperation, keys [][]byte, weights []float64, aggregate Aggregate) ([]ZSetMember, error) {
+	if weights != nil && len(weights) != len(keys) {
+		return nil, logger.ParameterIsNotAllowed
+	}
+	now := time.Now().UnixMilli()
+	// liveMembers 返回有序集合中没有过期的成员 score 已经乘上了权重
+	liveMembers := func(i int) map[string]float64 {
+		result := make(map[string]float64)
+		targetZset, ok := zi.index[string(keys[i])]
+		if !ok {
+			return result
+		}
+		for member, node := range targetZset.dict {
+			if isExpired(node.expiredAt, now) {
+				continue
+			}
+			score := node.score
+			if weights != nil {
+				score *= weights[i]
+			}
+			// 和 redis 一样 inf 乘以0的结果视为0
+			if math.IsNaN(score) {
+				score = 0
+			}
+			result[member] = score
+		}
+		return result
+	}
+
+	if len(keys) == 0 {
+		return []ZSetMember{}, nil
+	}
+	result := make(map[string]float64)
+	switch operation {
+	case zsetUnion:
+		for i := range keys {
+			for member, score := range liveMembers(i) {
+				if oldScore, ok := result[member]; ok {
+					score = aggregateScore(oldScore, score, aggregate)
+				}
+				result[member] = score
+			}
+		}
+	case zsetInter:
+		result = liveMembers(0)
+		for i := 1; i < len(keys) && len(result) != 0; i++ {
+			members := liveMembers(i)
+			for member, oldScore := range result {
+				score, ok := members[member]
+				if !ok {
+					delete(result, member)
+					continue
+				}
+				result[member] = aggregateScore(oldScore, score, aggregate)
+			}
+		}
+	case zsetDiff:
+		result = liveMembers(0)
+		for i := 1; i < len(keys) && len(result) != 0; i++ {
+			for member := range liveMembers(i) {
+				delete(result, member)
+			}
+		}
+	}
+
+	members := make([]ZSetMember, 0, len(result))
+	for member, score := range result {
+		members = append(members, ZSetMember{Member: []byte(member), Score: score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return zsetScore{score: members[i].Score, member: string(members[i].Member)}.Compare(zsetScore{score: members[j].Score, member: string(members[j].Member)}) < 0
+	})
+	return members, nil
+}
+
+// aggregateScore 按 aggregate 合并同一个 member 的两个 score
+func aggregateScore(score1, score2 float64, aggregate Aggregate) float64 {
+	switch aggregate {
+	case AggregateMin:
+		return math.Min(score1, score2)
+	case AggregateMax:
+		return math.Max(score1, score2)
+	}
+	// 和 redis 一样 inf 加上 -inf 的结果视为0
+	result := score1 + score2
+	if math.IsNaN(result) {
+		return 0
+	}
+	return result
+}
+
+// ZRank 获取 member 按 score 从小到大的排名 排名从0开始
+func (zi *ZSetIndex) ZRank(key []byte, member []byte) (int, error) {
+	return zi.rank(key, member, false)
+}
+
+// ZRevRank 获取 member 按 score 从大到小的排名 排名从0开始
+func (zi *ZSetIndex) ZRevRank(key []byte, member []byte) (int, error) {
+	return zi.rank(key, member, true)
+}
+
+// rank 获取 member 的排名 isRev 为 true 时按 score 从大到小排名
+func (zi *ZSetIndex) rank(key []byte, member []byte, isRev bool) (int, error) {
+	targetZset, ok := zi.readZset(key)
+	defer zi.mutex.RUnlock()
+	if !ok {
+		return 0, logger.KeyIsNotExisted
+	}
+	targetNode, ok := targetZset.dict[string(member)]
+	if !ok {
+		return 0, logger.MemberIsNotExisted
+	}
+	result, e := targetZset.skipList.Rank(targetNode.scoreKey())
+	if e != nil {
+		return 0, e
+	}
+	if isRev {
+		return targetZset.skipList.Length() - 1 - result, nil
+	}
+	return result, nil
+}
+
+// ZRange 获取排名在 [start, stop] 范围内的所有成员和 score 规则同 redis 负数表示从末尾开始数 -1 是最后一个成员
+//
+// isRev 为 true 时按 score 从大到小排名
+func (zi *ZSetIndex) ZRange(key []byte, start, stop int, isRev bool) ([]ZSetMember, error) {
+	targetZset, ok := zi.readZset(key)
+	defer zi.mutex.RUnlock()
+	if !ok {
 		return nil, logger.KeyIsNotExisted
 	}
-	if targetZset.expireNum != 0 {
-		zi.mutex.RUnlock()
-		zi.mutex.Lock()
-		targetZset.refreshZset()
-		zi.mutex.Unlock()
-		zi.mutex.RLock()
+	length := targetZset.skipList.Length()
+	start, stop, ok = rankRange(start, stop, length)
+	if !ok {
+		return []ZSetMember{}, nil
+	}
+	if isRev {
+		start, stop = length-1-stop, length-1-start
+	}
+	nodes := targetZset.skipList.QueryNodeByRank(start, stop)
+	result := make([]ZSetMember, len(nodes))
+	for i, node := range nodes {
+		if isRev {
+			i = len(nodes) - 1 - i
+		}
+		result[i] = ZSetMember{Member: node.value, Score: node.score}
 	}
-	nodes, e := targetZset.skipList.QueryNodeInterval(zsetScore{score: min}, zsetScore{score: max})
+	return result, nil
+}
+
+// ZRemRangeByRank 删除排名在 [start, stop] 范围内的所有成员 规则同 ZRange 返回删除的成员个数 删除后有序集合为空则自动删除有序集合
+func (zi *ZSetIndex) ZRemRangeByRank(key []byte, start, stop int) (int, error) {
+	zi.mutex.Lock()
+	defer zi.mutex.Unlock()
+
+	targetZset, ok := zi.index[string(key)]
+	if !ok {
+		return 0, logger.KeyIsNotExisted
+	}
+	e := zi.expireMembers(key, targetZset, time.Now().UnixMilli())
 	if e != nil {
-		zi.mutex.RUnlock()
-		return nil, e
+		return 0, e
+	}
+	start, stop, ok = rankRange(start, stop, targetZset.skipList.Length())
+	if !ok {
+		return 0, nil
 	}
-	result := make([][]byte, len(nodes))
-	for i := range nodes {
-		result[i] = nodes[i].value
+	nodes := targetZset.skipList.QueryNodeByRank(start, stop)
+	for _, node := range nodes {
+		e := zi.removeMember(key, targetZset, node)
+		if e != nil {
+			return 0, e
+		}
+	}
+	return len(nodes), nil
+}
+
+// readZset 加读锁获取有序集合 如果有会过期的成员 先删除已经过期的成员 返回时仍然持有读锁 调用者需要释放读锁
+func (zi *ZSetIndex) readZset(key []byte) (*zset, bool) {
+	zi.mutex.RLock()
+	targetZset, ok := zi.index[string(key)]
+	if !ok || !targetZset.hasExpired(time.Now().UnixMilli()) {
+		return targetZset, ok
 	}
 	zi.mutex.RUnlock()
-	return result, nil
+	zi.mutex.Lock()
+	// 升级锁的间隙里有序集合可能已经被删除并且重新创建了 这时旧的有序集合的过期成员不能再写入删除 entry
+	if zi.index[string(key)] == targetZset {
+		zi.refreshZset(key, targetZset)
+	}
+	zi.mutex.Unlock()
+	zi.mutex.RLock()
+	// 升级锁的间隙里有序集合可能已经被删除了 所以要重新获取
+	targetZset, ok = zi.index[string(key)]
+	return targetZset, ok
 }
 
-// refreshZset 对有序集合进行循环 删除过期元素
-func (z *zset) refreshZset() {
-	// 这块不加锁 因为调用者已经把锁加好了
-	var node *zsetNode
-	for key := range z.dict {
-		node = z.dict[key]
-		if node.expiredAt != -1 && node.expiredAt < time.Now().UnixMilli() {
-			// 过期
-			delete(z.dict, key)
-			_ = z.skipList.DeleteNode(zsetScore{score: node.score})
-			z.expireNum -= 1
+// rankRange 按 redis 的规则把可能为负数的排名范围转换为 [0, length) 内的范围 范围为空时 ok 为 false
+func rankRange(start, stop, length int) (int, int, bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	return start, stop, start <= stop
+}
+
+// rangeBetween 获取跳表中在 [lower, upper] 区间内的成员 isRev 为 true 时从 upper 开始向前遍历 跳过前 offset 个成员之后最多返回 count 个成员 调用者需要持有锁
+//
+// 区间为空时 不论从哪一端开始遍历 第一个节点都会超出另一端的边界 所以不需要单独判断
+func (z *zset) rangeBetween(lower, upper skipList.Comparable, isRev bool, offset, count int) []ZSetMember {
+	result := make([]ZSetMember, 0)
+	if offset < 0 || count == 0 {
+		return result
+	}
+	start, end := lower, upper
+	if isRev {
+		start, end = upper, lower
+	}
+	z.skipList.ForEach(start, isRev, func(node *zsetNode) bool {
+		compareResult := end.Compare(node.scoreKey())
+		if !isRev && compareResult < 0 || isRev && compareResult > 0 {
+			return false
+		}
+		if offset > 0 {
+			offset -= 1
+			return true
 		}
+		result = append(result, ZSetMember{Member: node.value, Score: node.score})
+		return count < 0 || len(result) < count
+	})
+	return result
+}
+
+// refreshZset 读操作发现有过期成员时调用 删除过期成员 调用者需要持有写锁 删除失败的成员留给 ExpireKey 之后再删
+func (zi *ZSetIndex) refreshZset(key []byte, targetZset *zset) {
+	e := zi.expireMembers(key, targetZset, time.Now().UnixMilli())
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), string(key))
 	}
 }
+
+// expireMembers 删除有序集合中在 now 之前过期的成员 同时写入删除 entry 并且重新计算最早的过期时间 调用者需要持有写锁
+//
+// 只有 hasExpired 为 true 时才会遍历整个有序集合
+func (zi *ZSetIndex) expireMembers(key []byte, targetZset *zset, now int64) error {
+	if !targetZset.hasExpired(now) {
+		return nil
+	}
+	next := int64(-1)
+	for _, node := range targetZset.dict {
+		if !isExpired(node.expiredAt, now) {
+			next = earlierExpiredAt(next, node.expiredAt)
+			continue
+		}
+		e := zi.removeMember(key, targetZset, node)
+		if e != nil {
+			return e
+		}
+	}
+	targetZset.nextExpiredAt = next
+	return nil
+}
+
+// SetExpiryScheduler 使用 es 进行主动过期 同时把有过期成员的有序集合交给 es
+func (zi *ZSetIndex) SetExpiryScheduler(es *ExpiryScheduler) {
+	zi.mutex.Lock()
+	defer zi.mutex.Unlock()
+
+	zi.expiry = es
+	for key, targetZset := range zi.index {
+		if targetZset.expireNum != 0 {
+			es.schedule(zi, key, targetZset.nextExpiredAt)
+		}
+	}
+}
+
+// ExpireKey 删除有序集合中所有在 now 之前过期的成员 同时写入删除 entry 返回剩下的成员中最早的过期时间
+func (zi *ZSetIndex) ExpireKey(key string, now int64) (int64, error) {
+	zi.mutex.Lock()
+	defer zi.mutex.Unlock()
+
+	targetZset, ok := zi.index[key]
+	if !ok {
+		return -1, nil
+	}
+	e := zi.expireMembers([]byte(key), targetZset, now)
+	if e != nil {
+		return -1, e
+	}
+	if _, ok = zi.index[key]; !ok || targetZset.expireNum == 0 {
+		return -1, nil
+	}
+	return targetZset.nextExpiredAt, nil
+}
+
+// Expire 修改有序集合中所有成员的过期时间 expiredAt 为-1时去掉过期时间
+func (zi *ZSetIndex) Expire(key []byte, expiredAt int64) error {
+	zi.mutex.Lock()
+	defer zi.mutex.Unlock()
+
+	now := time.Now().UnixMilli()
+	targetZset, ok := zi.index[string(key)]
+	if !ok {
+		return logger.KeyIsNotExisted
+	}
+	// 先删掉已经过期的成员 剩下的成员都要修改过期时间
+	e := zi.expireMembers(key, targetZset, now)
+	if e != nil {
+		return e
+	}
+	if _, ok = zi.index[string(key)]; !ok {
+		return logger.KeyIsNotExisted
+	}
+	_, e = zi.writeEntry(&storage.Entry{
+		EntryType: storage.TypeExpire,
+		Key:       key,
+		Value:     encodeExpireTime(now),
+		ExpiredAt: expiredAt,
+	})
+	if e != nil {
+		return e
+	}
+	for _, node := range targetZset.dict {
+		targetZset.setExpiredAt(node, expiredAt)
+	}
+	zi.expiry.schedule(zi, string(key), expiredAt)
+	return nil
+}
+
+// TTL 返回有序集合的过期时间 即最后一个过期的成员的过期时间 -1 表示永不过期
+func (zi *ZSetIndex) TTL(key []byte) (int64, error) {
+	zi.mutex.RLock()
+	defer zi.mutex.RUnlock()
+
+	targetZset, ok := zi.index[string(key)]
+	if !ok {
+		return 0, logger.KeyIsNotExisted
+	}
+	now := time.Now().UnixMilli()
+	isFound := false
+	var result int64
+	for _, node := range targetZset.dict {
+		if isExpired(node.expiredAt, now) {
+			continue
+		}
+		if !isFound {
+			isFound = true
+			result = node.expiredAt
+		} else {
+			result = laterExpiredAt(result, node.expiredAt)
+		}
+	}
+	if !isFound {
+		return 0, logger.KeyIsNotExisted
+	}
+	return result, nil
+}
@@ -1,13 +1,18 @@
 package index
 
 import (
+	"MisakaDB/logger"
 	"MisakaDB/storage"
+	"MisakaDB/util"
+	"errors"
+	"math"
+	"strconv"
 	"testing"
 	"time"
 )
 
 func TestZSetIndex(t *testing.T) {
-	zsetIndex, e := BuildZSetIndex(nil, nil, storage.TraditionalIOFile, "D:\\", 65536, time.Second)
+	zsetIndex, e := BuildZSetIndex(nil, nil, storage.TraditionalIOFile, "D:\\", 65536, time.Second, false)
 	if e != nil {
 		t.Error(e)
 		return
@@ -26,3 +31,555 @@ func TestZSetIndex(t *testing.T) {
 	}
 	t.Log(value)
 }
+
+func TestZSetIndexEqualScore(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	zsetIndex, e := BuildZSetIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// 所有成员的 score 都一样
+	for i := 0; i < 10; i++ {
+		e = zsetIndex.ZAdd([]byte("testZSet"), 1, []byte("testMember"+strconv.Itoa(i)), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	// 修改 score 之后旧的节点应该被删除
+	e = zsetIndex.ZAdd([]byte("testZSet"), 2, []byte("testMember9"), -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = zsetIndex.ZRem([]byte("testZSet"), []byte("testMember0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	check := func() {
+		n, e := zsetIndex.ZCount([]byte("testZSet"), ScoreBound{Score: 1}, ScoreBound{Score: 1})
+		if e != nil {
+			t.Fatal(e)
+		}
+		if n != 8 {
+			t.Error(n)
+		}
+		members, e := zsetIndex.ZRangeByScore([]byte("testZSet"), ScoreBound{Score: 0}, ScoreBound{Score: 2}, false, 0, -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if len(members) != 9 || string(members[0].Member) != "testMember1" || string(members[8].Member) != "testMember9" {
+			t.Error(members)
+		}
+		n, e = zsetIndex.ZCard([]byte("testZSet"))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if n != 9 {
+			t.Error(n)
+		}
+	}
+	check()
+	e = zsetIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 从文件重建索引 结果应该一样
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	zsetIndex, e = BuildZSetIndex(activeFiles[storage.ZSet], archiveFiles[storage.ZSet], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = zsetIndex.CloseIndex()
+	}()
+	check()
+}
+
+func TestZSetIndexFloatScore(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	zsetIndex, e := BuildZSetIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// 模拟旧版本用 strconv.Itoa 写入的整数 score
+	_, e = zsetIndex.writeEntry(&storage.Entry{
+		Key:       []byte("testZSet"),
+		Value:     util.EncodeKeyAndField("oldMember", strconv.Itoa(2)),
+		EntryType: storage.TypeRecord,
+		ExpiredAt: -1,
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	for member, score := range map[string]float64{"a": 1.5, "b": 2.5, "min": math.Inf(-1), "max": math.Inf(1)} {
+		e = zsetIndex.ZAdd([]byte("testZSet"), score, []byte(member), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	e = zsetIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	zsetIndex, e = BuildZSetIndex(activeFiles[storage.ZSet], archiveFiles[storage.ZSet], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = zsetIndex.CloseIndex()
+	}()
+	score, e := zsetIndex.ZScore([]byte("testZSet"), []byte("oldMember"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if score != 2 {
+		t.Error(score)
+	}
+	members, e := zsetIndex.ZRangeByScore([]byte("testZSet"), ScoreBound{Score: math.Inf(-1)}, ScoreBound{Score: math.Inf(1)}, false, 0, -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(members) != 5 || string(members[0].Member) != "min" || string(members[4].Member) != "max" {
+		t.Error(members)
+	}
+	// (1.5 2.5] 只包含 oldMember 和 b
+	members, e = zsetIndex.ZRangeByScore([]byte("testZSet"), ScoreBound{Score: 1.5, IsExclusive: true}, ScoreBound{Score: 2.5}, false, 0, -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(members) != 2 || string(members[0].Member) != "oldMember" || string(members[1].Member) != "b" {
+		t.Error(members)
+	}
+	n, e := zsetIndex.ZCount([]byte("testZSet"), ScoreBound{Score: 2, IsExclusive: true}, ScoreBound{Score: 2, IsExclusive: true})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if n != 0 {
+		t.Error(n)
+	}
+}
+
+func TestZSetIndexRank(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	zsetIndex, e := BuildZSetIndex(nil, nil, storage.TraditionalIOFile, t.TempDir(), 65536, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = zsetIndex.CloseIndex()
+	}()
+	// 乱序插入 然后删掉一部分 检查排名是否和 score 的顺序一致
+	for i := 0; i < 200; i++ {
+		score := (i * 37) % 200
+		e = zsetIndex.ZAdd([]byte("testZSet"), float64(score), []byte("testMember"+strconv.Itoa(score)), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	for i := 0; i < 200; i += 3 {
+		e = zsetIndex.ZRem([]byte("testZSet"), []byte("testMember"+strconv.Itoa(i)))
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	members, e := zsetIndex.ZRange([]byte("testZSet"), 0, -1, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(members) != 133 {
+		t.Error(len(members))
+	}
+	for i, member := range members {
+		rank, e := zsetIndex.ZRank([]byte("testZSet"), member.Member)
+		if e != nil {
+			t.Fatal(e)
+		}
+		revRank, e := zsetIndex.ZRevRank([]byte("testZSet"), member.Member)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if rank != i || revRank != len(members)-1-i {
+			t.Error(string(member.Member), rank, revRank)
+		}
+		if i > 0 && members[i-1].Score >= member.Score {
+			t.Error(members[i-1].Score, member.Score)
+		}
+	}
+
+	members, e = zsetIndex.ZRange([]byte("testZSet"), 0, 2, true)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// 198 是3的倍数 已经被删掉了
+	if len(members) != 3 || members[0].Score != 199 || members[1].Score != 197 || members[2].Score != 196 {
+		t.Error(members)
+	}
+	n, e := zsetIndex.ZRemRangeByRank([]byte("testZSet"), 0, -11)
+	if e != nil {
+		t.Fatal(e)
+	}
+	card, e := zsetIndex.ZCard([]byte("testZSet"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if card != 10 || n != 133-10 {
+		t.Error(n, card)
+	}
+	rank, e := zsetIndex.ZRank([]byte("testZSet"), []byte("testMember199"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if rank != 9 {
+		t.Error(rank)
+	}
+}
+
+func TestZSetIndexRangeBy(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	zsetIndex, e := BuildZSetIndex(nil, nil, storage.TraditionalIOFile, t.TempDir(), 65536, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = zsetIndex.CloseIndex()
+	}()
+	for i := 0; i < 10; i++ {
+		e = zsetIndex.ZAdd([]byte("testZSet"), float64(i), []byte(strconv.Itoa(i)), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+		e = zsetIndex.ZAdd([]byte("testLex"), 0, []byte(string(rune('a'+i))), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	join := func(members []ZSetMember) string {
+		result := ""
+		for _, v := range members {
+			result += string(v.Member)
+		}
+		return result
+	}
+
+	for _, v := range []struct {
+		min, max      ScoreBound
+		isRev         bool
+		offset, count int
+		expected      string
+	}{
+		{ScoreBound{Score: 2}, ScoreBound{Score: 5}, false, 0, -1, "2345"},
+		{ScoreBound{Score: 2}, ScoreBound{Score: 5}, true, 0, -1, "5432"},
+		{ScoreBound{Score: 2, IsExclusive: true}, ScoreBound{Score: 5, IsExclusive: true}, true, 0, -1, "43"},
+		{ScoreBound{Score: math.Inf(-1)}, ScoreBound{Score: math.Inf(1)}, true, 1, 3, "876"},
+		{ScoreBound{Score: math.Inf(-1)}, ScoreBound{Score: math.Inf(1)}, false, 8, 5, "89"},
+		{ScoreBound{Score: 5}, ScoreBound{Score: 2}, false, 0, -1, ""},
+		{ScoreBound{Score: 5}, ScoreBound{Score: 2}, true, 0, -1, ""},
+		{ScoreBound{Score: 20}, ScoreBound{Score: 30}, true, 0, -1, ""},
+	} {
+		members, e := zsetIndex.ZRangeByScore([]byte("testZSet"), v.min, v.max, v.isRev, v.offset, v.count)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if join(members) != v.expected {
+			t.Error(v, join(members))
+		}
+	}
+
+	for _, v := range []struct {
+		min, max      LexBound
+		isRev         bool
+		offset, count int
+		expected      string
+	}{
+		{LexBound{Infinity: -1}, LexBound{Member: []byte("c")}, false, 0, -1, "abc"},
+		{LexBound{Member: []byte("c"), IsExclusive: true}, LexBound{Infinity: 1}, true, 0, 3, "jih"},
+		{LexBound{Member: []byte("bb")}, LexBound{Member: []byte("e"), IsExclusive: true}, true, 0, -1, "dc"},
+		{LexBound{Infinity: 1}, LexBound{Infinity: -1}, false, 0, -1, ""},
+	} {
+		members, e := zsetIndex.ZRangeByLex([]byte("testLex"), v.min, v.max, v.isRev, v.offset, v.count)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if join(members) != v.expected {
+			t.Error(v, join(members))
+		}
+	}
+}
+
+func TestZSetIndexIncrAndPop(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	zsetIndex, e := BuildZSetIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 10; i++ {
+		_, e = zsetIndex.ZIncrBy([]byte("testZSet"), float64(i), []byte("testMember"+strconv.Itoa(i)))
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	score, e := zsetIndex.ZIncrBy([]byte("testZSet"), 0.5, []byte("testMember3"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if score != 3.5 {
+		t.Error(score)
+	}
+	_, e = zsetIndex.ZIncrBy([]byte("testZSet"), math.Inf(1), []byte("testMember4"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, e = zsetIndex.ZIncrBy([]byte("testZSet"), math.Inf(-1), []byte("testMember4"))
+	if !errors.Is(e, logger.ScoreIsNaN) {
+		t.Error(e)
+	}
+	popped, e := zsetIndex.ZPopMin([]byte("testZSet"), 2)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(popped) != 2 || string(popped[0].Member) != "testMember0" || string(popped[1].Member) != "testMember1" {
+		t.Error(popped)
+	}
+	popped, e = zsetIndex.ZPopMax([]byte("testZSet"), 1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(popped) != 1 || string(popped[0].Member) != "testMember4" {
+		t.Error(popped)
+	}
+	randMembers, e := zsetIndex.ZRandMember([]byte("testZSet"), 20)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(randMembers) != 7 {
+		t.Error(len(randMembers))
+	}
+	e = zsetIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 从文件重建索引 结果应该一样
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	zsetIndex, e = BuildZSetIndex(activeFiles[storage.ZSet], archiveFiles[storage.ZSet], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = zsetIndex.CloseIndex()
+	}()
+	scores, e := zsetIndex.ZMScore([]byte("testZSet"), []byte("testMember0"), []byte("testMember3"), []byte("testMember4"), []byte("testMember9"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if scores[0] != nil || scores[1] == nil || *scores[1] != 3.5 || scores[2] != nil || scores[3] == nil || *scores[3] != 9 {
+		t.Error(scores)
+	}
+	card, e := zsetIndex.ZCard([]byte("testZSet"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if card != 7 {
+		t.Error(card)
+	}
+}
+
+func TestZSetIndexLex(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	zsetIndex, e := BuildZSetIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, member := range []string{"apple", "apply", "banana", "band", "bandana", "cat", "ca"} {
+		e = zsetIndex.ZAdd([]byte("testZSet"), 0, []byte(member), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	// 以 ban 开头的成员
+	n, e := zsetIndex.ZLexCount([]byte("testZSet"), LexBound{Member: []byte("ban")}, LexBound{Member: []byte("ban\xff")})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if n != 3 {
+		t.Error(n)
+	}
+	n, e = zsetIndex.ZRemRangeByLex([]byte("testZSet"), LexBound{Infinity: -1}, LexBound{Member: []byte("banana"), IsExclusive: true})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if n != 2 {
+		t.Error(n)
+	}
+	e = zsetIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 从文件重建索引 结果应该一样
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	zsetIndex, e = BuildZSetIndex(activeFiles[storage.ZSet], archiveFiles[storage.ZSet], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = zsetIndex.CloseIndex()
+	}()
+	members, e := zsetIndex.ZRangeByLex([]byte("testZSet"), LexBound{Infinity: -1}, LexBound{Infinity: 1}, true, 0, -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	result := ""
+	for _, v := range members {
+		result += string(v.Member) + " "
+	}
+	if result != "cat ca bandana band banana " {
+		t.Error(result)
+	}
+}
+
+func TestZSetIndexOperation(t *testing.T) {
+	_, e := logger.NewLogger(t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	folderPath := t.TempDir()
+
+	zsetIndex, e := BuildZSetIndex(nil, nil, storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 4; i++ {
+		// zset1: 0 1 2 3 zset2: 2 3 4 5 score 都是成员的两倍
+		e = zsetIndex.ZAdd([]byte("zset1"), float64(i), []byte(strconv.Itoa(i)), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+		e = zsetIndex.ZAdd([]byte("zset2"), float64((i+2)*2), []byte(strconv.Itoa(i+2)), -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	join := func(members []ZSetMember) string {
+		result := ""
+		for _, v := range members {
+			result += string(v.Member) + ":" + util.FormatScore(v.Score) + " "
+		}
+		return result
+	}
+	keys := [][]byte{[]byte("zset1"), []byte("zset2"), []byte("notExist")}
+
+	members, e := zsetIndex.ZUnion(keys, nil, AggregateSum)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if join(members) != "0:0 1:1 2:6 4:8 3:9 5:10 " {
+		t.Error(join(members))
+	}
+	members, e = zsetIndex.ZInter(keys[:2], []float64{10, 1}, AggregateMax)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if join(members) != "2:20 3:30 " {
+		t.Error(join(members))
+	}
+	members, e = zsetIndex.ZInter(keys, nil, AggregateSum)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(members) != 0 {
+		t.Error(join(members))
+	}
+	_, e = zsetIndex.ZUnion(keys, []float64{1}, AggregateSum)
+	if !errors.Is(e, logger.ParameterIsNotAllowed) {
+		t.Error(e)
+	}
+
+	n, e := zsetIndex.ZDiffStore([]byte("zset3"), keys[:2])
+	if e != nil {
+		t.Fatal(e)
+	}
+	if n != 2 {
+		t.Error(n)
+	}
+	// destination 同时参与运算
+	n, e = zsetIndex.ZInterStore([]byte("zset1"), keys[:2], nil, AggregateMin)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if n != 2 {
+		t.Error(n)
+	}
+	e = zsetIndex.CloseIndex()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// 从文件重建索引 存储的结果应该还在
+	activeFiles, archiveFiles, e := storage.RecordFilesInit(folderPath, 256, storage.TraditionalIOFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	zsetIndex, e = BuildZSetIndex(activeFiles[storage.ZSet], archiveFiles[storage.ZSet], storage.TraditionalIOFile, folderPath, 256, time.Second, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = zsetIndex.CloseIndex()
+	}()
+	members, e = zsetIndex.ZRange([]byte("zset1"), 0, -1, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if join(members) != "2:2 3:3 " {
+		t.Error(join(members))
+	}
+	members, e = zsetIndex.ZRange([]byte("zset3"), 0, -1, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if join(members) != "0:0 1:1 " {
+		t.Error(join(members))
+	}
+}
@@ -9,6 +9,8 @@ var (
 	CRCCheckSumNotPassed    = errors.New("CRC32 Check is Not Passed! ")
 	FileIsNotExist          = errors.New("File is not Exist! ")
 	DecodeKeyAndFieldFailed = errors.New("Decode Key and Field Failed! ")
+	HintFileIsBroken        = errors.New("Hint File is Broken! ")
+	EntryIsIncomplete       = errors.New("Entry is Incomplete! ")
 
 	FieldIsExisted    = errors.New("Field is Existed! ")
 	FieldIsNotExisted = errors.New("Field is Not Existed! ")
@@ -18,19 +20,38 @@ var (
 
 	ValueIsExpired = errors.New("This Value was Expired! ")
 
+	ExpireEntryIsBroken = errors.New("Expire Entry is Broken! ")
+
 	ParameterIsNotAllowed = errors.New("Parameter is Not Allowed! ")
 
+	// WrongType 对一个 key 执行了不属于它的类型的操作 措辞和 redis 保持一致 方便客户端识别
+	WrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
 	TimeUnitIsNotSupported = errors.New("Time Unit is Not Supported! ")
 
+	// HashIndex 使用的错误
+
+	HashValueIsNotInteger = errors.New("Hash Value is Not an Integer! ")
+	HashValueIsNotFloat   = errors.New("Hash Value is Not a Valid Float! ")
+	IncrementIsOverflowed = errors.New("Increment or Decrement would Overflow! ")
+	IncrementIsNaNOrInf   = errors.New("Increment would Produce NaN or Infinity! ")
+
 	// ListIndex 使用的错误
 
 	IndexIsIllegal         = errors.New("Index is Illegal to Access List! ")
 	RemoveCountIsNotEnough = errors.New("List Do Not Have Enough Element to Remove! ")
+	ElementIsNotExisted    = errors.New("Element is Not Existed in List! ")
+	ElementIsExisted       = errors.New("Element is Existed in List! ")
+	ListEntryIsBroken      = errors.New("List Entry is Broken! ")
+	ListHistoryIsBroken    = errors.New("List History is Inconsistent with Index! ")
 
 	// ZSet 使用的错误
 
 	MemberIsNotExisted = errors.New("Member is Not Existed! ")
 	MemberIsExpired    = errors.New("This Member was Expired! ")
+	ScoreIsNotFloat    = errors.New("Score is Not a Valid Float! ")
+	LexBoundIsIllegal  = errors.New("Lex Bound is Not Valid! ")
+	ScoreIsNaN         = errors.New("Resulting Score is Not a Number! ")
 
 	OffsetIsIllegal = errors.New("Offset is exceeded the fileContentSize! ")
 )
@@ -7,11 +7,19 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 var logInputChannel = make(chan LogInfo, 10)
 
+var (
+	// runningLoggers 正在监听 channel 的 Logger 的数量 没有 Logger 在监听时 log 直接打印 不再写入 channel 否则会阻塞住
+	runningLoggers int
+	// runningLoggersMutex 发送 log 时持有读锁 从检查 runningLoggers 到写入 channel 都不会有 Logger 退出
+	runningLoggersMutex sync.RWMutex
+)
+
 type LogLevel string
 
 const (
@@ -38,7 +46,7 @@ func GenerateInfoLog(message string) {
 	} else {
 		log.message = runtime.FuncForPC(pc).Name() + ": " + message
 	}
-	logInputChannel <- log
+	sendLog(log)
 	return
 }
 
@@ -73,6 +81,18 @@ func GenerateErrorLog(isPanic bool, needStackTrace bool, message string, keyPara
 		}
 	}
 
+	sendLog(log)
+}
+
+// sendLog 把 log 发给正在监听的 Logger
+// attention 检查和发送必须在同一个读锁里 否则检查之后 Logger 退出了 channel 满了之后发送就会一直阻塞
+func sendLog(log LogInfo) {
+	runningLoggersMutex.RLock()
+	defer runningLoggersMutex.RUnlock()
+	if runningLoggers == 0 {
+		fmt.Println(string(log.level) + " " + log.timeString + " " + log.message)
+		return
+	}
 	logInputChannel <- log
 }
 
@@ -84,12 +104,18 @@ func (li *LogInfo) toByteArray() []byte {
 type Logger struct {
 	loggerFile *os.File
 
-	isStop bool
+	isBroken bool          // 写入log文件失败之后就只打印 不再写入文件
+	stop     chan struct{} // 通知监听协程停止
+	stopped  chan struct{} // 监听协程停止之后关闭
+	stopOnce sync.Once
 }
 
 // NewLogger 传入log文件存储的路径 以获取一个新的Logger
 func NewLogger(logPath string) (*Logger, error) {
-	result := &Logger{}
+	result := &Logger{
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
 	f, e := os.OpenFile(GenerateLogFilePath(logPath), os.O_CREATE|os.O_RDWR, 0644)
 	if e != nil {
 		return nil, e
@@ -99,48 +125,68 @@ func NewLogger(logPath string) (*Logger, error) {
 	return result, e
 }
 
+// StopLogger 停止监听 等到 channel 中剩余的 log 都写入文件之后再返回 重复调用不会出错
 func (logger *Logger) StopLogger() {
-	logger.isStop = true
+	logger.stopOnce.Do(func() {
+		// 拿到写锁时 正在发送的 log 都已经写入 channel 了 之后的 log 不会再写入 channel
+		// 监听协程在这期间一直在读 channel 所以不会死锁
+		runningLoggersMutex.Lock()
+		runningLoggers -= 1
+		runningLoggersMutex.Unlock()
+		close(logger.stop)
+	})
+	<-logger.stopped
 }
 
 // ListenLoggerChannel 开始监听channel以接收log信息 写入log文件并且打印
 func (logger *Logger) ListenLoggerChannel() {
+	runningLoggersMutex.Lock()
+	runningLoggers += 1
+	runningLoggersMutex.Unlock()
 	go func() {
-		var (
-			log   LogInfo
-			bytes []byte
-			e     error
-		)
+		var log LogInfo
 		for { // 循环监听
 			select {
 			case log = <-logInputChannel:
-				// 记录log
-				bytes = log.toByteArray()
-				_, e = logger.loggerFile.Write(bytes)
-				if e != nil { // 写入logger失败 准备关闭logger
-					fmt.Println("Can Not Write Log Cause of: ", e.Error())
-					fmt.Println("Will Close Logger!")
-					logger.isStop = true
-				}
-				fmt.Println(string(log.level) + " " + log.timeString + " " + log.message)
-			default:
-				if logger.isStop {
-					close(logInputChannel) // 销毁channel
-					e = logger.loggerFile.Sync()
-					if e != nil {
-						fmt.Println("Can Not Sync Log File Cause of: ", e.Error())
+				logger.writeLog(log)
+			case <-logger.stop:
+				// 把 channel 里剩下的 log 写完
+				for isEmpty := false; !isEmpty; {
+					select {
+					case log = <-logInputChannel:
+						logger.writeLog(log)
+					default:
+						isEmpty = true
 					}
-					e = logger.loggerFile.Close() // 关闭文件
-					if e != nil {
-						fmt.Println("Can Not Close Log File Cause of: ", e.Error())
-					}
-					return
 				}
+				e := logger.loggerFile.Sync()
+				if e != nil {
+					fmt.Println("Can Not Sync Log File Cause of: ", e.Error())
+				}
+				e = logger.loggerFile.Close() // 关闭文件
+				if e != nil {
+					fmt.Println("Can Not Close Log File Cause of: ", e.Error())
+				}
+				close(logger.stopped)
+				return
 			}
 		}
 	}()
 }
 
+// writeLog 记录log
+func (logger *Logger) writeLog(log LogInfo) {
+	if !logger.isBroken {
+		_, e := logger.loggerFile.Write(log.toByteArray())
+		if e != nil { // 写入logger失败 之后只打印
+			fmt.Println("Can Not Write Log Cause of: ", e.Error())
+			fmt.Println("Log will Only be Printed!")
+			logger.isBroken = true
+		}
+	}
+	fmt.Println(string(log.level) + " " + log.timeString + " " + log.message)
+}
+
 func GenerateLogFilePath(path string) string {
 	fileName := "log." + time.Now().Format("2006_01_02_15_04_05") + ".misaka"
 	return filepath.Join(path, fileName)
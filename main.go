@@ -2,11 +2,18 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"runtime"
 )
 
 func main() {
-	db, e := Init()
+	options, e := LoadOptions(os.Args[1:])
+	if e != nil {
+		fmt.Println(e.Error())
+		return
+	}
+
+	db, e := Init(options)
 	if e != nil {
 		fmt.Println(e.Error())
 		return
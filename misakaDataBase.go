@@ -1,143 +1,63 @@
 package main
 
 import (
-	"MisakaDB/index"
+	"MisakaDB/database"
 	"MisakaDB/logger"
-	"MisakaDB/storage"
 	"MisakaDB/util"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/tidwall/redcon"
+	"math"
 	"runtime/debug"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// 以下为可选配置项
-const (
-	MisakaDataBaseFolderPath = "D:\\MisakaDBTest"        // 数据库进行数据持久化时 文件的保存位置 注意该路径下不可以有其他人任何文件
-	RecordFileMaxSize        = 65536                     // 文件的最大存储字节数
-	RecordFileIOMode         = storage.TraditionalIOFile // 对文件的读写方式 可以是传统的IO 也可以是Mmap
-	MisakaServerAddr         = ":23456"                  // 数据库的端口
-	LoggerPath               = "D:\\MisakaDBLog"         // 数据库的Log保存位置 该位置下有无其它文件都可以
-	SyncDuration             = 1000                      // 持久化文件定时同步的时间间隔 单位为毫秒
-)
-
-// 下面这是Linux版的路径 方便我切换
-//const (
-//	MisakaDataBaseFolderPath = "/home/MisakaDB"
-//	LoggerPath               = "/home/MisakaDBLog"
-//)
-
 type MisakaDataBase struct {
-	server *redcon.Server
-	logger *logger.Logger
+	server   *redcon.Server
+	database *database.DB
 
-	hashIndex   *index.HashIndex
-	stringIndex *index.StringIndex
-	listIndex   *index.ListIndex
-	zsetIndex   *index.ZSetIndex
-}
+	ctx    context.Context // 服务器关闭时被取消 阻塞中的命令随之返回
+	cancel context.CancelFunc
 
-func Init() (*MisakaDataBase, error) {
-	database := &MisakaDataBase{}
-	var e error
+	options *ServerOptions
+}
 
-	// 初始化logger
-	database.logger, e = logger.NewLogger(LoggerPath)
+// Init 按照给定的配置打开数据库并且初始化服务器 配置不合法时直接返回错误
+func Init(options *ServerOptions) (*MisakaDataBase, error) {
+	e := options.Validate()
 	if e != nil {
 		return nil, e
 	}
-	logger.GenerateInfoLog("Logger is Ready!")
+	result := &MisakaDataBase{
+		options: options,
+	}
+	result.ctx, result.cancel = context.WithCancel(context.Background())
 
-	// 读取文件
-	activeFiles, archiveFiles, e := storage.RecordFilesInit(MisakaDataBaseFolderPath, RecordFileMaxSize, RecordFileIOMode)
+	// 打开数据库 数据的读写都交给 database 包
+	result.database, e = database.Open(options.DataBaseFolderPath, options.Options)
 	if e != nil {
 		return nil, e
 	}
 
-	// 开始构建索引
-	for key, value := range activeFiles {
-		if key == storage.Hash {
-			database.hashIndex, e = index.BuildHashIndex(value, archiveFiles[storage.Hash], RecordFileIOMode, MisakaDataBaseFolderPath, RecordFileMaxSize, time.Millisecond*SyncDuration)
-			if e != nil {
-				return nil, e
-			}
-			logger.GenerateInfoLog("Hash Index is Ready!")
-		}
-
-		if key == storage.String {
-			database.stringIndex, e = index.BuildStringIndex(value, archiveFiles[storage.String], RecordFileIOMode, MisakaDataBaseFolderPath, RecordFileMaxSize, time.Millisecond*SyncDuration)
-			if e != nil {
-				return nil, e
-			}
-			logger.GenerateInfoLog("String Index is Ready!")
-		}
-
-		if key == storage.List {
-			database.listIndex, e = index.BuildListIndex(value, archiveFiles[storage.List], RecordFileIOMode, MisakaDataBaseFolderPath, RecordFileMaxSize, time.Millisecond*SyncDuration)
-			if e != nil {
-				return nil, e
-			}
-			logger.GenerateInfoLog("List Index is Ready! ")
-		}
-
-		if key == storage.ZSet {
-			database.zsetIndex, e = index.BuildZSetIndex(value, archiveFiles[storage.ZSet], RecordFileIOMode, MisakaDataBaseFolderPath, RecordFileMaxSize, time.Millisecond*SyncDuration)
-			if e != nil {
-				return nil, e
-			}
-			logger.GenerateInfoLog("ZSet Index is Ready! ")
-		}
-	}
-
-	// 开始检查索引是否构建 如果否 构建一个空的索引
-	// 这是防activeFiles本身不存在
-	if database.hashIndex == nil {
-		database.hashIndex, e = index.BuildHashIndex(nil, nil, RecordFileIOMode, MisakaDataBaseFolderPath, RecordFileMaxSize, time.Millisecond*SyncDuration)
-		if e != nil {
-			logger.GenerateErrorLog(false, false, e.Error(), "Build Empty Hash Index Failed!")
-			return nil, e
-		}
-		logger.GenerateInfoLog("Hash Index is Ready!")
-	}
-	if database.stringIndex == nil {
-		database.stringIndex, e = index.BuildStringIndex(nil, nil, RecordFileIOMode, MisakaDataBaseFolderPath, RecordFileMaxSize, time.Millisecond*SyncDuration)
-		if e != nil {
-			logger.GenerateErrorLog(false, false, e.Error(), "Build Empty String Index Failed!")
-			return nil, e
-		}
-		logger.GenerateInfoLog("String Index is Ready!")
-	}
-	if database.listIndex == nil {
-		database.listIndex, e = index.BuildListIndex(nil, archiveFiles[storage.List], RecordFileIOMode, MisakaDataBaseFolderPath, RecordFileMaxSize, time.Millisecond*SyncDuration)
-		if e != nil {
-			return nil, e
-		}
-		logger.GenerateInfoLog("List Index is Ready! ")
-	}
-	if database.zsetIndex == nil {
-		database.zsetIndex, e = index.BuildZSetIndex(nil, archiveFiles[storage.ZSet], RecordFileIOMode, MisakaDataBaseFolderPath, RecordFileMaxSize, time.Millisecond*SyncDuration)
-		if e != nil {
-			return nil, e
-		}
-		logger.GenerateInfoLog("ZSet Index is Ready! ")
-	}
-
 	// 初始化服务器
-	e = database.ServerInit()
+	e = result.ServerInit()
 	if e != nil {
 		logger.GenerateErrorLog(false, false, e.Error(), "Server Init Failed!")
 		return nil, e
 	}
 	logger.GenerateInfoLog("Server is Ready!")
 
-	return database, nil
+	return result, nil
 }
 
 func (db *MisakaDataBase) Destroy() error {
 
+	// 让阻塞中的命令返回 分离出来的连接也会随之关闭
+	db.cancel()
+
 	// 关闭服务器
 	e := db.server.Close()
 	if e != nil {
@@ -145,24 +65,8 @@ func (db *MisakaDataBase) Destroy() error {
 		return e
 	}
 
-	// 关闭索引 索引里会挨个关闭文件的
-	e = db.hashIndex.CloseIndex()
-	if e != nil {
-		return e
-	}
-	e = db.stringIndex.CloseIndex()
-	if e != nil {
-		return e
-	}
-	e = db.listIndex.CloseIndex()
-	if e != nil {
-		return e
-	}
-
-	// 关闭logger
-	db.logger.StopLogger()
-
-	return nil
+	// 关闭数据库 数据库里会挨个关闭索引和文件的
+	return db.database.Close()
 }
 
 func (db *MisakaDataBase) ServerInit() error {
@@ -172,730 +76,2368 @@ func (db *MisakaDataBase) ServerInit() error {
 	// 1 通过连接接收请求时调用的函数
 	// 2 接受连接时调用的函数
 	// 3 断开连接时调用的函数
+	db.server = redcon.NewServer(db.options.ServerAddr,
+		db.handleCommand,
+		func(conn redcon.Conn) bool {
+			logger.GenerateInfoLog("DataBase Connection Accept: " + conn.RemoteAddr())
+			return true
+		},
+		func(conn redcon.Conn, err error) {
+			if _, ok := conn.Context().(*blockingConn); ok {
+				// 执行阻塞命令时被分离出来了 连接并没有断开 见 blockingConn.go
+				logger.GenerateInfoLog("DataBase Connection Detached: " + conn.RemoteAddr())
+				return
+			}
+			logger.GenerateInfoLog("DataBase Connection Closed: " + conn.RemoteAddr())
+			return
+		},
+	)
+
+	return nil
+}
+
+// handleCommand 解析并执行一条命令 redcon 的连接和阻塞命令分离出来的连接都通过这里执行命令
+func (db *MisakaDataBase) handleCommand(conn redcon.Conn, cmd redcon.Command) {
 	var (
 		e       error
 		expired int
 	)
-	db.server = redcon.NewServer(MisakaServerAddr,
-		func(conn redcon.Conn, cmd redcon.Command) {
-
-			// 捕捉panic
-			defer func() {
-				p := recover()
-				if p != nil {
-					stackTrace := debug.Stack() // 获取引发panic位置的堆栈信息
-					logger.GenerateErrorLog(true, false, string(stackTrace), fmt.Sprintf("%v", p))
-				}
-				return
-			}()
 
-			logger.GenerateInfoLog(conn.RemoteAddr() + ": Query Command: " + util.TurnByteArray2ToString(cmd.Args))
+	// 捕捉panic
+	defer func() {
+		p := recover()
+		if p != nil {
+			stackTrace := debug.Stack() // 获取引发panic位置的堆栈信息
+			logger.GenerateErrorLog(true, false, string(stackTrace), fmt.Sprintf("%v", p))
+		}
+		return
+	}()
+
+	logger.GenerateInfoLog(conn.RemoteAddr() + ": Query Command: " + util.TurnByteArray2ToString(cmd.Args))
 
-			switch strings.ToLower(string(cmd.Args[0])) {
-			default:
-				// 命令不能识别
-				conn.WriteError("ERR unknown command '" + util.TurnByteArray2ToString(cmd.Args) + "'")
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Unknown Query: " + util.TurnByteArray2ToString(cmd.Args))
+	switch strings.ToLower(string(cmd.Args[0])) {
+	default:
+		// 命令不能识别
+		conn.WriteError("ERR unknown command '" + util.TurnByteArray2ToString(cmd.Args) + "'")
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Unknown Query: " + util.TurnByteArray2ToString(cmd.Args))
+		return
+	case "ping":
+		conn.WriteString("PONG")
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: ping")
+		return
+	case "merge":
+		// merge 会阻塞到所有索引重写完成
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: merge")
+		if len(cmd.Args) != 1 {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+		e = db.database.Merge(false)
+		if e != nil {
+			conn.WriteError(e.Error())
+			return
+		}
+		conn.WriteString("OK")
+		return
+	case "bgrewriteaof":
+		// 同 merge 但是在后台进行
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: bgrewriteaof")
+		if len(cmd.Args) != 1 {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+		go func() {
+			mergeError := db.database.Merge(false)
+			if mergeError != nil {
+				logger.GenerateErrorLog(false, false, mergeError.Error())
+			}
+		}()
+		conn.WriteString("Background append only file rewriting started")
+		return
+	case "quit":
+		conn.WriteString("OK")
+		e = conn.Close()
+		if e != nil {
+			logger.GenerateErrorLog(false, false, e.Error())
+		}
+		return
+
+	// 键空间部分的命令解析 这些命令对所有类型的 key 都有效
+	case "del", "unlink":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 2 {
+			// del key [key ...]
+			var result int
+			result, e = db.database.Del(cmd.Args[1:]...)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "exists":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: exists")
+		if len(cmd.Args) >= 2 {
+			// exists key [key ...]
+			conn.WriteInt(db.database.Exists(cmd.Args[1:]...))
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "type":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: type")
+		if len(cmd.Args) == 2 {
+			// type key
+			conn.WriteString(db.database.Type(cmd.Args[1]))
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "expire", "pexpire", "expireat":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 3 || len(cmd.Args) == 4 {
+			// expire key seconds [NX | XX | GT | LT]
+			var t int64
+			t, e = strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+			if e != nil {
+				conn.WriteError("ERR value is not an integer or out of range")
 				return
-			case "ping":
-				conn.WriteString("PONG")
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: ping")
+			}
+			expiredAt, ok := calcExpiredAt(strings.ToLower(string(cmd.Args[0])), t)
+			if !ok {
+				conn.WriteError("ERR invalid expire time in '" + string(cmd.Args[0]) + "' command")
 				return
-			case "quit":
-				conn.WriteString("OK")
-				e = conn.Close()
+			}
+			condition := database.ExpireAlways
+			if len(cmd.Args) == 4 {
+				condition, e = parseExpireCondition(cmd.Args[3])
 				if e != nil {
-					logger.GenerateErrorLog(false, false, e.Error())
+					conn.WriteError(e.Error())
+					return
 				}
+			}
+			var isSet bool
+			isSet, e = db.database.Expire(cmd.Args[1], expiredAt, condition)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			if isSet {
+				conn.WriteInt(1)
+			} else {
+				conn.WriteInt(0)
+			}
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "ttl", "pttl":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 2 {
+			// ttl key
+			var result int64
+			if strings.ToLower(string(cmd.Args[0])) == "ttl" {
+				result, e = db.database.TTL(cmd.Args[1])
+			} else {
+				result, e = db.database.PTTL(cmd.Args[1])
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt64(result)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "persist":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: persist")
+		if len(cmd.Args) == 2 {
+			// persist key
+			var isSet bool
+			isSet, e = db.database.Persist(cmd.Args[1])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			if isSet {
+				conn.WriteInt(1)
+			} else {
+				conn.WriteInt(0)
+			}
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "keys":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: keys")
+		if len(cmd.Args) == 2 {
+			// keys pattern
+			writeBulkArray(conn, db.database.Keys(string(cmd.Args[1])))
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "scan":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: scan")
+		if len(cmd.Args) >= 2 {
+			// scan cursor [match pattern] [count count] [type type]
+			var options scanOptions
+			options, e = parseScanOptions(cmd.Args[1], cmd.Args[2:], true)
+			if e != nil {
+				conn.WriteError(e.Error())
 				return
+			}
+			next, keys := db.database.Scan(options.cursor, options.pattern, options.count, options.keyType)
+			conn.WriteArray(2)
+			conn.WriteBulkString(formatCursor(next))
+			writeBulkArray(conn, keys)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
 
-			// string部分的命令解析
-			case "set":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: set")
-				if len(cmd.Args) == 3 {
-					// set key value
-					e = db.stringIndex.Set(cmd.Args[1], cmd.Args[2], -1)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-				} else if len(cmd.Args) == 5 {
-					// set key value ex/px time
-					expired, e = strconv.Atoi(string(cmd.Args[4]))
-					if e != nil {
-						conn.WriteError("Cannot Read Expired As Number: " + e.Error())
-						return
-					}
-					var expiredAt int64
-					expiredAt, e = util.CalcTimeUnix(string(cmd.Args[3]), expired)
-					if e != nil {
-						conn.WriteError(e.Error() + string(cmd.Args[3]))
-						return
-					}
-					e = db.stringIndex.Set(cmd.Args[1], cmd.Args[2], expiredAt)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
+	// string部分的命令解析
+	case "set":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: set")
+		if len(cmd.Args) == 3 {
+			// set key value
+			e = db.database.Set(cmd.Args[1], cmd.Args[2], -1)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+		} else if len(cmd.Args) == 5 {
+			// set key value ex/px time
+			expired, e = strconv.Atoi(string(cmd.Args[4]))
+			if e != nil {
+				conn.WriteError("Cannot Read Expired As Number: " + e.Error())
+				return
+			}
+			var expiredAt int64
+			expiredAt, e = util.CalcTimeUnix(string(cmd.Args[3]), expired)
+			if e != nil {
+				conn.WriteError(e.Error() + string(cmd.Args[3]))
+				return
+			}
+			e = db.database.Set(cmd.Args[1], cmd.Args[2], expiredAt)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "setnx":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: setnx")
+		if len(cmd.Args) == 3 {
+			// setnx key value
+			e = db.database.SetNX(cmd.Args[1], cmd.Args[2], -1)
+			if e != nil {
+				if errors.Is(logger.KeyIsExisted, e) {
+					conn.WriteInt(0)
 					return
 				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+					conn.WriteError(e.Error())
 					return
 				}
-			case "setnx":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: setnx")
-				if len(cmd.Args) == 3 {
-					// setnx key value
-					e = db.stringIndex.SetNX(cmd.Args[1], cmd.Args[2], -1)
-					if e != nil {
-						if errors.Is(logger.KeyIsExisted, e) {
-							conn.WriteInt(0)
-							return
-						} else {
-							conn.WriteError(e.Error())
-							return
-						}
-					}
-					conn.WriteInt(1)
-				} else if len(cmd.Args) == 5 {
-					// setnx key value ex/px time
-					expired, e = strconv.Atoi(string(cmd.Args[4]))
-					var expiredAt int64
-					expiredAt, e = util.CalcTimeUnix(string(cmd.Args[3]), expired)
-					if e != nil {
-						conn.WriteError(e.Error() + string(cmd.Args[3]))
-						return
-					}
-					if e != nil {
-						conn.WriteError("Cannot Read Expired As Number: " + e.Error())
-						return
-					}
-					e = db.stringIndex.SetNX(cmd.Args[1], cmd.Args[2], expiredAt)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-					return
+			}
+			conn.WriteInt(1)
+		} else if len(cmd.Args) == 5 {
+			// setnx key value ex/px time
+			expired, e = strconv.Atoi(string(cmd.Args[4]))
+			var expiredAt int64
+			expiredAt, e = util.CalcTimeUnix(string(cmd.Args[3]), expired)
+			if e != nil {
+				conn.WriteError(e.Error() + string(cmd.Args[3]))
+				return
+			}
+			if e != nil {
+				conn.WriteError("Cannot Read Expired As Number: " + e.Error())
+				return
+			}
+			e = db.database.SetNX(cmd.Args[1], cmd.Args[2], expiredAt)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "get":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: get")
+		if len(cmd.Args) == 2 {
+			// get key
+			var result string
+			result, e = db.database.Get(cmd.Args[1])
+			if errors.Is(logger.KeyIsNotExisted, e) {
+				conn.WriteString("nil")
+				return
+			} else if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString(result)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "getrange":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: getrange")
+		if len(cmd.Args) == 4 {
+			// getrange key start end
+			var (
+				result string
+				start  int
+				end    int
+			)
+			start, e = strconv.Atoi(string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError("Cannot Read Start As Number: " + e.Error())
+				return
+			}
+			end, e = strconv.Atoi(string(cmd.Args[3]))
+			if e != nil {
+				conn.WriteError("Cannot Read End As Number: " + e.Error())
+				return
+			}
+			result, e = db.database.GetRange(cmd.Args[1], start, end)
+			if errors.Is(logger.KeyIsNotExisted, e) {
+				conn.WriteString("nil")
+			} else if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString(result)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "getset":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: getset")
+		if len(cmd.Args) == 3 {
+			// getset key value
+			var result string
+			result, e = db.database.GetSet(cmd.Args[1], cmd.Args[2])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString(result)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "append":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: append")
+		if len(cmd.Args) == 3 {
+			// append key appendValue
+			e = db.database.Append(cmd.Args[1], cmd.Args[2])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(len(cmd.Args[2]))
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	// hash部分的命令解析
+	case "hset":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hset")
+		if len(cmd.Args) == 4 {
+			// hset key field value
+			e = db.database.HSet(string(cmd.Args[1]), string(cmd.Args[2]), string(cmd.Args[3]), -1)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else if len(cmd.Args) == 6 {
+			// hset key field value ex/px time
+			// 设置过期时间
+			expired, e = strconv.Atoi(string(cmd.Args[5]))
+			var expiredAt int64
+			expiredAt, e = util.CalcTimeUnix(string(cmd.Args[4]), expired)
+			if e != nil {
+				conn.WriteError(e.Error() + string(cmd.Args[4]))
+				return
+			}
+			e = db.database.HSet(string(cmd.Args[1]), string(cmd.Args[2]), string(cmd.Args[3]), expiredAt)
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hsetnx":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hsetnx")
+		if len(cmd.Args) == 4 {
+			// hset key field value
+			e = db.database.HSetNX(string(cmd.Args[1]), string(cmd.Args[2]), string(cmd.Args[3]), -1)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else if len(cmd.Args) == 6 {
+			// hsetnx key field value ex/px time
+			// 设置过期时间
+			expired, e = strconv.Atoi(string(cmd.Args[5]))
+			var expiredAt int64
+			expiredAt, e = util.CalcTimeUnix(string(cmd.Args[4]), expired)
+			if e != nil {
+				conn.WriteError(e.Error() + string(cmd.Args[4]))
+				return
+			}
+			e = db.database.HSetNX(string(cmd.Args[1]), string(cmd.Args[2]), string(cmd.Args[3]), expiredAt)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hget":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hget")
+		if len(cmd.Args) == 3 {
+			// hget key field
+			var result string
+			result, e = db.database.HGet(string(cmd.Args[1]), string(cmd.Args[2]))
+			if errors.Is(logger.KeyIsNotExisted, e) || errors.Is(logger.FieldIsNotExisted, e) {
+				conn.WriteString("nil")
+			} else if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString(result)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hdel":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hdel")
+		if len(cmd.Args) == 3 {
+			// hdel key field
+			e = db.database.HDel(string(cmd.Args[1]), string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(1)
+			return
+		} else if len(cmd.Args) == 2 {
+			// hdel key
+			e = db.database.HDelKey(string(cmd.Args[1]))
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(1)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hlen":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hlen")
+		if len(cmd.Args) == 2 {
+			// hlen key
+			var result int
+			result, e = db.database.HLen(string(cmd.Args[1]))
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hexists":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hexists")
+		if len(cmd.Args) == 3 {
+			// hexists key field
+			var result bool
+			result, e = db.database.HExists(string(cmd.Args[1]), string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			if result {
+				conn.WriteInt(1)
+			} else {
+				conn.WriteInt(0)
+			}
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hstrlen":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hstrlen")
+		if len(cmd.Args) == 3 {
+			// hstrlen key field
+			var result int
+			result, e = db.database.HStrLen(string(cmd.Args[1]), string(cmd.Args[2]))
+			if errors.Is(logger.FieldIsNotExisted, e) {
+				conn.WriteInt(0)
+				return
+			} else if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hmset":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hmset")
+		if len(cmd.Args) >= 4 && len(cmd.Args)%2 == 0 {
+			// hmset key field value [field value ...]
+			fields := make([]database.HashField, 0, (len(cmd.Args)-2)/2)
+			for i := 2; i < len(cmd.Args); i += 2 {
+				fields = append(fields, database.HashField{Field: cmd.Args[i], Value: cmd.Args[i+1]})
+			}
+			e = db.database.HMSet(string(cmd.Args[1]), fields, -1)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hmget":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hmget")
+		if len(cmd.Args) >= 3 {
+			// hmget key field [field ...]
+			fields := make([]string, 0, len(cmd.Args)-2)
+			for _, v := range cmd.Args[2:] {
+				fields = append(fields, string(v))
+			}
+			var result [][]byte
+			result, e = db.database.HMGet(string(cmd.Args[1]), fields...)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteArray(len(result))
+			for _, v := range result {
+				if v == nil {
+					conn.WriteNull()
 				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-					return
+					conn.WriteBulk(v)
 				}
-			case "get":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: get")
-				if len(cmd.Args) == 2 {
-					// get key
-					var result string
-					result, e = db.stringIndex.Get(cmd.Args[1])
-					if errors.Is(logger.KeyIsNotExisted, e) {
-						conn.WriteString("nil")
-						return
-					} else if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString(result)
-					return
-				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			}
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hgetall":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hgetall")
+		if len(cmd.Args) == 2 {
+			// hgetall key
+			var result []database.HashField
+			result, e = db.database.HGetAll(string(cmd.Args[1]))
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			writeHashFields(conn, result, true)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hkeys", "hvals":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 2 {
+			// hkeys key
+			var result [][]byte
+			if strings.ToLower(string(cmd.Args[0])) == "hkeys" {
+				result, e = db.database.HKeys(string(cmd.Args[1]))
+			} else {
+				result, e = db.database.HVals(string(cmd.Args[1]))
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			writeBulkArray(conn, result)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hincrby":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hincrby")
+		if len(cmd.Args) == 4 {
+			// hincrby key field increment
+			var increment, result int64
+			increment, e = strconv.ParseInt(string(cmd.Args[3]), 10, 64)
+			if e != nil {
+				conn.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			result, e = db.database.HIncrBy(string(cmd.Args[1]), string(cmd.Args[2]), increment)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt64(result)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hincrbyfloat":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hincrbyfloat")
+		if len(cmd.Args) == 4 {
+			// hincrbyfloat key field increment
+			var increment, result float64
+			increment, e = strconv.ParseFloat(string(cmd.Args[3]), 64)
+			if e != nil || math.IsNaN(increment) || math.IsInf(increment, 0) {
+				conn.WriteError("ERR value is not a valid float")
+				return
+			}
+			result, e = db.database.HIncrByFloat(string(cmd.Args[1]), string(cmd.Args[2]), increment)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteBulkString(util.FormatScore(result))
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hrandfield":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hrandfield")
+		if len(cmd.Args) >= 2 && len(cmd.Args) <= 4 {
+			// hrandfield key [count [withvalues]]
+			count := 1
+			if len(cmd.Args) >= 3 {
+				count, e = strconv.Atoi(string(cmd.Args[2]))
+				if e != nil {
+					conn.WriteError("ERR value is not an integer or out of range")
 					return
 				}
-			case "getrange":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: getrange")
-				if len(cmd.Args) == 4 {
-					// getrange key start end
-					var (
-						result string
-						start  int
-						end    int
-					)
-					start, e = strconv.Atoi(string(cmd.Args[2]))
-					if e != nil {
-						conn.WriteError("Cannot Read Start As Number: " + e.Error())
-						return
-					}
-					end, e = strconv.Atoi(string(cmd.Args[3]))
-					if e != nil {
-						conn.WriteError("Cannot Read End As Number: " + e.Error())
-						return
-					}
-					result, e = db.stringIndex.GetRange(cmd.Args[1], start, end)
-					if errors.Is(logger.KeyIsNotExisted, e) {
-						conn.WriteString("nil")
-					} else if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString(result)
-					return
-				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			}
+			withValues := false
+			if len(cmd.Args) == 4 {
+				if strings.ToLower(string(cmd.Args[3])) != "withvalues" {
+					conn.WriteError("ERR syntax error")
 					return
 				}
-			case "getset":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: getset")
-				if len(cmd.Args) == 3 {
-					// getset key value
-					var result string
-					result, e = db.stringIndex.GetSet(cmd.Args[1], cmd.Args[2])
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString(result)
-					return
-				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+				withValues = true
+			}
+			var result []database.HashField
+			result, e = db.database.HRandField(string(cmd.Args[1]), count)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			if len(cmd.Args) >= 3 {
+				writeHashFields(conn, result, withValues)
+			} else if len(result) == 0 {
+				// 不带 count 时 hash 不存在返回 nil
+				conn.WriteNull()
+			} else {
+				conn.WriteBulk(result[0].Field)
+			}
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hexpire", "hpexpire", "hexpireat":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 6 {
+			// hexpire key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+			var t int64
+			t, e = strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+			if e != nil {
+				conn.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			expiredAt, ok := calcExpiredAt(strings.TrimPrefix(strings.ToLower(string(cmd.Args[0])), "h"), t)
+			if !ok {
+				conn.WriteError("ERR invalid expire time in '" + string(cmd.Args[0]) + "' command")
+				return
+			}
+			condition := database.ExpireAlways
+			rest := cmd.Args[3:]
+			if strings.ToLower(string(rest[0])) != "fields" {
+				condition, e = parseExpireCondition(rest[0])
+				if e != nil {
+					conn.WriteError(e.Error())
 					return
 				}
-			case "append":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: append")
-				if len(cmd.Args) == 3 {
-					// append key appendValue
-					e = db.stringIndex.Append(cmd.Args[1], cmd.Args[2])
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteInt(len(cmd.Args[2]))
-					return
-				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+				rest = rest[1:]
+			}
+			var fields []string
+			fields, e = parseHashFieldsArgs(rest)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			var result []int
+			result, e = db.database.HExpire(string(cmd.Args[1]), expiredAt, condition, fields...)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteArray(len(result))
+			for _, v := range result {
+				conn.WriteInt(v)
+			}
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "httl", "hpttl":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 5 {
+			// httl key FIELDS numfields field [field ...]
+			var fields []string
+			fields, e = parseHashFieldsArgs(cmd.Args[2:])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			var result []int64
+			if strings.ToLower(string(cmd.Args[0])) == "httl" {
+				result, e = db.database.HTTL(string(cmd.Args[1]), fields...)
+			} else {
+				result, e = db.database.HPTTL(string(cmd.Args[1]), fields...)
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteArray(len(result))
+			for _, v := range result {
+				conn.WriteInt64(v)
+			}
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hpersist":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hpersist")
+		if len(cmd.Args) >= 5 {
+			// hpersist key FIELDS numfields field [field ...]
+			var fields []string
+			fields, e = parseHashFieldsArgs(cmd.Args[2:])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			var result []int
+			result, e = db.database.HPersist(string(cmd.Args[1]), fields...)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteArray(len(result))
+			for _, v := range result {
+				conn.WriteInt(v)
+			}
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "hscan":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hscan")
+		if len(cmd.Args) >= 3 {
+			// hscan key cursor [match pattern] [count count]
+			var options scanOptions
+			options, e = parseScanOptions(cmd.Args[2], cmd.Args[3:], false)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			var next uint64
+			var fields []database.HashField
+			next, fields, e = db.database.HScan(string(cmd.Args[1]), options.cursor, options.pattern, options.count)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteArray(2)
+			conn.WriteBulkString(formatCursor(next))
+			writeHashFields(conn, fields, true)
+			return
+		} else {
+			// 参数数量错误
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+
+	// list 部分的命令解析
+	case "linsert":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: linsert")
+		if len(cmd.Args) == 4 {
+			// linsert key index value
+			i, e := strconv.Atoi(string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError("Cannot Read Index As Number: " + e.Error())
+				return
+			}
+			e = db.database.LInsert(cmd.Args[1], i, cmd.Args[3], -1)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else if len(cmd.Args) == 6 {
+			// linsert key index value ex/px time
+			i, e := strconv.Atoi(string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError("Cannot Read Index As Number: " + e.Error())
+				return
+			}
+			expired, e = strconv.Atoi(string(cmd.Args[5]))
+			if e != nil {
+				conn.WriteError("Cannot Read Expired As Number: " + e.Error())
+				return
+			}
+			var expiredAt int64
+			expiredAt, e = util.CalcTimeUnix(string(cmd.Args[4]), expired)
+			e = db.database.LInsert(cmd.Args[1], i, cmd.Args[3], expiredAt)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "lpop":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: lpop")
+		if len(cmd.Args) == 2 {
+			// lpop key
+			v, e := db.database.LPop(cmd.Args[1])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString(string(v))
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "lpush":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: lpush")
+		if len(cmd.Args) == 3 {
+			// lpush key value
+			e = db.database.LPush(cmd.Args[1], -1, cmd.Args[2])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else if len(cmd.Args) == 5 {
+			// lpush key value ex/px time
+			expired, e = strconv.Atoi(string(cmd.Args[4]))
+			if e != nil {
+				conn.WriteError("Cannot Read Expired As Number: " + e.Error())
+				return
+			}
+			var expiredAt int64
+			expiredAt, e = util.CalcTimeUnix(string(cmd.Args[3]), expired)
+			e = db.database.LPush(cmd.Args[1], expiredAt, cmd.Args[3])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "lset":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: lset")
+		if len(cmd.Args) == 4 {
+			// lset key index value
+			i, e := strconv.Atoi(string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError("Cannot Read Index As Number: " + e.Error())
+				return
+			}
+			e = db.database.LSet(cmd.Args[1], i, cmd.Args[2])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "lrem":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: lrem")
+		if len(cmd.Args) == 4 {
+			// lrem key index value
+			i, e := strconv.Atoi(string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError("Cannot Read Index As Number: " + e.Error())
+				return
+			}
+			e = db.database.LRem(cmd.Args[1], i, cmd.Args[2])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "llen":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 2 {
+			// llen key
+			result, e := db.database.LLen(cmd.Args[1])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "lindex":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 3 {
+			// lindex key index
+			i, e := strconv.Atoi(string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError("Cannot Read Index As Number: " + e.Error())
+				return
+			}
+			result, e := db.database.LIndex(cmd.Args[1], i)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString(string(result))
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "lrange":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 4 {
+			// lrange key start end
+			start, e := strconv.Atoi(string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError("Cannot Read Start As Number: " + e.Error())
+				return
+			}
+			end, e := strconv.Atoi(string(cmd.Args[3]))
+			if e != nil {
+				conn.WriteError("Cannot Read End As Number: " + e.Error())
+				return
+			}
+			result, e := db.database.LRange(cmd.Args[1], start, end)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString(util.TurnByteArray2ToString(result))
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+
+	case "rpush", "lpushx", "rpushx":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 3 {
+			// rpush key element [element ...]
+			var length int
+			switch strings.ToLower(string(cmd.Args[0])) {
+			case "rpush":
+				length, e = db.database.RPush(cmd.Args[1], -1, cmd.Args[2:]...)
+			case "lpushx":
+				length, e = db.database.LPushX(cmd.Args[1], -1, cmd.Args[2:]...)
+			default:
+				length, e = db.database.RPushX(cmd.Args[1], -1, cmd.Args[2:]...)
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(length)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "rpop":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 2 {
+			// rpop key
+			v, e := db.database.RPop(cmd.Args[1])
+			if errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteNull()
+				return
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteBulk(v)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "lmove", "rpoplpush":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		isLMove := strings.ToLower(string(cmd.Args[0])) == "lmove"
+		if (isLMove && len(cmd.Args) == 5) || (!isLMove && len(cmd.Args) == 3) {
+			// lmove source destination LEFT|RIGHT LEFT|RIGHT
+			// rpoplpush source destination
+			whereFrom, whereTo := database.ListRight, database.ListLeft
+			if isLMove {
+				whereFrom, e = parseListEnd(cmd.Args[3])
+				if e != nil {
+					conn.WriteError(e.Error())
 					return
 				}
-			case "del":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: del")
-				if len(cmd.Args) == 2 {
-					// del key
-					e = db.stringIndex.Del(cmd.Args[1])
-					if e != nil {
-						if errors.Is(logger.KeyIsNotExisted, e) {
-							conn.WriteInt(0)
-						} else {
-							conn.WriteError(e.Error())
-						}
-						return
-					}
-					conn.WriteInt(1)
-					return
-				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+				whereTo, e = parseListEnd(cmd.Args[4])
+				if e != nil {
+					conn.WriteError(e.Error())
 					return
 				}
-
-			// hash部分的命令解析
-			case "hset":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hset")
-				if len(cmd.Args) == 4 {
-					// hset key field value
-					e = db.hashIndex.HSet(string(cmd.Args[1]), string(cmd.Args[2]), string(cmd.Args[3]), -1)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-					return
-				} else if len(cmd.Args) == 6 {
-					// hset key field value ex/px time
-					// 设置过期时间
-					expired, e = strconv.Atoi(string(cmd.Args[5]))
-					var expiredAt int64
-					expiredAt, e = util.CalcTimeUnix(string(cmd.Args[4]), expired)
-					if e != nil {
-						conn.WriteError(e.Error() + string(cmd.Args[4]))
-						return
-					}
-					e = db.hashIndex.HSet(string(cmd.Args[1]), string(cmd.Args[2]), string(cmd.Args[3]), expiredAt)
-				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-					return
+			}
+			v, e := db.database.LMove(cmd.Args[1], cmd.Args[2], whereFrom, whereTo)
+			if errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteNull()
+				return
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteBulk(v)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "ltrim":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 4 {
+			// ltrim key start stop
+			start, e := strconv.Atoi(string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			stop, e := strconv.Atoi(string(cmd.Args[3]))
+			if e != nil {
+				conn.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			e = db.database.LTrim(cmd.Args[1], start, stop)
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "lcheck":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 2 {
+			// lcheck key 检查列表在文件中的历史和内存中的列表是否一致
+			e := db.database.CheckList(cmd.Args[1])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "lpos":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 3 {
+			// lpos key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+			options, e := parseLPosOptions(cmd.Args[3:])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			result, e := db.database.LPos(cmd.Args[1], cmd.Args[2], options.rank, options.count, options.maxLen)
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			if options.hasCount {
+				conn.WriteArray(len(result))
+				for _, v := range result {
+					conn.WriteInt(v)
 				}
-			case "hsetnx":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hsetnx")
-				if len(cmd.Args) == 4 {
-					// hset key field value
-					e = db.hashIndex.HSetNX(string(cmd.Args[1]), string(cmd.Args[2]), string(cmd.Args[3]), -1)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-					return
-				} else if len(cmd.Args) == 6 {
-					// hsetnx key field value ex/px time
-					// 设置过期时间
-					expired, e = strconv.Atoi(string(cmd.Args[5]))
-					var expiredAt int64
-					expiredAt, e = util.CalcTimeUnix(string(cmd.Args[4]), expired)
-					if e != nil {
-						conn.WriteError(e.Error() + string(cmd.Args[4]))
-						return
-					}
-					e = db.hashIndex.HSetNX(string(cmd.Args[1]), string(cmd.Args[2]), string(cmd.Args[3]), expiredAt)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
+				return
+			}
+			if len(result) == 0 {
+				conn.WriteNull()
+				return
+			}
+			conn.WriteInt(result[0])
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "blpop", "brpop":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 3 {
+			// blpop key [key ...] timeout
+			timeout, e := parseBlockingTimeout(cmd.Args[len(cmd.Args)-1])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			db.block(conn, cmd, func(ctx context.Context, args [][]byte) {
+				var key, value []byte
+				var e error
+				if strings.ToLower(string(args[0])) == "blpop" {
+					key, value, e = db.database.BLPop(ctx, timeout, args[1:len(args)-1]...)
 				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-					return
+					key, value, e = db.database.BRPop(ctx, timeout, args[1:len(args)-1]...)
 				}
-			case "hget":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hget")
-				if len(cmd.Args) == 3 {
-					// hget key field
-					var result string
-					result, e = db.hashIndex.HGet(string(cmd.Args[1]), string(cmd.Args[2]))
-					if errors.Is(logger.KeyIsNotExisted, e) || errors.Is(logger.FieldIsNotExisted, e) {
-						conn.WriteString("nil")
-					} else if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString(result)
+				if errors.Is(e, context.Canceled) {
+					// 连接已经断开或者服务器正在关闭 不需要回复
 					return
-				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+				}
+				if e != nil {
+					conn.WriteError(e.Error())
 					return
 				}
-			case "hdel":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hdel")
-				if len(cmd.Args) == 3 {
-					// hdel key field
-					e = db.hashIndex.HDel(string(cmd.Args[1]), string(cmd.Args[2]), true)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteInt(1)
-					return
-				} else if len(cmd.Args) == 2 {
-					// hdel key
-					e = db.hashIndex.HDel(string(cmd.Args[1]), "", false)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteInt(1)
-					return
-				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-					return
-				}
-			case "hlen":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hlen")
-				if len(cmd.Args) == 2 {
-					// hlen key
-					var result int
-					result, e = db.hashIndex.HLen(string(cmd.Args[1]))
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteInt(result)
-					return
-				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+				if key == nil {
+					// 超时 和 redis 一样回复空数组
+					conn.WriteArray(-1)
 					return
 				}
-			case "hexists":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hexists")
-				if len(cmd.Args) == 3 {
-					// hexists key field
-					var result bool
-					result, e = db.hashIndex.HExist(string(cmd.Args[1]), string(cmd.Args[2]))
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					if result {
-						conn.WriteInt(1)
-					} else {
-						conn.WriteInt(0)
-					}
-					return
-				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-					return
-				}
-			case "hstrlen":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: hstrlen")
-				if len(cmd.Args) == 3 {
-					// hstrlen key field
-					var result int
-					result, e = db.hashIndex.HStrLen(string(cmd.Args[1]), string(cmd.Args[2]))
-					if errors.Is(logger.FieldIsNotExisted, e) {
-						conn.WriteInt(0)
-						return
-					} else if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteInt(result)
-					return
-				} else {
-					// 参数数量错误
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+				writeBulkArray(conn, [][]byte{key, value})
+			})
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "blmove", "brpoplpush":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		isBLMove := strings.ToLower(string(cmd.Args[0])) == "blmove"
+		if (isBLMove && len(cmd.Args) == 6) || (!isBLMove && len(cmd.Args) == 4) {
+			// blmove source destination LEFT|RIGHT LEFT|RIGHT timeout
+			// brpoplpush source destination timeout
+			whereFrom, whereTo := database.ListRight, database.ListLeft
+			if isBLMove {
+				whereFrom, e = parseListEnd(cmd.Args[3])
+				if e != nil {
+					conn.WriteError(e.Error())
 					return
 				}
-
-			// list 部分的命令解析
-			case "linsert":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: linsert")
-				if len(cmd.Args) == 4 {
-					// linsert key index value
-					i, e := strconv.Atoi(string(cmd.Args[2]))
-					if e != nil {
-						conn.WriteError("Cannot Read Index As Number: " + e.Error())
-						return
-					}
-					e = db.listIndex.LInsert(cmd.Args[1], i, cmd.Args[3], -1)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-					return
-				} else if len(cmd.Args) == 6 {
-					// linsert key index value ex/px time
-					i, e := strconv.Atoi(string(cmd.Args[2]))
-					if e != nil {
-						conn.WriteError("Cannot Read Index As Number: " + e.Error())
-						return
-					}
-					expired, e = strconv.Atoi(string(cmd.Args[5]))
-					if e != nil {
-						conn.WriteError("Cannot Read Expired As Number: " + e.Error())
-						return
-					}
-					var expiredAt int64
-					expiredAt, e = util.CalcTimeUnix(string(cmd.Args[4]), expired)
-					e = db.listIndex.LInsert(cmd.Args[1], i, cmd.Args[3], expiredAt)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-					return
-				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+				whereTo, e = parseListEnd(cmd.Args[4])
+				if e != nil {
+					conn.WriteError(e.Error())
 					return
 				}
-			case "lpop":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: lpop")
-				if len(cmd.Args) == 2 {
-					// lpop key
-					v, e := db.listIndex.LPop(cmd.Args[1])
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString(string(v))
-					return
-				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			}
+			timeout, e := parseBlockingTimeout(cmd.Args[len(cmd.Args)-1])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			db.block(conn, cmd, func(ctx context.Context, args [][]byte) {
+				value, ok, e := db.database.BLMove(ctx, args[1], args[2], whereFrom, whereTo, timeout)
+				if errors.Is(e, context.Canceled) {
 					return
 				}
-			case "lpush":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: lpush")
-				if len(cmd.Args) == 3 {
-					// lpush key value
-					e = db.listIndex.LPush(cmd.Args[1], -1, cmd.Args[2])
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-					return
-				} else if len(cmd.Args) == 5 {
-					// lpush key value ex/px time
-					expired, e = strconv.Atoi(string(cmd.Args[4]))
-					if e != nil {
-						conn.WriteError("Cannot Read Expired As Number: " + e.Error())
-						return
-					}
-					var expiredAt int64
-					expiredAt, e = util.CalcTimeUnix(string(cmd.Args[3]), expired)
-					e = db.listIndex.LPush(cmd.Args[1], expiredAt, cmd.Args[3])
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-					return
-				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+				if e != nil {
+					conn.WriteError(e.Error())
 					return
 				}
-			case "lset":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: lset")
-				if len(cmd.Args) == 4 {
-					// lset key index value
-					i, e := strconv.Atoi(string(cmd.Args[2]))
-					if e != nil {
-						conn.WriteError("Cannot Read Index As Number: " + e.Error())
-						return
-					}
-					e = db.listIndex.LSet(cmd.Args[1], i, cmd.Args[2])
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-					return
-				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+				if !ok {
+					// 超时
+					conn.WriteNull()
 					return
 				}
-			case "lrem":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: lrem")
-				if len(cmd.Args) == 4 {
-					// lrem key index value
-					i, e := strconv.Atoi(string(cmd.Args[2]))
-					if e != nil {
-						conn.WriteError("Cannot Read Index As Number: " + e.Error())
-						return
-					}
-					e = db.listIndex.LRem(cmd.Args[1], i, cmd.Args[2])
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-					return
-				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+				conn.WriteBulk(value)
+			})
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+
+	// zset 部分命令解析
+	case "zadd":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 4 {
+			// zadd key score member
+			s, e := util.ParseScore(string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError("Cannot Read Score As Number: " + e.Error())
+				return
+			}
+			e = db.database.ZAdd(cmd.Args[1], s, cmd.Args[3], -1)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else if len(cmd.Args) == 6 {
+			// zadd key score member ex/px time
+			s, e := util.ParseScore(string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError("Cannot Read Score As Number: " + e.Error())
+				return
+			}
+			expired, e = strconv.Atoi(string(cmd.Args[5]))
+			if e != nil {
+				conn.WriteError("Cannot Read Expired As Number: " + e.Error())
+				return
+			}
+			var expiredAt int64
+			expiredAt, e = util.CalcTimeUnix(string(cmd.Args[4]), expired)
+			e = db.database.ZAdd(cmd.Args[1], s, cmd.Args[3], expiredAt)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zrem":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 3 {
+			// zrem key member
+			e = db.database.ZRem(cmd.Args[1], cmd.Args[2])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteString("OK")
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zscore":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 3 {
+			// zscore key member
+			result, e := db.database.ZScore(cmd.Args[1], cmd.Args[2])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteBulkString(util.FormatScore(result))
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zcard":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 2 {
+			// zcard key
+			result, e := db.database.ZCard(cmd.Args[1])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zcount":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 4 {
+			// zcount key min max
+			minScore, e := parseScoreBound(cmd.Args[2])
+			if e != nil {
+				conn.WriteError("Cannot Read Min As Number: " + e.Error())
+				return
+			}
+			maxScore, e := parseScoreBound(cmd.Args[3])
+			if e != nil {
+				conn.WriteError("Cannot Read Max As Number: " + e.Error())
+				return
+			}
+			result, e := db.database.ZCount(cmd.Args[1], minScore, maxScore)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zrange":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 4 {
+			// zrange key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+			options, e := parseZRangeOptions(cmd.Args[4:])
+			if e == nil {
+				e = options.validate()
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			db.writeZRange(conn, cmd.Args[1], cmd.Args[2], cmd.Args[3], options)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zrangebyscore", "zrevrangebyscore", "zrangebylex", "zrevrangebylex":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 4 {
+			// zrangebyscore key min max [WITHSCORES] [LIMIT offset count]
+			// zrevrangebyscore key max min [WITHSCORES] [LIMIT offset count]
+			// zrangebylex key min max [LIMIT offset count]
+			// zrevrangebylex key max min [LIMIT offset count]
+			options, e := parseZRangeOptions(cmd.Args[4:])
+			if e == nil && (options.byScore || options.byLex || options.isRev) {
+				e = errors.New("ERR syntax error")
+			}
+			command := strings.ToLower(string(cmd.Args[0]))
+			options.byLex = strings.HasSuffix(command, "bylex")
+			options.byScore = !options.byLex
+			options.isRev = strings.HasPrefix(command, "zrev")
+			if e == nil {
+				e = options.validate()
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			db.writeZRange(conn, cmd.Args[1], cmd.Args[2], cmd.Args[3], options)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zrank", "zrevrank":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 3 {
+			// zrank key member
+			var result int
+			if strings.ToLower(string(cmd.Args[0])) == "zrank" {
+				result, e = db.database.ZRank(cmd.Args[1], cmd.Args[2])
+			} else {
+				result, e = db.database.ZRevRank(cmd.Args[1], cmd.Args[2])
+			}
+			if errors.Is(e, logger.KeyIsNotExisted) || errors.Is(e, logger.MemberIsNotExisted) {
+				conn.WriteNull()
+				return
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zremrangebyrank":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 4 {
+			// zremrangebyrank key start stop
+			start, e := strconv.Atoi(string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			stop, e := strconv.Atoi(string(cmd.Args[3]))
+			if e != nil {
+				conn.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			result, e := db.database.ZRemRangeByRank(cmd.Args[1], start, stop)
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+
+	case "zlexcount":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 4 {
+			// zlexcount key min max
+			minLex, e1 := parseLexBound(cmd.Args[2])
+			maxLex, e2 := parseLexBound(cmd.Args[3])
+			if e1 != nil || e2 != nil {
+				conn.WriteError("ERR min or max not valid string range item")
+				return
+			}
+			result, e := db.database.ZLexCount(cmd.Args[1], minLex, maxLex)
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zremrangebylex":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 4 {
+			// zremrangebylex key min max
+			minLex, e1 := parseLexBound(cmd.Args[2])
+			maxLex, e2 := parseLexBound(cmd.Args[3])
+			if e1 != nil || e2 != nil {
+				conn.WriteError("ERR min or max not valid string range item")
+				return
+			}
+			result, e := db.database.ZRemRangeByLex(cmd.Args[1], minLex, maxLex)
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zincrby":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 4 {
+			// zincrby key increment member
+			increment, e := util.ParseScore(string(cmd.Args[2]))
+			if e != nil {
+				conn.WriteError("Cannot Read Increment As Number: " + e.Error())
+				return
+			}
+			result, e := db.database.ZIncrBy(cmd.Args[1], increment, cmd.Args[3])
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteBulkString(util.FormatScore(result))
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zpopmin", "zpopmax":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 2 || len(cmd.Args) == 3 {
+			// zpopmin key [count]
+			count := 1
+			if len(cmd.Args) == 3 {
+				count, e = strconv.Atoi(string(cmd.Args[2]))
+				if e != nil || count < 0 {
+					conn.WriteError("ERR value is out of range, must be positive")
 					return
 				}
-			case "llen":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
-				if len(cmd.Args) == 2 {
-					// llen key
-					result, e := db.listIndex.LLen(cmd.Args[1])
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteInt(result)
-					return
+			}
+			var result []database.ZSetMember
+			if strings.ToLower(string(cmd.Args[0])) == "zpopmin" {
+				result, e = db.database.ZPopMin(cmd.Args[1], count)
+			} else {
+				result, e = db.database.ZPopMax(cmd.Args[1], count)
+			}
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			writeZSetMembers(conn, result, true)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zmscore":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 3 {
+			// zmscore key member [member ...]
+			result, e := db.database.ZMScore(cmd.Args[1], cmd.Args[2:]...)
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			// 有序集合不存在时 所有 member 都视为不存在
+			conn.WriteArray(len(cmd.Args) - 2)
+			for i := 0; i < len(cmd.Args)-2; i++ {
+				if result == nil || result[i] == nil {
+					conn.WriteNull()
 				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-					return
+					conn.WriteBulkString(util.FormatScore(*result[i]))
 				}
-			case "lindex":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
-				if len(cmd.Args) == 3 {
-					// lindex key index
-					i, e := strconv.Atoi(string(cmd.Args[2]))
-					if e != nil {
-						conn.WriteError("Cannot Read Index As Number: " + e.Error())
-						return
-					}
-					result, e := db.listIndex.LIndex(cmd.Args[1], i)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString(string(result))
-					return
-				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			}
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zrandmember":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 2 && len(cmd.Args) <= 4 {
+			// zrandmember key [count [WITHSCORES]]
+			count := 1
+			if len(cmd.Args) >= 3 {
+				count, e = strconv.Atoi(string(cmd.Args[2]))
+				if e != nil {
+					conn.WriteError("ERR value is not an integer or out of range")
 					return
 				}
-			case "lrange":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
-				if len(cmd.Args) == 4 {
-					// lrange key start end
-					start, e := strconv.Atoi(string(cmd.Args[2]))
-					if e != nil {
-						conn.WriteError("Cannot Read Start As Number: " + e.Error())
-						return
-					}
-					end, e := strconv.Atoi(string(cmd.Args[3]))
-					if e != nil {
-						conn.WriteError("Cannot Read End As Number: " + e.Error())
-						return
-					}
-					result, e := db.listIndex.LRange(cmd.Args[1], start, end)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString(util.TurnByteArray2ToString(result))
-					return
-				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			}
+			withScores := false
+			if len(cmd.Args) == 4 {
+				if strings.ToLower(string(cmd.Args[3])) != "withscores" {
+					conn.WriteError("ERR syntax error")
 					return
 				}
+				withScores = true
+			}
+			result, e := db.database.ZRandMember(cmd.Args[1], count)
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			if len(cmd.Args) >= 3 {
+				writeZSetMembers(conn, result, withScores)
+			} else if len(result) == 0 {
+				// 不带 count 时有序集合不存在返回 nil
+				conn.WriteNull()
+			} else {
+				conn.WriteBulk(result[0].Member)
+			}
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
 
-			// zset 部分命令解析
-			case "zadd":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
-				if len(cmd.Args) == 4 {
-					// zadd key score member
-					s, e := strconv.Atoi(string(cmd.Args[2]))
-					if e != nil {
-						conn.WriteError("Cannot Read Score As Number: " + e.Error())
-						return
-					}
-					e = db.zsetIndex.ZAdd(cmd.Args[1], s, cmd.Args[3], -1)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-					return
-				} else if len(cmd.Args) == 6 {
-					// zadd key score member ex/px time
-					s, e := strconv.Atoi(string(cmd.Args[2]))
-					if e != nil {
-						conn.WriteError("Cannot Read Score As Number: " + e.Error())
-						return
-					}
-					expired, e = strconv.Atoi(string(cmd.Args[5]))
-					if e != nil {
-						conn.WriteError("Cannot Read Expired As Number: " + e.Error())
-						return
-					}
-					var expiredAt int64
-					expiredAt, e = util.CalcTimeUnix(string(cmd.Args[4]), expired)
-					e = db.zsetIndex.ZAdd(cmd.Args[1], s, cmd.Args[3], expiredAt)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-					return
-				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-					return
-				}
-			case "zrem":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
-				if len(cmd.Args) == 3 {
-					// zrem key member
-					e = db.zsetIndex.ZRem(cmd.Args[1], cmd.Args[2])
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString("OK")
-					return
-				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-					return
-				}
-			case "zscore":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
-				if len(cmd.Args) == 3 {
-					// zscore key member
-					result, e := db.zsetIndex.ZScore(cmd.Args[1], cmd.Args[2])
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteInt(result)
-					return
-				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-					return
-				}
-			case "zcard":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
-				if len(cmd.Args) == 2 {
-					// zcard key
-					result, e := db.zsetIndex.ZCard(cmd.Args[1])
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteInt(result)
-					return
+	case "zunion", "zinter", "zdiff":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 3 {
+			// zunion numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+			// zdiff numkeys key [key ...] [WITHSCORES]
+			command := strings.ToLower(string(cmd.Args[0]))
+			options, e := parseZSetOperationOptions(cmd.Args[1:], command == "zdiff", false)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			var result []database.ZSetMember
+			switch command {
+			case "zunion":
+				result, e = db.database.ZUnion(options.keys, options.weights, options.aggregate)
+			case "zinter":
+				result, e = db.database.ZInter(options.keys, options.weights, options.aggregate)
+			default:
+				result, e = db.database.ZDiff(options.keys)
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			writeZSetMembers(conn, result, options.withScores)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zunionstore", "zinterstore", "zdiffstore":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 4 {
+			// zunionstore destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+			// zdiffstore destination numkeys key [key ...]
+			command := strings.ToLower(string(cmd.Args[0]))
+			options, e := parseZSetOperationOptions(cmd.Args[2:], command == "zdiffstore", true)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			var result int
+			switch command {
+			case "zunionstore":
+				result, e = db.database.ZUnionStore(cmd.Args[1], options.keys, options.weights, options.aggregate)
+			case "zinterstore":
+				result, e = db.database.ZInterStore(cmd.Args[1], options.keys, options.weights, options.aggregate)
+			default:
+				result, e = db.database.ZDiffStore(cmd.Args[1], options.keys)
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "zscan":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: zscan")
+		if len(cmd.Args) >= 3 {
+			// zscan key cursor [match pattern] [count count]
+			var options scanOptions
+			options, e = parseScanOptions(cmd.Args[2], cmd.Args[3:], false)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			var next uint64
+			var members []database.ZSetMember
+			next, members, e = db.database.ZScan(cmd.Args[1], options.cursor, options.pattern, options.count)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteArray(2)
+			conn.WriteBulkString(formatCursor(next))
+			writeZSetMembers(conn, members, true)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+
+	// set 部分命令解析
+	case "sadd", "srem":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 3 {
+			// sadd key member [member ...]
+			var result int
+			if strings.ToLower(string(cmd.Args[0])) == "sadd" {
+				result, e = db.database.SAdd(cmd.Args[1], cmd.Args[2:]...)
+			} else {
+				result, e = db.database.SRem(cmd.Args[1], cmd.Args[2:]...)
+			}
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "smembers":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 2 {
+			// smembers key
+			result, e := db.database.SMembers(cmd.Args[1])
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			writeBulkArray(conn, result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "sismember":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 3 {
+			// sismember key member
+			result, e := db.database.SIsMember(cmd.Args[1], cmd.Args[2])
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			if result {
+				conn.WriteInt(1)
+			} else {
+				conn.WriteInt(0)
+			}
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "smismember":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 3 {
+			// smismember key member [member ...]
+			result, e := db.database.SMIsMember(cmd.Args[1], cmd.Args[2:]...)
+			if errors.Is(e, logger.KeyIsNotExisted) {
+				result = make([]bool, len(cmd.Args)-2)
+			} else if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteArray(len(result))
+			for _, v := range result {
+				if v {
+					conn.WriteInt(1)
 				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-					return
+					conn.WriteInt(0)
 				}
-			case "zcount":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
-				if len(cmd.Args) == 4 {
-					// zcount key min max
-					minIndex, e := strconv.Atoi(string(cmd.Args[2]))
-					if e != nil {
-						conn.WriteError("Cannot Read Min As Number: " + e.Error())
-						return
-					}
-					maxIndex, e := strconv.Atoi(string(cmd.Args[3]))
-					if e != nil {
-						conn.WriteError("Cannot Read Max As Number: " + e.Error())
-						return
-					}
-					result, e := db.zsetIndex.ZCount(cmd.Args[1], minIndex, maxIndex)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteInt(result)
-					return
-				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			}
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "scard":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 2 {
+			// scard key
+			result, e := db.database.SCard(cmd.Args[1])
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "spop", "srandmember":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 2 || len(cmd.Args) == 3 {
+			// spop key [count]
+			count := 1
+			if len(cmd.Args) == 3 {
+				count, e = strconv.Atoi(string(cmd.Args[2]))
+				if e != nil {
+					conn.WriteError("Cannot Read Count As Number: " + e.Error())
 					return
 				}
-			case "zrange":
-				logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
-				if len(cmd.Args) == 4 {
-					// zrange key min max
-					minIndex, e := strconv.Atoi(string(cmd.Args[2]))
-					if e != nil {
-						conn.WriteError("Cannot Read Min As Number: " + e.Error())
-						return
-					}
-					maxIndex, e := strconv.Atoi(string(cmd.Args[3]))
-					if e != nil {
-						conn.WriteError("Cannot Read Max As Number: " + e.Error())
-						return
-					}
-					result, e := db.zsetIndex.ZRange(cmd.Args[1], minIndex, maxIndex)
-					if e != nil {
-						conn.WriteError(e.Error())
-						return
-					}
-					conn.WriteString(util.TurnByteArray2ToString(result))
-					return
-				} else {
-					conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			}
+			var result [][]byte
+			if strings.ToLower(string(cmd.Args[0])) == "spop" {
+				result, e = db.database.SPop(cmd.Args[1], count)
+			} else {
+				result, e = db.database.SRandMember(cmd.Args[1], count)
+			}
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			if len(cmd.Args) == 3 {
+				writeBulkArray(conn, result)
+			} else if len(result) == 0 {
+				// 不带 count 时 set 不存在返回 nil
+				conn.WriteNull()
+			} else {
+				conn.WriteBulk(result[0])
+			}
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "smove":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) == 4 {
+			// smove source destination member
+			result, e := db.database.SMove(cmd.Args[1], cmd.Args[2], cmd.Args[3])
+			if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+				conn.WriteError(e.Error())
+				return
+			}
+			if result {
+				conn.WriteInt(1)
+			} else {
+				conn.WriteInt(0)
+			}
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "sinter", "sunion", "sdiff":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 2 {
+			// sinter key [key ...]
+			var result [][]byte
+			var e error
+			switch strings.ToLower(string(cmd.Args[0])) {
+			case "sinter":
+				result, e = db.database.SInter(cmd.Args[1:]...)
+			case "sunion":
+				result, e = db.database.SUnion(cmd.Args[1:]...)
+			default:
+				result, e = db.database.SDiff(cmd.Args[1:]...)
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			writeBulkArray(conn, result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "sinterstore", "sunionstore", "sdiffstore":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 3 {
+			// sinterstore destination key [key ...]
+			var result int
+			var e error
+			switch strings.ToLower(string(cmd.Args[0])) {
+			case "sinterstore":
+				result, e = db.database.SInterStore(cmd.Args[1], cmd.Args[2:]...)
+			case "sunionstore":
+				result, e = db.database.SUnionStore(cmd.Args[1], cmd.Args[2:]...)
+			default:
+				result, e = db.database.SDiffStore(cmd.Args[1], cmd.Args[2:]...)
+			}
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "sintercard":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: " + string(cmd.Args[0]))
+		if len(cmd.Args) >= 3 {
+			// sintercard numkeys key [key ...] [LIMIT limit]
+			numKeys, e := strconv.Atoi(string(cmd.Args[1]))
+			if e != nil || numKeys <= 0 {
+				conn.WriteError("ERR numkeys should be greater than 0")
+				return
+			}
+			if len(cmd.Args) < 2+numKeys {
+				conn.WriteError("ERR Number of keys can't be greater than number of args")
+				return
+			}
+			limit := 0
+			rest := cmd.Args[2+numKeys:]
+			if len(rest) == 2 && strings.ToLower(string(rest[0])) == "limit" {
+				limit, e = strconv.Atoi(string(rest[1]))
+				if e != nil || limit < 0 {
+					conn.WriteError("ERR LIMIT can't be negative")
 					return
 				}
+			} else if len(rest) != 0 {
+				conn.WriteError("ERR syntax error")
+				return
 			}
-		},
-		func(conn redcon.Conn) bool {
-			logger.GenerateInfoLog("DataBase Connection Accept: " + conn.RemoteAddr())
-			return true
-		},
-		func(conn redcon.Conn, err error) {
-			logger.GenerateInfoLog("DataBase Connection Closed: " + conn.RemoteAddr())
+			result, e := db.database.SInterCard(limit, cmd.Args[2:2+numKeys]...)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteInt(result)
 			return
-		},
-	)
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	case "sscan":
+		logger.GenerateInfoLog(conn.RemoteAddr() + ": Query: sscan")
+		if len(cmd.Args) >= 3 {
+			// sscan key cursor [match pattern] [count count]
+			var options scanOptions
+			options, e = parseScanOptions(cmd.Args[2], cmd.Args[3:], false)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			var next uint64
+			var members [][]byte
+			next, members, e = db.database.SScan(cmd.Args[1], options.cursor, options.pattern, options.count)
+			if e != nil {
+				conn.WriteError(e.Error())
+				return
+			}
+			conn.WriteArray(2)
+			conn.WriteBulkString(formatCursor(next))
+			writeBulkArray(conn, members)
+			return
+		} else {
+			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			return
+		}
+	}
+}
+
+// writeBulkArray 以 RESP 数组的形式回复多个值
+func writeBulkArray(conn redcon.Conn, values [][]byte) {
+	conn.WriteArray(len(values))
+	for _, v := range values {
+		conn.WriteBulk(v)
+	}
+}
+
+// writeHashFields 以 RESP 数组的形式回复 hash 的 field withValues 为 true 时每个 field 后面跟着它的 value
+func writeHashFields(conn redcon.Conn, fields []database.HashField, withValues bool) {
+	if withValues {
+		conn.WriteArray(len(fields) * 2)
+	} else {
+		conn.WriteArray(len(fields))
+	}
+	for _, v := range fields {
+		conn.WriteBulk(v.Field)
+		if withValues {
+			conn.WriteBulk(v.Value)
+		}
+	}
+}
+
+// writeZSetMembers 以 RESP 数组的形式回复有序集合的成员 withScores 为 true 时每个成员后面跟着它的 score
+func writeZSetMembers(conn redcon.Conn, members []database.ZSetMember, withScores bool) {
+	if withScores {
+		conn.WriteArray(len(members) * 2)
+	} else {
+		conn.WriteArray(len(members))
+	}
+	for _, v := range members {
+		conn.WriteBulk(v.Member)
+		if withScores {
+			conn.WriteBulkString(util.FormatScore(v.Score))
+		}
+	}
+}
 
+// zrangeOptions ZRANGE 类命令的可选参数
+type zrangeOptions struct {
+	byScore    bool
+	byLex      bool
+	isRev      bool
+	withScores bool
+	hasLimit   bool
+	offset     int
+	count      int
+}
+
+// parseZRangeOptions 解析 ZRANGE 类命令 start stop 之后的可选参数 规则同 redis 6.2 参数组合是否合法由 validate 检查
+func parseZRangeOptions(args [][]byte) (zrangeOptions, error) {
+	options := zrangeOptions{count: -1}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "byscore":
+			options.byScore = true
+		case "bylex":
+			options.byLex = true
+		case "rev":
+			options.isRev = true
+		case "withscores":
+			options.withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return options, errors.New("ERR syntax error")
+			}
+			offset, e := strconv.Atoi(string(args[i+1]))
+			if e != nil {
+				return options, errors.New("ERR value is not an integer or out of range")
+			}
+			count, e := strconv.Atoi(string(args[i+2]))
+			if e != nil {
+				return options, errors.New("ERR value is not an integer or out of range")
+			}
+			options.hasLimit, options.offset, options.count = true, offset, count
+			i += 2
+		default:
+			return options, errors.New("ERR syntax error")
+		}
+	}
+	return options, nil
+}
+
+// validate 检查可选参数的组合是否合法
+func (options zrangeOptions) validate() error {
+	if options.byScore && options.byLex {
+		return errors.New("ERR syntax error")
+	}
+	if options.hasLimit && !options.byScore && !options.byLex {
+		return errors.New("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if options.withScores && options.byLex {
+		return errors.New("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
 	return nil
 }
 
+// writeZRange 按解析好的参数执行 ZRANGE 类命令并回复 和 redis 一样 REV 时 start 是较大的一端 stop 是较小的一端
+func (db *MisakaDataBase) writeZRange(conn redcon.Conn, key, start, stop []byte, options zrangeOptions) {
+	var result []database.ZSetMember
+	var e error
+	if options.isRev && (options.byScore || options.byLex) {
+		start, stop = stop, start
+	}
+	switch {
+	case options.byScore:
+		minScore, e1 := parseScoreBound(start)
+		maxScore, e2 := parseScoreBound(stop)
+		if e1 != nil || e2 != nil {
+			conn.WriteError("ERR min or max is not a float")
+			return
+		}
+		result, e = db.database.ZRangeByScore(key, minScore, maxScore, options.isRev, options.offset, options.count)
+	case options.byLex:
+		minLex, e1 := parseLexBound(start)
+		maxLex, e2 := parseLexBound(stop)
+		if e1 != nil || e2 != nil {
+			conn.WriteError("ERR min or max not valid string range item")
+			return
+		}
+		result, e = db.database.ZRangeByLex(key, minLex, maxLex, options.isRev, options.offset, options.count)
+	default:
+		startIndex, e1 := strconv.Atoi(string(start))
+		stopIndex, e2 := strconv.Atoi(string(stop))
+		if e1 != nil || e2 != nil {
+			conn.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		result, e = db.database.ZRange(key, startIndex, stopIndex, options.isRev)
+	}
+	if e != nil && !errors.Is(e, logger.KeyIsNotExisted) {
+		conn.WriteError(e.Error())
+		return
+	}
+	writeZSetMembers(conn, result, options.withScores)
+}
+
+// zsetOperationOptions ZUNION 类命令的参数
+type zsetOperationOptions struct {
+	keys       [][]byte
+	weights    []float64
+	aggregate  database.Aggregate
+	withScores bool
+}
+
+// parseZSetOperationOptions 解析 ZUNION 类命令从 numkeys 开始的参数 isDiff 为 true 时不支持 WEIGHTS 和 AGGREGATE isStore 为 true 时不支持 WITHSCORES
+func parseZSetOperationOptions(args [][]byte, isDiff, isStore bool) (zsetOperationOptions, error) {
+	options := zsetOperationOptions{aggregate: database.AggregateSum}
+	numKeys, e := strconv.Atoi(string(args[0]))
+	if e != nil {
+		return options, errors.New("ERR value is not an integer or out of range")
+	}
+	if numKeys <= 0 {
+		return options, errors.New("ERR at least 1 input key is needed")
+	}
+	if numKeys > len(args)-1 {
+		return options, errors.New("ERR syntax error")
+	}
+	options.keys = args[1 : 1+numKeys]
+	rest := args[1+numKeys:]
+	for i := 0; i < len(rest); i++ {
+		switch strings.ToLower(string(rest[i])) {
+		case "weights":
+			if isDiff || i+numKeys >= len(rest) {
+				return options, errors.New("ERR syntax error")
+			}
+			options.weights = make([]float64, numKeys)
+			for j := range options.weights {
+				options.weights[j], e = util.ParseScore(string(rest[i+1+j]))
+				if e != nil {
+					return options, errors.New("ERR weight value is not a float")
+				}
+			}
+			i += numKeys
+		case "aggregate":
+			if isDiff || i+1 >= len(rest) {
+				return options, errors.New("ERR syntax error")
+			}
+			switch strings.ToLower(string(rest[i+1])) {
+			case "sum":
+				options.aggregate = database.AggregateSum
+			case "min":
+				options.aggregate = database.AggregateMin
+			case "max":
+				options.aggregate = database.AggregateMax
+			default:
+				return options, errors.New("ERR syntax error")
+			}
+			i += 1
+		case "withscores":
+			if isStore {
+				return options, errors.New("ERR syntax error")
+			}
+			options.withScores = true
+		default:
+			return options, errors.New("ERR syntax error")
+		}
+	}
+	return options, nil
+}
+
+// lposOptions LPOS 命令的可选参数
+type lposOptions struct {
+	rank     int
+	count    int
+	maxLen   int
+	hasCount bool
+}
+
+// parseLPosOptions 解析 LPOS 命令 element 之后的可选参数 规则同 redis
+func parseLPosOptions(args [][]byte) (lposOptions, error) {
+	options := lposOptions{rank: 1, count: 1}
+	if len(args)%2 != 0 {
+		return options, errors.New("ERR syntax error")
+	}
+	for i := 0; i < len(args); i += 2 {
+		value, e := strconv.Atoi(string(args[i+1]))
+		if e != nil {
+			return options, errors.New("ERR value is not an integer or out of range")
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "rank":
+			if value == 0 {
+				return options, errors.New("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			options.rank = value
+		case "count":
+			if value < 0 {
+				return options, errors.New("ERR COUNT can't be negative")
+			}
+			options.count, options.hasCount = value, true
+		case "maxlen":
+			if value < 0 {
+				return options, errors.New("ERR MAXLEN can't be negative")
+			}
+			options.maxLen = value
+		default:
+			return options, errors.New("ERR syntax error")
+		}
+	}
+	return options, nil
+}
+
+// calcExpiredAt 按 EXPIRE 类命令计算过期的毫秒时间戳 溢出时返回 false
+func calcExpiredAt(command string, t int64) (int64, bool) {
+	now := time.Now().UnixMilli()
+	switch command {
+	case "expire":
+		if t > (math.MaxInt64-now)/1000 || t < (math.MinInt64+now)/1000 {
+			return 0, false
+		}
+		return now + t*1000, true
+	case "pexpire":
+		if t > math.MaxInt64-now {
+			return 0, false
+		}
+		return now + t, true
+	default:
+		// expireat
+		if t > math.MaxInt64/1000 || t < math.MinInt64/1000 {
+			return 0, false
+		}
+		return t * 1000, true
+	}
+}
+
+// parseHashFieldsArgs 解析 HEXPIRE 类命令的 FIELDS numfields field [field ...] 部分
+func parseHashFieldsArgs(args [][]byte) ([]string, error) {
+	if len(args) < 3 || strings.ToLower(string(args[0])) != "fields" {
+		return nil, errors.New("ERR Mandatory argument FIELDS is missing or not at the right position")
+	}
+	numFields, e := strconv.Atoi(string(args[1]))
+	if e != nil || numFields <= 0 {
+		return nil, errors.New("ERR Parameter `numFields` should be greater than 0")
+	}
+	if numFields != len(args)-2 {
+		return nil, errors.New("ERR The `numfields` parameter must match the number of arguments")
+	}
+	fields := make([]string, 0, numFields)
+	for _, v := range args[2:] {
+		fields = append(fields, string(v))
+	}
+	return fields, nil
+}
+
+// parseExpireCondition 解析 EXPIRE 类命令的 NX XX GT LT 选项
+func parseExpireCondition(input []byte) (database.ExpireCondition, error) {
+	switch strings.ToLower(string(input)) {
+	case "nx":
+		return database.ExpireNX, nil
+	case "xx":
+		return database.ExpireXX, nil
+	case "gt":
+		return database.ExpireGT, nil
+	case "lt":
+		return database.ExpireLT, nil
+	}
+	return database.ExpireAlways, errors.New("ERR Unsupported option " + string(input))
+}
+
+// scanOptions SCAN 类命令的游标和可选参数
+type scanOptions struct {
+	cursor  uint64
+	pattern string
+	count   int
+	keyType string
+}
+
+// parseScanOptions 解析 SCAN 类命令的游标 cursor 和它之后的可选参数 args allowType 为 false 时不支持 TYPE 选项
+func parseScanOptions(cursor []byte, args [][]byte, allowType bool) (scanOptions, error) {
+	options := scanOptions{count: 10}
+	var e error
+	options.cursor, e = parseCursor(cursor)
+	if e != nil {
+		return options, e
+	}
+	if len(args)%2 != 0 {
+		return options, errors.New("ERR syntax error")
+	}
+	for i := 0; i < len(args); i += 2 {
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			options.pattern = string(args[i+1])
+			if options.pattern == "*" {
+				options.pattern = ""
+			}
+		case "count":
+			count, e := strconv.Atoi(string(args[i+1]))
+			if e != nil {
+				return options, errors.New("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return options, errors.New("ERR syntax error")
+			}
+			options.count = count
+		case "type":
+			if !allowType {
+				return options, errors.New("ERR syntax error")
+			}
+			options.keyType = strings.ToLower(string(args[i+1]))
+		default:
+			return options, errors.New("ERR syntax error")
+		}
+	}
+	return options, nil
+}
+
+// parseCursor 解析 SCAN 类命令的游标 游标是一个无符号的64位整数 0 表示从头开始
+func parseCursor(input []byte) (uint64, error) {
+	cursor, e := strconv.ParseUint(string(input), 10, 64)
+	if e != nil {
+		return 0, errors.New("ERR invalid cursor")
+	}
+	return cursor, nil
+}
+
+// formatCursor 把下一次遍历的游标转换为字符串 0 表示已经遍历完了
+func formatCursor(next uint64) string {
+	return strconv.FormatUint(next, 10)
+}
+
+// parseLexBound 解析有序集合字典序区间的边界 规则同 redis
+func parseLexBound(input []byte) (database.LexBound, error) {
+	member, isExclusive, infinity, e := util.ParseLexBound(string(input))
+	return database.LexBound{Member: []byte(member), IsExclusive: isExclusive, Infinity: infinity}, e
+}
+
+// parseScoreBound 解析有序集合 score 区间的边界 以 ( 开头的是开区间的边界
+func parseScoreBound(input []byte) (database.ScoreBound, error) {
+	score, isExclusive, e := util.ParseScoreBound(string(input))
+	return database.ScoreBound{Score: score, IsExclusive: isExclusive}, e
+}
+
 func (db *MisakaDataBase) StartServe() error {
 	logger.GenerateInfoLog("Server start Listen And Serve!")
 	return db.server.ListenAndServe()
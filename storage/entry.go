@@ -31,6 +31,17 @@ const (
 	TypeLPush
 
 	TypeListExpired // 过期标识 专门问 list 和 zset 用的
+
+	TypeDeleteKey // 删除整个键 merge 重写 list 时用来保证重放结果不受旧文件影响
+
+	TypeListPush // 以下为 list 基于元素 ID 的 entry type 上面基于位置的 list entry type 只在重放旧文件时使用
+	TypeListInsert
+	TypeListSet
+	TypeListRemove // 弹出 删除和过期都只是按 ID 移除元素
+	TypeListMove
+	TypeListTrim
+
+	TypeExpire // 修改过期时间 ExpiredAt 为新的过期时间 -1 表示去掉过期时间 值为写入时的时间戳
 )
 
 // 因为整个数据库的操作 增删改查 体现在文件上的只有删除和新增两种（改可以通过新增的方式进行覆盖）
@@ -83,6 +94,19 @@ func (e *Entry) Encode() ([]byte, int) {
 	return buffer, size
 }
 
+// EntrySize 计算给定长度的键 值和过期时间编码为Entry之后的长度 用于估算文件中的有效数据量
+func EntrySize(keyLength int, valueLength int, expiredAt int64) int64 {
+	buffer := make([]byte, binary.MaxVarintLen64)
+	size := 5 + keyLength + valueLength
+	size += binary.PutVarint(buffer, int64(keyLength))
+	size += binary.PutVarint(buffer, int64(valueLength))
+	size += binary.PutVarint(buffer, expiredAt)
+	if size < MaxEntryHeaderLength {
+		size = MaxEntryHeaderLength
+	}
+	return int64(size)
+}
+
 // 将给定的byte数组解码为entryHeaderInfo 即Entry的头信息 返回该头信息和头信息的字节长度
 func decodeEntryHeader(input []byte) (*entryHeaderInfo, int64) {
 	if len(input) <= 4 {
@@ -94,14 +118,23 @@ func decodeEntryHeader(input []byte) (*entryHeaderInfo, int64) {
 	}
 	index := 5
 	kSize, n := binary.Varint(input[index:])
+	if n <= 0 || kSize < 0 { // 头信息本身就是坏的
+		return nil, 0
+	}
 	result.keyLength = uint32(kSize)
 	index += n
 
 	vSize, n := binary.Varint(input[index:])
+	if n <= 0 || vSize < 0 {
+		return nil, 0
+	}
 	result.valueLength = uint32(vSize)
 	index += n
 
 	e, n := binary.Varint(input[index:])
+	if n <= 0 {
+		return nil, 0
+	}
 	result.expiredAt = e
 
 	return result, int64(index + n)
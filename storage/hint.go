@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"MisakaDB/logger"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// hint编码结构：
+// +--------+----------+--------+-----------+------------+-------+-------------------+------------+
+// |  type  | key size | offset | expiresAt | value size |  key  | (hint value size) | hint value |
+// +--------+----------+--------+-----------+------------+-------+-------------------+------------+
+// hint文件就是所有的hint首尾相连 最后再加上4字节的crc32校验和 校验和覆盖前面的全部内容
+//
+// list 和 zset 的索引在重放时离不开 entry 的值 所以它们的 hint 在最后还会带上值中重放需要的部分 其它类型没有这两项
+
+// Hint 记录一个entry在文件中的位置信息 但是不包括值本身 用于启动时快速重建索引
+type Hint struct {
+	EntryType EntryType
+	Key       []byte
+	Offset    int64
+	ExpiredAt int64
+	ValueSize uint32
+	Value     []byte // 值中重放需要的部分 只有 list 和 zset 的 hint 有
+}
+
+// HintValueFunc 返回 entry 的值中需要写入 hint 的部分
+type HintValueFunc func(entry *Entry) []byte
+
+// hintValueFuncs 由索引通过 SetHintValueFunc 设置 list 和 zset 没有设置时 hint 带上完整的值
+var hintValueFuncs = make(map[FileForData]HintValueFunc)
+
+// SetHintValueFunc 设置该类型的 hint 带上值中的哪一部分 只对 list 和 zset 有效 应该在打开文件之前调用
+func SetHintValueFunc(dataType FileForData, f HintValueFunc) {
+	hintValueFuncs[dataType] = f
+}
+
+// hintHasValue 该类型的 hint 是否带上值
+func hintHasValue(dataType FileForData) bool {
+	return dataType == List || dataType == ZSet
+}
+
+// Encode 将hint转换为byte数组 hasValue 为 true 时在最后带上 hint 的值
+func (h *Hint) Encode(hasValue bool) []byte {
+	buffer := make([]byte, 1+binary.MaxVarintLen64*5+len(h.Key)+len(h.Value))
+	buffer[0] = byte(h.EntryType)
+	index := 1
+	index += binary.PutVarint(buffer[index:], int64(len(h.Key)))
+	index += binary.PutVarint(buffer[index:], h.Offset)
+	index += binary.PutVarint(buffer[index:], h.ExpiredAt)
+	index += binary.PutVarint(buffer[index:], int64(h.ValueSize))
+	index += copy(buffer[index:], h.Key)
+	if hasValue {
+		index += binary.PutVarint(buffer[index:], int64(len(h.Value)))
+		index += copy(buffer[index:], h.Value)
+	}
+	return buffer[:index]
+}
+
+// decodeHint 从给定的byte数组中解码出一个hint 返回该hint和它的字节长度 hasValue 为 true 时 hint 的最后带有值
+func decodeHint(input []byte, hasValue bool) (*Hint, int, error) {
+	if len(input) < 1 {
+		return nil, 0, logger.HintFileIsBroken
+	}
+	result := &Hint{
+		EntryType: EntryType(input[0]),
+	}
+	index := 1
+	var values [4]int64
+	for i := range values {
+		value, n := binary.Varint(input[index:])
+		if n <= 0 {
+			return nil, 0, logger.HintFileIsBroken
+		}
+		values[i] = value
+		index += n
+	}
+	keyLength := int(values[0])
+	if keyLength < 0 || index+keyLength > len(input) {
+		return nil, 0, logger.HintFileIsBroken
+	}
+	result.Key = make([]byte, keyLength)
+	copy(result.Key, input[index:index+keyLength])
+	result.Offset = values[1]
+	result.ExpiredAt = values[2]
+	result.ValueSize = uint32(values[3])
+	index += keyLength
+	if hasValue {
+		valueLength, n := binary.Varint(input[index:])
+		if n <= 0 || valueLength < 0 || index+n+int(valueLength) > len(input) {
+			return nil, 0, logger.HintFileIsBroken
+		}
+		index += n
+		result.Value = make([]byte, valueLength)
+		copy(result.Value, input[index:index+int(valueLength)])
+		index += int(valueLength)
+	}
+	return result, index, nil
+}
+
+// WriteHintFile 为该文件生成hint文件 应该在文件写满 不再作为活跃文件之后调用
+//
+// 如果该文件是从磁盘加载的 内存中并没有它的hint 这时会重新读一遍整个文件来生成hint
+func (rf *RecordFile) WriteHintFile() error {
+	if !rf.hintsComplete {
+		hints, e := rf.scanHints()
+		if e != nil {
+			return e
+		}
+		rf.hints = hints
+		rf.hintsComplete = true
+	}
+
+	var content []byte
+	for _, v := range rf.hints {
+		content = append(content, v.Encode(hintHasValue(rf.dataType))...)
+	}
+	content = binary.LittleEndian.AppendUint32(content, crc32.ChecksumIEEE(content))
+
+	hintPath, e := getHintFileName(rf.fileID, rf.dataType, rf.folderPath)
+	if e != nil {
+		return e
+	}
+	// 先写临时文件再重命名 保证hint文件要么完整存在 要么不存在
+	e = os.WriteFile(hintPath+".tmp", content, 0644)
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), hintPath)
+		return e
+	}
+	e = os.Rename(hintPath+".tmp", hintPath)
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), hintPath)
+		return e
+	}
+	rf.hints = nil // 写完之后就不再需要留在内存里了
+	return nil
+}
+
+// ReadHintFile 读取该文件对应的hint文件 如果hint文件不存在则返回FileIsNotExist 如果校验不通过则返回CRCCheckSumNotPassed
+func (rf *RecordFile) ReadHintFile() ([]*Hint, error) {
+	hintPath, e := getHintFileName(rf.fileID, rf.dataType, rf.folderPath)
+	if e != nil {
+		return nil, e
+	}
+	content, e := os.ReadFile(hintPath)
+	if errors.Is(e, os.ErrNotExist) {
+		return nil, logger.FileIsNotExist
+	} else if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), hintPath)
+		return nil, e
+	}
+	if len(content) < crc32.Size {
+		logger.GenerateErrorLog(false, false, logger.HintFileIsBroken.Error(), hintPath)
+		return nil, logger.HintFileIsBroken
+	}
+	body := content[:len(content)-crc32.Size]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(content[len(content)-crc32.Size:]) {
+		logger.GenerateErrorLog(false, false, logger.CRCCheckSumNotPassed.Error(), hintPath)
+		return nil, logger.CRCCheckSumNotPassed
+	}
+
+	var result []*Hint
+	index := 0
+	for index < len(body) {
+		hint, n, e := decodeHint(body[index:], hintHasValue(rf.dataType))
+		if e != nil {
+			logger.GenerateErrorLog(false, false, e.Error(), hintPath, strconv.Itoa(index))
+			return nil, e
+		}
+		result = append(result, hint)
+		index += n
+	}
+	return result, nil
+}
+
+// deleteHintFile 删除该文件对应的hint文件 hint文件不存在不算错误
+func (rf *RecordFile) deleteHintFile() error {
+	hintPath, e := getHintFileName(rf.fileID, rf.dataType, rf.folderPath)
+	if e != nil {
+		return e
+	}
+	e = os.Remove(hintPath)
+	if e != nil && !errors.Is(e, os.ErrNotExist) {
+		logger.GenerateErrorLog(false, false, e.Error(), hintPath)
+		return e
+	}
+	return nil
+}
+
+// appendHint 文件写入entry之后记录对应的hint
+func (rf *RecordFile) appendHint(entry *Entry, offset int64) {
+	if !rf.hintsComplete {
+		return
+	}
+	// entry的键和值可能是调用者还要复用的切片 这里复制一份
+	hint := rf.newHint(entry, offset)
+	hint.Key = append([]byte(nil), hint.Key...)
+	hint.Value = append([]byte(nil), hint.Value...)
+	rf.hints = append(rf.hints, hint)
+}
+
+// newHint 生成 entry 对应的 hint 键和值直接引用 entry 中的切片
+func (rf *RecordFile) newHint(entry *Entry, offset int64) *Hint {
+	result := &Hint{
+		EntryType: entry.EntryType,
+		Key:       entry.Key,
+		Offset:    offset,
+		ExpiredAt: entry.ExpiredAt,
+		ValueSize: uint32(len(entry.Value)),
+	}
+	if hintHasValue(rf.dataType) {
+		result.Value = entry.Value
+		if f, ok := hintValueFuncs[rf.dataType]; ok {
+			result.Value = f(entry)
+		}
+	}
+	return result
+}
+
+// scanHints 读取整个文件 生成所有entry对应的hint
+func (rf *RecordFile) scanHints() ([]*Hint, error) {
+	var (
+		result      []*Hint
+		offset      int64
+		entry       *Entry
+		entryLength int64
+		e           error
+	)
+	for offset < rf.newestOffset {
+		entry, entryLength, e = rf.ReadIntoEntry(offset)
+		if e != nil {
+			return nil, e
+		}
+		result = append(result, rf.newHint(entry, offset))
+		offset += entryLength
+	}
+	return result, nil
+}
+
+// getHintFileName 给hint文件起名 示例名字：hint.string.000000001.misaka
+func getHintFileName(fid uint32, dataType FileForData, path string) (string, error) {
+	recordFileName, e := getFileName(fid, dataType, path)
+	if e != nil {
+		return "", e
+	}
+	return filepath.Join(path, hintFileNamePrefix+filepath.Base(recordFileName)[len(recordFileNamePrefix):]), nil
+}
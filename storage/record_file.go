@@ -4,8 +4,10 @@ import (
 	"MisakaDB/file"
 	"MisakaDB/logger"
 	"MisakaDB/util"
+	"errors"
 	"fmt"
 	"hash/crc32"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -25,6 +27,11 @@ const (
 	ZSet
 )
 
+const (
+	recordFileNamePrefix = "record." // 数据文件的文件名前缀
+	hintFileNamePrefix   = "hint."   // hint文件的文件名前缀
+)
+
 var (
 	// 文件名的后缀
 	fileNameSuffix = map[FileForData]string{
@@ -52,8 +59,13 @@ type RecordFile struct {
 	newestOffset int64           // 该文件写入位置 或者说最新偏移位也可以
 	dataType     FileForData     // 该文件存储的键值对的类型
 	fileMaxSize  int64           // 该文件最大的大小
+	folderPath   string          // 该文件所在的文件夹 hint文件也放在这里
+
+	hints         []*Hint // 该文件中所有entry的hint 文件写满之后写入hint文件
+	hintsComplete bool    // hints是否从文件开头就开始记录 从磁盘加载的非空文件在内存中是没有hint的
 
 	IsSyncing bool // 是否在定时sync
+	isClosed  bool // 文件是否已经关闭或删除 关闭之后定时sync不能再碰这个文件
 }
 
 // FileIOType 指定文件的读写模式
@@ -67,10 +79,12 @@ const (
 // NewRecordFile 给定路径 读写模式 存储数据类型 文件ID和文件最大大小 新建一个RecordFile
 func NewRecordFile(ioType FileIOType, dataType FileForData, fid uint32, path string, fileMaxSize int64) (*RecordFile, error) {
 	result := &RecordFile{
-		fileID:       fid,
-		fileMaxSize:  fileMaxSize,
-		newestOffset: 0,
-		dataType:     dataType,
+		fileID:        fid,
+		fileMaxSize:   fileMaxSize,
+		newestOffset:  0,
+		dataType:      dataType,
+		folderPath:    path,
+		hintsComplete: true,
 	}
 	fileFullPath, e := getFileName(fid, dataType, path)
 	if e != nil {
@@ -111,9 +125,11 @@ func LoadRecordFileFromDisk(filePath string, fileMaxSize int64, ioType FileIOTyp
 		return nil, e
 	}
 	result := &RecordFile{
-		file:         f,
-		fileMaxSize:  fileMaxSize,
-		newestOffset: fileLen,
+		file:          f,
+		fileMaxSize:   fileMaxSize,
+		newestOffset:  fileLen,
+		folderPath:    filepath.Dir(filePath),
+		hintsComplete: fileLen == 0,
 	}
 	result.fileID, result.dataType, e = parseFileName(path.Base(filePath))
 	if e != nil {
@@ -130,11 +146,16 @@ func (rf *RecordFile) WriteEntryIntoFile(entry *Entry) error {
 		return logger.FileBytesIsMaxedOut
 	}
 	e := rf.file.Write(writeContent, int(rf.newestOffset))
+	if e == nil {
+		rf.appendHint(entry, rf.newestOffset)
+	}
 	rf.newestOffset += int64(length) // 调整偏移位
 	return e
 }
 
 // ReadIntoEntry 在RecordFile中 从给定的offset开始 尝试读取一个完整的Entry并且返回 第二个返回值为当此读取Entry的长度 用以快速定位下次Entry的offset
+//
+// 如果Entry超出了文件末尾 返回EntryIsIncomplete 如果校验不通过 返回CRCCheckSumNotPassed 此时第二个返回值为头信息中记录的Entry长度
 func (rf *RecordFile) ReadIntoEntry(offset int64) (*Entry, int64, error) {
 	entryHeaderBytes := make([]byte, MaxEntryHeaderLength)
 	e := rf.file.Read(entryHeaderBytes, int(offset))
@@ -142,6 +163,15 @@ func (rf *RecordFile) ReadIntoEntry(offset int64) (*Entry, int64, error) {
 		return nil, 0, e
 	}
 	entryHeader, index := decodeEntryHeader(entryHeaderBytes)
+	if entryHeader == nil {
+		logger.GenerateErrorLog(false, false, logger.CRCCheckSumNotPassed.Error(), util.TurnByteArrayToString(entryHeaderBytes))
+		return nil, MaxEntryHeaderLength, logger.CRCCheckSumNotPassed
+	}
+	// 先检查长度 防止残缺的头信息里读出一个巨大的长度
+	if offset+index+int64(entryHeader.keyLength)+int64(entryHeader.valueLength) > rf.newestOffset {
+		logger.GenerateErrorLog(false, false, logger.EntryIsIncomplete.Error(), strconv.FormatInt(offset, 10), strconv.Itoa(int(rf.fileID)))
+		return nil, 0, logger.EntryIsIncomplete
+	}
 	result := &Entry{
 		EntryType: entryHeader.entryType,
 		ExpiredAt: entryHeader.expiredAt,
@@ -156,29 +186,82 @@ func (rf *RecordFile) ReadIntoEntry(offset int64) (*Entry, int64, error) {
 	if e != nil {
 		return nil, 0, e
 	}
+	entrySize := index + int64(entryHeader.keyLength) + int64(entryHeader.valueLength)
+	if entrySize < MaxEntryHeaderLength { // 注意Entry的最小长度为25
+		entrySize = MaxEntryHeaderLength
+	}
 	if crc := getEntryCRC(result, entryHeaderBytes[crc32.Size:index]); crc != entryHeader.crc {
 		logger.GenerateErrorLog(false, false, logger.CRCCheckSumNotPassed.Error(), util.TurnByteArrayToString(entryHeaderBytes))
-		return nil, 0, logger.CRCCheckSumNotPassed
-	}
-	entrySize := index + int64(entryHeader.keyLength+entryHeader.valueLength)
-	if entrySize < MaxEntryHeaderLength { // 注意Entry的最小长度为25
-		return result, MaxEntryHeaderLength, nil
+		return nil, entrySize, logger.CRCCheckSumNotPassed
 	}
 	return result, entrySize, nil
 }
 
+// IsTornTail 在从offset读取Entry失败之后 判断失败的Entry是否是文件尾部写入到一半的残缺Entry
+//
+// entryLength和readError为ReadIntoEntry的返回值 Entry超出文件末尾 或者校验不通过但是它之后的内容全部为0（mmap预先分配的空间）时 认为是尾部的残缺Entry
+func (rf *RecordFile) IsTornTail(offset int64, entryLength int64, readError error) bool {
+	if errors.Is(readError, logger.EntryIsIncomplete) || errors.Is(readError, io.EOF) || errors.Is(readError, io.ErrUnexpectedEOF) {
+		return true
+	}
+	if !errors.Is(readError, logger.CRCCheckSumNotPassed) {
+		return false
+	}
+	rest := offset + entryLength
+	if rest >= rf.newestOffset {
+		return true
+	}
+	restBytes := make([]byte, rf.newestOffset-rest)
+	e := rf.file.Read(restBytes, int(rest))
+	if e != nil {
+		return false
+	}
+	for _, v := range restBytes {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Truncate 将文件截断到给定的长度 用于丢弃文件尾部残缺的Entry
+func (rf *RecordFile) Truncate(size int64) error {
+	e := rf.file.Truncate(size)
+	if e != nil {
+		return e
+	}
+	rf.newestOffset = size
+	if rf.hintsComplete {
+		for i := range rf.hints {
+			if rf.hints[i].Offset >= size {
+				rf.hints = rf.hints[:i]
+				break
+			}
+		}
+	}
+	return nil
+}
+
 // Sync 强制刷新缓冲区到文件中
-func (rf *RecordFile) sync() error {
+func (rf *RecordFile) Sync() error {
 	return rf.file.Sync()
 }
 
-// Delete 删除该文件
+// Delete 删除该文件 如果有对应的hint文件也一并删除
 func (rf *RecordFile) Delete() error {
-	return rf.file.Delete()
+	rf.IsSyncing = false
+	rf.isClosed = true
+	e := rf.file.Delete()
+	if e != nil {
+		return e
+	}
+	return rf.deleteHintFile()
 }
 
 // Close 关闭该文件
 func (rf *RecordFile) Close() error {
+	rf.IsSyncing = false
+	rf.isClosed = true
 	return rf.file.Close()
 }
 
@@ -192,6 +275,11 @@ func (rf *RecordFile) GetFileID() uint32 {
 	return rf.fileID
 }
 
+// GetDataType 获取该文件存储的数据类型
+func (rf *RecordFile) GetDataType() FileForData {
+	return rf.dataType
+}
+
 // GetOffset 获取当前文件的最新offset
 func (rf *RecordFile) GetOffset() int64 {
 	return rf.newestOffset
@@ -205,13 +293,18 @@ func (rf *RecordFile) StartSyncRoutine(duration time.Duration) {
 		for {
 			if rf.IsSyncing {
 				time.Sleep(duration)
+				if rf.isClosed { // 睡眠期间文件被关闭了
+					return
+				}
 				e := rf.file.Sync()
 				if e != nil { // 一旦报错就结束定时同步
 					return
 				}
 			} else {
 				logger.GenerateInfoLog("File " + strconv.Itoa(int(rf.fileID)) + " Stop Sync!")
-				_ = rf.file.Sync()
+				if !rf.isClosed {
+					_ = rf.file.Sync()
+				}
 				return
 			}
 		}
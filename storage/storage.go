@@ -4,6 +4,8 @@ import (
 	"MisakaDB/logger"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 // RecordFilesInit 按路径读取所有文件 并且转换为RecordFile 按数据类型进行分类 默认情况下编号最大的文件是活跃文件
@@ -11,7 +13,8 @@ import (
 func RecordFilesInit(path string, fileMaxSize int64, ioType FileIOType) (activeFiles map[FileForData]*RecordFile, archiveFiles map[FileForData]map[uint32]*RecordFile, e error) {
 	var filesPath []string
 	var walkFunc = func(path string, info os.FileInfo, err error) error {
-		if !info.IsDir() {
+		// 文件夹下面还有hint文件 只读取数据文件
+		if !info.IsDir() && strings.HasPrefix(info.Name(), recordFileNamePrefix) {
 			filesPath = append(filesPath, path)
 		}
 		return nil
@@ -51,3 +54,32 @@ func RecordFilesInit(path string, fileMaxSize int64, ioType FileIOType) (activeF
 	e = nil
 	return
 }
+
+// SortedFileIDs 将给定文件的ID按从小到大的顺序返回 文件ID越大说明文件越新 还原索引时必须按照这个顺序读取
+// attention merge之后文件ID不再从1开始连续 所以不能用 1 到 len 的循环来读取文件
+func SortedFileIDs(files map[uint32]*RecordFile) []uint32 {
+	result := make([]uint32, 0, len(files))
+	for fileID := range files {
+		result = append(result, fileID)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+	return result
+}
+
+// SyncFolder 同步文件夹本身 保证在此之前创建和删除文件的操作已经落盘
+func SyncFolder(path string) error {
+	folder, e := os.Open(path)
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), path)
+		return e
+	}
+	defer folder.Close()
+	e = folder.Sync()
+	if e != nil {
+		logger.GenerateErrorLog(false, false, e.Error(), path)
+		return e
+	}
+	return nil
+}
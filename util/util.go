@@ -3,6 +3,7 @@ package util
 import (
 	"MisakaDB/logger"
 	"encoding/binary"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -72,6 +73,63 @@ func CalcTimeUnix(unit string, t int) (int64, error) {
 	return 0, logger.TimeUnitIsNotSupported
 }
 
+// ParseScore 将字符串解析为有序集合的 score 支持 inf +inf -inf 不支持 nan 和超出 float64 范围的数
+func ParseScore(input string) (float64, error) {
+	score, e := strconv.ParseFloat(input, 64)
+	if e != nil || math.IsNaN(score) {
+		return 0, logger.ScoreIsNotFloat
+	}
+	return score, nil
+}
+
+// ParseScoreBound 将字符串解析为有序集合 score 区间的边界 以 ( 开头的是开区间的边界
+func ParseScoreBound(input string) (score float64, isExclusive bool, e error) {
+	if strings.HasPrefix(input, "(") {
+		input = input[1:]
+		isExclusive = true
+	}
+	score, e = ParseScore(input)
+	return
+}
+
+// ParseLexBound 将字符串解析为有序集合字典序区间的边界 规则同 redis
+//
+// - 和 + 分别表示负无穷和正无穷 此时 infinity 为 -1 或 1 以 [ 开头的是闭区间的边界 以 ( 开头的是开区间的边界
+func ParseLexBound(input string) (member string, isExclusive bool, infinity int8, e error) {
+	switch {
+	case input == "-":
+		infinity = -1
+	case input == "+":
+		infinity = 1
+	case strings.HasPrefix(input, "["):
+		member = input[1:]
+	case strings.HasPrefix(input, "("):
+		member = input[1:]
+		isExclusive = true
+	default:
+		e = logger.LexBoundIsIllegal
+	}
+	return
+}
+
+// FormatScore 将有序集合的 score 转换为字符串 整数不会带小数点 所以和旧版本用 strconv.Itoa 写入的 score 格式一致
+//
+// 和 redis 的 %.17g 一样 指数小于-4或者不小于17时使用科学计数法 比如 1e+300 不会展开成301位 位数取能够精确还原 score 的最少位数
+func FormatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	result := strconv.FormatFloat(score, 'e', -1, 64)
+	exp, e := strconv.Atoi(result[strings.LastIndexByte(result, 'e')+1:])
+	if e == nil && exp >= -4 && exp < 17 {
+		return strconv.FormatFloat(score, 'f', -1, 64)
+	}
+	return result
+}
+
 // BytesArrayCompare 比较两个字节数组是否相同
 func BytesArrayCompare(array1, array2 []byte) bool {
 	if len(array1) != len(array2) {
@@ -84,3 +142,92 @@ func BytesArrayCompare(array1, array2 []byte) bool {
 	}
 	return true
 }
+
+// MatchPattern 检查 input 是否和 glob 风格的 pattern 匹配 规则同 redis 的 KEYS 和 SCAN 的 MATCH
+//
+// * 匹配任意个字符 ? 匹配一个字符 [abc] [a-z] 匹配其中的一个字符 [^abc] 匹配不在其中的一个字符 \ 转义下一个字符
+func MatchPattern(pattern string, input string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(input); i++ {
+				if MatchPattern(pattern[1:], input[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(input) == 0 {
+				return false
+			}
+			input = input[1:]
+		case '[':
+			if len(input) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			isNot := len(pattern) > 0 && pattern[0] == '^'
+			if isNot {
+				pattern = pattern[1:]
+			}
+			isMatched := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) >= 2:
+					pattern = pattern[1:]
+					isMatched = isMatched || pattern[0] == input[0]
+				case len(pattern) >= 3 && pattern[1] == '-':
+					lower, upper := min(pattern[0], pattern[2]), max(pattern[0], pattern[2])
+					isMatched = isMatched || (input[0] >= lower && input[0] <= upper)
+					pattern = pattern[2:]
+				default:
+					isMatched = isMatched || pattern[0] == input[0]
+				}
+				pattern = pattern[1:]
+			}
+			if isMatched == isNot {
+				return false
+			}
+			input = input[1:]
+			if len(pattern) == 0 {
+				// 没有 ] 的话 [ 之后的内容都属于这一个字符
+				return len(input) == 0
+			}
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(input) == 0 || pattern[0] != input[0] {
+				return false
+			}
+			input = input[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(input) == 0
+}
+
+// PatternPrefix 返回 pattern 开头不含通配符的部分 能和 pattern 匹配的字符串一定以它开头
+func PatternPrefix(pattern string) string {
+	var prefix []byte
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[':
+			return string(prefix)
+		case '\\':
+			if i+1 < len(pattern) {
+				i += 1
+			}
+		}
+		prefix = append(prefix, pattern[i])
+	}
+	return string(prefix)
+}